@@ -5,26 +5,61 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/stolostron/search-indexer/pkg/clustersync"
 	"github.com/stolostron/search-indexer/pkg/config"
 	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/kafka"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stolostron/search-indexer/pkg/opensearch"
 	"github.com/stolostron/search-indexer/pkg/server"
+	"github.com/stolostron/search-indexer/pkg/tracing"
 	"k8s.io/klog/v2"
 )
 
+const usage = `Usage: search-indexer [command] [flags]
+
+Commands:
+  serve    Run the indexer. Default command.
+  migrate  Create or update the database tables, and exit.
+
+Flags:
+`
+
 func main() {
-	// Initialize the logger.
+	// Initialize the logger and the flags. The settings flags override the environment, see config/flags.go
 	klog.InitFlags(nil)
-	flag.Parse()
+	fs := pflag.NewFlagSet("search-indexer", pflag.ExitOnError)
+	fs.AddGoFlagSet(flag.CommandLine)
+	config.AddFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
 	defer klog.Flush()
-	klog.Info("Starting search-indexer.")
 
-	// Read the config from the environment.
+	command := fs.Arg(0)
+	if command == "" {
+		command = "serve"
+	}
+	if command != "serve" && command != "migrate" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", command)
+		fs.Usage()
+		os.Exit(2)
+	}
+	klog.Infof("Starting search-indexer %s.", command)
+
+	// Read the config from the flags, the config file, and the environment. See config/configFile.go
+	config.Cfg = config.LoadFlags(fs)
+	logging.Setup(config.Cfg.LogFormat)
 	config.Cfg.PrintConfig()
 
 	// Validate required configuration to proceed.
@@ -33,18 +68,74 @@ func main() {
 		klog.Fatal(configError)
 	}
 
+	if command == "migrate" {
+		migrate()
+		return
+	}
+
 	ctx, exitRoutines := context.WithCancel(context.Background())
 
-	// Initialize the database
-	dao := database.NewDAO(nil)
-	dao.InitializeTables(ctx)
+	// Reload the tunables from the mounted ConfigMap. See config/reload.go
+	if config.Cfg.ConfigReloadDir != "" {
+		go config.WatchReload(ctx)
+	}
+
+	// Export the traces of the sync requests. See tracing/tracing.go
+	go tracing.Run(ctx)
 
-	// Start cluster sync.
-	go clustersync.ElectLeaderAndStart(ctx)
+	// Watch the per-cluster overrides of the sync policy. See config/clusterOverrides.go
+	if config.Cfg.ClusterOverrides != "" && config.Cfg.RunsServer() {
+		go config.WatchClusterOverrides(ctx, config.Cfg.KubeClient)
+	}
+
+	// Initialize the storage backend.
+	var store database.Store
+	switch config.Cfg.StorageBackend {
+	case "opensearch":
+		store = initializeOpenSearch(ctx)
+	case "memory":
+		klog.Warning("Using the in-memory store. The data is lost on restart, use it only for development.")
+		store = memory.NewStore()
+	default:
+		store = initializePostgres(ctx)
+	}
 
-	// Start the server.
+	// Start cluster sync. With RUN_MODE=server, another deployment runs the cluster sync.
+	clustersync.SetStore(store)
+	clusterSyncDone := make(chan struct{})
+	if config.Cfg.RunsClusterSync() {
+		go func() {
+			clustersync.ElectLeaderAndStart(ctx)
+			close(clusterSyncDone)
+		}()
+	} else {
+		klog.Info("RUN_MODE is server. Not starting the cluster sync.")
+		close(clusterSyncDone)
+	}
+
+	// Start the server. With RUN_MODE=clustersync, only the probes, metrics, and debug endpoints are served.
+	producer, err := kafka.NewProducer()
+	if err != nil {
+		klog.Fatal(err)
+	}
 	srv := &server.ServerConfig{
-		Dao: &dao,
+		Dao:         store,
+		DisableSync: !config.Cfg.RunsServer(),
+	}
+	if outbox, ok := store.(database.OutboxStore); ok && producer != nil && config.Cfg.PublishesFromOutbox() {
+		// Publish the changes written to the outbox. See kafka/outbox.go
+		go producer.RunOutbox(ctx, outbox)
+	} else if producer != nil {
+		srv.Producer = producer
+		go srv.Producer.Run(ctx)
+	}
+	// Apply the sync events sent to Kafka. See kafka/consumer.go
+	consumer, err := kafka.NewConsumer(store, srv)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if consumer != nil && config.Cfg.RunsServer() {
+		go consumer.Run(ctx)
 	}
 	go srv.StartAndListen(ctx)
 
@@ -56,8 +147,54 @@ func main() {
 	klog.Warningf("Received termination signal %s. Exiting server and clustersync routines. ", sig)
 	exitRoutines()
 
-	// We could use a waitgroup to wait for leader election and server to shutdown
-	// but it add more complexity so keeping simple for now.
-	time.Sleep(5 * time.Second)
+	// Wait for clustersync to stop the watchers and release the leader lease, so another replica takes over without
+	// waiting for the lease to expire. The server shuts down within the same time.
+	select {
+	case <-clusterSyncDone:
+		klog.Info("Clustersync stopped and released the leader lease.")
+	case <-time.After(5 * time.Second):
+		klog.Warning("Timed out waiting for clustersync to stop.")
+	}
 	klog.Warning("Exiting search-indexer.")
 }
+
+// Creates or updates the database tables. Only the Postgres backend has a schema to migrate.
+func migrate() {
+	if config.Cfg.StorageBackend != "postgres" {
+		klog.Fatalf("The migrate command requires STORAGE_BACKEND=postgres. Found: %s", config.Cfg.StorageBackend)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	dao := database.NewDAO(nil)
+	if err := dao.InitializeTables(ctx); err != nil {
+		klog.Fatal(err)
+	}
+	klog.Info("The database tables are up to date.")
+}
+
+// Initializes the database and starts the background jobs.
+func initializePostgres(ctx context.Context) database.Store {
+	dao := database.NewDAO(nil)
+	if err := dao.InitializeTables(ctx); err != nil {
+		klog.Fatal(err)
+	}
+	if config.Cfg.PublishesFromOutbox() {
+		go dao.StartOutboxCleanup(ctx)
+	}
+	if config.Cfg.FullTextSearch {
+		go dao.StartSearchTextBackfill(ctx)
+	}
+	return &dao
+}
+
+// Initializes the OpenSearch indices.
+func initializeOpenSearch(ctx context.Context) database.Store {
+	store, err := opensearch.NewStore()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if err = store.InitializeIndices(ctx); err != nil {
+		klog.Error("Error initializing the OpenSearch indices. ", err)
+	}
+	return store
+}
@@ -0,0 +1,96 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Addon health.
+// Adds the status of the ManagedClusterAddOns in the cluster namespace to the Cluster node, so clusters can be
+// searched by addon health, e.g. the clusters where search-collector is Degraded.
+//   - addonStatus: map of addon name to Available, Degraded, Progressing, Unavailable, or Unknown.
+// The status is taken from the addon conditions. Degraded takes precedence over Available, because a degraded addon
+// is usually still available.
+
+// Addon status by addon name, for each cluster.
+var addonStatuses = map[string]map[string]string{}
+var addonMux sync.Mutex
+
+// Returns the status of the addon from its conditions.
+func addonStatus(addon *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(addon.Object, "status", "conditions")
+	status := map[string]interface{}{}
+	for _, c := range conditions {
+		if condition, ok := c.(map[string]interface{}); ok {
+			conditionType, _ := condition["type"].(string)
+			status[conditionType] = condition["status"]
+		}
+	}
+	switch {
+	case status["Degraded"] == "True":
+		return "Degraded"
+	case status["Available"] == "True":
+		return "Available"
+	case status["Progressing"] == "True":
+		return "Progressing"
+	case status["Available"] == "False":
+		return "Unavailable"
+	}
+	return "Unknown"
+}
+
+// Updates the status of the addon in the Cluster node.
+func updateAddonStatus(ctx context.Context, addon *unstructured.Unstructured) {
+	clusterName := addon.GetNamespace() // Namespace reflects the name of the cluster
+	status := addonStatus(addon)
+
+	addonMux.Lock()
+	if addonStatuses[clusterName] == nil {
+		addonStatuses[clusterName] = map[string]string{}
+	}
+	if current, ok := addonStatuses[clusterName][addon.GetName()]; ok && current == status {
+		addonMux.Unlock()
+		return
+	}
+	addonStatuses[clusterName][addon.GetName()] = status
+	props := addonStatusProperties(clusterName)
+	addonMux.Unlock()
+
+	dao.UpsertCluster(ctx, clusterNode(clusterName, props))
+}
+
+// Removes the addon from the Cluster node. Skipped after the ManagedCluster is deleted.
+func deleteAddonStatus(ctx context.Context, addon *unstructured.Unstructured) {
+	clusterName := addon.GetNamespace()
+
+	addonMux.Lock()
+	if _, ok := addonStatuses[clusterName][addon.GetName()]; !ok {
+		addonMux.Unlock()
+		return
+	}
+	delete(addonStatuses[clusterName], addon.GetName())
+	props := addonStatusProperties(clusterName)
+	addonMux.Unlock()
+
+	dao.UpsertCluster(ctx, clusterNode(clusterName, props))
+}
+
+// Forgets the addons of the cluster when the ManagedCluster is deleted.
+func forgetAddonStatus(clusterName string) {
+	addonMux.Lock()
+	defer addonMux.Unlock()
+	delete(addonStatuses, clusterName)
+}
+
+// Returns the addonStatus property of the cluster. The caller must hold addonMux.
+func addonStatusProperties(clusterName string) map[string]interface{} {
+	statuses := make(map[string]interface{}, len(addonStatuses[clusterName]))
+	for name, status := range addonStatuses[clusterName] {
+		statuses[name] = status
+	}
+	return map[string]interface{}{"addonStatus": statuses}
+}
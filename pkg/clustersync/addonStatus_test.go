@@ -0,0 +1,59 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newAddon(name string, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	addon := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "addon.open-cluster-management.io/v1alpha1",
+		"kind":       "ManagedClusterAddOn",
+		"metadata":   map[string]interface{}{"namespace": "name-foo", "name": name},
+	}}
+	statusConditions := []interface{}{}
+	for _, condition := range conditions {
+		statusConditions = append(statusConditions, condition)
+	}
+	_ = unstructured.SetNestedSlice(addon.Object, statusConditions, "status", "conditions")
+	return addon
+}
+
+func addonCondition(conditionType, status string) map[string]interface{} {
+	return map[string]interface{}{"type": conditionType, "status": status}
+}
+
+func Test_addonStatus(t *testing.T) {
+	assert.Equal(t, "Available", addonStatus(newAddon("work-manager", addonCondition("Available", "True"))))
+	assert.Equal(t, "Degraded", addonStatus(newAddon("work-manager", addonCondition("Available", "True"),
+		addonCondition("Degraded", "True"))))
+	assert.Equal(t, "Progressing", addonStatus(newAddon("work-manager", addonCondition("Progressing", "True"))))
+	assert.Equal(t, "Unavailable", addonStatus(newAddon("work-manager", addonCondition("Available", "False"))))
+	assert.Equal(t, "Unknown", addonStatus(newAddon("work-manager")))
+}
+
+// Should add the status of each addon to the Cluster node, and remove it when the addon is deleted.
+func Test_processAddonUpsert_addonStatus(t *testing.T) {
+	dao = memory.NewStore()
+	defer forgetAddonStatus("name-foo")
+
+	processAddonUpsert(context.Background(), newAddon("work-manager", addonCondition("Available", "True")))
+	processAddonUpsert(context.Background(), newAddon(searchCollectorAddon, addonCondition("Degraded", "True")))
+
+	addonMux.Lock()
+	assert.Equal(t, map[string]interface{}{"addonStatus": map[string]interface{}{
+		"work-manager": "Available", searchCollectorAddon: "Degraded"}}, addonStatusProperties("name-foo"))
+	addonMux.Unlock()
+
+	processClusterDelete(context.Background(), newAddon("work-manager"))
+	addonMux.Lock()
+	assert.Equal(t, map[string]interface{}{"addonStatus": map[string]interface{}{searchCollectorAddon: "Degraded"}},
+		addonStatusProperties("name-foo"))
+	addonMux.Unlock()
+}
@@ -0,0 +1,101 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	klog "k8s.io/klog/v2"
+)
+
+// Cluster delete.
+// When a ManagedCluster or the search-collector ManagedClusterAddOn is deleted, the data of the cluster is deleted
+// from the database. With CLUSTER_DELETE_GRACE_MS, the delete waits for the grace period and it's canceled if the
+// object is created again, so a cluster that's imported again or an addon that's re-installed keeps its data.
+// Deletes received for a cluster while another is pending are combined, the cluster node is deleted if any of them
+// was for the ManagedCluster. DeleteClusterAndResources is idempotent, a delete of a cluster without data is a no-op.
+
+type pendingDelete struct {
+	timer             *time.Timer
+	deleteClusterNode bool
+	kind              string
+}
+
+var pendingDeletes = map[string]*pendingDelete{}
+var pendingMux sync.Mutex
+
+// Deletes the data of the cluster after the grace period, or immediately if there isn't a grace period.
+func deleteCluster(ctx context.Context, clusterName string, deleteClusterNode bool, kind string) {
+	grace := time.Duration(config.Cfg.ClusterDeleteGrace) * time.Millisecond
+	if grace <= 0 {
+		runClusterDelete(ctx, clusterName, deleteClusterNode, kind)
+		return
+	}
+
+	pendingMux.Lock()
+	defer pendingMux.Unlock()
+	if pending, ok := pendingDeletes[clusterName]; ok {
+		if deleteClusterNode && !pending.deleteClusterNode {
+			pending.deleteClusterNode = true
+			pending.kind = kind
+		}
+		klog.V(3).Infof("Delete of cluster %s is already scheduled.", clusterName)
+		return
+	}
+	klog.Infof("%s for cluster %s was deleted. Deleting the cluster data in %s unless it's created again.",
+		kind, clusterName, grace)
+	pending := &pendingDelete{deleteClusterNode: deleteClusterNode, kind: kind}
+	pending.timer = time.AfterFunc(grace, func() {
+		pendingMux.Lock()
+		if pendingDeletes[clusterName] != pending {
+			pendingMux.Unlock()
+			return // Canceled.
+		}
+		delete(pendingDeletes, clusterName)
+		pendingMux.Unlock()
+		runClusterDelete(ctx, clusterName, pending.deleteClusterNode, pending.kind)
+	})
+	pendingDeletes[clusterName] = pending
+}
+
+// Cancels the pending delete of the cluster when the deleted object is created again.
+// A ManagedClusterAddOn only cancels the delete of the cluster resources, not the delete of the ManagedCluster.
+func cancelClusterDelete(clusterName string, kind string) {
+	pendingMux.Lock()
+	defer pendingMux.Unlock()
+	pending, ok := pendingDeletes[clusterName]
+	if !ok || (pending.deleteClusterNode && kind != "ManagedCluster") {
+		return
+	}
+	pending.timer.Stop()
+	delete(pendingDeletes, clusterName)
+	metrics.ClusterDeletes.WithLabelValues(pending.kind, "canceled").Inc()
+	klog.Infof("%s for cluster %s was created again. Canceled the delete of the cluster data.", kind, clusterName)
+}
+
+func runClusterDelete(ctx context.Context, clusterName string, deleteClusterNode bool, kind string) {
+	start := time.Now()
+	dao.DeleteClusterAndResources(ctx, clusterName, deleteClusterNode)
+	if deleteClusterNode {
+		// The cluster was removed, stop reporting when it last synced.
+		metrics.LastSyncTimestamp.DeleteLabelValues(clusterName)
+	}
+	metrics.ClusterDeletes.WithLabelValues(kind, "deleted").Inc()
+	klog.Infof("Deleted the data of cluster %s after %s was deleted. Deleted cluster node: %t. Took: %s",
+		clusterName, kind, deleteClusterNode, time.Since(start).Round(time.Millisecond))
+}
+
+// Cancels all the pending deletes when the leader lease is lost. The next leader finds the data of deleted
+// clusters at startup, see deleteStaleClusterResources().
+func cancelPendingDeletes() {
+	pendingMux.Lock()
+	defer pendingMux.Unlock()
+	for clusterName, pending := range pendingDeletes {
+		pending.timer.Stop()
+		delete(pendingDeletes, clusterName)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newMemoryStoreWithCluster(clusterName string) *memory.Store {
+	store := memory.NewStore()
+	store.UpsertCluster(context.Background(), model.Resource{
+		UID: "cluster__" + clusterName, Kind: "Cluster", Properties: map[string]interface{}{"name": clusterName}})
+	dao = store
+	return store
+}
+
+func managedClusters(t *testing.T, store *memory.Store) []string {
+	clusters, err := store.GetManagedClusters(context.Background())
+	assert.Nil(t, err)
+	return clusters
+}
+
+// Should delete the cluster after the grace period.
+func Test_deleteCluster_afterGracePeriod(t *testing.T) {
+	config.Cfg.ClusterDeleteGrace = 20
+	defer func() { config.Cfg.ClusterDeleteGrace = 0 }()
+	store := newMemoryStoreWithCluster("name-foo")
+
+	obj := newTestUnstructured(managedclusterinfogroupAPIVersion, "ManagedCluster", "", "name-foo", "test-mc-uid")
+	processClusterDelete(context.Background(), cache.DeletedFinalStateUnknown{Key: "name-foo", Obj: obj})
+
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+	assert.Eventually(t, func() bool { return len(managedClusters(t, store)) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+// Should stop reporting the last sync of the deleted cluster.
+func Test_deleteCluster_lastSyncTimestamp(t *testing.T) {
+	newMemoryStoreWithCluster("name-foo")
+	metrics.LastSyncTimestamp.WithLabelValues("name-foo").SetToCurrentTime()
+
+	obj := newTestUnstructured(managedclusterinfogroupAPIVersion, "ManagedCluster", "", "name-foo", "test-mc-uid")
+	processClusterDelete(context.Background(), obj)
+
+	assert.False(t, metrics.LastSyncTimestamp.DeleteLabelValues("name-foo"))
+}
+
+// Should cancel the delete when the ManagedCluster is created again within the grace period.
+func Test_deleteCluster_canceled(t *testing.T) {
+	config.Cfg.ClusterDeleteGrace = 20
+	defer func() { config.Cfg.ClusterDeleteGrace = 0 }()
+	store := newMemoryStoreWithCluster("name-foo")
+
+	deleteCluster(context.Background(), "name-foo", true, "ManagedCluster")
+	cancelClusterDelete("name-foo", "ManagedClusterAddOn") // Doesn't cancel the delete of the ManagedCluster.
+	pendingMux.Lock()
+	_, pending := pendingDeletes["name-foo"]
+	pendingMux.Unlock()
+	assert.True(t, pending)
+	cancelClusterDelete("name-foo", "ManagedCluster")
+	time.Sleep(40 * time.Millisecond)
+
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+	assert.Empty(t, pendingDeletes)
+}
+
+// Should delete the cluster resources, but keep the cluster node, when the search-collector addon is terminating.
+func Test_processAddonUpsert_terminating(t *testing.T) {
+	store := newMemoryStoreWithCluster("name-foo")
+	err := store.SyncData(context.Background(), model.SyncEvent{
+		AddResources: []model.Resource{{UID: "uid-1", Kind: "Pod", Properties: map[string]interface{}{"name": "a"}}},
+	}, "name-foo", &model.SyncResponse{})
+	assert.Nil(t, err)
+
+	obj := newTestUnstructured(managedclusteraddongroupAPIVersion, "ManagedClusterAddOn", "name-foo",
+		"search-collector", "test-mca-uid")
+	obj.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+	processClusterUpsert(context.Background(), obj)
+
+	resources, _, err := store.ClusterTotals(context.Background(), "name-foo")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, resources)
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+}
+
+// Should cancel the pending deletes when the leader lease is lost.
+func Test_cancelPendingDeletes(t *testing.T) {
+	config.Cfg.ClusterDeleteGrace = 20
+	defer func() { config.Cfg.ClusterDeleteGrace = 0 }()
+	store := newMemoryStoreWithCluster("name-foo")
+
+	deleteCluster(context.Background(), "name-foo", true, "ManagedCluster")
+	cancelPendingDeletes()
+	time.Sleep(40 * time.Millisecond)
+
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+	assert.Empty(t, pendingDeletes)
+}
@@ -0,0 +1,88 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	klog "k8s.io/klog/v2"
+)
+
+// Cluster events.
+// Indexing failures are reported as Warning events on the ManagedCluster, so cluster admins see them with
+// `oc describe managedcluster` instead of only in the indexer logs. When the ManagedCluster wasn't received yet,
+// the event is created on the indexer pod. The database operations are retried, so they're reported after a few
+// failed attempts, see database.OnClusterFailure. The event recorder aggregates repeated events.
+
+var eventRecorder record.EventRecorder
+var podRef *corev1.ObjectReference
+var clusterUIDs = map[string]types.UID{} // ManagedCluster UID by name, used to reference the ManagedCluster.
+var eventsMux sync.Mutex
+
+// Starts the event recorder. The recorder is stopped when the context is cancelled.
+func startEventRecorder(ctx context.Context, client kubernetes.Interface) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-ctx.Done()
+		broadcaster.Shutdown()
+	}()
+
+	ref := &corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: config.Cfg.PodNamespace,
+		Name: config.Cfg.PodName}
+	if pod, err := client.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err == nil {
+		ref.UID = pod.GetUID()
+	} else {
+		klog.V(2).Infof("Unable to get the indexer pod, the events won't be listed with the pod. %s", err)
+	}
+
+	eventsMux.Lock()
+	defer eventsMux.Unlock()
+	podRef = ref
+	eventRecorder = broadcaster.NewRecorder(scheme.Scheme,
+		corev1.EventSource{Component: "search-indexer", Host: config.Cfg.PodName})
+	database.OnClusterFailure = recordClusterFailure
+}
+
+// Keeps the UID of the ManagedCluster to create events on it.
+func rememberClusterUID(clusterName string, uid types.UID) {
+	eventsMux.Lock()
+	defer eventsMux.Unlock()
+	clusterUIDs[clusterName] = uid
+}
+
+func forgetClusterUID(clusterName string) {
+	eventsMux.Lock()
+	defer eventsMux.Unlock()
+	delete(clusterUIDs, clusterName)
+}
+
+// Creates a Warning event on the ManagedCluster, or on the indexer pod if the ManagedCluster isn't known.
+func recordClusterFailure(clusterName, reason, message string) {
+	eventsMux.Lock()
+	defer eventsMux.Unlock()
+	if eventRecorder == nil {
+		return // Not started, e.g. in tests.
+	}
+	if uid, ok := clusterUIDs[clusterName]; ok {
+		eventRecorder.Event(&corev1.ObjectReference{Kind: "ManagedCluster",
+			APIVersion: "cluster.open-cluster-management.io/v1", Name: clusterName, UID: uid},
+			corev1.EventTypeWarning, reason, message)
+		return
+	}
+	if podRef != nil {
+		eventRecorder.Event(podRef, corev1.EventTypeWarning, reason, fmt.Sprintf("Cluster %s: %s", clusterName,
+			message))
+	}
+}
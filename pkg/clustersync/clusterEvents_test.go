@@ -0,0 +1,52 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func useFakeRecorder() (*record.FakeRecorder, func()) {
+	recorder := record.NewFakeRecorder(10)
+	recorder.IncludeObject = true
+	eventsMux.Lock()
+	eventRecorder = recorder
+	podRef = &corev1.ObjectReference{Kind: "Pod", Namespace: "test-namespace", Name: "test-pod"}
+	eventsMux.Unlock()
+	return recorder, func() {
+		eventsMux.Lock()
+		eventRecorder = nil
+		podRef = nil
+		eventsMux.Unlock()
+	}
+}
+
+// Should create the event on the ManagedCluster.
+func Test_recordClusterFailure(t *testing.T) {
+	recorder, reset := useFakeRecorder()
+	defer reset()
+	rememberClusterUID("name-foo", "test-mc-uid")
+	defer forgetClusterUID("name-foo")
+
+	recordClusterFailure("name-foo", "ClusterWriteFailed", "Database is unavailable.")
+
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning ClusterWriteFailed Database is unavailable.")
+	assert.Contains(t, event, "kind=ManagedCluster")
+}
+
+// Should create the event on the indexer pod when the ManagedCluster isn't known.
+func Test_recordClusterFailure_unknownCluster(t *testing.T) {
+	recorder, reset := useFakeRecorder()
+	defer reset()
+
+	recordClusterFailure("name-bar", "ClusterDeleteFailed", "Database is unavailable.")
+
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning ClusterDeleteFailed Cluster name-bar: Database is unavailable.")
+	assert.Contains(t, event, "kind=Pod")
+}
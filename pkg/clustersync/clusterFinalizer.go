@@ -0,0 +1,86 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// Cluster finalizer.
+// With CLUSTER_FINALIZER, the indexer adds a finalizer to the selected ManagedClusters. The delete of the
+// ManagedCluster waits until the leader deletes the data of the cluster and removes the finalizer, so the data isn't
+// left in the database when the delete happens while the indexer is down. The next leader lists the ManagedCluster
+// with the deletion timestamp and completes the cleanup. The delete doesn't wait for CLUSTER_DELETE_GRACE_MS, a
+// ManagedCluster being deleted can't be created again.
+// When CLUSTER_FINALIZER is disabled, the finalizer is removed from the ManagedClusters, so they aren't blocked by an
+// indexer that no longer handles it.
+
+const clusterFinalizer = "search.open-cluster-management.io/cleanup"
+
+// Deletes the data of a ManagedCluster being deleted and removes the finalizer. Removes the finalizer when the
+// feature is disabled. Returns true if the ManagedCluster is being deleted, so its Cluster node isn't written again.
+func handleClusterFinalizer(ctx context.Context, managedCluster *clusterv1.ManagedCluster) bool {
+	hasFinalizer := hasClusterFinalizer(managedCluster)
+	clusterName := managedCluster.GetName()
+	if managedCluster.GetDeletionTimestamp() == nil {
+		if hasFinalizer && !config.Cfg.ClusterFinalizer {
+			klog.Infof("Removing the finalizer from ManagedCluster %s, CLUSTER_FINALIZER is disabled.", clusterName)
+			updateClusterFinalizer(ctx, managedCluster, false)
+		}
+		return false
+	}
+	if !hasFinalizer {
+		return true
+	}
+
+	klog.Infof("ManagedCluster %s is being deleted. Deleting the cluster data before removing the finalizer.",
+		clusterName)
+	cancelClusterDelete(clusterName, "ManagedCluster")
+	forgetCluster(clusterName)
+	runClusterDelete(ctx, clusterName, true, "ManagedCluster")
+	updateClusterFinalizer(ctx, managedCluster, false)
+	return true
+}
+
+// Adds the finalizer to the ManagedCluster if CLUSTER_FINALIZER is enabled.
+func addClusterFinalizer(ctx context.Context, managedCluster *clusterv1.ManagedCluster) {
+	if config.Cfg.ClusterFinalizer && !hasClusterFinalizer(managedCluster) {
+		updateClusterFinalizer(ctx, managedCluster, true)
+	}
+}
+
+func hasClusterFinalizer(managedCluster *clusterv1.ManagedCluster) bool {
+	for _, finalizer := range managedCluster.GetFinalizers() {
+		if finalizer == clusterFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds or removes the finalizer. A failed update is retried with the next event or resync of the ManagedCluster.
+func updateClusterFinalizer(ctx context.Context, managedCluster *clusterv1.ManagedCluster, add bool) {
+	if clusterClient == nil {
+		return
+	}
+	updated := managedCluster.DeepCopy() // Don't modify the object of the informer cache.
+	finalizers := []string{}
+	for _, finalizer := range updated.GetFinalizers() {
+		if finalizer != clusterFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if add {
+		finalizers = append(finalizers, clusterFinalizer)
+	}
+	updated.SetFinalizers(finalizers)
+	_, err := clusterClient.ClusterV1().ManagedClusters().Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		klog.Warningf("Error updating the finalizer of ManagedCluster %s. %s", managedCluster.GetName(), err)
+	}
+}
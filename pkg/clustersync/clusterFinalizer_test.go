@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterfake "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func getFinalizers(t *testing.T, name string) []string {
+	managedCluster, err := clusterClient.ClusterV1().ManagedClusters().Get(context.Background(), name,
+		metav1.GetOptions{})
+	assert.Nil(t, err)
+	return managedCluster.GetFinalizers()
+}
+
+// Should add the finalizer to the ManagedCluster when enabled.
+func Test_addClusterFinalizer(t *testing.T) {
+	config.Cfg.ClusterFinalizer = true
+	defer func() { config.Cfg.ClusterFinalizer = false }()
+	managedCluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "name-foo",
+		Finalizers: []string{"cluster.open-cluster-management.io/api-resource-cleanup"}}}
+	clusterClient = clusterfake.NewSimpleClientset(managedCluster)
+
+	addClusterFinalizer(context.Background(), managedCluster)
+
+	assert.Equal(t, []string{"cluster.open-cluster-management.io/api-resource-cleanup", clusterFinalizer},
+		getFinalizers(t, "name-foo"))
+	assert.Len(t, managedCluster.GetFinalizers(), 1, "Expected to keep the object of the informer cache.")
+}
+
+// Should delete the cluster data and remove the finalizer when the ManagedCluster is being deleted.
+func Test_handleClusterFinalizer_deleting(t *testing.T) {
+	config.Cfg.ClusterFinalizer = true
+	config.Cfg.ClusterDeleteGrace = 60 * 1000 // Not used by the finalizer.
+	defer func() {
+		config.Cfg.ClusterFinalizer = false
+		config.Cfg.ClusterDeleteGrace = 0
+	}()
+	store := newMemoryStoreWithCluster("name-foo")
+	now := metav1.Now()
+	managedCluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "name-foo",
+		DeletionTimestamp: &now, Finalizers: []string{clusterFinalizer}}}
+	clusterClient = clusterfake.NewSimpleClientset(managedCluster)
+
+	deleting := handleClusterFinalizer(context.Background(), managedCluster)
+
+	assert.True(t, deleting)
+	assert.Empty(t, managedClusters(t, store))
+	assert.Empty(t, getFinalizers(t, "name-foo"))
+}
+
+// Should remove the finalizer when disabled.
+func Test_handleClusterFinalizer_disabled(t *testing.T) {
+	store := newMemoryStoreWithCluster("name-foo")
+	managedCluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "name-foo",
+		Finalizers: []string{clusterFinalizer}}}
+	clusterClient = clusterfake.NewSimpleClientset(managedCluster)
+
+	deleting := handleClusterFinalizer(context.Background(), managedCluster)
+
+	assert.False(t, deleting)
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+	assert.Empty(t, getFinalizers(t, "name-foo"))
+}
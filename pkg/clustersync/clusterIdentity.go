@@ -0,0 +1,113 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/stolostron/search-indexer/pkg/database"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// Cluster identity.
+// A cluster can be detached and imported again, with a new ManagedCluster under the same name or under a different
+// name. If the delete of the old ManagedCluster wasn't observed, its data is left in the database. The Cluster node
+// keeps the ManagedCluster UID and the cluster ID claim (id.k8s.io), and they're compared with the stored Cluster
+// nodes once for each ManagedCluster UID:
+//   - Same name, different cluster ID: another cluster was imported with the name. The resources and edges of the
+//     old cluster are deleted and a resync is requested.
+//   - Same name, new ManagedCluster UID: the cluster was imported again. A resync is requested, which replaces the
+//     data left from the previous import.
+//   - Different name, same cluster ID: the cluster was imported again under a new name. The data of the old name is
+//     deleted if its ManagedCluster doesn't exist.
+// Only for Postgres, the other stores don't keep the Cluster nodes across restarts.
+
+const clusterIDClaim = "id.k8s.io"
+
+var checkedIdentities = map[string]types.UID{} // ManagedCluster UID checked for each cluster name.
+var identityMux sync.Mutex
+
+// Compares the ManagedCluster with the stored Cluster nodes and cleans up the data left from a previous import.
+// Called before writing the Cluster node of the ManagedCluster.
+func checkClusterIdentity(ctx context.Context, managedCluster *clusterv1.ManagedCluster) {
+	postgresDAO, ok := dao.(*database.DAO)
+	if !ok || managedCluster.GetUID() == "" {
+		return
+	}
+	clusterName := managedCluster.GetName()
+	uid := managedCluster.GetUID()
+	identityMux.Lock()
+	checked := checkedIdentities[clusterName] == uid
+	identityMux.Unlock()
+	if checked {
+		return
+	}
+
+	clusterID := clusterClaim(managedCluster, clusterIDClaim)
+	identities, err := postgresDAO.ClusterIdentities(ctx, clusterName, clusterID)
+	if err != nil {
+		return // Checked again on the next event.
+	}
+	for _, identity := range identities {
+		switch {
+		case identity.Name != clusterName:
+			deleteRenamedCluster(ctx, identity.Name, clusterName)
+		case clusterID != "" && identity.ClusterID != "" && identity.ClusterID != clusterID:
+			klog.Infof("Cluster %s was imported again with a different cluster ID [%s], previously [%s]. "+
+				"Deleting the resources of the previous cluster.", clusterName, clusterID, identity.ClusterID)
+			dao.DeleteClusterAndResources(ctx, clusterName, false)
+			requestClusterResync(ctx, clusterName)
+		case identity.ManagedClusterUID != "" && identity.ManagedClusterUID != string(uid):
+			klog.Infof("Cluster %s was imported again. Requesting a resync to replace the data of the previous "+
+				"import.", clusterName)
+			requestClusterResync(ctx, clusterName)
+		}
+	}
+
+	identityMux.Lock()
+	defer identityMux.Unlock()
+	checkedIdentities[clusterName] = uid
+}
+
+// Deletes the data of a cluster imported again under a new name, unless the ManagedCluster with the old name
+// still exists.
+func deleteRenamedCluster(ctx context.Context, oldName, clusterName string) {
+	if clusterClient == nil {
+		return
+	}
+	_, err := clusterClient.ClusterV1().ManagedClusters().Get(ctx, oldName, metav1.GetOptions{})
+	if err == nil {
+		klog.Warningf("Clusters %s and %s have the same cluster ID. Keeping the data of both clusters.", oldName,
+			clusterName)
+		return
+	}
+	if !apierrors.IsNotFound(err) {
+		klog.Warningf("Error getting ManagedCluster %s. %s", oldName, err)
+		return
+	}
+	klog.Infof("Cluster %s was imported again as %s. Deleting the data of %s.", oldName, clusterName, oldName)
+	forgetClusterIdentity(oldName)
+	deleteCluster(ctx, oldName, true, "ManagedCluster")
+}
+
+// Returns the value of the cluster claim, or "" if the ManagedCluster doesn't have the claim.
+func clusterClaim(managedCluster *clusterv1.ManagedCluster, name string) string {
+	for _, claim := range managedCluster.Status.ClusterClaims {
+		if claim.Name == name {
+			return claim.Value
+		}
+	}
+	return ""
+}
+
+// Checks the identity again when the ManagedCluster is created again.
+func forgetClusterIdentity(clusterName string) {
+	identityMux.Lock()
+	defer identityMux.Unlock()
+	delete(checkedIdentities, clusterName)
+}
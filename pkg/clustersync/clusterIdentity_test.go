@@ -0,0 +1,75 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const clusterIdentitiesSql = "SELECT name, coalesce(data->>'_managedClusterUID', ''), " +
+	"coalesce(data->'clusterClaim'->>'id.k8s.io', '') FROM clusters " +
+	"WHERE uid = $1 OR ($2 != '' AND data->'clusterClaim'->>'id.k8s.io' = $2)"
+
+func newManagedClusterWithID(name string, uid types.UID, clusterID string) *clusterv1.ManagedCluster {
+	return &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: uid},
+		Status: clusterv1.ManagedClusterStatus{
+			ClusterClaims: []clusterv1.ManagedClusterClaim{{Name: "id.k8s.io", Value: clusterID}},
+		},
+	}
+}
+
+// Returns the Postgres DAO with the identities of the stored Cluster nodes.
+func mockClusterIdentities(t *testing.T, identities ...database.ClusterIdentity) pgxmock.PgxPoolIface {
+	mockPool := testutils.NewMockPool(t)
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
+	rows := pgxmock.NewRows([]string{"name", "managed_cluster_uid", "cluster_id"})
+	for _, identity := range identities {
+		rows.AddRow(identity.Name, identity.ManagedClusterUID, identity.ClusterID)
+	}
+	mockPool.ExpectQuery(clusterIdentitiesSql).WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).WillReturnRows(rows)
+	return mockPool
+}
+
+// Should request a resync when the cluster is imported again, and check the identity once for each UID.
+func Test_checkClusterIdentity_importedAgain(t *testing.T) {
+	defer forgetClusterIdentity("name-foo")
+	mockPool := mockClusterIdentities(t,
+		database.ClusterIdentity{Name: "name-foo", ManagedClusterUID: "old-uid", ClusterID: "cluster-id-1"})
+	mockPool.ExpectExec("UPDATE cluster_sync SET resync_requested=true WHERE cluster=ANY($1)").
+		WithArgs([]string{"name-foo"}).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	managedCluster := newManagedClusterWithID("name-foo", "new-uid", "cluster-id-1")
+	checkClusterIdentity(context.Background(), managedCluster)
+	checkClusterIdentity(context.Background(), managedCluster) // Already checked.
+}
+
+// Should delete the data of the old name when the cluster is imported again under a new name.
+func Test_checkClusterIdentity_renamed(t *testing.T) {
+	config.Cfg.ClusterDeleteGrace = 60 * 1000
+	defer func() { config.Cfg.ClusterDeleteGrace = 0 }()
+	defer cancelPendingDeletes()
+	defer forgetClusterIdentity("name-bar")
+	clusterClient = fakeClusterClient()
+	mockClusterIdentities(t,
+		database.ClusterIdentity{Name: "name-old", ManagedClusterUID: "old-uid", ClusterID: "cluster-id-1"},
+		database.ClusterIdentity{Name: "name-foo", ManagedClusterUID: "foo-uid", ClusterID: "cluster-id-1"})
+
+	checkClusterIdentity(context.Background(), newManagedClusterWithID("name-bar", "new-uid", "cluster-id-1"))
+
+	pendingMux.Lock()
+	defer pendingMux.Unlock()
+	assert.Contains(t, pendingDeletes, "name-old")
+	assert.NotContains(t, pendingDeletes, "name-foo", "Expected to keep the cluster with an existing ManagedCluster.")
+}
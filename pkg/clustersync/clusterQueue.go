@@ -0,0 +1,183 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	klog "k8s.io/klog/v2"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// Cluster event queue.
+// The informer handlers add the events to a rate limited workqueue and return, so bursts of updates, e.g. the
+// ManagedClusterInfo status updates, don't block the informers. The queue keeps only the latest event of each object,
+// so repeated updates waiting in the queue are processed once. CLUSTER_EVENT_WORKERS process the events, the
+// workqueue never gives the same object to two workers, and the events of the same cluster are serialized with
+// lockCluster().
+
+const clusterEventBurst = 100
+
+// Latest event of an object waiting in the queue.
+type clusterEvent struct {
+	deleted interface{} // Processed first, when the object was deleted and created again.
+	upsert  interface{}
+}
+
+type clusterEventQueue struct {
+	queue         workqueue.RateLimitingInterface
+	events        map[string]*clusterEvent // Events waiting in the queue, by object key.
+	processing    int                      // Events being processed by the workers.
+	mux           sync.Mutex
+	processUpsert func(ctx context.Context, obj interface{})
+	processDelete func(ctx context.Context, obj interface{})
+}
+
+func newClusterEventQueue(processUpsert, processDelete func(ctx context.Context, obj interface{})) *clusterEventQueue {
+	limiter := &workqueue.BucketRateLimiter{
+		Limiter: rate.NewLimiter(rate.Limit(config.Cfg.ClusterEventQPS), clusterEventBurst)}
+	return &clusterEventQueue{
+		queue:         workqueue.NewNamedRateLimitingQueue(limiter, "cluster-events"),
+		events:        map[string]*clusterEvent{},
+		processUpsert: processUpsert,
+		processDelete: processDelete,
+	}
+}
+
+// Returns the queue key of the object, kind/namespace/name.
+func clusterEventKey(obj interface{}) (string, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, err := meta.Accessor(obj)
+	if err != nil || objectKind(obj) == "" {
+		return "", false
+	}
+	return objectKind(obj) + "/" + object.GetNamespace() + "/" + object.GetName(), true
+}
+
+// Returns the kind of the informer object. The objects from the typed informers don't have the kind set.
+func objectKind(obj interface{}) string {
+	switch obj := obj.(type) {
+	case *clusterv1.ManagedCluster:
+		return "ManagedCluster"
+	case *unstructured.Unstructured:
+		return obj.GetKind()
+	case cache.DeletedFinalStateUnknown:
+		return objectKind(obj.Obj)
+	}
+	return ""
+}
+
+// Adds the event to the queue, or replaces the event of the object waiting in the queue.
+func (q *clusterEventQueue) add(obj interface{}, deleted bool) {
+	key, ok := clusterEventKey(obj)
+	if !ok {
+		klog.Warningf("Unable to queue cluster event for object type %T", obj)
+		return
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	event, queued := q.events[key]
+	if !queued {
+		event = &clusterEvent{}
+		q.events[key] = event
+	}
+	if deleted {
+		event.deleted = obj
+		event.upsert = nil
+	} else {
+		event.upsert = obj
+	}
+	if !queued {
+		q.queue.AddRateLimited(key)
+	}
+}
+
+// Processes the events until the context is cancelled. Returns after the workers finish the current events.
+func (q *clusterEventQueue) run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q.processNext(ctx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	q.queue.ShutDown() // The events left in the queue are dropped, the next leader lists the objects again.
+	wg.Wait()
+}
+
+func (q *clusterEventQueue) processNext(ctx context.Context) bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+	key := item.(string)
+
+	q.mux.Lock()
+	event := q.events[key]
+	delete(q.events, key)
+	q.processing++
+	q.mux.Unlock()
+	defer func() {
+		q.mux.Lock()
+		q.processing--
+		q.mux.Unlock()
+	}()
+
+	if event != nil && event.deleted != nil {
+		q.processDelete(ctx, event.deleted)
+	}
+	if event != nil && event.upsert != nil {
+		q.processUpsert(ctx, event.upsert)
+	}
+	q.queue.Forget(item)
+	return true
+}
+
+// Returns true when there are no events waiting in the queue or being processed.
+func (q *clusterEventQueue) idle() bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.events) == 0 && q.processing == 0
+}
+
+var clusterMuxes [16]sync.Mutex
+
+// Locks the cluster of the object. ManagedCluster, ManagedClusterInfo, and ManagedClusterAddOn only write the
+// Cluster node of their cluster, so the events of different clusters run in parallel. The other kinds can write
+// several Cluster nodes and lock all clusters. Returns the unlock function.
+func lockCluster(kind string, obj metav1.Object) func() {
+	var clusterName string
+	switch kind {
+	case "ManagedCluster":
+		clusterName = obj.GetName()
+	case "ManagedClusterInfo", "ManagedClusterAddOn":
+		clusterName = obj.GetNamespace() // Namespace reflects the name of the cluster
+	default:
+		mux.Lock()
+		return mux.Unlock
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(clusterName))
+	clusterMux := &clusterMuxes[hash.Sum32()%uint32(len(clusterMuxes))]
+	mux.RLock()
+	clusterMux.Lock()
+	return func() {
+		clusterMux.Unlock()
+		mux.RUnlock()
+	}
+}
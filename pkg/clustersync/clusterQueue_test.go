@@ -0,0 +1,132 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func newQueueObject(kind, namespace, name, version string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     kind,
+		"metadata": map[string]interface{}{"namespace": namespace, "name": name, "resourceVersion": version},
+	}}
+}
+
+// Returns a queue recording the processed events as "upsert|delete kind/name resourceVersion".
+func newRecordingQueue() (*clusterEventQueue, func() []string) {
+	var processed []string
+	var processedMux sync.Mutex
+	record := func(action string) func(ctx context.Context, obj interface{}) {
+		return func(ctx context.Context, obj interface{}) {
+			u := obj.(*unstructured.Unstructured)
+			processedMux.Lock()
+			defer processedMux.Unlock()
+			processed = append(processed, action+" "+u.GetKind()+"/"+u.GetName()+" "+u.GetResourceVersion())
+		}
+	}
+	return newClusterEventQueue(record("upsert"), record("delete")), func() []string {
+		processedMux.Lock()
+		defer processedMux.Unlock()
+		return append([]string{}, processed...)
+	}
+}
+
+// Should process only the latest event of an object waiting in the queue.
+func Test_clusterEventQueue_deduplicate(t *testing.T) {
+	events, processed := newRecordingQueue()
+	events.add(newQueueObject("ManagedClusterInfo", "name-foo", "name-foo", "1"), false)
+	events.add(newQueueObject("ManagedClusterInfo", "name-foo", "name-foo", "2"), false)
+	events.add(newQueueObject("ManagedClusterInfo", "name-foo", "name-foo", "3"), false)
+	events.add(newQueueObject("ManagedCluster", "", "name-foo", "1"), false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go events.run(ctx, 2)
+
+	assert.Eventually(t, func() bool { return len(processed()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.ElementsMatch(t, []string{"upsert ManagedClusterInfo/name-foo 3", "upsert ManagedCluster/name-foo 1"},
+		processed())
+}
+
+// Should process the delete before the upsert when the object is deleted and created again.
+func Test_clusterEventQueue_deleteAndCreate(t *testing.T) {
+	events, processed := newRecordingQueue()
+	events.add(newQueueObject("ManagedCluster", "", "name-foo", "1"), false)
+	events.add(newQueueObject("ManagedCluster", "", "name-foo", "1"), true)
+	events.add(newQueueObject("ManagedCluster", "", "name-foo", "2"), false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go events.run(ctx, 1)
+
+	assert.Eventually(t, func() bool { return len(processed()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"delete ManagedCluster/name-foo 1", "upsert ManagedCluster/name-foo 2"}, processed())
+}
+
+// Should stop the workers when the context is cancelled.
+func Test_clusterEventQueue_stop(t *testing.T) {
+	events, _ := newRecordingQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		events.run(ctx, 2)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the queue workers to stop.")
+	}
+}
+
+// Should process different clusters in parallel and lock all clusters for the other kinds.
+func Test_lockCluster(t *testing.T) {
+	unlock := lockCluster("ManagedCluster", newQueueObject("ManagedCluster", "", "name-foo", "1"))
+
+	locked := make(chan struct{})
+	go func() {
+		defer close(locked)
+		addon := newQueueObject("ManagedClusterAddOn", "name-bar", "search-collector", "1")
+		lockCluster("ManagedClusterAddOn", addon)()
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected to lock a different cluster.")
+	}
+
+	locked = make(chan struct{})
+	go func() {
+		defer close(locked)
+		lockCluster("ManagedClusterSet", newQueueObject("ManagedClusterSet", "", "set-foo", "1"))()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Expected ManagedClusterSet to wait for the cluster lock.")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+}
+
+// Should use the kind of the typed objects, which don't have the kind set.
+func Test_clusterEventKey_typed(t *testing.T) {
+	managedCluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "name-foo"}}
+
+	key, ok := clusterEventKey(cache.DeletedFinalStateUnknown{Key: "name-foo", Obj: managedCluster})
+
+	assert.True(t, ok)
+	assert.Equal(t, "ManagedCluster//name-foo", key)
+}
@@ -0,0 +1,81 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	klog "k8s.io/klog/v2"
+)
+
+// Cluster label selector.
+// With CLUSTER_LABEL_SELECTOR, only the ManagedClusters matching the selector are indexed, for example
+// vendor=OpenShift or !quarantine. When a cluster stops matching, its Cluster node, resources, and edges are
+// deleted, and the other hub resources of the cluster don't write the Cluster node until it matches again.
+// The collector of an excluded cluster keeps sending its resources, so disable the search-collector addon in the
+// clusters that shouldn't be indexed.
+
+var clusterSelector = labels.Everything()
+var excludedClusters = map[string]bool{}
+var selectorMux sync.Mutex
+
+// Reads the selector from the config. Called when the cluster watch starts.
+func initClusterSelector() {
+	selector, err := labels.Parse(config.Cfg.ClusterSelector)
+	if err != nil {
+		klog.Errorf("Invalid CLUSTER_LABEL_SELECTOR [%s], indexing all clusters. %s", config.Cfg.ClusterSelector, err)
+		selector = labels.Everything()
+	}
+	selectorMux.Lock()
+	defer selectorMux.Unlock()
+	clusterSelector = selector
+	excludedClusters = map[string]bool{}
+}
+
+// Returns true if the ManagedCluster matches the selector. Deletes the data of the cluster when it stops matching.
+func clusterSelected(ctx context.Context, managedCluster metav1.Object) bool {
+	clusterName := managedCluster.GetName()
+	selectorMux.Lock()
+	selected := clusterSelector.Matches(labels.Set(managedCluster.GetLabels()))
+	wasExcluded := excludedClusters[clusterName]
+	if selected {
+		delete(excludedClusters, clusterName)
+	} else {
+		excludedClusters[clusterName] = true
+	}
+	selectorMux.Unlock()
+
+	if !selected && !wasExcluded {
+		klog.Infof("Cluster %s doesn't match CLUSTER_LABEL_SELECTOR. Deleting the cluster data.", clusterName)
+		stopOfflineTracking(clusterName)
+		dao.DeleteClusterAndResources(ctx, clusterName, true)
+		metrics.LastSyncTimestamp.DeleteLabelValues(clusterName)
+	}
+	return selected
+}
+
+// Returns true if the ManagedCluster doesn't match the selector.
+func clusterExcluded(clusterName string) bool {
+	selectorMux.Lock()
+	defer selectorMux.Unlock()
+	return excludedClusters[clusterName]
+}
+
+// Removes the ManagedCluster from the excluded clusters when it's deleted.
+func forgetExcludedCluster(clusterName string) {
+	selectorMux.Lock()
+	defer selectorMux.Unlock()
+	delete(excludedClusters, clusterName)
+}
+
+// Returns true if the labels match the selector. Used to find the data of excluded clusters at startup.
+func clusterLabelsSelected(clusterLabels map[string]string) bool {
+	selectorMux.Lock()
+	defer selectorMux.Unlock()
+	return clusterSelector.Matches(labels.Set(clusterLabels))
+}
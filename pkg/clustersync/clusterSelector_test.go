@@ -0,0 +1,72 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newLabeledManagedCluster(clusterLabels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.open-cluster-management.io/v1",
+		"kind":       "ManagedCluster",
+		"metadata":   map[string]interface{}{"name": "name-foo", "labels": clusterLabels},
+	}}
+}
+
+// Should delete the cluster data when the ManagedCluster stops matching the selector.
+func Test_clusterSelected(t *testing.T) {
+	config.Cfg.ClusterSelector = "vendor=OpenShift,!quarantine"
+	initClusterSelector()
+	defer func() {
+		config.Cfg.ClusterSelector = ""
+		initClusterSelector()
+	}()
+	store := newMemoryStoreWithCluster("name-foo")
+
+	assert.True(t, clusterSelected(context.Background(), newLabeledManagedCluster(map[string]interface{}{
+		"vendor": "OpenShift"})))
+	assert.False(t, clusterExcluded("name-foo"))
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+
+	assert.False(t, clusterSelected(context.Background(), newLabeledManagedCluster(map[string]interface{}{
+		"vendor": "OpenShift", "quarantine": "true"})))
+	assert.True(t, clusterExcluded("name-foo"))
+	assert.Empty(t, managedClusters(t, store))
+}
+
+// Should skip the Cluster node from the other hub resources of an excluded cluster.
+func Test_processClusterUpsert_excludedCluster(t *testing.T) {
+	config.Cfg.ClusterSelector = "vendor=OpenShift"
+	initClusterSelector()
+	defer func() {
+		config.Cfg.ClusterSelector = ""
+		initClusterSelector()
+	}()
+	store := newMemoryStoreWithCluster("name-foo")
+	processClusterUpsert(context.Background(), newLabeledManagedCluster(map[string]interface{}{"vendor": "EKS"}))
+	assert.Empty(t, managedClusters(t, store))
+
+	hostedCluster := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": hypershiftGroupVersion,
+		"kind":       "HostedCluster",
+		"metadata":   map[string]interface{}{"namespace": "clusters", "name": "name-foo"},
+	}}
+	processClusterUpsert(context.Background(), hostedCluster)
+
+	assert.Empty(t, managedClusters(t, store))
+}
+
+// Should index all clusters without a selector.
+func Test_clusterSelected_noSelector(t *testing.T) {
+	initClusterSelector()
+	newMemoryStoreWithCluster("name-foo")
+
+	assert.True(t, clusterSelected(context.Background(), newLabeledManagedCluster(map[string]interface{}{})))
+	assert.True(t, clusterLabelsSelected(map[string]string{"vendor": "EKS"}))
+}
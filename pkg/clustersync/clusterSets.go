@@ -0,0 +1,208 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	klog "k8s.io/klog/v2"
+	clusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+)
+
+// ManagedClusterSets.
+// Adds the ManagedClusterSets selecting the cluster to the Cluster node, so clusters can be searched and scoped by
+// cluster set.
+//   - clusterSet: names of the ManagedClusterSets selecting the cluster.
+//   - clusterSetNamespaces: namespaces where those sets are bound with a ManagedClusterSetBinding.
+// Also writes an edge from each ManagedClusterSet on the hub to the Cluster node. The edges are interCluster edges
+// written with the name of the managed cluster, so they're deleted with the cluster data and the resync of the
+// cluster keeps them. The properties are only set after the ManagedClusterSets are received from the hub.
+
+const hubClusterName = "local-cluster"
+
+type managedClusterSet struct {
+	uid      string
+	selector labels.Selector
+}
+
+var clusterSets = map[string]managedClusterSet{}
+var clusterSetBindings = map[string]string{}         // ManagedClusterSet name by binding namespace/name.
+var managedClusterLabels = map[string]labels.Set{}   // ManagedCluster labels by cluster name.
+var clusterSetEdges = map[string]map[string]string{} // Edges written for the cluster, set UID by set name.
+var clusterSetMux sync.Mutex
+
+func init() {
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "ManagedClusterSet",
+		GVR:          "managedclustersets.v1beta2.cluster.open-cluster-management.io",
+		GroupVersion: "cluster.open-cluster-management.io/v1beta2",
+		Transform:    transformManagedClusterSet,
+		Delete:       deleteManagedClusterSet,
+	})
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "ManagedClusterSetBinding",
+		GVR:          "managedclustersetbindings.v1beta2.cluster.open-cluster-management.io",
+		GroupVersion: "cluster.open-cluster-management.io/v1beta2",
+		Transform:    transformManagedClusterSetBinding,
+		Delete:       deleteManagedClusterSetBinding,
+	})
+}
+
+// Records the ManagedClusterSet and updates the clusters selected by it.
+// Returns an empty resource because the set doesn't have its own Cluster node.
+func transformManagedClusterSet(obj *unstructured.Unstructured) (model.Resource, error) {
+	clusterSet := clusterv1beta2.ManagedClusterSet{}
+	if err := fromUnstructured(obj, &clusterSet); err != nil {
+		return model.Resource{}, err
+	}
+	selector, err := clusterv1beta2.BuildClusterSelector(&clusterSet)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	clusterSetMux.Lock()
+	clusterSets[clusterSet.GetName()] = managedClusterSet{uid: string(clusterSet.GetUID()), selector: selector}
+	clusterSetMux.Unlock()
+	refreshClusterSets()
+	return model.Resource{}, nil
+}
+
+func deleteManagedClusterSet(obj *unstructured.Unstructured) (model.Resource, error) {
+	clusterSetMux.Lock()
+	delete(clusterSets, obj.GetName())
+	clusterSetMux.Unlock()
+	refreshClusterSets()
+	return model.Resource{}, nil
+}
+
+func transformManagedClusterSetBinding(obj *unstructured.Unstructured) (model.Resource, error) {
+	clusterSet, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterSet")
+	clusterSetMux.Lock()
+	clusterSetBindings[obj.GetNamespace()+"/"+obj.GetName()] = clusterSet
+	clusterSetMux.Unlock()
+	refreshClusterSets()
+	return model.Resource{}, nil
+}
+
+func deleteManagedClusterSetBinding(obj *unstructured.Unstructured) (model.Resource, error) {
+	clusterSetMux.Lock()
+	delete(clusterSetBindings, obj.GetNamespace()+"/"+obj.GetName())
+	clusterSetMux.Unlock()
+	refreshClusterSets()
+	return model.Resource{}, nil
+}
+
+// Returns the cluster set properties of the ManagedCluster, and updates the edges from the sets to the cluster.
+func clusterSetProperties(clusterName string, clusterLabels map[string]string) map[string]interface{} {
+	clusterSetMux.Lock()
+	defer clusterSetMux.Unlock()
+	managedClusterLabels[clusterName] = labels.Set(clusterLabels)
+	return updateClusterSets(clusterName)
+}
+
+// Forgets the cluster when the ManagedCluster is deleted. The edges are deleted with the cluster data.
+func forgetClusterSets(clusterName string) {
+	clusterSetMux.Lock()
+	defer clusterSetMux.Unlock()
+	delete(managedClusterLabels, clusterName)
+	delete(clusterSetEdges, clusterName)
+}
+
+// Updates the Cluster nodes and edges after a ManagedClusterSet or ManagedClusterSetBinding changes.
+func refreshClusterSets() {
+	clusterSetMux.Lock()
+	defer clusterSetMux.Unlock()
+	for clusterName := range managedClusterLabels {
+		props := updateClusterSets(clusterName)
+		if props == nil || clusterExcluded(clusterName) {
+			continue
+		}
+		dao.UpsertCluster(context.Background(), clusterNode(clusterName, props))
+	}
+}
+
+// Returns the cluster set properties, or nil before the sets are received. The caller must hold clusterSetMux.
+func updateClusterSets(clusterName string) map[string]interface{} {
+	if len(clusterSets) == 0 && len(clusterSetEdges[clusterName]) == 0 {
+		return nil
+	}
+	selected := map[string]string{}
+	setNames := []string{}
+	for name, set := range clusterSets {
+		if set.selector.Matches(managedClusterLabels[clusterName]) {
+			selected[name] = set.uid
+			setNames = append(setNames, name)
+		}
+	}
+	sort.Strings(setNames)
+
+	boundNamespaces := map[string]bool{}
+	for binding, setName := range clusterSetBindings {
+		if _, ok := selected[setName]; ok {
+			boundNamespaces[strings.SplitN(binding, "/", 2)[0]] = true
+		}
+	}
+	namespaces := make([]string, 0, len(boundNamespaces))
+	for namespace := range boundNamespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	syncClusterSetEdges(clusterName, selected)
+	return map[string]interface{}{
+		"clusterSet":           setNames,
+		"clusterSetNamespaces": namespaces,
+	}
+}
+
+// Adds the edges from the sets selecting the cluster and deletes the edges from the sets that no longer select it.
+// The first time, deletes the edges from all the other sets, in case the cluster changed sets while the indexer
+// wasn't running. The caller must hold clusterSetMux.
+func syncClusterSetEdges(clusterName string, selected map[string]string) {
+	previous, known := clusterSetEdges[clusterName]
+	stale := map[string]string{}
+	for name, uid := range previous {
+		stale[name] = uid
+	}
+	if !known {
+		for name, set := range clusterSets {
+			stale[name] = set.uid
+		}
+	}
+
+	event := model.SyncEvent{}
+	for name, uid := range selected {
+		if previous[name] != uid {
+			event.AddEdges = append(event.AddEdges, clusterSetEdge(clusterName, uid))
+		}
+		if stale[name] == uid {
+			delete(stale, name)
+		}
+	}
+	for _, uid := range stale {
+		event.DeleteEdges = append(event.DeleteEdges, clusterSetEdge(clusterName, uid))
+	}
+	clusterSetEdges[clusterName] = selected
+	if len(event.AddEdges) == 0 && len(event.DeleteEdges) == 0 {
+		return
+	}
+	if err := dao.SyncData(context.Background(), event, clusterName, &model.SyncResponse{}); err != nil {
+		klog.Warningf("Error updating the ManagedClusterSet edges of cluster %s. %s", clusterName, err)
+	}
+}
+
+func clusterSetEdge(clusterName, setUID string) model.Edge {
+	return model.Edge{
+		SourceUID:  hubClusterName + "/" + setUID,
+		SourceKind: "ManagedClusterSet",
+		DestUID:    "cluster__" + clusterName,
+		DestKind:   "Cluster",
+		EdgeType:   "interCluster",
+		Properties: map[string]interface{}{"relationship": "clusterSet"},
+	}
+}
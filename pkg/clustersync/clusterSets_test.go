@@ -0,0 +1,129 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func resetClusterSets() {
+	clusterSetMux.Lock()
+	defer clusterSetMux.Unlock()
+	clusterSets = map[string]managedClusterSet{}
+	clusterSetBindings = map[string]string{}
+	managedClusterLabels = map[string]labels.Set{}
+	clusterSetEdges = map[string]map[string]string{}
+}
+
+func newClusterSet(name, uid string, selector map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.open-cluster-management.io/v1beta2",
+		"kind":       "ManagedClusterSet",
+		"metadata":   map[string]interface{}{"name": name, "uid": uid},
+		"spec":       map[string]interface{}{"clusterSelector": selector},
+	}}
+}
+
+func newClusterSetBinding(namespace, clusterSet string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.open-cluster-management.io/v1beta2",
+		"kind":       "ManagedClusterSetBinding",
+		"metadata":   map[string]interface{}{"namespace": namespace, "name": clusterSet},
+		"spec":       map[string]interface{}{"clusterSet": clusterSet},
+	}}
+}
+
+func clusterEdges(t *testing.T, store *memory.Store, clusterName string) int {
+	_, edges, err := store.ClusterTotals(context.Background(), clusterName)
+	assert.Nil(t, err)
+	return edges
+}
+
+// Should not add the cluster set properties before the ManagedClusterSets are received.
+func Test_clusterSetProperties_noClusterSets(t *testing.T) {
+	resetClusterSets()
+	dao = memory.NewStore()
+
+	props := clusterSetProperties("cluster-a", map[string]string{"env": "dev"})
+	assert.Nil(t, props)
+}
+
+// Should add the sets selecting the cluster, the namespaces where they're bound, and the edges to the cluster.
+func Test_clusterSetProperties(t *testing.T) {
+	resetClusterSets()
+	defer resetClusterSets()
+	store := memory.NewStore()
+	dao = store
+
+	exclusive := newClusterSet("set-a", "set-a-uid", map[string]interface{}{"selectorType": "ExclusiveClusterSetLabel"})
+	dev := newClusterSet("set-dev", "set-dev-uid", map[string]interface{}{
+		"selectorType":  "LabelSelector",
+		"labelSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"env": "dev"}},
+	})
+	for _, obj := range []*unstructured.Unstructured{exclusive, dev} {
+		_, err := transformManagedClusterSet(obj)
+		assert.Nil(t, err)
+	}
+	_, err := transformManagedClusterSetBinding(newClusterSetBinding("app-ns", "set-dev"))
+	assert.Nil(t, err)
+
+	props := clusterSetProperties("cluster-a", map[string]string{
+		"env": "dev", "cluster.open-cluster-management.io/clusterset": "set-a"})
+	assert.Equal(t, []string{"set-a", "set-dev"}, props["clusterSet"])
+	assert.Equal(t, []string{"app-ns"}, props["clusterSetNamespaces"])
+	assert.Equal(t, 2, clusterEdges(t, store, "cluster-a"))
+
+	// The cluster leaves set-dev.
+	props = clusterSetProperties("cluster-a", map[string]string{"cluster.open-cluster-management.io/clusterset": "set-a"})
+	assert.Equal(t, []string{"set-a"}, props["clusterSet"])
+	assert.Equal(t, []string{}, props["clusterSetNamespaces"])
+	assert.Equal(t, 1, clusterEdges(t, store, "cluster-a"))
+}
+
+// Should update the Cluster node and edges when a ManagedClusterSet is deleted.
+func Test_deleteManagedClusterSet(t *testing.T) {
+	resetClusterSets()
+	defer resetClusterSets()
+	store := memory.NewStore()
+	dao = store
+
+	set := newClusterSet("set-a", "set-a-uid", map[string]interface{}{"selectorType": "ExclusiveClusterSetLabel"})
+	_, err := transformManagedClusterSet(set)
+	assert.Nil(t, err)
+	resource := transformManagedCluster(&clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{
+		Name: "cluster-a", Labels: map[string]string{"cluster.open-cluster-management.io/clusterset": "set-a"}}})
+	assert.Equal(t, []string{"set-a"}, resource.Properties["clusterSet"])
+	assert.Equal(t, 1, clusterEdges(t, store, "cluster-a"))
+
+	resource, err = deleteManagedClusterSet(set)
+	assert.Nil(t, err)
+	assert.Equal(t, "", resource.UID) // The set doesn't have its own Cluster node.
+	assert.Equal(t, 0, clusterEdges(t, store, "cluster-a"))
+
+	clusters, err := store.GetManagedClusters(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cluster-a"}, clusters)
+}
+
+// Should write the edge from the ManagedClusterSet on the hub to the Cluster node.
+func Test_clusterSetEdge(t *testing.T) {
+	edge := clusterSetEdge("cluster-a", "set-a-uid")
+
+	assert.Equal(t, model.Edge{
+		SourceUID:  "local-cluster/set-a-uid",
+		SourceKind: "ManagedClusterSet",
+		DestUID:    "cluster__cluster-a",
+		DestKind:   "Cluster",
+		EdgeType:   "interCluster",
+		Properties: map[string]interface{}{"relationship": "clusterSet"},
+	}, edge)
+}
@@ -5,6 +5,7 @@ package clustersync
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -12,7 +13,9 @@ import (
 	clusterv1beta1 "github.com/stolostron/multicloud-operators-foundation/pkg/apis/internal.open-cluster-management.io/v1beta1"
 	"github.com/stolostron/search-indexer/pkg/config"
 	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -21,19 +24,22 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	klog "k8s.io/klog/v2"
+	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterinformers "open-cluster-management.io/api/client/cluster/informers/externalversions"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 )
 
 var dynamicClient dynamic.Interface
-var dao database.DAO
+var clusterClient clusterclientset.Interface
+var dao database.Store
 var client *kubernetes.Clientset
-var mux sync.Mutex
+var mux sync.RWMutex
 
 const managedClusterGVR = "managedclusters.v1.cluster.open-cluster-management.io"
 const managedClusterInfoGVR = "managedclusterinfos.v1beta1.internal.open-cluster-management.io"
 const managedClusterAddonGVR = "managedclusteraddons.v1alpha1.addon.open-cluster-management.io"
-const lockName = "search-indexer.open-cluster-management.io"
 const managedClusterInfoApiGrp = "internal.open-cluster-management.io"
+const searchCollectorAddon = "search-collector"
 
 var allAddons = [9]string{
 	"application-manager",
@@ -47,83 +53,163 @@ var allAddons = [9]string{
 	"work-manager",
 }
 
+// Sets the storage backend used to write the Cluster nodes. Must be called before ElectLeaderAndStart,
+// otherwise we use the Postgres DAO.
+func SetStore(store database.Store) {
+	dao = store
+}
+
 func ElectLeaderAndStart(ctx context.Context) {
 	client = config.Cfg.KubeClient
 	podName := config.Cfg.PodName
 	podNamespace := config.Cfg.PodNamespace
 	dynamicClient = config.GetDynamicClient()
-	if (database.DAO{} == dao) {
-		dao = database.NewDAO(nil)
+	clusterClient = config.GetClusterClient()
+	if dao == nil {
+		postgresDAO := database.NewDAO(nil)
+		dao = &postgresDAO
 	}
-	lock := getNewLock(client, lockName, podName, podNamespace)
+	startEventRecorder(ctx, client) // See clusterEvents.go
+	lock := getNewLock(client, config.Cfg.LeaderLockName, podName, podNamespace)
 	runLeaderElection(ctx, lock, syncClusters)
 }
 
 // Watches ManagedCluster objects and updates the database with a Cluster node.
+// Runs while this replica holds the leader lease, and returns after the watch stops when the context is cancelled.
 func syncClusters(ctx context.Context) {
 	klog.Info("Attempting to sync clusters. Begin ClusterWatch routine")
+	initialSyncPending.Store(true) // See readiness.go
+	defer initialSyncPending.Store(false)
 
-	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient,
-		time.Duration(config.Cfg.RediscoverRateMS)*time.Millisecond)
-
-	// Filter and Process only search-addon events
-	filter := metav1.ListOptions{FieldSelector: "metadata.name=search-collector"}
-	filterFunc := dynamicinformer.TweakListOptionsFunc(func(options *metav1.ListOptions) { *options = filter })
-
-	filteredDynamicFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient,
-		time.Duration(config.Cfg.RediscoverRateMS)*time.Millisecond, metav1.NamespaceAll, filterFunc)
-
-	// Create GVR for ManagedCluster and ManagedClusterInfo
-	managedClusterGvr, _ := schema.ParseResourceArg(managedClusterGVR)
-	managedClusterInfoGvr, _ := schema.ParseResourceArg(managedClusterInfoGVR)
-	managedClusterAddonGvr, _ := schema.ParseResourceArg(managedClusterAddonGVR)
-
-	//Create Informers for ManagedCluster and ManagedClusterInfo
-	managedClusterInformer := dynamicFactory.ForResource(*managedClusterGvr).Informer()
-	managedClusterInfoInformer := dynamicFactory.ForResource(*managedClusterInfoGvr).Informer()
-	managedClusterAddonInformer := filteredDynamicFactory.ForResource(*managedClusterAddonGvr).Informer()
+	initClusterSelector() // See clusterSelector.go
 
 	resyncPeriod := time.Duration(config.Cfg.ResyncPeriodMS) * time.Millisecond
 	// Confirm delete event not missed if indexer OR db goes offline:
-	err := deleteStaleClusterResources(ctx, dynamicClient, *managedClusterGvr)
+	err := deleteStaleClusterResources(ctx, clusterClient)
 	if err != nil {
 		klog.Warning("Error deleting stale clusters resources", err.Error())
 	}
 
-	// Create handlers for events
+	// Delete orphan edges, tombstones, and stale clusters, check consistency, flag stale data, reconcile the clusters
+	// cache, maintain the tables, and prune the history and dead letter items only from the leader, it's enough to
+	// run once for all replicas.
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.OrphanEdgeCleanupMS > 0 {
+		go postgresDAO.StartOrphanEdgeCleanup(ctx, time.Duration(config.Cfg.OrphanEdgeCleanupMS)*time.Millisecond)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.SoftDelete {
+		go postgresDAO.StartTombstoneCleanup(ctx, time.Duration(config.Cfg.SoftDeleteRetention)*time.Hour)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.StaleClusterTTL > 0 {
+		go postgresDAO.StartStaleClusterCleanup(ctx, time.Duration(config.Cfg.StaleClusterTTL)*time.Hour,
+			config.Cfg.StaleClusterDryRun)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.ConsistencyCheckMS > 0 {
+		go postgresDAO.StartConsistencyCheck(ctx, time.Duration(config.Cfg.ConsistencyCheckMS)*time.Millisecond,
+			config.Cfg.ConsistencyResync)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.StaleDataWindowMS > 0 {
+		go postgresDAO.StartStaleDataCheck(ctx, time.Duration(config.Cfg.StaleDataWindowMS)*time.Millisecond)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.ClusterCacheSyncMS > 0 {
+		go postgresDAO.StartClusterCacheSync(ctx, time.Duration(config.Cfg.ClusterCacheSyncMS)*time.Millisecond)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.MaintenanceMS > 0 {
+		go postgresDAO.StartTableMaintenance(ctx, time.Duration(config.Cfg.MaintenanceMS)*time.Millisecond,
+			config.Cfg.MaintenancePct)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.HistoryEnabled {
+		go postgresDAO.StartHistoryCleanup(ctx, time.Duration(config.Cfg.HistoryRetention)*time.Hour)
+	}
+	if postgresDAO, ok := dao.(*database.DAO); ok && config.Cfg.DeadLetter {
+		go postgresDAO.StartDeadLetterCleanup(ctx, time.Duration(config.Cfg.DeadLetterRetention)*time.Hour,
+			config.Cfg.DeadLetterMaxRows)
+	}
+
+	// Create handlers for events. The events are processed by the workers of the queue, see clusterQueue.go
+	events := newClusterEventQueue(processClusterUpsert, processClusterDelete)
 	handlers := cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			klog.V(4).Info("AddFunc for ", obj.(*unstructured.Unstructured).GetKind())
-			processClusterUpsert(ctx, obj)
+			klog.V(4).Info("AddFunc for ", objectKind(obj))
+			events.add(obj, false)
 		},
 		UpdateFunc: func(prev interface{}, next interface{}) {
-			klog.V(4).Info("UpdateFunc for ", next.(*unstructured.Unstructured).GetKind())
-			processClusterUpsert(ctx, next)
+			klog.V(4).Info("UpdateFunc for ", objectKind(next))
+			events.add(next, false)
 		},
 		DeleteFunc: func(obj interface{}) {
-			klog.V(4).Info("DeleteFunc for ", obj.(*unstructured.Unstructured).GetKind())
-			processClusterDelete(ctx, obj)
+			klog.V(4).Infof("DeleteFunc for %T", obj)
+			events.add(obj, true)
 		},
 	}
+	eventsDone := make(chan struct{})
+	go func() {
+		defer close(eventsDone)
+		events.run(ctx, config.Cfg.ClusterEventWorkers)
+	}()
+
+	// Create an informer for each watched hub resource. See watchedResources.go
+	// Returns after the informers are stopped, so the leader lease isn't released while they're running.
+	var informers sync.WaitGroup
+	initial := &initialSync{}
+	for _, watched := range listWatchedResources() {
+		informer := newInformer(watched)
+		if informer == nil {
+			continue
+		}
+		registration, err := informer.AddEventHandlerWithResyncPeriod(handlers, resyncPeriod)
+		checkError(err, "Error adding eventHandler for "+watched.Kind)
+		onDiscovered := initial.add(watched.Kind, registration)
+
+		// Periodically check if the resource exists
+		informers.Add(1)
+		go func(groupVersion string) {
+			defer informers.Done()
+			stopAndStartInformer(ctx, groupVersion, informer, onDiscovered)
+		}(watched.GroupVersion)
+	}
+	go waitForInitialSync(ctx, initial, events)
+	informers.Wait()
+	<-eventsDone
+
+	// Don't write from the timers scheduled while leading, the next leader schedules them again.
+	cancelPendingDeletes()
+	stopAllOfflineTracking()
+	// The next leader can change the Cluster nodes, read them again if leading again.
+	database.InvalidateClustersCache()
+	klog.Info("Stopped ClusterWatch routine.")
+}
 
-	// Add Handlers to both Informers
-	_, managedClusterErr := managedClusterInformer.AddEventHandlerWithResyncPeriod(handlers, resyncPeriod)
-	checkError(managedClusterErr, "Error adding eventHandler for managedCluster")
-	_, managedClusterInfoErr := managedClusterInfoInformer.AddEventHandlerWithResyncPeriod(handlers, resyncPeriod)
-	checkError(managedClusterInfoErr, "Error adding eventHandler for managedClusterInfo")
-	_, managedClusterAddonErr := managedClusterAddonInformer.AddEventHandlerWithResyncPeriod(handlers, resyncPeriod)
-	checkError(managedClusterAddonErr, "Error adding eventHandler for managedClusterAddon")
-
-	// Periodically check if the ManagedCluster/ManagedClusterInfo resource exists
-	go stopAndStartInformer(ctx, "cluster.open-cluster-management.io/v1", managedClusterInformer)
-	go stopAndStartInformer(ctx, "internal.open-cluster-management.io/v1beta1", managedClusterInfoInformer)
-	go stopAndStartInformer(ctx, "addon.open-cluster-management.io/v1alpha1", managedClusterAddonInformer)
+// Creates the informer of the watched resource. ManagedCluster uses the generated typed informer, the other
+// resources use a dynamic informer and are converted by their Transform function.
+func newInformer(watched WatchedResource) cache.SharedIndexInformer {
+	if watched.Kind == "ManagedCluster" {
+		rediscoverRate := time.Duration(config.Live().RediscoverRateMS) * time.Millisecond
+		return clusterinformers.NewSharedInformerFactory(clusterClient, rediscoverRate).Cluster().V1().
+			ManagedClusters().Informer()
+	}
+	gvr, _ := schema.ParseResourceArg(watched.GVR)
+	if gvr == nil {
+		klog.Errorf("Invalid GVR [%s] for watched resource %s.", watched.GVR, watched.Kind)
+		return nil
+	}
+	return newInformerFactory(watched.FieldSelector).ForResource(*gvr).Informer()
+}
 
+// Creates the informer factory, optionally watching only the objects matching the field selector.
+func newInformerFactory(fieldSelector string) dynamicinformer.DynamicSharedInformerFactory {
+	rediscoverRate := time.Duration(config.Live().RediscoverRateMS) * time.Millisecond
+	if fieldSelector == "" {
+		return dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, rediscoverRate)
+	}
+	filterFunc := dynamicinformer.TweakListOptionsFunc(func(options *metav1.ListOptions) {
+		options.FieldSelector = fieldSelector
+	})
+	return dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, rediscoverRate,
+		metav1.NamespaceAll, filterFunc)
 }
 
-func deleteStaleClusterResources(ctx context.Context, dynamicClient dynamic.Interface,
-	managedClusterGvr schema.GroupVersionResource) error {
-	clusterRemaining, err := findStaleClusterResources(ctx, dynamicClient, managedClusterGvr)
+func deleteStaleClusterResources(ctx context.Context, clusterClient clusterclientset.Interface) error {
+	clusterRemaining, err := findStaleClusterResources(ctx, clusterClient)
 	if err != nil {
 		klog.Warning("Error finding stale cluster resources", err.Error())
 		return err
@@ -136,16 +222,21 @@ func deleteStaleClusterResources(ctx context.Context, dynamicClient dynamic.Inte
 }
 
 // Stop and Start informer according to Rediscover Rate
-func stopAndStartInformer(ctx context.Context, groupVersion string, informer cache.SharedIndexInformer) {
+// Calls onDiscovered after the first check of the resource, with true if the informer was started.
+func stopAndStartInformer(ctx context.Context, groupVersion string, informer cache.SharedIndexInformer,
+	onDiscovered func(running bool)) {
 	var stopper chan struct{}
 	informerRunning := false
+	discovered := false
 	wait := time.Duration(1 * time.Millisecond)
 
 	for {
 		select {
 		case <-ctx.Done():
 			klog.Info("Exit informers for clusterwatch.")
-			stopper <- struct{}{}
+			if informerRunning {
+				close(stopper)
+			}
 			return
 		case <-time.After(wait):
 			_, err := config.Cfg.KubeClient.ServerResourcesForGroupVersion(groupVersion)
@@ -163,63 +254,97 @@ func stopAndStartInformer(ctx context.Context, groupVersion string, informer cac
 					informerRunning = true
 					go informer.Run(stopper)
 				}
+				if !discovered && onDiscovered != nil {
+					discovered = true
+					onDiscovered(informerRunning)
+				}
 			}
-			wait = time.Duration(config.Cfg.RediscoverRateMS) * time.Millisecond
+			wait = time.Duration(config.Live().RediscoverRateMS) * time.Millisecond
 		}
 	}
 }
 
 func processClusterUpsert(ctx context.Context, obj interface{}) {
-	// Lock so only one goroutine at a time can access add a cluster.
-	// Helps to eliminate duplicate entries.
-	mux.Lock()
-	defer mux.Unlock()
-	j, err := json.Marshal(obj.(*unstructured.Unstructured))
-	if err != nil {
-		klog.Warning("Error unmarshalling object from Informer in processClusterUpsert.")
+	if managedCluster, ok := obj.(*clusterv1.ManagedCluster); ok {
+		processManagedClusterUpsert(ctx, managedCluster)
+		return
 	}
+	u := obj.(*unstructured.Unstructured)
+	if u.GetKind() == "ManagedCluster" {
+		managedCluster := &clusterv1.ManagedCluster{}
+		if err := fromUnstructured(u, managedCluster); err != nil {
+			klog.Warning("Error transforming object from Informer in processClusterUpsert. ", err)
+			metrics.Errors.WithLabelValues("clustersync", "transform").Inc()
+			return
+		}
+		processManagedClusterUpsert(ctx, managedCluster)
+		return
+	}
+	// Lock so only one goroutine at a time can add the same cluster.
+	// Helps to eliminate duplicate entries.
+	unlock := lockCluster(u.GetKind(), u)
+	defer unlock()
 
-	// We update by name, and the name *should be* the same for a given cluster in either object
+	// We update by name, and the name *should be* the same for a given cluster in all the watched objects
 	// Objects from a given cluster collide and update rather than duplicate insert
-	// Unmarshall either ManagedCluster or ManagedClusterInfo
-	// check which object we are using
-
-	var resource model.Resource
-	switch obj.(*unstructured.Unstructured).GetKind() {
-	case "ManagedCluster":
-		managedCluster := clusterv1.ManagedCluster{}
-		err = json.Unmarshal(j, &managedCluster)
-		if err != nil {
-			klog.Warning("Failed to Unmarshal ManagedCluster", err)
-		}
-		resource = transformManagedCluster(&managedCluster)
-	case "ManagedClusterInfo":
-		managedClusterInfo := clusterv1beta1.ManagedClusterInfo{}
-		err = json.Unmarshal(j, &managedClusterInfo)
-		if err != nil {
-			klog.Warning("Failed to Unmarshal ManagedclusterInfo", err)
-		}
-		resource = transformManagedClusterInfo(&managedClusterInfo)
+	switch u.GetKind() {
 	case "ManagedClusterAddOn":
-		klog.V(4).Infof("No upsert cluster actions for kind: %s", obj.(*unstructured.Unstructured).GetKind())
+		processAddonUpsert(ctx, u)
 		return
-	default:
-		klog.Warning("ClusterWatch received unknown kind.", obj.(*unstructured.Unstructured).GetKind())
+	}
+	watched, ok := watchedResource(u.GetKind())
+	if !ok {
+		klog.Warning("ClusterWatch received unknown kind.", u.GetKind())
+		return
+	}
+	if watched.Transform == nil {
+		klog.V(4).Infof("No upsert cluster actions for kind: %s", u.GetKind())
+		return
+	}
+	resource, err := watched.Transform(u)
+	if err != nil {
+		klog.Warning("Error transforming object from Informer in processClusterUpsert. ", err)
+		metrics.Errors.WithLabelValues("clustersync", "transform").Inc()
+		recordClusterFailure(u.GetName(), "ClusterTransformFailed",
+			fmt.Sprintf("Search indexer failed to process %s %s. %s", u.GetKind(), u.GetName(), err))
 		return
 	}
 
+	if resource.UID == "" {
+		return // The resource doesn't write a Cluster node, e.g. ManagedClusterSet.
+	}
+	if name, _ := resource.Properties["name"].(string); clusterExcluded(name) {
+		klog.V(4).Infof("Cluster %s doesn't match CLUSTER_LABEL_SELECTOR. Skipping %s.", name, u.GetKind())
+		return
+	}
 	// Upsert (attempt insert, update on failure)
 	dao.UpsertCluster(ctx, resource)
+}
 
-	// A cluster can be offline due to resource shortage, network outage or other reasons. We are not deleting
-	// the cluster or resources if a cluster is offline to avoid unnecessary deletes and re-inserts in the database.
-	// We need to add a Message in the UI to show a list of clusters that are offline and warn users
-	// that the data might be stale
-	/*if resource.Properties["status"] == "offline" {
-		klog.Infof("Cluster %s is offline, removing cluster resources from datastore.", cluster.GetName())
-		delClusterResources(cluster)
-	}*/
-
+// Writes the Cluster node of the ManagedCluster. ManagedCluster is the primary source of the cluster information.
+func processManagedClusterUpsert(ctx context.Context, managedCluster *clusterv1.ManagedCluster) {
+	unlock := lockCluster("ManagedCluster", managedCluster)
+	defer unlock()
+	clusterName := managedCluster.GetName()
+	// The data is deleted before the ManagedCluster is removed. See clusterFinalizer.go
+	if handleClusterFinalizer(ctx, managedCluster) {
+		return
+	}
+	if !clusterSelected(ctx, managedCluster) {
+		return
+	}
+	rememberClusterUID(clusterName, managedCluster.GetUID())
+	cancelClusterDelete(clusterName, "ManagedCluster")
+	// Cleans up the data left when the cluster was detached and imported again. See clusterIdentity.go
+	checkClusterIdentity(ctx, managedCluster)
+
+	resource := transformManagedCluster(managedCluster)
+	// A cluster can be offline due to resource shortage, network outage or other reasons. The resources are only
+	// deleted if the cluster stays offline past OFFLINE_CLUSTER_PURGE_GRACE_MS. See offlineClusters.go
+	trackOfflineCluster(ctx, managedCluster, resource.Properties)
+	// Upsert (attempt insert, update on failure)
+	dao.UpsertCluster(ctx, resource)
+	addClusterFinalizer(ctx, managedCluster)
 }
 
 func isClusterCrdMissing(err error) bool {
@@ -248,6 +373,20 @@ func addAdditionalProperties(props map[string]interface{}) map[string]interface{
 	return props
 }
 
+// Returns the Cluster node with the properties to update. The other properties are kept from the cached node,
+// see addAdditionalProperties().
+func clusterNode(clusterName string, props map[string]interface{}) model.Resource {
+	props["kind"] = "Cluster"
+	props["name"] = clusterName
+	props = addAdditionalProperties(props)
+	return model.Resource{
+		Kind:           "Cluster",
+		UID:            "cluster__" + clusterName,
+		Properties:     props,
+		ResourceString: "managedclusterinfos", // Maps rbac to ManagedClusterInfo
+	}
+}
+
 // Transform ManagedClusterInfo object into Resource suitable for insert into database
 func transformManagedClusterInfo(managedClusterInfo *clusterv1beta1.ManagedClusterInfo) model.Resource {
 	// https://github.com/stolostron/multicloud-operators-foundation/
@@ -298,6 +437,9 @@ func transformManagedCluster(managedCluster *clusterv1.ManagedCluster) model.Res
 	props["name"] = managedCluster.GetName()     // must match ManagedClusterInfo
 	props["apigroup"] = managedClusterInfoApiGrp // maps rbac to ManagedClusterInfo
 	props["created"] = managedCluster.GetCreationTimestamp().UTC().Format(time.RFC3339)
+	if managedCluster.GetUID() != "" {
+		props["_managedClusterUID"] = string(managedCluster.GetUID()) // See clusterIdentity.go
+	}
 
 	cpuCapacity := managedCluster.Status.Capacity["cpu"]
 	props["cpu"], _ = cpuCapacity.AsInt64()
@@ -308,6 +450,21 @@ func transformManagedCluster(managedCluster *clusterv1.ManagedCluster) model.Res
 	for _, condition := range managedCluster.Status.Conditions {
 		props[condition.Type] = string(condition.Status)
 	}
+
+	// Map the cluster claims by name, e.g. product.open-cluster-management.io, version.openshift.io, so clusters
+	// can be searched by the claim values.
+	if len(managedCluster.Status.ClusterClaims) > 0 {
+		claims := make(map[string]interface{}, len(managedCluster.Status.ClusterClaims))
+		for _, claim := range managedCluster.Status.ClusterClaims {
+			claims[claim.Name] = claim.Value
+		}
+		props["clusterClaim"] = claims
+	}
+
+	// ManagedClusterSets selecting the cluster. See clusterSets.go
+	for key, value := range clusterSetProperties(managedCluster.GetName(), managedCluster.GetLabels()) {
+		props[key] = value
+	}
 	props = addAdditionalProperties(props)
 	resource := model.Resource{
 		Kind:           "Cluster",
@@ -318,24 +475,61 @@ func transformManagedCluster(managedCluster *clusterv1.ManagedCluster) model.Res
 	return resource
 }
 
+// Updates the addon status in the Cluster node, see addonStatus.go
+// The search-collector ManagedClusterAddOn is being deleted when search is disabled in the cluster. Deletes the
+// resources and edges of the cluster, same as when the addon is deleted, so the data isn't kept while the addon
+// is terminating. Otherwise cancels a pending delete if the addon was enabled again.
+func processAddonUpsert(ctx context.Context, addon *unstructured.Unstructured) {
+	clusterName := addon.GetNamespace() // Namespace reflects the name of the cluster
+	if clusterExcluded(clusterName) {
+		return
+	}
+	updateAddonStatus(ctx, addon)
+	if addon.GetName() != searchCollectorAddon {
+		return
+	}
+	if addon.GetDeletionTimestamp() != nil {
+		klog.V(3).Infof("Search is disabled in cluster %s. Deleting the cluster resources and edges from the DB.",
+			clusterName)
+		deleteCluster(ctx, clusterName, false, addon.GetKind())
+		return
+	}
+	cancelClusterDelete(clusterName, addon.GetKind())
+}
+
 // Deletes a cluster resource and all resources from the cluster.
 func processClusterDelete(ctx context.Context, obj interface{}) {
 	klog.V(4).Info("Processing Cluster Delete.")
-	clusterName := obj.(*unstructured.Unstructured).GetName()
+	// The informer sends the last known state when the watch missed the delete.
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, err := meta.Accessor(obj)
+	if err != nil || objectKind(obj) == "" {
+		klog.Warningf("Unable to process cluster delete for object type %T", obj)
+		return
+	}
+	clusterName := object.GetName()
 	var deleteClusterNode bool
-	kind := obj.(*unstructured.Unstructured).GetKind()
-	name := obj.(*unstructured.Unstructured).GetName()
+	kind := objectKind(obj)
+	name := object.GetName()
 	switch kind {
 	case "ManagedCluster":
 		// When ManagedCluster (MC) is deleted, delete the resources and edges and cluster node for that cluster from db
 		// ManagedClusterInfo (namespace scoped) will be deleted when the MC (cluster scoped) is being deleted.
 		// So, we are tracking deletes of MC only to avoid duplication.
 		deleteClusterNode = true
+		forgetCluster(clusterName)
 		klog.V(3).Infof("Received delete for %s. Deleting Cluster resource %s and all resources from the DB", kind,
 			clusterName)
 
 	case "ManagedClusterAddOn":
-		clusterName = obj.(*unstructured.Unstructured).GetNamespace() // Namespace reflects the name of the cluster
+		deleteAddonStatus(ctx, obj.(*unstructured.Unstructured))
+		if name != searchCollectorAddon {
+			klog.V(4).Infof("No delete cluster actions for %s %s", kind, name)
+			return
+		}
+		clusterName = object.GetNamespace() // Namespace reflects the name of the cluster
 		// When ManagedClusterAddOn (MCA) is deleted, search is disabled in the cluster. So, we delete the resources
 		// and edges for that cluster from db. But the cluster node is kept until MC is deleted.
 		deleteClusterNode = false
@@ -347,29 +541,57 @@ func processClusterDelete(ctx context.Context, obj interface{}) {
 		return
 
 	default:
+		if watched, ok := watchedResource(kind); ok && watched.Delete != nil {
+			processWatchedDelete(ctx, watched, obj.(*unstructured.Unstructured))
+			return
+		}
 		klog.Warningf("No delete cluster actions for kind: %s", kind)
 		return
 	}
-	dao.DeleteClusterAndResources(ctx, clusterName, deleteClusterNode)
+	deleteCluster(ctx, clusterName, deleteClusterNode, kind)
+}
 
+// Forgets the state kept in memory for a deleted ManagedCluster.
+func forgetCluster(clusterName string) {
+	stopOfflineTracking(clusterName)
+	forgetExcludedCluster(clusterName)
+	forgetAddonStatus(clusterName)
+	forgetClusterSets(clusterName)
+	forgetClusterUID(clusterName)
+	forgetClusterIdentity(clusterName)
+}
+
+// Writes the Cluster node returned by the Delete function of a watched resource.
+func processWatchedDelete(ctx context.Context, watched WatchedResource, obj *unstructured.Unstructured) {
+	mux.Lock()
+	defer mux.Unlock()
+	resource, err := watched.Delete(obj)
+	if err != nil {
+		klog.Warning("Error processing delete of ", watched.Kind, ". ", err)
+		metrics.Errors.WithLabelValues("clustersync", "transform").Inc()
+		return
+	}
+	if resource.UID != "" {
+		dao.UpsertCluster(ctx, resource)
+	}
 }
 
 // finds lingering data in database from deleted/detached clusters or clusters with search-collector-addon disabled:
-func findStaleClusterResources(ctx context.Context, dynamicClient dynamic.Interface,
-	gvr schema.GroupVersionResource) ([]string, error) {
+func findStaleClusterResources(ctx context.Context, clusterClient clusterclientset.Interface) ([]string, error) {
 	var needToDelete []string
 	managedClustersFromClient := make(map[string]struct{})
 
 	// get all managed clusters from kube client:
-	resourceObj, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+	resourceObj, err := clusterClient.ClusterV1().ManagedClusters().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		klog.Warning("Error resolving ManagedClusters with dynamic client", err.Error())
+		klog.Warning("Error resolving ManagedClusters with cluster client", err.Error())
 		return nil, err
 	}
 	for _, item := range resourceObj.Items {
 		// Here we want all managed clusters that have the search-collector addon available
 		if item.GetLabels()["local-cluster"] != "true" && //note: need better method instead of using name local-cluster.
-			item.GetLabels()["feature.open-cluster-management.io/addon-search-collector"] == "available" {
+			item.GetLabels()["feature.open-cluster-management.io/addon-search-collector"] == "available" &&
+			clusterLabelsSelected(item.GetLabels()) {
 			managedClustersFromClient[item.GetName()] = struct{}{}
 		}
 	}
@@ -384,6 +606,9 @@ func findStaleClusterResources(ctx context.Context, dynamicClient dynamic.Interf
 	klog.V(3).Infof("Managed Clusters reported from database: %+v", managedClustersFromDB)
 
 	for _, dmCluster := range managedClustersFromDB {
+		if database.IsFederatedCluster(dmCluster) {
+			continue // Received from another hub, see database/federation.go
+		}
 		if _, exist := managedClustersFromClient[dmCluster]; !exist {
 			// At this point the cluster exists in DB, but not in the list from client.
 			needToDelete = append(needToDelete, dmCluster)
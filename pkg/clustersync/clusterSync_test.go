@@ -7,20 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"regexp"
 	"testing"
 
-	"github.com/driftprogramming/pgxpoolmock"
-	"github.com/golang/mock/gomock"
-	"github.com/jackc/pgx/v4"
-	"github.com/pashagolub/pgxmock"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/testutils"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic/fake"
 	"k8s.io/klog/v2"
+	clusterfake "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
 )
 
 // Create a GroupVersionResource
@@ -62,6 +62,12 @@ func fakeDynamicClient() *fake.FakeDynamicClient {
 	return dyn
 }
 
+// Returns the typed cluster client with the ManagedCluster name-foo.
+func fakeClusterClient() *clusterfake.Clientset {
+	return clusterfake.NewSimpleClientset(&clusterv1.ManagedCluster{ObjectMeta: v1.ObjectMeta{Name: "name-foo",
+		Labels: map[string]string{"feature.open-cluster-management.io/addon-search-collector": "available"}}})
+}
+
 func newTestUnstructured(apiVersion, kind, namespace, name, uid string) *unstructured.Unstructured {
 	return &unstructured.Unstructured{
 		Object: map[string]interface{}{
@@ -117,24 +123,22 @@ func Test_ProcessClusterUpsert_ManagedCluster(t *testing.T) {
 	initializeVars()
 	obj := newTestUnstructured(managedclustergroupAPIVersion, "ManagedCluster", "", "name-foo", "test-mc-uid")
 
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	mockPool := testutils.NewMockPool(t)
 	// Prepare a mock DAO instance
-	dao = database.NewDAO(mockPool)
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
 	dynamicClient = fakeDynamicClient()
+	existingCluster["Properties"].(map[string]interface{})["_managedClusterUID"] = "test-mc-uid"
 	expectedProps, _ := json.Marshal(existingCluster["Properties"])
+	defer forgetClusterIdentity("name-foo")
 
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT "uid", "data" FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool.ExpectQuery(clusterIdentitiesSql).WithArgs("cluster__name-foo", "").
+		WillReturnRows(pgxmock.NewRows([]string{"name", "uid", "cluster_id"}))
+	mockPool.ExpectQuery(`SELECT "uid", "data" FROM "clusters" WHERE ("uid" = $1)`).
+		WithArgs("cluster__name-foo").WillReturnRows(pgxmock.NewRows([]string{"uid", "data"}))
 
-	sql := fmt.Sprintf(`INSERT INTO "search"."resources" AS "r" ("cluster", "data", "uid") VALUES ('name-foo', '%[1]s', '%[2]s') ON CONFLICT (uid) DO UPDATE SET "data"='%[1]s' WHERE ("r".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(sql),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	sql := fmt.Sprintf(`INSERT INTO "clusters" AS "c" ("console_url", "data", "kubernetes_version", "name", "status", "uid") VALUES (NULL, '%[1]s', '', 'name-foo', NULL, '%[2]s') ON CONFLICT (uid) DO UPDATE SET "console_url"=NULL,"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object('lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', "c".data->'searchDataStale')),"kubernetes_version"='',"name"='name-foo',"status"=NULL WHERE ("c".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
+	mockPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("UPDATE", 0))
 
 	processClusterUpsert(context.Background(), obj)
 	// Once processClusterUpsert is done, existingClustersCache should have an entry for cluster foo
@@ -143,17 +147,29 @@ func Test_ProcessClusterUpsert_ManagedCluster(t *testing.T) {
 
 }
 
+// Should write the Cluster node of the ManagedCluster from the typed informer.
+func Test_ProcessClusterUpsert_typedManagedCluster(t *testing.T) {
+	store := newMemoryStoreWithCluster("other-cluster")
+	managedCluster := &clusterv1.ManagedCluster{ObjectMeta: v1.ObjectMeta{Name: "name-typed", UID: "test-mc-uid"}}
+
+	processClusterUpsert(context.Background(), managedCluster)
+	defer processClusterDelete(context.Background(), managedCluster)
+
+	AssertEqual(t, reflect.DeepEqual(managedClusters(t, store), []string{"other-cluster", "name-typed"}) ||
+		reflect.DeepEqual(managedClusters(t, store), []string{"name-typed", "other-cluster"}), true,
+		"Expected the Cluster node of the typed ManagedCluster")
+}
+
 func Test_ProcessClusterUpsert_ManagedClusterInfo(t *testing.T) {
 	initializeVars()
 	// Ensure there is an entry for cluster_foo in the cluster cache
 	database.UpdateClustersCache("cluster__name-foo", existingCluster["Properties"])
 	obj := newTestUnstructured(managedclusterinfogroupAPIVersion, "ManagedClusterInfo", "name-foo", "name-foo", "test-mc-uid")
 
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	mockPool := testutils.NewMockPool(t)
 	// Prepare a mock DAO instance
-	dao = database.NewDAO(mockPool)
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
 	dynamicClient = fakeDynamicClient()
 	// Add props specific to ManagedClusterInfo
 	props := existingCluster["Properties"].(map[string]interface{})
@@ -163,11 +179,8 @@ func Test_ProcessClusterUpsert_ManagedClusterInfo(t *testing.T) {
 	existingCluster["Properties"] = props
 	expectedProps, _ := json.Marshal(existingCluster["Properties"])
 
-	sql := fmt.Sprintf(`INSERT INTO "search"."resources" AS "r" ("cluster", "data", "uid") VALUES ('name-foo', '%[1]s', '%[2]s') ON CONFLICT (uid) DO UPDATE SET "data"='%[1]s' WHERE ("r".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(sql),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	sql := fmt.Sprintf(`INSERT INTO "clusters" AS "c" ("console_url", "data", "kubernetes_version", "name", "status", "uid") VALUES ('', '%[1]s', '', 'name-foo', NULL, '%[2]s') ON CONFLICT (uid) DO UPDATE SET "console_url"='',"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object('lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', "c".data->'searchDataStale')),"kubernetes_version"='',"name"='name-foo',"status"=NULL WHERE ("c".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
+	mockPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("UPDATE", 0))
 
 	processClusterUpsert(context.Background(), obj)
 	// Once processClusterUpsert is done, existingClustersCache should have an entry for cluster foo
@@ -184,6 +197,16 @@ func AssertEqual(t *testing.T, a interface{}, b interface{}, message string) {
 	t.Errorf("%s Received %v (type %v), expected %v (type %v)", message, a, reflect.TypeOf(a), b, reflect.TypeOf(b))
 }
 
+// Mocks the transaction deleting the resources and edges of the cluster.
+func mockDeleteClusterResources(mockPool pgxmock.PgxPoolIface, clusterName string) {
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(fmt.Sprintf(`DELETE FROM "resources" WHERE ("cluster" = '%s')`, clusterName)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectExec(fmt.Sprintf(`DELETE FROM "edges" WHERE ("cluster" = '%s')`, clusterName)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectCommit()
+}
+
 func Test_isClusterCrdMissingNoError(t *testing.T) {
 	ok := isClusterCrdMissing(nil)
 	AssertEqual(t, ok, false, "No error found in clusterCRDMissing")
@@ -204,8 +227,6 @@ func Test_ProcessClusterNoDeleteOnMCInfo(t *testing.T) {
 	obj := newTestUnstructured(managedclusterinfogroupAPIVersion, "ManagedClusterInfo", "", "name-foo", "test-mc-uid")
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	database.UpdateClustersCache("cluster__name-foo", nil)
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
 	processClusterDelete(context.Background(), obj)
 
 	//Once processClusterDelete is done, existingClustersCache should still have an entry for cluster foo as resources
@@ -220,26 +241,15 @@ func Test_ProcessClusterDeleteOnMC(t *testing.T) {
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	database.UpdateClustersCache("cluster__name-foo", nil)
 
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	mockPool := testutils.NewMockPool(t)
 	// Prepare a mock DAO instance
-	dao = database.NewDAO(mockPool)
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
 
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer mockConn.Close(context.Background())
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Return(mockConn, nil)
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectCommit()
+	mockDeleteClusterResources(mockPool, "name-foo")
 
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(`DELETE FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool.ExpectExec(`DELETE FROM "clusters" WHERE ("uid" = 'cluster__name-foo')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
 
 	processClusterDelete(context.Background(), obj)
 
@@ -257,20 +267,11 @@ func Test_ProcessClusterDeleteOnMCASearch(t *testing.T) {
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	database.UpdateClustersCache("cluster__name-foo", nil)
 
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+	mockPool := testutils.NewMockPool(t)
 	// Prepare a mock DAO instance
-	dao = database.NewDAO(mockPool)
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer mockConn.Close(context.Background())
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Return(mockConn, nil)
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectCommit()
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
+	mockDeleteClusterResources(mockPool, "name-foo")
 
 	processClusterDelete(context.Background(), obj)
 
@@ -300,6 +301,23 @@ type error interface {
 	Error() string
 }
 
+// Should map the cluster claims by name.
+func Test_transformManagedCluster_clusterClaims(t *testing.T) {
+	managedCluster := clusterv1.ManagedCluster{
+		ObjectMeta: v1.ObjectMeta{Name: "name-claims"},
+		Status: clusterv1.ManagedClusterStatus{ClusterClaims: []clusterv1.ManagedClusterClaim{
+			{Name: "product.open-cluster-management.io", Value: "OpenShift"},
+			{Name: "version.openshift.io", Value: "4.14.2"},
+		}},
+	}
+
+	resource := transformManagedCluster(&managedCluster)
+
+	expected := map[string]interface{}{"product.open-cluster-management.io": "OpenShift", "version.openshift.io": "4.14.2"}
+	AssertEqual(t, reflect.DeepEqual(resource.Properties["clusterClaim"], expected), true,
+		"clusterClaim property should map the claims by name")
+}
+
 // Find stale cluster resources, if found, delete them
 func Test_DeleteStaleClustersResources(t *testing.T) {
 	//ensure cluster in cache exists
@@ -318,53 +336,35 @@ func Test_DeleteStaleClustersResources(t *testing.T) {
 	label["feature.open-cluster-management.io/addon-search-collector"] = "available"
 	obj.SetLabels(label)
 	//create obj in with client:
-	dynamicClient := fakeDynamicClient()
-	_, clientErr := dynamicClient.Resource(*managedClusterGvr).Namespace("name-foo").Create(context.Background(), obj, v1.CreateOptions{})
-	if clientErr != nil {
-		t.Errorf("an error '%s' has occured while trying to create resources", clientErr)
-	}
+	clusterClient := fakeClusterClient()
 	//create the addon in namespace name-foo:
-	_, clientErr = dynamicClient.Resource(*managedClusterAddonGvr).Namespace("name-foo").Create(context.Background(), obj3, v1.CreateOptions{})
+	_, clientErr := fakeDynamicClient().Resource(*managedClusterAddonGvr).Namespace("name-foo").Create(context.Background(), obj3, v1.CreateOptions{})
 
 	if clientErr != nil {
 		t.Errorf("an error '%s' has occured while trying to create resources", clientErr)
 	}
 
 	// Prepare a mock DAO instance
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
-	dao = database.NewDAO(mockPool)
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Errorf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-
-	defer mockConn.Close(context.Background())
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Return(mockConn, nil)
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectCommit()
+	mockPool := testutils.NewMockPool(t)
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
+	mockDeleteClusterResources(mockPool, "name-foo")
 
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(`DELETE FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool.ExpectExec(`DELETE FROM "clusters" WHERE ("uid" = 'cluster__name-foo')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
 	//delete managed cluster:
 	processClusterDelete(context.Background(), obj)
 
 	columns := []string{"cluster"}
-	pgxRows := pgxpoolmock.NewRows(columns).AddRow("name-foo").AddRow("remaining-managed-foo").ToPgxRows()
+	pgxRows := pgxmock.NewRows(columns).AddRow("name-foo").AddRow("remaining-managed-foo")
 
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT DISTINCT "cluster" FROM "search"."resources"`),
-		gomock.Eq([]interface{}{}),
-	).Return(pgxRows, nil).Times(2)
+	mockPool.ExpectQuery(`SELECT "cluster" FROM "resources" UNION (SELECT "name" FROM "clusters")`).
+		WillReturnRows(pgxRows).Times(2)
 
 	// Execute function test - the clusters in mc are to be deleted
-	mc, _ := findStaleClusterResources(context.Background(), dynamicClient, *managedClusterGvr)
+	mc, _ := findStaleClusterResources(context.Background(), clusterClient)
 
-	err = deleteStaleClusterResources(context.Background(), dynamicClient, *managedClusterGvr)
+	err := deleteStaleClusterResources(context.Background(), clusterClient)
 	if err != nil {
 		t.Errorf("Error processing delete for remaining cluster: %s", err)
 	}
@@ -400,48 +400,30 @@ func Test_DeleteStaleClustersResources_DB_Outage(t *testing.T) {
 	obj.SetLabels(label)
 
 	//create obj in with client:
-	dynamicClient := fakeDynamicClient()
-	_, clientErr := dynamicClient.Resource(*managedClusterGvr).Namespace("name-foo").Create(context.Background(), obj, v1.CreateOptions{})
-	if clientErr != nil {
-		t.Errorf("an error '%s' has occured while trying to create resources", clientErr)
-	}
+	clusterClient := fakeClusterClient()
 
 	// Prepare a mock DAO instance
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
-	dao = database.NewDAO(mockPool)
-	mockConn, err := pgxmock.NewConn()
-	//mock db error
-	fakeErr := errors.New("Mock DB Error")
-	if err != nil {
-		t.Errorf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-
-	defer mockConn.Close(context.Background())
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Return(mockConn, fakeErr).Times(1).Return(mockConn, nil).Times(1) // return mock error
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectCommit()
-
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(`DELETE FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool := testutils.NewMockPool(t)
+	postgresDAO := database.NewDAO(mockPool)
+	dao = &postgresDAO
+	// Mock database error, the delete is retried.
+	mockPool.ExpectBeginTx(pgx.TxOptions{}).WillReturnError(errors.New("Mock DB Error"))
+	mockDeleteClusterResources(mockPool, "name-foo")
+
+	mockPool.ExpectExec(`DELETE FROM "clusters" WHERE ("uid" = 'cluster__name-foo')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
 	//delete managed cluster:
 
 	processClusterDelete(context.Background(), obj)
 
 	columns := []string{"cluster"}
-	pgxRows := pgxpoolmock.NewRows(columns).AddRow("name-foo").AddRow("remaining-managed-foo").ToPgxRows()
+	pgxRows := pgxmock.NewRows(columns).AddRow("name-foo").AddRow("remaining-managed-foo")
 
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT DISTINCT "cluster" FROM "search"."resources"`),
-		gomock.Eq([]interface{}{}),
-	).Return(pgxRows, nil)
+	mockPool.ExpectQuery(`SELECT "cluster" FROM "resources" UNION (SELECT "name" FROM "clusters")`).
+		WillReturnRows(pgxRows)
 
 	// Execute function test
-	mc, _ := findStaleClusterResources(context.Background(), dynamicClient, *managedClusterGvr)
+	mc, _ := findStaleClusterResources(context.Background(), clusterClient)
 
 	//Once findStaleClusterResources is done, existingClustersCache should not have an entry for remaining-managed-foo
 	for _, c := range mc {
@@ -0,0 +1,126 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// HyperShift hosted clusters.
+// Adds the properties of the HostedCluster and its NodePools to the Cluster node of hosted control plane clusters.
+//   - hostingNamespace: namespace of the HostedCluster in the hosting cluster.
+//   - hostedControlPlaneAvailable: status of the HostedCluster Available condition.
+//   - nodePools: number of NodePools of the HostedCluster.
+//   - nodePoolReplicas: total replicas reported by the NodePools.
+// The ManagedCluster of a HostedCluster has the same name, unless it's set with the managedClusterNameAnnotation.
+
+const hypershiftGroupVersion = "hypershift.openshift.io/v1beta1"
+const managedClusterNameAnnotation = "cluster.open-cluster-management.io/managedcluster-name"
+
+// NodePool replicas by NodePool name, for each HostedCluster (namespace/name).
+var nodePools = map[string]map[string]int64{}
+
+// ManagedCluster name for each HostedCluster (namespace/name).
+var hostedClusterNames = map[string]string{}
+var hostedMux sync.Mutex
+
+func init() {
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "HostedCluster",
+		GVR:          "hostedclusters.v1beta1.hypershift.openshift.io",
+		GroupVersion: hypershiftGroupVersion,
+		Transform:    transformHostedCluster,
+	})
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "NodePool",
+		GVR:          "nodepools.v1beta1.hypershift.openshift.io",
+		GroupVersion: hypershiftGroupVersion,
+		Transform:    transformNodePool,
+		Delete:       deleteNodePool,
+	})
+}
+
+// Transform HostedCluster object into the properties of the Cluster node.
+func transformHostedCluster(obj *unstructured.Unstructured) (model.Resource, error) {
+	// https://github.com/openshift/hypershift/blob/main/api/hypershift/v1beta1/hostedcluster_types.go
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	clusterName := obj.GetName()
+	if name, ok := obj.GetAnnotations()[managedClusterNameAnnotation]; ok && name != "" {
+		clusterName = name
+	}
+
+	available := "Unknown"
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Available" {
+			available = fmt.Sprint(condition["status"])
+		}
+	}
+
+	hostedMux.Lock()
+	defer hostedMux.Unlock()
+	hostedClusterNames[key] = clusterName
+	props := nodePoolProperties(key)
+	props["hostingNamespace"] = obj.GetNamespace()
+	props["hostedControlPlaneAvailable"] = available
+	return clusterNode(clusterName, props), nil
+}
+
+// Transform NodePool object into the node pool properties of the Cluster node.
+func transformNodePool(obj *unstructured.Unstructured) (model.Resource, error) {
+	// https://github.com/openshift/hypershift/blob/main/api/hypershift/v1beta1/nodepool_types.go
+	hostedCluster, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterName")
+	if hostedCluster == "" {
+		return model.Resource{}, fmt.Errorf("NodePool %s/%s doesn't set spec.clusterName.", obj.GetNamespace(),
+			obj.GetName())
+	}
+	replicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+	key := obj.GetNamespace() + "/" + hostedCluster
+
+	hostedMux.Lock()
+	defer hostedMux.Unlock()
+	if nodePools[key] == nil {
+		nodePools[key] = map[string]int64{}
+	}
+	nodePools[key][obj.GetName()] = replicas
+	return clusterNode(hostedClusterName(key, hostedCluster), nodePoolProperties(key)), nil
+}
+
+// Removes the NodePool from the node pool properties of the Cluster node.
+func deleteNodePool(obj *unstructured.Unstructured) (model.Resource, error) {
+	hostedCluster, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterName")
+	key := obj.GetNamespace() + "/" + hostedCluster
+
+	hostedMux.Lock()
+	defer hostedMux.Unlock()
+	delete(nodePools[key], obj.GetName())
+	if len(nodePools[key]) == 0 {
+		delete(nodePools, key)
+	}
+	return clusterNode(hostedClusterName(key, hostedCluster), nodePoolProperties(key)), nil
+}
+
+// Returns the ManagedCluster name of the HostedCluster. The caller must hold hostedMux.
+func hostedClusterName(key, hostedCluster string) string {
+	if name, ok := hostedClusterNames[key]; ok {
+		return name
+	}
+	return hostedCluster
+}
+
+// Returns the node pool properties of the HostedCluster. The caller must hold hostedMux.
+func nodePoolProperties(key string) map[string]interface{} {
+	var replicas int64
+	for _, r := range nodePools[key] {
+		replicas += r
+	}
+	return map[string]interface{}{
+		"nodePools":        int64(len(nodePools[key])),
+		"nodePoolReplicas": replicas,
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newNodePool(name string, replicas int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": hypershiftGroupVersion,
+		"kind":       "NodePool",
+		"metadata":   map[string]interface{}{"namespace": "clusters", "name": name},
+		"spec":       map[string]interface{}{"clusterName": "hosted-a"},
+		"status":     map[string]interface{}{"replicas": replicas},
+	}}
+}
+
+// Should add the HostedCluster and NodePool properties to the Cluster node of the ManagedCluster.
+func Test_transformHostedCluster(t *testing.T) {
+	hostedCluster := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": hypershiftGroupVersion,
+		"kind":       "HostedCluster",
+		"metadata": map[string]interface{}{
+			"namespace":   "clusters",
+			"name":        "hosted-a",
+			"annotations": map[string]interface{}{managedClusterNameAnnotation: "managed-a"},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"type": "Available", "status": "True"}},
+		},
+	}}
+
+	resource, err := transformHostedCluster(hostedCluster)
+	assert.Nil(t, err)
+	assert.Equal(t, "cluster__managed-a", resource.UID)
+	assert.Equal(t, "clusters", resource.Properties["hostingNamespace"])
+	assert.Equal(t, "True", resource.Properties["hostedControlPlaneAvailable"])
+	assert.Equal(t, int64(0), resource.Properties["nodePools"])
+
+	_, err = transformNodePool(newNodePool("pool-1", 2))
+	assert.Nil(t, err)
+	resource, err = transformNodePool(newNodePool("pool-2", 3))
+	assert.Nil(t, err)
+	assert.Equal(t, "cluster__managed-a", resource.UID)
+	assert.Equal(t, int64(2), resource.Properties["nodePools"])
+	assert.Equal(t, int64(5), resource.Properties["nodePoolReplicas"])
+
+	resource, err = deleteNodePool(newNodePool("pool-1", 2))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), resource.Properties["nodePools"])
+	assert.Equal(t, int64(3), resource.Properties["nodePoolReplicas"])
+}
+
+// Should return an error for a NodePool without the HostedCluster name.
+func Test_transformNodePool_withoutClusterName(t *testing.T) {
+	nodePool := newNodePool("pool-1", 2)
+	unstructured.RemoveNestedField(nodePool.Object, "spec", "clusterName")
+
+	_, err := transformNodePool(nodePool)
+
+	assert.NotNil(t, err)
+}
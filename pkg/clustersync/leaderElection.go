@@ -4,9 +4,12 @@ package clustersync
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -15,7 +18,59 @@ import (
 	klog "k8s.io/klog/v2"
 )
 
-var leader string
+// Status of the leader election observed by this replica. Exposed with the search_indexer_leader metrics and the
+// /debug/leader endpoint, so operators can tell which replica runs the clustersync.
+type LeaderStatus struct {
+	Identity    string     `json:"identity"`              // Identity of this replica, the pod name.
+	Leader      string     `json:"leader"`                // Identity of the current leader. Empty if unknown.
+	IsLeader    bool       `json:"isLeader"`              // True while this replica holds the leader lease.
+	LeaderSince *time.Time `json:"leaderSince,omitempty"` // Time this replica observed the current leader.
+	Transitions int        `json:"transitions"`           // Leader changes observed by this replica.
+}
+
+var leaderStatus LeaderStatus
+var leaderMux sync.Mutex
+
+// Returns the status of the leader election.
+func GetLeaderStatus() LeaderStatus {
+	leaderMux.Lock()
+	defer leaderMux.Unlock()
+	status := leaderStatus
+	status.Identity = config.Cfg.PodName
+	return status
+}
+
+// Records the current leader. A change from a known leader counts as a transition.
+func setLeader(identity string) {
+	leaderMux.Lock()
+	defer leaderMux.Unlock()
+	if leaderStatus.Leader == identity {
+		return
+	}
+	if leaderStatus.Leader != "" {
+		leaderStatus.Transitions++
+		metrics.LeaderTransitions.Inc()
+	}
+	now := time.Now()
+	leaderStatus.Leader = identity
+	leaderStatus.LeaderSince = &now
+	metrics.Leader.Reset()
+	metrics.Leader.WithLabelValues(identity).Set(1)
+}
+
+// Records if this replica holds the leader lease. Returns the previous value.
+func setLeading(leading bool) bool {
+	leaderMux.Lock()
+	defer leaderMux.Unlock()
+	wasLeading := leaderStatus.IsLeader
+	leaderStatus.IsLeader = leading
+	if leading {
+		metrics.IsLeader.Set(1)
+	} else {
+		metrics.IsLeader.Set(0)
+	}
+	return wasLeading
+}
 
 func getNewLock(client *kubernetes.Clientset, lockname, podName, podNamespace string) *resourcelock.LeaseLock {
 	return &resourcelock.LeaseLock{
@@ -30,6 +85,8 @@ func getNewLock(client *kubernetes.Clientset, lockname, podName, podNamespace st
 	}
 }
 
+// Runs the leader election until the context is cancelled. The leader runs the leader tasks until it loses the
+// lease, then tries to become the leader again.
 func runLeaderElection(ctx context.Context, lock *resourcelock.LeaseLock, runLeaderTasks func(context.Context)) {
 	for {
 		select {
@@ -38,31 +95,68 @@ func runLeaderElection(ctx context.Context, lock *resourcelock.LeaseLock, runLea
 			return
 		default:
 			klog.V(1).Info("Attempting to become leader.")
-			leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-				Lock:            lock,
-				ReleaseOnCancel: true, // Releases the lock on context cancel.
-				LeaseDuration:   15 * time.Second,
-				RenewDeadline:   10 * time.Second,
-				RetryPeriod:     2 * time.Second,
-				Callbacks: leaderelection.LeaderCallbacks{
-					OnStartedLeading: func(c context.Context) {
-						klog.Info("I'm the leader! Starting leader activities.")
-						leader = config.Cfg.PodName
-						runLeaderTasks(c)
-					},
-					OnStoppedLeading: func() {
-						if leader == config.Cfg.PodName {
-							klog.Info("I'm no longer the leader.")
-						}
-					},
-					OnNewLeader: func(currentId string) {
-						if currentId != config.Cfg.PodName {
-							klog.Infof("Leader is %s", currentId)
-							leader = currentId
-						}
-					},
-				},
-			})
+			runElection(ctx, lock, runLeaderTasks)
 		}
 	}
 }
+
+// Runs one leader election, returns when the lease is lost or the context is cancelled. The election runs with its
+// own context, so on cancel the leader tasks are stopped before the lease is released. Otherwise, the next leader
+// could start the tasks while they are still running here.
+func runElection(ctx context.Context, lock *resourcelock.LeaseLock, runLeaderTasks func(context.Context)) {
+	electionCtx, cancelElection := context.WithCancel(context.Background())
+	defer cancelElection()
+	var leading atomic.Bool
+	tasksDone := make(chan struct{})
+
+	// Releases the lease after the leader tasks stop.
+	go func() {
+		select {
+		case <-ctx.Done():
+			if leading.Load() {
+				<-tasksDone
+			}
+			cancelElection()
+		case <-electionCtx.Done():
+		}
+	}()
+
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true, // Releases the lock on context cancel.
+		LeaseDuration:   time.Duration(config.Cfg.LeaderLeaseDuration) * time.Millisecond,
+		RenewDeadline:   time.Duration(config.Cfg.LeaderRenewDeadline) * time.Millisecond,
+		RetryPeriod:     time.Duration(config.Cfg.LeaderRetryPeriod) * time.Millisecond,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(c context.Context) {
+				leading.Store(true)
+				defer close(tasksDone)
+				// Stop the leader tasks when the lease is lost or the parent context is cancelled.
+				leaderCtx, cancelTasks := context.WithCancel(c)
+				defer cancelTasks()
+				go func() {
+					select {
+					case <-ctx.Done():
+						cancelTasks()
+					case <-leaderCtx.Done():
+					}
+				}()
+				klog.Info("I'm the leader! Starting leader activities.")
+				setLeading(true)
+				setLeader(config.Cfg.PodName)
+				runLeaderTasks(leaderCtx)
+			},
+			OnStoppedLeading: func() {
+				if setLeading(false) {
+					klog.Info("I'm no longer the leader.")
+				}
+			},
+			OnNewLeader: func(currentId string) {
+				if currentId != config.Cfg.PodName {
+					klog.Infof("Leader is %s", currentId)
+				}
+				setLeader(currentId)
+			},
+		},
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	fakeClient "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 )
@@ -45,3 +47,71 @@ func Test_runLeaderElectionAndCancel(t *testing.T) {
 		t.Error("Expected leader process to be cancelled.")
 	}
 }
+
+const testLockName = "search-indexer.open-cluster-management.io"
+
+func Test_runLeaderElection_releasesLease(t *testing.T) {
+	supressConsoleOutput()
+
+	mockClient := fakeClient.NewSimpleClientset()
+	lock := resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: testLockName, Namespace: "test-namespace"},
+		Client:     mockClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: "test-pod"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The leader tasks must stop before the lease is released.
+	tasksStopped := make(chan struct{})
+	leaderTasks := func(c context.Context) {
+		<-c.Done()
+		lease, err := mockClient.CoordinationV1().Leases("test-namespace").Get(context.Background(), testLockName,
+			metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "test-pod", *lease.Spec.HolderIdentity)
+		close(tasksStopped)
+	}
+	electionDone := make(chan struct{})
+	go func() {
+		runLeaderElection(ctx, &lock, leaderTasks)
+		close(electionDone)
+	}()
+
+	assert.Eventually(t, func() bool {
+		lease, err := mockClient.CoordinationV1().Leases("test-namespace").Get(context.Background(), testLockName,
+			metav1.GetOptions{})
+		return err == nil && lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == "test-pod"
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+
+	select {
+	case <-electionDone:
+	case <-time.After(time.Second):
+		t.Fatal("Expected leader election to exit after the context is cancelled.")
+	}
+	<-tasksStopped
+	lease, err := mockClient.CoordinationV1().Leases("test-namespace").Get(context.Background(), testLockName,
+		metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", *lease.Spec.HolderIdentity) // Released.
+}
+
+// Should record the current leader and count the leader changes.
+func Test_setLeader(t *testing.T) {
+	leaderMux.Lock()
+	leaderStatus = LeaderStatus{}
+	leaderMux.Unlock()
+
+	setLeader("pod-a")
+	setLeader("pod-a")
+	assert.Equal(t, 0, GetLeaderStatus().Transitions)
+	assert.False(t, setLeading(true))
+	setLeader("pod-b")
+
+	status := GetLeaderStatus()
+	assert.Equal(t, "pod-b", status.Leader)
+	assert.Equal(t, 1, status.Transitions)
+	assert.True(t, status.IsLeader)
+	assert.NotNil(t, status.LeaderSince)
+	assert.True(t, setLeading(false))
+}
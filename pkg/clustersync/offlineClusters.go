@@ -0,0 +1,133 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// Offline clusters.
+// A cluster can be offline due to resource shortage, network outage or other reasons. By default, the data of an
+// offline cluster is kept to avoid unnecessary deletes and re-inserts in the database. With
+// OFFLINE_CLUSTER_PURGE_GRACE_MS, the resources and edges of a cluster whose ManagedClusterConditionAvailable is
+// False or Unknown for longer than the grace period are deleted, and the Cluster node is kept with
+// resourcesPurged=true. When the cluster is available again, a resync is requested so the collector sends its
+// complete state on the next sync. The grace period starts at the last transition of the condition, so it survives
+// restarts and leader changes.
+
+type offlineCluster struct {
+	timer  *time.Timer
+	purged bool
+}
+
+var offlineClusters = map[string]*offlineCluster{}
+var offlineMux sync.Mutex
+
+// Schedules the purge of the cluster resources while the ManagedCluster is offline, or cancels it when the cluster
+// is available. Sets the resourcesPurged property of the Cluster node.
+func trackOfflineCluster(ctx context.Context, managedCluster *clusterv1.ManagedCluster,
+	props map[string]interface{}) {
+	grace := time.Duration(config.Cfg.OfflinePurgeGrace) * time.Millisecond
+	if grace <= 0 {
+		return
+	}
+	clusterName := managedCluster.GetName()
+	available, since := clusterAvailable(managedCluster)
+	// Purged before a restart, the Cluster node has the last value written.
+	purged := props["resourcesPurged"] == true
+
+	offlineMux.Lock()
+	defer offlineMux.Unlock()
+	offline, tracked := offlineClusters[clusterName]
+	if tracked {
+		purged = purged || offline.purged
+	}
+	if available {
+		if tracked {
+			offline.timer.Stop()
+			delete(offlineClusters, clusterName)
+		}
+		if purged {
+			klog.Infof("Cluster %s is available again. Requesting a resync of the purged resources.", clusterName)
+			requestClusterResync(ctx, clusterName)
+		}
+		props["resourcesPurged"] = false
+		return
+	}
+	if !tracked {
+		offline = &offlineCluster{purged: purged}
+		wait := time.Until(since.Add(grace))
+		klog.Infof("Cluster %s is offline. Deleting its resources in %s unless it's available again.", clusterName,
+			wait.Round(time.Second))
+		offline.timer = time.AfterFunc(wait, func() { purgeOfflineCluster(ctx, clusterName, offline) })
+		offlineClusters[clusterName] = offline
+	}
+	props["resourcesPurged"] = offline.purged
+}
+
+// Stops tracking the cluster when the ManagedCluster is deleted.
+func stopOfflineTracking(clusterName string) {
+	offlineMux.Lock()
+	defer offlineMux.Unlock()
+	if offline, ok := offlineClusters[clusterName]; ok {
+		offline.timer.Stop()
+		delete(offlineClusters, clusterName)
+	}
+}
+
+// Stops tracking all the clusters when the leader lease is lost. The next leader tracks the offline clusters from
+// the last transition of their condition.
+func stopAllOfflineTracking() {
+	offlineMux.Lock()
+	defer offlineMux.Unlock()
+	for clusterName, offline := range offlineClusters {
+		offline.timer.Stop()
+		delete(offlineClusters, clusterName)
+	}
+}
+
+// Deletes the resources and edges of the cluster, keeping the Cluster node.
+func purgeOfflineCluster(ctx context.Context, clusterName string, offline *offlineCluster) {
+	offlineMux.Lock()
+	if offlineClusters[clusterName] != offline || offline.purged || ctx.Err() != nil {
+		offlineMux.Unlock()
+		return // Available again, deleted, or lost the leader lease.
+	}
+	offline.purged = true
+	offlineMux.Unlock()
+
+	start := time.Now()
+	dao.DeleteClusterAndResources(ctx, clusterName, false)
+	dao.UpsertCluster(ctx, clusterNode(clusterName, map[string]interface{}{"resourcesPurged": true}))
+	klog.Infof("Cluster %s was offline for longer than the grace period. Deleted its resources. Took: %s",
+		clusterName, time.Since(start).Round(time.Millisecond))
+}
+
+// Returns true if the ManagedClusterConditionAvailable is True, and the time of its last transition.
+func clusterAvailable(managedCluster *clusterv1.ManagedCluster) (bool, time.Time) {
+	condition := meta.FindStatusCondition(managedCluster.Status.Conditions, clusterv1.ManagedClusterConditionAvailable)
+	if condition == nil {
+		return false, time.Now() // The condition isn't reported yet.
+	}
+	since := condition.LastTransitionTime.Time
+	if since.IsZero() {
+		since = time.Now()
+	}
+	return condition.Status == metav1.ConditionTrue, since
+}
+
+// Asks the collector to send its complete state on the next sync.
+func requestClusterResync(ctx context.Context, clusterName string) {
+	if postgresDAO, ok := dao.(*database.DAO); ok {
+		_ = postgresDAO.RequestResync(ctx, []string{clusterName})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func newManagedClusterWithAvailable(status string, transition time.Time) *clusterv1.ManagedCluster {
+	return &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "name-foo"},
+		Status: clusterv1.ManagedClusterStatus{Conditions: []metav1.Condition{{
+			Type:               clusterv1.ManagedClusterConditionAvailable,
+			Status:             metav1.ConditionStatus(status),
+			LastTransitionTime: metav1.NewTime(transition),
+		}}},
+	}
+}
+
+func newMemoryStoreWithResource(clusterName string) *memory.Store {
+	store := newMemoryStoreWithCluster(clusterName)
+	err := store.SyncData(context.Background(), model.SyncEvent{
+		AddResources: []model.Resource{{UID: "pod-uid", Kind: "Pod", Properties: map[string]interface{}{}}},
+	}, clusterName, &model.SyncResponse{})
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func clusterResources(t *testing.T, store *memory.Store) int {
+	resources, _, err := store.ClusterTotals(context.Background(), "name-foo")
+	assert.Nil(t, err)
+	return resources
+}
+
+// Should delete the resources and keep the Cluster node when the cluster stays offline past the grace period.
+func Test_trackOfflineCluster_purge(t *testing.T) {
+	config.Cfg.OfflinePurgeGrace = 20
+	defer func() { config.Cfg.OfflinePurgeGrace = 0 }()
+	store := newMemoryStoreWithResource("name-foo")
+
+	props := map[string]interface{}{}
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("Unknown", time.Now()), props)
+
+	assert.Equal(t, false, props["resourcesPurged"])
+	assert.Equal(t, 1, clusterResources(t, store))
+	assert.Eventually(t, func() bool { return clusterResources(t, store) == 0 }, time.Second, 5*time.Millisecond)
+	assert.Contains(t, managedClusters(t, store), "name-foo")
+
+	// Reconnects.
+	props = map[string]interface{}{}
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("True", time.Now()), props)
+	assert.Equal(t, false, props["resourcesPurged"])
+	assert.NotContains(t, offlineClusters, "name-foo")
+}
+
+// Should keep the resources when the cluster is available again within the grace period.
+func Test_trackOfflineCluster_availableAgain(t *testing.T) {
+	config.Cfg.OfflinePurgeGrace = 20
+	defer func() { config.Cfg.OfflinePurgeGrace = 0 }()
+	store := newMemoryStoreWithResource("name-foo")
+
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("False", time.Now()),
+		map[string]interface{}{})
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("True", time.Now()),
+		map[string]interface{}{})
+	time.Sleep(40 * time.Millisecond)
+
+	assert.Equal(t, 1, clusterResources(t, store))
+}
+
+// Should use the last transition of the condition, so a cluster offline before a restart is purged immediately.
+func Test_trackOfflineCluster_offlineBeforeRestart(t *testing.T) {
+	config.Cfg.OfflinePurgeGrace = 60 * 1000
+	defer func() { config.Cfg.OfflinePurgeGrace = 0 }()
+	store := newMemoryStoreWithResource("name-foo")
+
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("False", time.Now().Add(-time.Hour)),
+		map[string]interface{}{})
+
+	assert.Eventually(t, func() bool { return clusterResources(t, store) == 0 }, time.Second, 5*time.Millisecond)
+	stopOfflineTracking("name-foo")
+}
+
+// Should keep the data of offline clusters when the grace period isn't set.
+func Test_trackOfflineCluster_disabled(t *testing.T) {
+	props := map[string]interface{}{}
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("False", time.Now().Add(-time.Hour)),
+		props)
+
+	assert.NotContains(t, props, "resourcesPurged")
+	assert.NotContains(t, offlineClusters, "name-foo")
+}
+
+// Should stop the purge timers when the leader lease is lost.
+func Test_stopAllOfflineTracking(t *testing.T) {
+	config.Cfg.OfflinePurgeGrace = 20
+	defer func() { config.Cfg.OfflinePurgeGrace = 0 }()
+	store := newMemoryStoreWithResource("name-foo")
+
+	trackOfflineCluster(context.Background(), newManagedClusterWithAvailable("False", time.Now()),
+		map[string]interface{}{})
+	stopAllOfflineTracking()
+	time.Sleep(40 * time.Millisecond)
+
+	assert.Equal(t, 1, clusterResources(t, store))
+	assert.Empty(t, offlineClusters)
+}
@@ -0,0 +1,93 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	klog "k8s.io/klog/v2"
+)
+
+// Readiness.
+// When a replica becomes the leader, the Cluster nodes are written after the informers list the existing objects and
+// the queue processes the events. Until then, the sync requests of the clusters would be checked against an
+// incomplete list of Cluster nodes, so the leader isn't ready until:
+//   - Each informer delivered the events of the initial list. The informers of missing resources are skipped.
+//   - The event queue processed these events.
+// The other replicas don't run the informers and are always ready.
+
+const initialSyncPollInterval = 100 * time.Millisecond
+
+var initialSyncPending atomic.Bool // True while the leader waits for the initial sync.
+
+// Returns false while this replica is the leader and the initial sync of the hub resources isn't complete.
+// Used by the readiness probe, must not allocate.
+func Ready() bool {
+	return !initialSyncPending.Load()
+}
+
+// Tracks the informers of the initial sync.
+type initialSync struct {
+	informers []*informerSync
+	mux       sync.Mutex
+}
+
+type informerSync struct {
+	kind         string
+	registration cache.ResourceEventHandlerRegistration
+	discovered   bool // The first check of the resource is complete.
+	running      bool // The resource exists and the informer was started.
+}
+
+// Adds the informer with its event handler registration. Returns the function to call after the first check of the
+// resource, see stopAndStartInformer().
+func (s *initialSync) add(kind string, registration cache.ResourceEventHandlerRegistration) func(running bool) {
+	informer := &informerSync{kind: kind, registration: registration}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.informers = append(s.informers, informer)
+	return func(running bool) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		informer.discovered = true
+		informer.running = running
+	}
+}
+
+// Returns true after the handlers of all running informers received the events of the initial list.
+func (s *initialSync) synced() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, informer := range s.informers {
+		if !informer.discovered {
+			return false
+		}
+		if informer.running && informer.registration != nil && !informer.registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Marks this replica ready after the informers synced and the queue processed the initial events.
+func waitForInitialSync(ctx context.Context, initial *initialSync, events *clusterEventQueue) {
+	start := time.Now()
+	ticker := time.NewTicker(initialSyncPollInterval)
+	defer ticker.Stop()
+	for {
+		if initial.synced() && events.idle() {
+			klog.Infof("Initial sync of the hub resources completed in %s.", time.Since(start))
+			initialSyncPending.Store(false)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
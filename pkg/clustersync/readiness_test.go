@@ -0,0 +1,50 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRegistration struct{ synced bool }
+
+func (f *fakeRegistration) HasSynced() bool { return f.synced }
+
+// Should be synced after each informer is discovered and the running informers delivered the initial events.
+func Test_initialSync_synced(t *testing.T) {
+	initial := &initialSync{}
+	registration := &fakeRegistration{}
+	onDiscoveredA := initial.add("ManagedCluster", registration)
+	onDiscoveredB := initial.add("HostedCluster", &fakeRegistration{})
+
+	assert.False(t, initial.synced(), "Expected to wait for the first check of the resources.")
+	onDiscoveredA(true)
+	onDiscoveredB(false) // CRD missing, the informer isn't started.
+	assert.False(t, initial.synced(), "Expected to wait for the ManagedCluster informer.")
+	registration.synced = true
+	assert.True(t, initial.synced())
+}
+
+// Should be ready after the initial sync and the queued events are processed.
+func Test_waitForInitialSync(t *testing.T) {
+	initialSyncPending.Store(true)
+	defer initialSyncPending.Store(false)
+	events, _ := newRecordingQueue()
+	events.add(newQueueObject("ManagedClusterAddOn", "cluster-a", "addon-a", "1"), false)
+	initial := &initialSync{}
+	initial.add("ManagedCluster", &fakeRegistration{synced: true})(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go waitForInitialSync(ctx, initial, events)
+
+	time.Sleep(2 * initialSyncPollInterval)
+	assert.False(t, Ready(), "Expected not ready while the queue has events.")
+
+	go events.run(ctx, 1)
+	assert.Eventually(t, Ready, time.Second, 10*time.Millisecond)
+}
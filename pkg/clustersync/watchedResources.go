@@ -0,0 +1,98 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	clusterv1beta1 "github.com/stolostron/multicloud-operators-foundation/pkg/apis/internal.open-cluster-management.io/v1beta1"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Watched hub resources.
+// The cluster watch creates an informer for each registered hub resource. When the resource is added or updated,
+// the Transform function returns the Cluster node to upsert. ManagedCluster, ManagedClusterInfo, ManagedClusterAddOn,
+// the HyperShift resources in hostedCluster.go, and the ManagedClusterSet resources in clusterSets.go are
+// registered by default. ManagedCluster is watched with the generated typed informer and written by
+// processManagedClusterUpsert(), the other resources are watched with dynamic informers.
+// Downstream distributions can index additional hub-side cluster metadata with RegisterWatchedResource() before
+// ElectLeaderAndStart.
+
+// Transforms a hub resource into the Cluster node written to the database.
+type TransformFunc func(obj *unstructured.Unstructured) (model.Resource, error)
+
+type WatchedResource struct {
+	Kind          string        // Kind of the hub resource, e.g. ManagedCluster
+	GVR           string        // Resource in the format resource.version.group, e.g. managedclusters.v1.cluster...
+	GroupVersion  string        // Used to check that the resource is installed, e.g. cluster.open-cluster-management.io/v1
+	FieldSelector string        // Optional. Watch only the objects matching the selector.
+	Transform     TransformFunc // Optional. Resources without a transform don't write the Cluster node.
+	Delete        TransformFunc // Optional. Returns the Cluster node to write when the resource is deleted.
+}
+
+var watchedResources = map[string]WatchedResource{}
+var watchedMux sync.Mutex
+
+func init() {
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "ManagedCluster",
+		GVR:          managedClusterGVR,
+		GroupVersion: "cluster.open-cluster-management.io/v1",
+	})
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "ManagedClusterInfo",
+		GVR:          managedClusterInfoGVR,
+		GroupVersion: "internal.open-cluster-management.io/v1beta1",
+		Transform: func(obj *unstructured.Unstructured) (model.Resource, error) {
+			managedClusterInfo := clusterv1beta1.ManagedClusterInfo{}
+			if err := fromUnstructured(obj, &managedClusterInfo); err != nil {
+				return model.Resource{}, err
+			}
+			return transformManagedClusterInfo(&managedClusterInfo), nil
+		},
+	})
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "ManagedClusterAddOn",
+		GVR:          managedClusterAddonGVR,
+		GroupVersion: "addon.open-cluster-management.io/v1alpha1",
+	})
+}
+
+// Adds or replaces the hub resource watched by the cluster watch. Must be called before ElectLeaderAndStart.
+func RegisterWatchedResource(resource WatchedResource) {
+	watchedMux.Lock()
+	defer watchedMux.Unlock()
+	watchedResources[resource.Kind] = resource
+}
+
+// Returns the registered hub resource for the kind.
+func watchedResource(kind string) (WatchedResource, bool) {
+	watchedMux.Lock()
+	defer watchedMux.Unlock()
+	resource, ok := watchedResources[kind]
+	return resource, ok
+}
+
+// Returns the registered hub resources, sorted by kind.
+func listWatchedResources() []WatchedResource {
+	watchedMux.Lock()
+	defer watchedMux.Unlock()
+	resources := make([]WatchedResource, 0, len(watchedResources))
+	for _, resource := range watchedResources {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Kind < resources[j].Kind })
+	return resources
+}
+
+// Converts the object from the dynamic informer into the typed struct, without a JSON round trip.
+func fromUnstructured(obj *unstructured.Unstructured, into interface{}) error {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, into); err != nil {
+		return fmt.Errorf("Failed to convert %s %s. %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package clustersync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Should register the default hub resources.
+func Test_listWatchedResources(t *testing.T) {
+	kinds := []string{}
+	for _, watched := range listWatchedResources() {
+		kinds = append(kinds, watched.Kind)
+	}
+
+	assert.Equal(t, []string{"HostedCluster", "ManagedCluster", "ManagedClusterAddOn", "ManagedClusterInfo",
+		"ManagedClusterSet", "ManagedClusterSetBinding", "NodePool"}, kinds)
+}
+
+// Should upsert the Cluster node returned by the transform of a registered resource.
+func Test_RegisterWatchedResource(t *testing.T) {
+	RegisterWatchedResource(WatchedResource{
+		Kind:         "ClusterClaim",
+		GVR:          "clusterclaims.v1alpha1.cluster.open-cluster-management.io",
+		GroupVersion: "cluster.open-cluster-management.io/v1alpha1",
+		Transform: func(obj *unstructured.Unstructured) (model.Resource, error) {
+			return model.Resource{Kind: "Cluster", UID: "cluster__" + obj.GetNamespace(),
+				Properties: map[string]interface{}{"name": obj.GetNamespace(), "claim": obj.GetName()}}, nil
+		},
+	})
+	defer func() {
+		watchedMux.Lock()
+		delete(watchedResources, "ClusterClaim")
+		watchedMux.Unlock()
+	}()
+	store := newMemoryStoreWithCluster("other-cluster")
+
+	processClusterUpsert(context.Background(),
+		newTestUnstructured("cluster.open-cluster-management.io/v1alpha1", "ClusterClaim", "name-foo", "id", "uid"))
+
+	assert.ElementsMatch(t, []string{"other-cluster", "name-foo"}, managedClusters(t, store))
+}
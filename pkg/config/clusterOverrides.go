@@ -0,0 +1,112 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Per-cluster overrides.
+// With CLUSTER_OVERRIDES_CONFIGMAP, the indexer watches the ConfigMap in POD_NAMESPACE and applies its overrides to
+// the sync requests of each cluster. Each key is a cluster name, and the value is YAML with the overrides:
+//   - paused: true               The sync requests are rejected, and the collector retries later.
+//   - requestsPerMinute: 6       Max sync requests accepted per minute.
+//   - maxRequestSize: 10485760   Max size of the request body in bytes.
+//   - stripProperties: status    STRIP_PROPERTIES rules added to the global rules. Only with Postgres.
+// The changes apply to the next request. The clusters without a key use the global settings. A key with an invalid
+// value is logged and ignored.
+
+// Overrides of the sync policy for a cluster. The zero value keeps the global settings.
+type ClusterOverride struct {
+	Paused            bool   `json:"paused"`
+	RequestsPerMinute int    `json:"requestsPerMinute"`
+	MaxRequestSize    int64  `json:"maxRequestSize"`
+	StripProperties   string `json:"stripProperties"`
+}
+
+var clusterOverrides atomic.Pointer[map[string]ClusterOverride]
+
+// Returns the overrides of the cluster.
+func ClusterOverrideFor(clusterName string) ClusterOverride {
+	if overrides := clusterOverrides.Load(); overrides != nil {
+		return (*overrides)[clusterName]
+	}
+	return ClusterOverride{}
+}
+
+// Replaces the overrides of all the clusters. Use nil to remove them.
+func SetClusterOverrides(overrides map[string]ClusterOverride) {
+	clusterOverrides.Store(&overrides)
+}
+
+// Watches the CLUSTER_OVERRIDES_CONFIGMAP until the context is cancelled.
+func WatchClusterOverrides(ctx context.Context, client kubernetes.Interface) {
+	klog.Infof("Watching the per-cluster overrides in ConfigMap %s/%s.", Cfg.PodNamespace, Cfg.ClusterOverrides)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(Cfg.PodNamespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", Cfg.ClusterOverrides).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if configMap, ok := obj.(*corev1.ConfigMap); ok {
+				SetClusterOverrides(parseClusterOverrides(configMap.Data))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if configMap, ok := newObj.(*corev1.ConfigMap); ok {
+				SetClusterOverrides(parseClusterOverrides(configMap.Data))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			klog.Info("The per-cluster overrides ConfigMap was deleted. Using the global settings for all clusters.")
+			SetClusterOverrides(nil)
+		},
+	})
+	informer.Run(ctx.Done())
+}
+
+// Parses the overrides of each cluster from the ConfigMap data.
+func parseClusterOverrides(data map[string]string) map[string]ClusterOverride {
+	overrides := make(map[string]ClusterOverride, len(data))
+	for clusterName, value := range data {
+		override, err := parseClusterOverride(value)
+		if err != nil {
+			klog.Errorf("Ignoring the overrides of cluster %s. %s", clusterName, err)
+			continue
+		}
+		overrides[clusterName] = override
+	}
+	klog.V(2).Infof("Loaded the overrides of %d clusters.", len(overrides))
+	return overrides
+}
+
+func parseClusterOverride(value string) (ClusterOverride, error) {
+	var override ClusterOverride
+	if err := yaml.UnmarshalStrict([]byte(value), &override); err != nil {
+		return override, err
+	}
+	if override.RequestsPerMinute < 0 || override.MaxRequestSize < 0 {
+		return override, fmt.Errorf("requestsPerMinute and maxRequestSize must be >= 0.")
+	}
+	for _, rule := range strings.Split(override.StripProperties, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" && !stripRuleRegex.MatchString(rule) {
+			return override, fmt.Errorf("Invalid stripProperties rule [%s]. Must be one of: name, name[key], name[:N].",
+				rule)
+		}
+	}
+	return override, nil
+}
@@ -0,0 +1,49 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Should parse the overrides of each cluster, and ignore the invalid values.
+func Test_parseClusterOverrides(t *testing.T) {
+	overrides := parseClusterOverrides(map[string]string{
+		"cluster-a": "paused: true\nrequestsPerMinute: 6\nmaxRequestSize: 1024\nstripProperties: status,label[app]",
+		"cluster-b": "requestsPerMinute: -1",
+		"cluster-c": "unknown: true",
+		"cluster-d": "stripProperties: label[",
+	})
+
+	assert.Equal(t, map[string]ClusterOverride{"cluster-a": {Paused: true, RequestsPerMinute: 6, MaxRequestSize: 1024,
+		StripProperties: "status,label[app]"}}, overrides)
+}
+
+// Should apply the overrides from the ConfigMap, and remove them when the ConfigMap is deleted.
+func Test_WatchClusterOverrides(t *testing.T) {
+	Cfg.ClusterOverrides = "search-cluster-overrides"
+	defer func() { Cfg.ClusterOverrides = ""; SetClusterOverrides(nil) }()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "search-cluster-overrides", Namespace: Cfg.PodNamespace},
+		Data:       map[string]string{"cluster-a": "paused: true"},
+	}
+	client := fake.NewSimpleClientset(configMap)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go WatchClusterOverrides(ctx, client)
+
+	assert.Eventually(t, func() bool { return ClusterOverrideFor("cluster-a").Paused }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ClusterOverride{}, ClusterOverrideFor("cluster-b"))
+
+	_ = client.CoreV1().ConfigMaps(Cfg.PodNamespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+	assert.Eventually(t, func() bool { return !ClusterOverrideFor("cluster-a").Paused }, 5*time.Second,
+		10*time.Millisecond)
+}
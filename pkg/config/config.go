@@ -5,55 +5,234 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/url"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
 const COMPONENT_VERSION = "2.13.0"
 
+// Properties that inflate the resource data and aren't useful for search.
+const defaultStripProperties = "managedFields,annotation[kubectl.kubernetes.io/last-applied-configuration]"
+
 var DEVELOPMENT_MODE = false // Do not change this. See config_development.go to enable.
 var Cfg = new()
 
 // Struct to hold our configuratioin
 type Config struct {
-	DBBatchSize         int // Batch size used to write to DB. Default: 500
-	DBHealthCkeckPeriod int // Overrides pgxpool.Config{ HealthCheckPeriod } Default: 1 min
-	DBHost              string
-	DBMinConns          int32 // Overrides pgxpool.Config{ MinConns } Default: 0
-	DBMaxConns          int32 // Overrides pgxpool.Config{ MaxConns } Default: 20
-	DBMaxConnIdleTime   int   // Overrides pgxpool.Config{ MaxConnIdleTime } Default: 30 min
-	DBMaxConnLifeTime   int   // Overrides pgxpool.Config{ MaxConnLifetime } Default: 60 min
-	DBMaxConnLifeJitter int   // Overrides pgxpool.Config{ MaxConnLifetimeJitter } Default: 2 min
+	AWSRegion           string // AWS region of the RDS database. Used with DB_IAM_AUTH.
+	BackpressureBatches int    // Reject sync requests with 503 above this number of in-flight batches. Default: 64
+	BackpressureLatency int    // Reject sync requests with 503 above this average batch latency in ms. Default: 10000
+	ClusterCacheSyncMS  int    // Time in MS to reconcile the clusters cache with the database. Default: 10 min
+	ClusterCacheTTL     int    // Time in MS to keep a Cluster node in the clusters cache. Default: 1 hour
+	ClusterDeleteGrace  int    // Time in MS to wait before deleting the data of a deleted cluster. Default: 0
+	ClusterEventQPS     int    // Max ManagedCluster, ManagedClusterInfo, etc. events processed per second. Default: 100
+	ClusterEventWorkers int    // Workers processing the events of the hub cluster resources. Default: 4
+	ClusterFinalizer    bool   // Add a finalizer to the ManagedClusters, so the delete waits for the data cleanup.
+	ClusterOverrides    string // ConfigMap with per-cluster overrides of the sync policy. See clusterOverrides.go
+	ClusterSelector     string // Label selector for the ManagedClusters to index, e.g. vendor=OpenShift. Default: all
+	ClusterTotalsTTL    int    // Time in MS to use the cluster totals kept in memory before counting again. Default: 0
+	ConsistencyCheckMS  int    // Time in MS to compare the data with the collector totals. Default: 0 (disabled)
+	ConfigFile          string // YAML or JSON file with the settings, overridden by the environment. See configFile.go
+	ConfigReloadDir     string // Directory with a mounted ConfigMap with the tunables to reload. See reload.go
+	ConsistencyResync   bool   // Request a resync from the clusters that failed the consistency check.
+	DBBatchAdaptive     bool   // Adjust the batch size to the batch latency. See database/adaptiveBatch.go
+	DBBatchLingerMS     int    // Max time in ms to hold a partially filled batch before writing it. Default: 0 (disabled)
+	DBBatchMaxSize      int    // Max batch size with DB_BATCH_ADAPTIVE. Default: 10000
+	DBBatchMinSize      int    // Min batch size with DB_BATCH_ADAPTIVE. Default: 100
+	DBBatchSize         int    // Batch size used to write to DB. Default: 500
+	DBBatchTargetMS     int    // Batch latency in ms to stay under with DB_BATCH_ADAPTIVE. Default: 1000
+	DBBatchWorkers      int    // Max concurrent batches sent to the DB for all requests. Default: 8
+	DBCompressThreshold int    // Rows larger than this size in bytes are compressed (toast_tuple_target). Default: 0
+	DBCompression       string // Compression of the resource data, pglz or lz4. Default: "" (server default)
+	DBCopyThreshold     int    // Use COPY protocol to insert rows during resync if reaching this number. Default: 10000
+	DBHealthCkeckPeriod int    // Overrides pgxpool.Config{ HealthCheckPeriod } Default: 1 min
+	DBHost              string // Comma-separated list of hosts tried in order for failover, or a unix socket directory.
+	DBIAMAuth           bool   // Authenticate with an AWS RDS IAM auth token instead of password.
+	DBMinConns          int32  // Overrides pgxpool.Config{ MinConns } Default: 0
+	DBMaxConns          int32  // Overrides pgxpool.Config{ MaxConns } Default: 20
+	DBMaxConnIdleTime   int    // Overrides pgxpool.Config{ MaxConnIdleTime } Default: 30 min
+	DBMaxConnLifeTime   int    // Overrides pgxpool.Config{ MaxConnLifetime } Default: 60 min
+	DBMaxConnLifeJitter int    // Overrides pgxpool.Config{ MaxConnLifetimeJitter } Default: 2 min
 	DBName              string
+	DBOutageBuffer      int // Max batch items kept in memory during a DB outage. Default: 0 (disabled)
 	DBPass              string
+	DBPassFile          string // Path to the password in a mounted Secret. See database/credentialFiles.go
 	DBPort              int
+	DBRequestWorkers    int    // Max concurrent batches sent to the DB for a single request. Default: 4
+	DBSchema            string // Schema for the search tables. Use one per hub sharing the database. Default: search
+	DBSSLCert           string // Path to the client certificate. Used for certificate authentication instead of password.
+	DBSSLKey            string // Path to the client certificate key.
+	DBSSLMode           string // Postgres sslmode. Default: require
+	DBSSLRootCert       string // Path to the CA certificate used to verify the Postgres server certificate.
+	DBStatementTimeout  int    // Max time in ms for a database operation. Default: 5 min
+	DBStmtCacheCapacity int    // Max prepared statements cached per connection. Default: 512
+	DBStmtCacheMode     string // pgx statement cache mode, prepare or describe. Default: prepare
 	DBUser              string
+	DBUserFile          string
+	DataGINIndex        bool // Create a jsonb_path_ops GIN index over the entire data column. Default: false
+	DataGINMaxSizeMB    int  // Skip creating the data GIN index when search.resources is larger. Default: 10240
+	DeadLetter          bool // Save batch items that fail permanently in search.dead_letter. Default: false
+	DeadLetterMaxRows   int  // Max items kept in search.dead_letter, the oldest are deleted. Default: 10000
+	DeadLetterRetention int  // Hours to keep the items in search.dead_letter. Default: 168 (7 days)
+	DeferEdges          bool // Write the edges after their source and destination resources. Default: false
 	DevelopmentMode     bool
-	HTTPTimeout         int // Timeout for http server connections. Default: 5 min
+	EventTransport      string // Transport of the resource changes: kafka or nats. Default: kafka
+	FeatureGates        string // Comma-separated <feature>=<true|false> for the subsystems. See featureGates.go
+	FederationHubs      string // Comma-separated hubs allowed to send their cluster data. See database/federation.go
+	FederationHubUsers  string // Comma-separated hub=user, the Kubernetes user authenticating each hub.
+	FullTextSearch      bool   // Maintain the search_text tsvector column used for full-text search.
+	HistoryEnabled      bool   // Record previous versions of resources in search.resources_history.
+	HistoryRetention    int    // Hours to keep the resource history. Default: 168 (7 days)
+	HTTP2Enabled        bool   // Enable HTTP/2 so collectors can multiplex requests over one connection.
+	HTTPTimeout         int    // Timeout for http server connections. Default: 5 min
+	IndexDefinitions    string // JSON list of additional indexes created at startup. See database/indexes.go
+	IndexDropUndeclared bool   // Drop the indexes removed from INDEX_DEFINITIONS.
+	KafkaBrokers        string // Kafka brokers, comma separated. Publishes to the brokers instead of the REST Proxy.
+	KafkaCACert         string // Path to the CA certificate used to verify the Kafka REST Proxy or broker certificates.
+	KafkaClientCert     string // Path to the client certificate for mutual TLS with the Kafka REST Proxy or brokers.
+	KafkaClientKey      string
+	KafkaGroup          string // Kafka consumer group of the indexer replicas. Default: search-indexer
+	KafkaMaxRetry       int    // Attempts to publish a batch of changes to Kafka before dropping it. Default: 3
+	KafkaKey            string // Key of the changes: uid (<cluster>/<uid>) or cluster. Default: uid
+	KafkaOutbox         bool   // Publish the changes to Kafka from search.outbox, written with the resources.
+	KafkaOAuthClientID  string // OAuth client for the bearer tokens sent to the Kafka REST Proxy.
+	KafkaOAuthScope     string // Space separated OAuth scopes requested for the Kafka tokens.
+	KafkaOAuthSecret    string
+	KafkaOAuthTokenURL  string // OAuth token endpoint. Sends a bearer token instead of KAFKA_REST_USER when set.
+	KafkaPartition      int    // Kafka partition for the changes with KAFKA_PARTITIONER=fixed. Default: -1
+	KafkaPartitioner    string // How the changes are partitioned: key, fixed, or random. Default: key
+	KafkaRestPass       string // Sent with KAFKA_REST_USER, the REST Proxy can use them as SASL/SCRAM credentials.
+	KafkaRestURL        string // Kafka REST Proxy URL. Publishes the resource changes to Kafka when set.
+	KafkaRestUser       string
+	KafkaSASLMechanism  string // SASL of the KAFKA_BROKERS: SCRAM-SHA-256, SCRAM-SHA-512, or OAUTHBEARER.
+	KafkaSASLPass       string
+	KafkaSASLUser       string // SASL/SCRAM user of the KAFKA_BROKERS.
+	KafkaSyncTopic      string // Topic prefix with the sync events from the collectors. See kafka/consumer.go
+	KafkaTLS            bool   // Connect to the KAFKA_BROKERS with TLS. Default: false
+	KafkaTopic          string // Topic for the changes, can include {clusterName}. Default: search-changes
 	KubeClient          *kubernetes.Clientset
 	KubeConfigPath      string
-	MaxBackoffMS        int // Maximum backoff in ms to wait after db connection error
+	LeaderLeaseDuration int    // Time in MS that non-leaders wait before taking over the lease. Default: 15000
+	LeaderLockName      string // Name of the leader election Lease. Use one per indexer deployment in a namespace.
+	LeaderRenewDeadline int    // Time in MS the leader retries to renew the lease before giving up. Default: 10000
+	LeaderRetryPeriod   int    // Time in MS to wait between attempts to acquire or renew the lease. Default: 2000
+	MaintenanceMS       int    // Time in MS to check if the search tables need VACUUM or ANALYZE. Default: 0 (disabled)
+	MaintenancePct      int    // Dead or modified rows, in percent of the live rows, to run the maintenance. Default: 20
+	MaxBackoffMS        int    // Maximum backoff in ms to wait after db connection error
+	MaxPropertySize     int    // Max bytes of a property value. Default: 0 (disabled)
+	MaxResourceSize     int    // Max bytes of the resource data. Default: 0 (disabled)
+	NatsCACert          string // Path to the CA certificate used to verify the NATS server certificate.
+	NatsMaxRetry        int    // Attempts to publish a batch of changes to NATS before dropping it. Default: 3
+	NatsOutbox          bool   // Publish the changes to NATS from search.outbox, written with the resources.
+	NatsPass            string
+	NatsSubject         string // Subject for the changes, can include {clusterName}. See events/nats/publisher.go
+	NatsURL             string // NATS URL. Publishes the resource changes to JetStream with EVENT_TRANSPORT=nats
+	NatsUser            string
+	NotifyChanges       bool   // NOTIFY a per-cluster channel after writing the changes from a sync request.
+	OfflinePurgeGrace   int    // Time in MS a cluster can be offline before its resources are deleted. Default: 0
+	OpenSearchCACert    string // Path to the CA certificate used to verify the OpenSearch server certificate.
+	OpenSearchIndex     string // Prefix of the OpenSearch indices. Default: search
+	OpenSearchPass      string
+	OpenSearchURL       string // OpenSearch or Elasticsearch URL. Required when STORAGE_BACKEND=opensearch
+	OpenSearchUser      string
+	OrphanEdgeCleanupMS int    // Time in MS to delete the edges to resources that don't exist. Default: 0 (disabled)
+	OversizedResources  string // Action for resources over the size limits, truncate or reject. Default: truncate
 	PodName             string
 	PodNamespace        string
+	PublishSelector     string // Label selector for the properties of the published changes. See kafka/filter.go
+	PublishSkipClusters string // Patterns matching the clusters with the changes not published.
+	PublishSkipKinds    string // Kinds with the changes not published. Example: Event,ReplicaSet
+	PublishSkipNS       string // Patterns matching the namespaces with the changes not published.
+	QueueClusterRequest bool   // Park a request while a previous request from the same cluster is processing.
+	RedactBase64        bool   // Redact string values that look like base64 encoded blobs. Default: false
+	RedactKinds         string // Kinds with the property values redacted before storing. Default: Secret
+	RedactProperties    string // Patterns of property names with the values redacted before storing.
 	ResyncPeriodMS      int    // Time in MS for the clusters informer. Default: 15 min.
 	RediscoverRateMS    int    // Time in MS we should check on cluster resource type
 	RequestLimit        int    // Max number of concurrent requests. Used to prevent from overloading the database
 	LargeRequestLimit   int    // Max number of large concurrent requests. Used to help control memory spikes
 	LargeRequestSize    int    // Size defining a large request. Used by large request limiter middleware to control large requests
+	LogFormat           string // Format of the logs: text or json. Default: text
+	LogSampleRate       int    // Log 1 in N repeated error messages. Default: 100. Use 1 to disable sampling.
+	RunMode             string // Components run by this process: all, server, or clustersync. Default: all
 	ServerAddress       string // Web server address
 	SlowLog             int    // Log operations slower than the specified time in ms. Default: 1 sec
+	SoftDelete          bool   // Mark deleted resources with a tombstone (deleted_at) instead of deleting the rows.
+	SoftDeleteRetention int    // Hours to keep the tombstones before deleting the rows. Default: 24
+	StaleClusterDryRun  bool   // Only log the stale clusters instead of deleting their resources.
+	StaleClusterTTL     int    // Hours without a sync before deleting the cluster resources. Default: 0 (disabled)
+	StaleDataWindowMS   int    // Time in MS without a sync before flagging the Cluster node. Default: 0 (disabled)
+	StorageBackend      string // Store for the indexed data, postgres, opensearch, or memory. Default: postgres
+	StripProperties     string // Properties removed before storing the data. See database/stripProperties.go
+	TracingEndpoint     string // OTLP/HTTP endpoint to export the traces. Default: "" (disabled). See tracing/tracing.go
+	TracingSamplePct    int    // Percent of the new traces sampled. Default: 100
+	TrigramIndex        bool   // Install pg_trgm and create a trigram index on the resource name. Default: false
 	Version             string
+	featureGates        map[Feature]bool // Parsed FEATURE_GATES.
+	fileErr             error            // Error reading the config file, returned by Validate().
+	malformed           []string         // Values that can't be parsed, returned by Validate(). See ranges.go
 }
 
 // Reads config from environment.
 func new() *Config {
+	conf := readSettings()
+
+	// Initialize Kube Client
+	conf.KubeClient = getKubeClient()
+	return conf
+}
+
+// Reads the settings from the config file, the environment, and the flags, without the Kube client.
+func readSettings() *Config {
+	// Read the config file first, the environment variables override its settings.
+	configFile := configFileFlag
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+	settings, fileErr := readConfigFile(configFile)
+	settingsMux.Lock()
+	fileSettings, knownSettings, malformedSettings = settings, map[string]bool{}, nil
+	settingsMux.Unlock()
+
 	conf := &Config{
-		DBBatchSize: getEnvAsInt("DB_BATCH_SIZE", 2500),
-		DBHost:      getEnv("DB_HOST", "localhost"),
+		AWSRegion:           getEnv("AWS_REGION", ""),
+		BackpressureBatches: getEnvAsInt("BACKPRESSURE_INFLIGHT_BATCHES", 64), // Use 0 to disable.
+		BackpressureLatency: getEnvAsInt("BACKPRESSURE_LATENCY_MS", 10*1000),  // Use 0 to disable.
+		ClusterCacheSyncMS:  getEnvAsInt("CLUSTER_CACHE_SYNC_MS", 10*60*1000), // Use 0 to disable.
+		ClusterCacheTTL:     getEnvAsInt("CLUSTER_CACHE_TTL_MS", 60*60*1000),  // Use 0 to keep until deleted.
+		ClusterDeleteGrace:  getEnvAsInt("CLUSTER_DELETE_GRACE_MS", 0),        // Use 0 to delete immediately.
+		ClusterEventQPS:     getEnvAsInt("CLUSTER_EVENT_QPS", 100),            // Bursts of 100 events are allowed.
+		ClusterEventWorkers: getEnvAsInt("CLUSTER_EVENT_WORKERS", 4),          // Events of a cluster run in order.
+		ClusterFinalizer:    getEnvAsBool("CLUSTER_FINALIZER", false),         // Removed from the clusters if disabled.
+		ClusterOverrides:    getEnv("CLUSTER_OVERRIDES_CONFIGMAP", ""),        // Use "" to disable.
+		ClusterSelector:     getEnv("CLUSTER_LABEL_SELECTOR", ""),             // Use "" to index all clusters.
+		ClusterTotalsTTL:    getEnvAsInt("CLUSTER_TOTALS_TTL_MS", 0),          // Use 0 to disable.
+		ConsistencyCheckMS:  getEnvAsInt("CONSISTENCY_CHECK_MS", 0),           // Use 0 to disable.
+		ConfigFile:          configFile,
+		ConfigReloadDir:     getEnv("CONFIG_RELOAD_DIR", ""),
+		ConsistencyResync:   getEnvAsBool("CONSISTENCY_CHECK_RESYNC", false),
+		DBBatchAdaptive:     getEnvAsBool("DB_BATCH_ADAPTIVE", false),
+		DBBatchLingerMS:     getEnvAsInt("DB_BATCH_LINGER_MS", 0), // Disabled by default.
+		DBBatchMaxSize:      getEnvAsInt("DB_BATCH_MAX_SIZE", 10000),
+		DBBatchMinSize:      getEnvAsInt("DB_BATCH_MIN_SIZE", 100),
+		DBBatchSize:         getEnvAsInt("DB_BATCH_SIZE", 2500),
+		DBBatchTargetMS:     getEnvAsInt("DB_BATCH_TARGET_MS", 1000),
+		DBBatchWorkers:      getEnvAsInt("DB_BATCH_WORKERS", 8), // Leave connections available for queries.
+		DBCompressThreshold: getEnvAsInt("DB_COMPRESSION_THRESHOLD", 0),
+		DBCompression:       getEnv("DB_DATA_COMPRESSION", ""),
+		DBCopyThreshold:     getEnvAsInt("DB_COPY_THRESHOLD", 10000), // Use 0 to disable.
+		DBHost:              getEnv("DB_HOST", "localhost"),
+		DBIAMAuth:           getEnvAsBool("DB_IAM_AUTH", false),
 		// Postgres has 100 conns by default. Using 10 allows scaling indexer and api.
 		DBMaxConns:          getEnvAsInt32("DB_MAX_CONNS", int32(10)),          // 10 - Overrides pgxpool default
 		DBMaxConnLifeJitter: getEnvAsInt("DB_MAX_CONN_LIFE_JITTER", 2*60*1000), // 2 min - Overrides pgxpool default
@@ -61,40 +240,191 @@ func new() *Config {
 		DBMaxConnLifeTime:   getEnvAsInt("DB_MAX_CONN_LIFE_TIME", 60*60*1000),  // 60 min - Default for pgxpool.Config
 		DBMinConns:          getEnvAsInt32("DB_MIN_CONNS", int32(2)),           // 2 - Overrides pgxpool default
 		DBName:              getEnv("DB_NAME", ""),
+		DBOutageBuffer:      getEnvAsInt("DB_OUTAGE_BUFFER_SIZE", 0), // Use 0 to disable.
 		DBPass:              getEnv("DB_PASS", ""),
+		DBPassFile:          getEnv("DB_PASS_FILE", ""),
 		DBPort:              getEnvAsInt("DB_PORT", 5432),
+		DBRequestWorkers:    getEnvAsInt("DB_REQUEST_BATCH_WORKERS", 4),
+		DBSchema:            getEnv("DB_SCHEMA", "search"),
+		DBSSLCert:           getEnv("DB_SSLCERT", ""),
+		DBSSLKey:            getEnv("DB_SSLKEY", ""),
+		DBSSLMode:           getEnv("DB_SSLMODE", "require"), // https://www.postgresql.org/docs/current/libpq-ssl.html
+		DBSSLRootCert:       getEnv("DB_SSLROOTCERT", ""),
+		DBStatementTimeout:  getEnvAsInt("DB_STATEMENT_TIMEOUT", 5*60*1000),  // 5 min. Use 0 to disable.
+		DBStmtCacheCapacity: getEnvAsInt("DB_STATEMENT_CACHE_CAPACITY", 512), // Use 0 to disable.
+		DBStmtCacheMode:     getEnv("DB_STATEMENT_CACHE_MODE", "prepare"),    // Use describe with pgbouncer.
 		DBUser:              getEnv("DB_USER", ""),
-		DevelopmentMode:     DEVELOPMENT_MODE,                       // Don't read ENV. See config_development.go to enable.
+		DBUserFile:          getEnv("DB_USER_FILE", ""),
+		DataGINIndex:        getEnvAsBool("DATA_GIN_INDEX", false),
+		DataGINMaxSizeMB:    getEnvAsInt("DATA_GIN_INDEX_MAX_SIZE_MB", 10*1024), // 10 GB
+		DeadLetter:          getEnvAsBool("DEAD_LETTER", false),
+		DeadLetterMaxRows:   getEnvAsInt("DEAD_LETTER_MAX_ROWS", 10000),
+		DeadLetterRetention: getEnvAsInt("DEAD_LETTER_RETENTION_HOURS", 7*24), // 7 days
+		DeferEdges:          getEnvAsBool("DEFER_EDGES", false),
+		DevelopmentMode:     DEVELOPMENT_MODE, // Don't read ENV. See config_development.go to enable.
+		EventTransport:      getEnv("EVENT_TRANSPORT", "kafka"),
+		FeatureGates:        getEnv("FEATURE_GATES", ""),
+		FederationHubs:      getEnv("FEDERATION_HUBS", ""),
+		FederationHubUsers:  getEnv("FEDERATION_HUB_USERS", ""),
+		FullTextSearch:      getEnvAsBool("FULL_TEXT_SEARCH", false),
+		HistoryEnabled:      getEnvAsBool("RESOURCE_HISTORY", false),
+		HistoryRetention:    getEnvAsInt("RESOURCE_HISTORY_RETENTION_HOURS", 7*24), // 7 days
+		HTTP2Enabled:        getEnvAsBool("HTTP2_ENABLED", false),
 		HTTPTimeout:         getEnvAsInt("HTTP_TIMEOUT", 5*60*1000), // 5 min
+		IndexDefinitions:    getEnv("INDEX_DEFINITIONS", ""),
+		IndexDropUndeclared: getEnvAsBool("INDEX_DROP_UNDECLARED", false),
+		KafkaBrokers:        getEnv("KAFKA_BROKERS", ""), // Use "" to disable.
+		KafkaCACert:         getEnv("KAFKA_CA_CERT", ""),
+		KafkaClientCert:     getEnv("KAFKA_CLIENT_CERT", ""),
+		KafkaClientKey:      getEnv("KAFKA_CLIENT_KEY", ""),
+		KafkaGroup:          getEnv("KAFKA_GROUP", "search-indexer"),
+		KafkaMaxRetry:       getEnvAsInt("KAFKA_MAX_RETRY", 3),
+		KafkaKey:            getEnv("KAFKA_KEY", "uid"),
+		KafkaOutbox:         getEnvAsBool("KAFKA_OUTBOX", false),
+		KafkaOAuthClientID:  getEnv("KAFKA_OAUTH_CLIENT_ID", ""),
+		KafkaOAuthScope:     getEnv("KAFKA_OAUTH_SCOPE", ""),
+		KafkaOAuthSecret:    getEnv("KAFKA_OAUTH_CLIENT_SECRET", ""),
+		KafkaOAuthTokenURL:  getEnv("KAFKA_OAUTH_TOKEN_URL", ""),
+		KafkaPartition:      getEnvAsInt("KAFKA_PARTITION", -1),
+		KafkaPartitioner:    getEnv("KAFKA_PARTITIONER", "key"),
+		KafkaRestPass:       getEnv("KAFKA_REST_PASS", ""),
+		KafkaRestURL:        getEnv("KAFKA_REST_URL", ""), // Use "" to disable.
+		KafkaRestUser:       getEnv("KAFKA_REST_USER", ""),
+		KafkaSASLMechanism:  getEnv("KAFKA_SASL_MECHANISM", ""),
+		KafkaSASLPass:       getEnv("KAFKA_SASL_PASS", ""),
+		KafkaSASLUser:       getEnv("KAFKA_SASL_USER", ""),
+		KafkaSyncTopic:      getEnv("KAFKA_SYNC_TOPIC", ""), // Use "" to disable.
+		KafkaTLS:            getEnvAsBool("KAFKA_TLS", false),
+		KafkaTopic:          getEnv("KAFKA_TOPIC", "search-changes"), // Use "" to disable.
 		KubeConfigPath:      getKubeConfigPath(),
+		LeaderLeaseDuration: getEnvAsInt("LEADER_LEASE_DURATION_MS", 15*1000),
+		LeaderLockName:      getEnv("LEADER_LOCK_NAME", "search-indexer.open-cluster-management.io"),
+		LeaderRenewDeadline: getEnvAsInt("LEADER_RENEW_DEADLINE_MS", 10*1000),
+		LeaderRetryPeriod:   getEnvAsInt("LEADER_RETRY_PERIOD_MS", 2*1000),
+		MaintenanceMS:       getEnvAsInt("MAINTENANCE_INTERVAL_MS", 0), // Use 0 to disable.
+		MaintenancePct:      getEnvAsInt("MAINTENANCE_THRESHOLD_PCT", 20),
 		// Use 5 min for delete cluster activities and 30 seconds for db reconnect retry
-		MaxBackoffMS:      getEnvAsInt("MAX_BACKOFF_MS", 5*60*1000), // 5 min
-		PodName:           getEnv("POD_NAME", "local-dev"),
-		PodNamespace:      getEnv("POD_NAMESPACE", "open-cluster-management"),
-		RediscoverRateMS:  getEnvAsInt("REDISCOVER_RATE_MS", 5*60*1000), // 5 min
-		ResyncPeriodMS:    getEnvAsInt("RESYNC_PERIOD_MS", 15*60*1000),  // 15 min - cluster resync period
-		RequestLimit:      getEnvAsInt("REQUEST_LIMIT", 25),             // Set to 25 to prevent memory issues.
-		LargeRequestLimit: getEnvAsInt("LARGE_REQUEST_LIMIT", 5),
-		LargeRequestSize:  getEnvAsInt("LARGE_REQUEST_SIZE", 1024*1024*20), // 20 MB
-		ServerAddress:     getEnv("AGGREGATOR_ADDRESS", ":3010"),
-		SlowLog:           getEnvAsInt("SLOW_LOG", 1000), // 1 second
-		Version:           COMPONENT_VERSION,
+		MaxBackoffMS:        getEnvAsInt("MAX_BACKOFF_MS", 5*60*1000), // 5 min
+		MaxPropertySize:     getEnvAsInt("MAX_PROPERTY_SIZE", 0),      // Use 0 to disable.
+		MaxResourceSize:     getEnvAsInt("MAX_RESOURCE_SIZE", 0),      // Use 0 to disable.
+		NatsCACert:          getEnv("NATS_CA_CERT", ""),
+		NatsMaxRetry:        getEnvAsInt("NATS_MAX_RETRY", 3),
+		NatsOutbox:          getEnvAsBool("NATS_OUTBOX", false),
+		NatsPass:            getEnv("NATS_PASS", ""),
+		NatsSubject:         getEnv("NATS_SUBJECT", "search.changes.{clusterName}"),
+		NatsURL:             getEnv("NATS_URL", ""), // Use "" to disable.
+		NatsUser:            getEnv("NATS_USER", ""),
+		NotifyChanges:       getEnvAsBool("NOTIFY_CHANGES", false),
+		OfflinePurgeGrace:   getEnvAsInt("OFFLINE_CLUSTER_PURGE_GRACE_MS", 0), // Use 0 to keep the data.
+		OpenSearchCACert:    getEnv("OPENSEARCH_CA_CERT", ""),
+		OpenSearchIndex:     getEnv("OPENSEARCH_INDEX_PREFIX", "search"),
+		OpenSearchPass:      getEnv("OPENSEARCH_PASS", ""),
+		OpenSearchURL:       getEnv("OPENSEARCH_URL", ""),
+		OpenSearchUser:      getEnv("OPENSEARCH_USER", ""),
+		OrphanEdgeCleanupMS: getEnvAsInt("ORPHAN_EDGE_CLEANUP_MS", 0), // Use 0 to disable.
+		OversizedResources:  getEnv("OVERSIZED_RESOURCES", "truncate"),
+		PodName:             getEnv("POD_NAME", "local-dev"),
+		PodNamespace:        getEnv("POD_NAMESPACE", "open-cluster-management"),
+		PublishSelector:     getEnv("PUBLISH_PROPERTY_SELECTOR", ""),
+		PublishSkipClusters: getEnv("PUBLISH_SKIP_CLUSTERS", ""),
+		PublishSkipKinds:    getEnv("PUBLISH_SKIP_KINDS", ""),
+		PublishSkipNS:       getEnv("PUBLISH_SKIP_NAMESPACES", ""),
+		// Collectors may send a small delta right after a large resync. Wait instead of rejecting with 429.
+		QueueClusterRequest: getEnvAsBool("QUEUE_CLUSTER_REQUEST", false),
+		RedactBase64:        getEnvAsBool("REDACT_BASE64", false),
+		RedactKinds:         getEnv("REDACT_KINDS", "Secret"),
+		RedactProperties:    getEnv("REDACT_PROPERTIES", ""),              // Example: *password*,*token
+		RediscoverRateMS:    getEnvAsInt("REDISCOVER_RATE_MS", 5*60*1000), // 5 min
+		ResyncPeriodMS:      getEnvAsInt("RESYNC_PERIOD_MS", 15*60*1000),  // 15 min - cluster resync period
+		RequestLimit:        getEnvAsInt("REQUEST_LIMIT", 25),             // Set to 25 to prevent memory issues.
+		LargeRequestLimit:   getEnvAsInt("LARGE_REQUEST_LIMIT", 5),
+		LargeRequestSize:    getEnvAsInt("LARGE_REQUEST_SIZE", 1024*1024*20), // 20 MB
+		LogFormat:           getEnv("LOG_FORMAT", "text"),
+		LogSampleRate:       getEnvAsInt("LOG_SAMPLE_RATE", 100),
+		RunMode:             getEnv("RUN_MODE", "all"),
+		ServerAddress:       getEnv("AGGREGATOR_ADDRESS", ":3010"),
+		SlowLog:             getEnvAsInt("SLOW_LOG", 1000), // 1 second
+		SoftDelete:          getEnvAsBool("SOFT_DELETE", false),
+		SoftDeleteRetention: getEnvAsInt("SOFT_DELETE_RETENTION_HOURS", 24),
+		StaleClusterDryRun:  getEnvAsBool("STALE_CLUSTER_DRY_RUN", false),
+		StaleClusterTTL:     getEnvAsInt("STALE_CLUSTER_TTL_HOURS", 0), // Use 0 to disable.
+		StaleDataWindowMS:   getEnvAsInt("STALE_DATA_WINDOW_MS", 0),    // Use 0 to disable.
+		StorageBackend:      getEnv("STORAGE_BACKEND", "postgres"),
+		StripProperties:     getEnv("STRIP_PROPERTIES", defaultStripProperties),
+		TracingEndpoint:     getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), // Use "" to disable.
+		TracingSamplePct:    getEnvAsInt("TRACING_SAMPLE_PCT", 100),
+		TrigramIndex:        getEnvAsBool("TRIGRAM_INDEX", false),
+		Version:             COMPONENT_VERSION,
 	}
 
 	// URLEncode the db password.
 	conf.DBPass = url.QueryEscape(conf.DBPass)
 
-	// Initialize Kube Client
-	conf.KubeClient = getKubeClient()
+	// Validate() returns the error.
+	conf.featureGates, _ = parseFeatureGates(conf.FeatureGates)
+
+	if fileErr == nil {
+		fileErr = unknownSettings()
+	}
+	conf.fileErr = fileErr
+	settingsMux.Lock()
+	conf.malformed = malformedSettings
+	settingsMux.Unlock()
 
 	return conf
 }
 
+// Returns true if the resource changes are published to the EVENT_TRANSPORT.
+func (cfg *Config) PublishesChanges() bool {
+	if !cfg.FeatureEnabled(ChangeStream) {
+		return false
+	}
+	if cfg.EventTransport == "nats" {
+		return cfg.NatsURL != "" && cfg.NatsSubject != ""
+	}
+	return (cfg.KafkaRestURL != "" || cfg.KafkaBrokers != "") && cfg.KafkaTopic != ""
+}
+
+// Returns true if the changes are published from search.outbox, with KAFKA_OUTBOX or NATS_OUTBOX for the
+// EVENT_TRANSPORT.
+func (cfg *Config) PublishesFromOutbox() bool {
+	if cfg.EventTransport == "nats" {
+		return cfg.NatsOutbox
+	}
+	return cfg.KafkaOutbox
+}
+
+// Returns the attempts to publish a batch of changes, KAFKA_MAX_RETRY or NATS_MAX_RETRY for the EVENT_TRANSPORT.
+func (cfg *Config) PublishMaxRetry() int {
+	if cfg.EventTransport == "nats" {
+		return cfg.NatsMaxRetry
+	}
+	return cfg.KafkaMaxRetry
+}
+
+// Returns the Kubernetes user of the hub in FEDERATION_HUB_USERS, or "" if the hub doesn't have a user.
+func (cfg *Config) FederationHubUser(hub string) string {
+	for _, pair := range strings.Split(cfg.FederationHubUsers, ",") {
+		if name, user, found := strings.Cut(pair, "="); found && strings.TrimSpace(name) == hub {
+			return strings.TrimSpace(user)
+		}
+	}
+	return ""
+}
+
+// Returns true if this process receives the sync requests from the clusters.
+func (cfg *Config) RunsServer() bool {
+	return cfg.RunMode != "clustersync"
+}
+
+// Returns true if this process runs the leader election and watches the hub resources.
+func (cfg *Config) RunsClusterSync() bool {
+	return cfg.RunMode != "server"
+}
+
 // Format and print environment to logger.
 func (cfg *Config) PrintConfig() {
-	// Make a copy to redact secrets and sensitive information.
-	tmp := *cfg
-	tmp.DBPass = "[REDACTED]"
+	tmp := cfg.Redacted()
 
 	// Convert to JSON for nicer formatting.
 	cfgJSON, err := json.MarshalIndent(tmp, "", "\t")
@@ -105,11 +435,32 @@ func (cfg *Config) PrintConfig() {
 	klog.Infof("Using configuration:\n%s\n", string(cfgJSON))
 }
 
-// Simple helper function to read an environment or return a default value
+// Returns a copy of the config with the secrets and sensitive information redacted.
+func (cfg *Config) Redacted() Config {
+	tmp := *cfg
+	tmp.DBPass = "[REDACTED]"
+	tmp.OpenSearchPass = "[REDACTED]"
+	tmp.KafkaRestPass = "[REDACTED]"
+	tmp.KafkaOAuthSecret = "[REDACTED]"
+	tmp.KafkaSASLPass = "[REDACTED]"
+	tmp.NatsPass = "[REDACTED]"
+	return tmp
+}
+
+// Simple helper function to read a flag, or an environment, or the config file, or return a default value
 func getEnv(key string, defaultVal string) string {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	knownSettings[key] = true
+	if value, exists := flagSettings[key]; exists {
+		return value
+	}
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
+	if value, exists := fileSettings[key]; exists {
+		return value
+	}
 	return defaultVal
 }
 
@@ -118,6 +469,19 @@ func getEnvAsInt(name string, defaultVal int) int {
 	valueStr := getEnv(name, "")
 	if value, err := strconv.Atoi(valueStr); err == nil {
 		return value
+	} else if valueStr != "" {
+		invalidSetting(name, valueStr, "an integer")
+	}
+	return defaultVal
+}
+
+// Helper function to read an environment variable into a bool or return a default value
+func getEnvAsBool(name string, defaultVal bool) bool {
+	valueStr := getEnv(name, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	} else if valueStr != "" {
+		invalidSetting(name, valueStr, "true or false")
 	}
 	return defaultVal
 }
@@ -127,20 +491,271 @@ func getEnvAsInt32(name string, defaultVal int32) int32 {
 	valueStr := getEnv(name, "")
 	if value, err := strconv.ParseInt(valueStr, 10, 32); err == nil {
 		return int32(value)
+	} else if valueStr != "" {
+		invalidSetting(name, valueStr, "a 32-bit integer")
 	}
 	return defaultVal
 }
 
+// Matches a STRIP_PROPERTIES rule: name, name[key], or name[:N]
+var stripRuleRegex = regexp.MustCompile(`^[^\[\],]+(\[(:[0-9]+|[^\]:][^\]]*)\])?$`)
+
+// Matches a lowercase Postgres identifier, so DB_SCHEMA can be used in the queries without quoting.
+var schemaNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// Matches a legal Kafka topic name.
+var kafkaTopicRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Matches a NATS subject to publish, non-empty tokens without whitespace or wildcards.
+var natsSubjectRegex = regexp.MustCompile(`^[^\s.*>]+(\.[^\s.*>]+)*$`)
+
 // Validate required configuration.
 func (cfg *Config) Validate() error {
+	if cfg.fileErr != nil {
+		return cfg.fileErr
+	}
+	if problems := cfg.settingProblems(); len(problems) > 0 {
+		return problemsError(problems)
+	}
+	if cfg.OversizedResources != "truncate" && cfg.OversizedResources != "reject" {
+		return fmt.Errorf("Invalid OVERSIZED_RESOURCES [%s]. Must be one of: truncate, reject.",
+			cfg.OversizedResources)
+	}
+	for _, pattern := range strings.Split(cfg.RedactProperties, ",") {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("Invalid REDACT_PROPERTIES pattern [%s]. %s", pattern, err)
+		}
+	}
+	for _, rule := range strings.Split(cfg.StripProperties, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" && !stripRuleRegex.MatchString(rule) {
+			return fmt.Errorf("Invalid STRIP_PROPERTIES rule [%s]. Must be one of: name, name[key], name[:N].", rule)
+		}
+	}
+	if _, err := labels.Parse(cfg.ClusterSelector); err != nil {
+		return fmt.Errorf("Invalid CLUSTER_LABEL_SELECTOR [%s]. %s", cfg.ClusterSelector, err)
+	}
+	for _, pair := range strings.Split(cfg.FederationHubUsers, ",") {
+		if hub, user, found := strings.Cut(pair, "="); strings.TrimSpace(pair) != "" &&
+			(!found || strings.TrimSpace(hub) == "" || strings.TrimSpace(user) == "") {
+			return fmt.Errorf("Invalid FEDERATION_HUB_USERS entry [%s]. Must be hub=user.", pair)
+		}
+	}
+	for _, hub := range strings.Split(cfg.FederationHubs, ",") {
+		if hub = strings.TrimSpace(hub); hub != "" && len(validation.IsDNS1123Label(hub)) > 0 {
+			return fmt.Errorf("Invalid FEDERATION_HUBS hub [%s]. Must be a DNS-1123 label.", hub)
+		}
+		if hub != "" && cfg.FederationHubUser(hub) == "" {
+			return fmt.Errorf("Environment FEDERATION_HUB_USERS is missing the user of hub [%s].", hub)
+		}
+	}
+	if cfg.PublishesChanges() && cfg.PublishMaxRetry() < 1 {
+		return fmt.Errorf("Environment %s_MAX_RETRY must be greater than 0.", strings.ToUpper(cfg.EventTransport))
+	}
+	// Cluster names are DNS-1123 labels, so the topic is valid for any cluster if it's valid for one.
+	sampleTopic := strings.ReplaceAll(cfg.KafkaTopic, "{clusterName}", "cluster")
+	if cfg.KafkaTopic != "" && !kafkaTopicRegex.MatchString(sampleTopic) {
+		return fmt.Errorf("Invalid KAFKA_TOPIC [%s]. Must contain only alphanumeric characters, '.', '_', '-', "+
+			"and the {clusterName} placeholder.", cfg.KafkaTopic)
+	}
+	if cfg.KafkaKey != "uid" && cfg.KafkaKey != "cluster" {
+		return fmt.Errorf("Invalid KAFKA_KEY [%s]. Must be one of: uid, cluster.", cfg.KafkaKey)
+	}
+	switch cfg.KafkaPartitioner {
+	case "key", "random":
+		if cfg.KafkaPartition >= 0 {
+			return errors.New("Environment KAFKA_PARTITION requires KAFKA_PARTITIONER=fixed.")
+		}
+	case "fixed":
+		if cfg.KafkaPartition < 0 {
+			return errors.New("Environment KAFKA_PARTITION is required with KAFKA_PARTITIONER=fixed.")
+		}
+	default:
+		return fmt.Errorf("Invalid KAFKA_PARTITIONER [%s]. Must be one of: key, fixed, random.",
+			cfg.KafkaPartitioner)
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("Invalid LOG_FORMAT [%s]. Must be one of: text, json.", cfg.LogFormat)
+	}
+	if cfg.EventTransport != "kafka" && cfg.EventTransport != "nats" {
+		return fmt.Errorf("Invalid EVENT_TRANSPORT [%s]. Must be one of: kafka, nats.", cfg.EventTransport)
+	}
+	if cfg.NatsURL != "" {
+		if u, err := url.Parse(cfg.NatsURL); err != nil || (u.Scheme != "nats" && u.Scheme != "tls") {
+			return fmt.Errorf("Invalid NATS_URL [%s]. Must be nats://<host>:<port> or tls://<host>:<port>.",
+				cfg.NatsURL)
+		}
+	}
+	sampleSubject := strings.ReplaceAll(cfg.NatsSubject, "{clusterName}", "cluster")
+	if cfg.NatsSubject != "" && !natsSubjectRegex.MatchString(sampleSubject) {
+		return fmt.Errorf("Invalid NATS_SUBJECT [%s]. Must be tokens separated by '.', without wildcards.",
+			cfg.NatsSubject)
+	}
+	for env, patterns := range map[string]string{"PUBLISH_SKIP_CLUSTERS": cfg.PublishSkipClusters,
+		"PUBLISH_SKIP_NAMESPACES": cfg.PublishSkipNS} {
+		for _, pattern := range strings.Split(patterns, ",") {
+			if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+				return fmt.Errorf("Invalid %s pattern [%s]. %s", env, pattern, err)
+			}
+		}
+	}
+	if _, err := labels.Parse(cfg.PublishSelector); err != nil {
+		return fmt.Errorf("Invalid PUBLISH_PROPERTY_SELECTOR [%s]. %s", cfg.PublishSelector, err)
+	}
+	if _, err := parseFeatureGates(cfg.FeatureGates); err != nil {
+		return err
+	}
+	if cfg.DBBatchAdaptive && !cfg.FeatureEnabled(AdaptiveBatching) {
+		return errors.New("Environment DB_BATCH_ADAPTIVE requires the AdaptiveBatching feature gate.")
+	}
+	if cfg.DBOutageBuffer > 0 && !cfg.FeatureEnabled(OutageBuffer) {
+		return errors.New("Environment DB_OUTAGE_BUFFER_SIZE requires the OutageBuffer feature gate.")
+	}
+	if cfg.StorageBackend == "opensearch" && !cfg.FeatureEnabled(OpenSearchStore) {
+		return errors.New("The opensearch STORAGE_BACKEND requires the OpenSearchStore feature gate.")
+	}
+	if cfg.StorageBackend == "memory" && !cfg.FeatureEnabled(MemoryStore) {
+		return errors.New("The memory STORAGE_BACKEND requires the MemoryStore feature gate.")
+	}
+	if cfg.KafkaOutbox && cfg.EventTransport == "nats" {
+		return errors.New("Environment KAFKA_OUTBOX can't be used with EVENT_TRANSPORT=nats. Use NATS_OUTBOX.")
+	}
+	if cfg.NatsOutbox && cfg.EventTransport != "nats" {
+		return errors.New("Environment NATS_OUTBOX requires EVENT_TRANSPORT=nats.")
+	}
+	outboxEnv := strings.ToUpper(cfg.EventTransport) + "_OUTBOX"
+	if cfg.PublishesFromOutbox() && !cfg.FeatureEnabled(ChangeStream) {
+		return fmt.Errorf("Environment %s requires the ChangeStream feature gate.", outboxEnv)
+	}
+	if cfg.PublishesFromOutbox() && !cfg.PublishesChanges() {
+		if cfg.EventTransport == "nats" {
+			return errors.New("Environment NATS_OUTBOX requires NATS_URL and NATS_SUBJECT.")
+		}
+		return errors.New("Environment KAFKA_OUTBOX requires KAFKA_REST_URL or KAFKA_BROKERS with KAFKA_TOPIC.")
+	}
+	if cfg.PublishesFromOutbox() && cfg.StorageBackend != "postgres" {
+		return fmt.Errorf("Environment %s requires the postgres STORAGE_BACKEND.", outboxEnv)
+	}
+	if cfg.KafkaSyncTopic != "" && (cfg.KafkaRestURL == "" || cfg.KafkaGroup == "") {
+		return errors.New("Environment KAFKA_REST_URL and KAFKA_GROUP are required with KAFKA_SYNC_TOPIC.")
+	}
+	if (cfg.KafkaClientCert == "") != (cfg.KafkaClientKey == "") {
+		return errors.New("Environment KAFKA_CLIENT_CERT and KAFKA_CLIENT_KEY must be set together.")
+	}
+	if cfg.KafkaOAuthTokenURL != "" && (cfg.KafkaOAuthClientID == "" || cfg.KafkaOAuthSecret == "") {
+		return errors.New("Environment KAFKA_OAUTH_CLIENT_ID and KAFKA_OAUTH_CLIENT_SECRET are required with " +
+			"KAFKA_OAUTH_TOKEN_URL.")
+	}
+	if cfg.KafkaOAuthTokenURL != "" && cfg.KafkaRestUser != "" {
+		return errors.New("Environment KAFKA_REST_USER and KAFKA_OAUTH_TOKEN_URL can't be set together.")
+	}
+	switch cfg.KafkaSASLMechanism {
+	case "":
+	case "SCRAM-SHA-256", "SCRAM-SHA-512":
+		if cfg.KafkaSASLUser == "" || cfg.KafkaSASLPass == "" {
+			return fmt.Errorf("Environment KAFKA_SASL_USER and KAFKA_SASL_PASS are required with "+
+				"KAFKA_SASL_MECHANISM=%s.", cfg.KafkaSASLMechanism)
+		}
+	case "OAUTHBEARER":
+		if cfg.KafkaOAuthTokenURL == "" {
+			return errors.New("Environment KAFKA_OAUTH_TOKEN_URL is required with KAFKA_SASL_MECHANISM=OAUTHBEARER.")
+		}
+	default:
+		return fmt.Errorf("Invalid KAFKA_SASL_MECHANISM [%s]. Must be one of: SCRAM-SHA-256, SCRAM-SHA-512, "+
+			"OAUTHBEARER.", cfg.KafkaSASLMechanism)
+	}
+	if cfg.KafkaSASLMechanism != "" && cfg.KafkaBrokers == "" {
+		return errors.New("Environment KAFKA_SASL_MECHANISM requires KAFKA_BROKERS.")
+	}
+	if cfg.ConfigReloadDir != "" {
+		if info, err := os.Stat(cfg.ConfigReloadDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("Invalid CONFIG_RELOAD_DIR [%s]. Must be a directory.", cfg.ConfigReloadDir)
+		}
+	}
+	switch cfg.RunMode {
+	case "all", "server", "clustersync":
+	default:
+		return fmt.Errorf("Invalid RUN_MODE [%s]. Must be one of: all, server, clustersync.", cfg.RunMode)
+	}
+	if cfg.RunMode != "all" && cfg.StorageBackend == "memory" {
+		return errors.New("The memory STORAGE_BACKEND can't be shared, RUN_MODE must be all.")
+	}
+	if cfg.ClusterEventQPS < 1 || cfg.ClusterEventWorkers < 1 {
+		return errors.New("Environment CLUSTER_EVENT_QPS and CLUSTER_EVENT_WORKERS must be greater than 0.")
+	}
+	if cfg.LeaderLockName == "" {
+		return errors.New("Required environment LEADER_LOCK_NAME is not set.")
+	}
+	// Same as the checks in leaderelection.NewLeaderElector(), which panics with invalid timings.
+	if cfg.LeaderRetryPeriod < 1 || float64(cfg.LeaderRenewDeadline) <= 1.2*float64(cfg.LeaderRetryPeriod) ||
+		cfg.LeaderLeaseDuration <= cfg.LeaderRenewDeadline {
+		return fmt.Errorf("Invalid leader election timings. LEADER_LEASE_DURATION_MS [%d] must be greater than "+
+			"LEADER_RENEW_DEADLINE_MS [%d], which must be greater than 1.2 * LEADER_RETRY_PERIOD_MS [%d].",
+			cfg.LeaderLeaseDuration, cfg.LeaderRenewDeadline, cfg.LeaderRetryPeriod)
+	}
+	switch cfg.StorageBackend {
+	case "postgres":
+	case "opensearch":
+		// The DB_* settings aren't used with OpenSearch.
+		if cfg.OpenSearchURL == "" {
+			return errors.New("Required environment OPENSEARCH_URL is not set.")
+		}
+		return nil
+	case "memory":
+		return nil // For development only.
+	default:
+		return fmt.Errorf("Invalid STORAGE_BACKEND [%s]. Must be one of: postgres, opensearch, memory.",
+			cfg.StorageBackend)
+	}
 	if cfg.DBName == "" {
 		return errors.New("Required environment DB_NAME is not set.")
 	}
-	if cfg.DBUser == "" {
+	if cfg.DBUser == "" && cfg.DBUserFile == "" {
 		return errors.New("Required environment DB_USER is not set.")
 	}
-	if cfg.DBPass == "" {
+	// Password isn't required with certificate or IAM authentication, or when connecting to a local unix socket
+	// (e.g. pgBouncer sidecar) which may use trust or peer authentication.
+	if cfg.DBPass == "" && cfg.DBPassFile == "" && cfg.DBSSLCert == "" && !cfg.DBIAMAuth &&
+		!strings.HasPrefix(cfg.DBHost, "/") {
 		return errors.New("Required environment DB_PASS is not set.")
 	}
+	if cfg.DBIAMAuth && (cfg.DBUserFile != "" || cfg.DBPassFile != "") {
+		return errors.New("Environment DB_USER_FILE and DB_PASS_FILE can't be used with DB_IAM_AUTH.")
+	}
+	for env, file := range map[string]string{"DB_USER_FILE": cfg.DBUserFile, "DB_PASS_FILE": cfg.DBPassFile} {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			return fmt.Errorf("Invalid %s [%s]. %s", env, file, err)
+		}
+	}
+	if cfg.DBIAMAuth && cfg.AWSRegion == "" {
+		return errors.New("Environment AWS_REGION is required when DB_IAM_AUTH is enabled.")
+	}
+	if cfg.DBIAMAuth && strings.Contains(cfg.DBHost, ",") {
+		return errors.New("Environment DB_HOST must be a single host when DB_IAM_AUTH is enabled.")
+	}
+	if (cfg.DBSSLCert == "") != (cfg.DBSSLKey == "") {
+		return errors.New("Environment DB_SSLCERT and DB_SSLKEY must be set together.")
+	}
+	switch cfg.DBSSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("Invalid DB_SSLMODE [%s]. Must be one of: disable, allow, prefer, require, "+
+			"verify-ca, verify-full.", cfg.DBSSLMode)
+	}
+	if !schemaNameRegex.MatchString(cfg.DBSchema) {
+		return fmt.Errorf("Invalid DB_SCHEMA [%s]. Must be a lowercase Postgres identifier.", cfg.DBSchema)
+	}
+	if cfg.DBBatchWorkers < 1 || cfg.DBRequestWorkers < 1 {
+		return errors.New("Environment DB_BATCH_WORKERS and DB_REQUEST_BATCH_WORKERS must be greater than 0.")
+	}
+	if cfg.DBCompression != "" && cfg.DBCompression != "pglz" && cfg.DBCompression != "lz4" {
+		return fmt.Errorf("Invalid DB_DATA_COMPRESSION [%s]. Must be one of: pglz, lz4.", cfg.DBCompression)
+	}
+	if cfg.DBCompressThreshold != 0 && (cfg.DBCompressThreshold < 128 || cfg.DBCompressThreshold > 8160) {
+		return errors.New("Environment DB_COMPRESSION_THRESHOLD must be between 128 and 8160 bytes.")
+	}
+	if cfg.DBStmtCacheMode != "prepare" && cfg.DBStmtCacheMode != "describe" {
+		return fmt.Errorf("Invalid DB_STATEMENT_CACHE_MODE [%s]. Must be one of: prepare, describe.",
+			cfg.DBStmtCacheMode)
+	}
 	return nil
 }
@@ -0,0 +1,134 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config file.
+// The settings can be read from a YAML or JSON file, set with the --config flag or CONFIG_FILE. The keys are the
+// names of the environment variables, and the environment variables override the file. The keys of the nested
+// maps are joined with '_', so the settings can be grouped. For example:
+//   DB_HOST: postgres.example.com
+//   DB:
+//     BATCH_SIZE: 1000     # DB_BATCH_SIZE
+//     MAX_CONNS: 20        # DB_MAX_CONNS
+//   REDACT_KINDS: [Secret, ConfigMap]
+//   INDEX_DEFINITIONS: [{name: ..., expression: ...}]
+// The lists of values are joined with ',', and the lists of maps are sent as JSON. An unknown key is an error, so
+// a typo doesn't silently use the default value.
+
+// Settings read from the config file, by environment variable. Set by readSettings()
+var fileSettings = map[string]string{}
+
+// Environment variables read with getEnv(), to find the unknown keys in the config file.
+var knownSettings = map[string]bool{}
+var settingsMux sync.Mutex
+
+// Config file from the --config flag. See Load()
+var configFileFlag string
+
+// Reads the config from the file and the environment, and applies it to Cfg. The environment variables override the
+// file, and the flags override both. See flags.go
+// Cfg keeps its Kube client, so the client created at init isn't created again.
+func Load(file string) *Config {
+	configFileFlag = file
+	conf := readSettings()
+	conf.KubeClient = Cfg.KubeClient
+	*Cfg = *conf
+	return Cfg
+}
+
+// Reads the settings from the YAML or JSON file.
+func readConfigFile(file string) (map[string]string, error) {
+	settings := map[string]string{}
+	if file == "" {
+		return settings, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return settings, fmt.Errorf("Error reading the config file. %w", err)
+	}
+	var values map[string]interface{}
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return settings, fmt.Errorf("Error parsing the config file %s. %w", file, err)
+	}
+	if err = flattenSettings("", values, settings); err != nil {
+		return settings, fmt.Errorf("Invalid config file %s. %w", file, err)
+	}
+	return settings, nil
+}
+
+func flattenSettings(prefix string, values map[string]interface{}, settings map[string]string) error {
+	for key, value := range values {
+		name := prefix + key
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenSettings(name+"_", v, settings); err != nil {
+				return err
+			}
+		case []interface{}:
+			list, err := settingList(v)
+			if err != nil {
+				return fmt.Errorf("Invalid list [%s]. %w", name, err)
+			}
+			settings[name] = list
+		case nil:
+			settings[name] = ""
+		default:
+			settings[name] = settingValue(v)
+		}
+	}
+	return nil
+}
+
+// Returns the values joined with ',', or the list as JSON if it has maps or lists.
+func settingList(values []interface{}) (string, error) {
+	items := make([]string, len(values))
+	for i, value := range values {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			encoded, err := json.Marshal(values)
+			return string(encoded), err
+		}
+		items[i] = settingValue(value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+func settingValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Returns an error if the config file has a setting that isn't read.
+func unknownSettings() error {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	var unknown []string
+	for key := range fileSettings {
+		if !knownSettings[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("Unknown settings in the config file: %s", strings.Join(unknown, ", "))
+}
@@ -0,0 +1,86 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	_ = os.WriteFile(file, []byte(content), 0600)
+	return file
+}
+
+// Restores Cfg and the config file flag after a test loading the config.
+func restoreCfg() func() {
+	saved := *Cfg
+	return func() {
+		*Cfg = saved
+		configFileFlag = ""
+	}
+}
+
+// Should read the settings from the file, with the environment variables overriding them.
+func Test_Load(t *testing.T) {
+	file := writeConfigFile(t, `
+DB_HOST: postgres.example.com
+DB:
+  BATCH_SIZE: 1000
+  MAX_CONNS: 30
+REDACT_KINDS: [Secret, ConfigMap]
+RESOURCE_HISTORY: true
+INDEX_DEFINITIONS: [{name: idx_app, expression: "data->>'app'"}]
+`)
+	os.Setenv("DB_MAX_CONNS", "40")
+	defer os.Unsetenv("DB_MAX_CONNS")
+	defer restoreCfg()()
+
+	conf := Load(file)
+
+	assert.Nil(t, conf.fileErr)
+	assert.Equal(t, file, conf.ConfigFile)
+	assert.Equal(t, "postgres.example.com", conf.DBHost)
+	assert.Equal(t, 1000, conf.DBBatchSize)
+	assert.Equal(t, int32(40), conf.DBMaxConns)
+	assert.Equal(t, "Secret,ConfigMap", conf.RedactKinds)
+	assert.True(t, conf.HistoryEnabled)
+	assert.JSONEq(t, `[{"name":"idx_app","expression":"data->>'app'"}]`, conf.IndexDefinitions)
+}
+
+// Should fail the validation with an unknown setting in the file.
+func Test_Load_unknown(t *testing.T) {
+	file := writeConfigFile(t, `{"DB_BATCH_SIZ": 1000, "DB": {"NAME": "search"}}`)
+	defer restoreCfg()()
+
+	conf := Load(file)
+
+	assert.Equal(t, "search", conf.DBName)
+	assert.EqualError(t, conf.Validate(), "Unknown settings in the config file: DB_BATCH_SIZ")
+}
+
+// Should fail the validation if the file can't be read.
+func Test_Load_missing(t *testing.T) {
+	defer restoreCfg()()
+
+	conf := Load("/missing/config.yaml")
+
+	assert.NotNil(t, conf.Validate())
+}
+
+// Should apply the settings to Cfg, keeping its Kube client.
+func Test_Load_appliesToCfg(t *testing.T) {
+	file := writeConfigFile(t, "DB_NAME: filedb\n")
+	defer restoreCfg()()
+	cfg, kubeClient := Cfg, Cfg.KubeClient
+
+	conf := Load(file)
+
+	assert.Same(t, cfg, conf)
+	assert.Same(t, kubeClient, conf.KubeClient)
+	assert.Equal(t, "filedb", Cfg.DBName)
+}
@@ -12,5 +12,5 @@ import "k8s.io/klog/v2"
 func init() {
 	klog.Warning("!!! Running in development mode. !!!")
 	DEVELOPMENT_MODE = true
-	Cfg = new()
+	Cfg.DevelopmentMode = true
 }
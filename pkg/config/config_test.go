@@ -5,6 +5,7 @@ package config
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -49,6 +50,21 @@ func Test_getEnvAsInt(t *testing.T) {
 	}
 }
 
+// Should load bool value from environment or use default value when it can't be parsed.
+func Test_getEnvAsBool(t *testing.T) {
+	os.Setenv("TEST_VARIABLE", "true")
+	res := getEnvAsBool("TEST_VARIABLE", false)
+	if !res {
+		t.Errorf("Failed testing getEnvAsBool()  Expected: %t  Got: %t", true, res)
+	}
+
+	os.Setenv("TEST_VARIABLE", "not-a-bool")
+	res = getEnvAsBool("TEST_VARIABLE", false)
+	if res {
+		t.Errorf("Failed testing getEnvAsBool()  Expected: %t  Got: %t", false, res)
+	}
+}
+
 // Should print environment and redact the database password.
 func Test_PrintConfig(t *testing.T) {
 	// Redirect the logger output.
@@ -87,6 +103,422 @@ func Test_Validate(t *testing.T) {
 		t.Errorf("Expected %v Got: %+v", nil, result)
 	}
 
+	os.Setenv("FEDERATION_HUBS", "hub-a, Hub_B")
+	os.Setenv("FEDERATION_HUB_USERS", "hub-a=system:serviceaccount:search:hub-a")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid FEDERATION_HUBS hub [Hub_B].") {
+		t.Errorf("Expected error for invalid FEDERATION_HUBS Got: %s", result)
+	}
+	os.Setenv("FEDERATION_HUBS", "hub-a,hub-b")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment FEDERATION_HUB_USERS is missing the user of hub") {
+		t.Errorf("Expected error for FEDERATION_HUBS hub without a user Got: %s", result)
+	}
+	os.Setenv("FEDERATION_HUB_USERS", "hub-a=system:serviceaccount:search:hub-a,hub-b=,hub-b=user-b")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid FEDERATION_HUB_USERS entry [hub-b=].") {
+		t.Errorf("Expected error for invalid FEDERATION_HUB_USERS Got: %s", result)
+	}
+	os.Unsetenv("FEDERATION_HUBS")
+	os.Unsetenv("FEDERATION_HUB_USERS")
+
+	os.Setenv("FEATURE_GATES", "ChangeStream=true")
+	os.Setenv("KAFKA_REST_URL", "https://kafka-rest:8082")
+	os.Setenv("KAFKA_MAX_RETRY", "0")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_MAX_RETRY must be greater than 0.") {
+		t.Errorf("Expected error for invalid KAFKA_MAX_RETRY Got: %s", result)
+	}
+	os.Unsetenv("FEATURE_GATES")
+	os.Unsetenv("KAFKA_REST_URL")
+	os.Unsetenv("KAFKA_MAX_RETRY")
+
+	os.Setenv("KAFKA_TOPIC", "search/{clusterName}")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid KAFKA_TOPIC [search/{clusterName}].") {
+		t.Errorf("Expected error for invalid KAFKA_TOPIC Got: %s", result)
+	}
+	os.Setenv("KAFKA_TOPIC", "search.{clusterName}")
+	conf = new()
+	if result = conf.Validate(); result != nil {
+		t.Errorf("Expected no error for KAFKA_TOPIC with {clusterName} Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_TOPIC")
+
+	os.Setenv("KAFKA_KEY", "kind")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid KAFKA_KEY [kind].") {
+		t.Errorf("Expected error for invalid KAFKA_KEY Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_KEY")
+
+	os.Setenv("KAFKA_PARTITION", "1")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_PARTITION requires KAFKA_PARTITIONER") {
+		t.Errorf("Expected error for KAFKA_PARTITION without KAFKA_PARTITIONER=fixed Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_PARTITION")
+	os.Setenv("KAFKA_PARTITIONER", "fixed")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_PARTITION is required") {
+		t.Errorf("Expected error for KAFKA_PARTITIONER=fixed without KAFKA_PARTITION Got: %s", result)
+	}
+	os.Setenv("KAFKA_PARTITIONER", "hash")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid KAFKA_PARTITIONER [hash].") {
+		t.Errorf("Expected error for invalid KAFKA_PARTITIONER Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_PARTITIONER")
+
+	os.Setenv("FEATURE_GATES", "ChangeStream=true")
+	os.Setenv("KAFKA_OUTBOX", "true")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_OUTBOX requires KAFKA_REST_URL") {
+		t.Errorf("Expected error for KAFKA_OUTBOX without KAFKA_REST_URL Got: %s", result)
+	}
+	os.Setenv("EVENT_TRANSPORT", "nats")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_OUTBOX can't be used with EVENT_TRANSPORT") {
+		t.Errorf("Expected error for KAFKA_OUTBOX with EVENT_TRANSPORT=nats Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_OUTBOX")
+	os.Setenv("NATS_OUTBOX", "true")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment NATS_OUTBOX requires NATS_URL") {
+		t.Errorf("Expected error for NATS_OUTBOX without NATS_URL Got: %s", result)
+	}
+	os.Setenv("NATS_URL", "nats://nats:4222")
+	os.Setenv("NATS_MAX_RETRY", "0")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment NATS_MAX_RETRY must be greater than 0.") {
+		t.Errorf("Expected error for invalid NATS_MAX_RETRY Got: %s", result)
+	}
+	os.Unsetenv("NATS_MAX_RETRY")
+	conf = new()
+	if result = conf.Validate(); result != nil || !conf.PublishesFromOutbox() {
+		t.Errorf("Expected no error for NATS_OUTBOX with NATS_URL Got: %s", result)
+	}
+	os.Unsetenv("EVENT_TRANSPORT")
+	os.Unsetenv("NATS_URL")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment NATS_OUTBOX requires EVENT_TRANSPORT=nats.") {
+		t.Errorf("Expected error for NATS_OUTBOX with EVENT_TRANSPORT=kafka Got: %s", result)
+	}
+	os.Unsetenv("FEATURE_GATES")
+	os.Unsetenv("NATS_OUTBOX")
+
+	os.Setenv("EVENT_TRANSPORT", "amqp")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid EVENT_TRANSPORT [amqp].") {
+		t.Errorf("Expected error for invalid EVENT_TRANSPORT Got: %s", result)
+	}
+	os.Unsetenv("EVENT_TRANSPORT")
+
+	os.Setenv("NATS_URL", "http://nats:4222")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid NATS_URL [http://nats:4222].") {
+		t.Errorf("Expected error for invalid NATS_URL Got: %s", result)
+	}
+	os.Unsetenv("NATS_URL")
+
+	os.Setenv("NATS_SUBJECT", "search.*.{clusterName}")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid NATS_SUBJECT [search.*.{clusterName}].") {
+		t.Errorf("Expected error for invalid NATS_SUBJECT Got: %s", result)
+	}
+	os.Unsetenv("NATS_SUBJECT")
+
+	os.Setenv("KAFKA_SYNC_TOPIC", "search-sync")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_REST_URL and KAFKA_GROUP are required") {
+		t.Errorf("Expected error for KAFKA_SYNC_TOPIC without KAFKA_REST_URL Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_SYNC_TOPIC")
+
+	os.Setenv("KAFKA_CLIENT_CERT", "/certs/tls.crt")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_CLIENT_CERT and KAFKA_CLIENT_KEY") {
+		t.Errorf("Expected error for KAFKA_CLIENT_CERT without KAFKA_CLIENT_KEY Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_CLIENT_CERT")
+
+	os.Setenv("KAFKA_OAUTH_TOKEN_URL", "https://sso/token")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_OAUTH_CLIENT_ID and "+
+		"KAFKA_OAUTH_CLIENT_SECRET are required") {
+		t.Errorf("Expected error for KAFKA_OAUTH_TOKEN_URL without client Got: %s", result)
+	}
+	os.Setenv("KAFKA_OAUTH_CLIENT_ID", "search")
+	os.Setenv("KAFKA_OAUTH_CLIENT_SECRET", "secret")
+	os.Setenv("KAFKA_REST_USER", "search")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_REST_USER and KAFKA_OAUTH_TOKEN_URL") {
+		t.Errorf("Expected error for KAFKA_REST_USER with KAFKA_OAUTH_TOKEN_URL Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_OAUTH_TOKEN_URL")
+	os.Unsetenv("KAFKA_OAUTH_CLIENT_ID")
+	os.Unsetenv("KAFKA_OAUTH_CLIENT_SECRET")
+	os.Unsetenv("KAFKA_REST_USER")
+
+	os.Setenv("KAFKA_SASL_MECHANISM", "GSSAPI")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid KAFKA_SASL_MECHANISM [GSSAPI].") {
+		t.Errorf("Expected error for invalid KAFKA_SASL_MECHANISM Got: %s", result)
+	}
+	os.Setenv("KAFKA_SASL_MECHANISM", "SCRAM-SHA-512")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_SASL_USER and KAFKA_SASL_PASS") {
+		t.Errorf("Expected error for SCRAM-SHA-512 without KAFKA_SASL_USER Got: %s", result)
+	}
+	os.Setenv("KAFKA_SASL_USER", "search")
+	os.Setenv("KAFKA_SASL_PASS", "secret")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_SASL_MECHANISM requires KAFKA_BROKERS.") {
+		t.Errorf("Expected error for KAFKA_SASL_MECHANISM without KAFKA_BROKERS Got: %s", result)
+	}
+	os.Setenv("KAFKA_BROKERS", "kafka:9093")
+	conf = new()
+	result = conf.Validate()
+	if result != nil {
+		t.Errorf("Expected no error for SCRAM-SHA-512 with KAFKA_BROKERS Got: %s", result)
+	}
+	os.Setenv("KAFKA_SASL_MECHANISM", "OAUTHBEARER")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment KAFKA_OAUTH_TOKEN_URL is required") {
+		t.Errorf("Expected error for OAUTHBEARER without KAFKA_OAUTH_TOKEN_URL Got: %s", result)
+	}
+	os.Unsetenv("KAFKA_SASL_MECHANISM")
+	os.Unsetenv("KAFKA_SASL_USER")
+	os.Unsetenv("KAFKA_SASL_PASS")
+	os.Unsetenv("KAFKA_BROKERS")
+
+	os.Setenv("RUN_MODE", "invalid")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid RUN_MODE [invalid].") {
+		t.Errorf("Expected error for invalid RUN_MODE Got: %s", result)
+	}
+	os.Unsetenv("RUN_MODE")
+
+	os.Setenv("DB_SSLMODE", "invalid")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid DB_SSLMODE [invalid].") {
+		t.Errorf("Expected error for invalid DB_SSLMODE Got: %s", result)
+	}
+	os.Unsetenv("DB_SSLMODE")
+
+	os.Setenv("DB_SCHEMA", "Hub-1")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid DB_SCHEMA [Hub-1].") {
+		t.Errorf("Expected error for invalid DB_SCHEMA Got: %s", result)
+	}
+	os.Unsetenv("DB_SCHEMA")
+
+	os.Setenv("DB_DATA_COMPRESSION", "zstd")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid DB_DATA_COMPRESSION [zstd].") {
+		t.Errorf("Expected error for invalid DB_DATA_COMPRESSION Got: %s", result)
+	}
+	os.Unsetenv("DB_DATA_COMPRESSION")
+
+	os.Setenv("DB_COMPRESSION_THRESHOLD", "64")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment DB_COMPRESSION_THRESHOLD must be") {
+		t.Errorf("Expected error for invalid DB_COMPRESSION_THRESHOLD Got: %s", result)
+	}
+	os.Unsetenv("DB_COMPRESSION_THRESHOLD")
+
+	os.Setenv("DB_STATEMENT_CACHE_MODE", "invalid")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid DB_STATEMENT_CACHE_MODE [invalid].") {
+		t.Errorf("Expected error for invalid DB_STATEMENT_CACHE_MODE Got: %s", result)
+	}
+	os.Unsetenv("DB_STATEMENT_CACHE_MODE")
+
+	os.Setenv("OVERSIZED_RESOURCES", "invalid")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid OVERSIZED_RESOURCES [invalid].") {
+		t.Errorf("Expected error for invalid OVERSIZED_RESOURCES Got: %s", result)
+	}
+	os.Unsetenv("OVERSIZED_RESOURCES")
+
+	os.Setenv("REDACT_PROPERTIES", "*password*,[token")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid REDACT_PROPERTIES pattern [[token].") {
+		t.Errorf("Expected error for invalid REDACT_PROPERTIES Got: %s", result)
+	}
+	os.Unsetenv("REDACT_PROPERTIES")
+
+	os.Setenv("STRIP_PROPERTIES", "managedFields,condition[:x]")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid STRIP_PROPERTIES rule [condition[:x]].") {
+		t.Errorf("Expected error for invalid STRIP_PROPERTIES Got: %s", result)
+	}
+	os.Unsetenv("STRIP_PROPERTIES")
+
+	os.Setenv("CLUSTER_LABEL_SELECTOR", "vendor in (OpenShift")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid CLUSTER_LABEL_SELECTOR [vendor in (OpenShift].") {
+		t.Errorf("Expected error for invalid CLUSTER_LABEL_SELECTOR Got: %s", result)
+	}
+	os.Unsetenv("CLUSTER_LABEL_SELECTOR")
+
+	os.Setenv("PUBLISH_SKIP_NAMESPACES", "openshift-*,[kube")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid PUBLISH_SKIP_NAMESPACES pattern [[kube].") {
+		t.Errorf("Expected error for invalid PUBLISH_SKIP_NAMESPACES Got: %s", result)
+	}
+	os.Unsetenv("PUBLISH_SKIP_NAMESPACES")
+
+	os.Setenv("PUBLISH_PROPERTY_SELECTOR", "status in (Failed")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid PUBLISH_PROPERTY_SELECTOR [status in (Failed].") {
+		t.Errorf("Expected error for invalid PUBLISH_PROPERTY_SELECTOR Got: %s", result)
+	}
+	os.Unsetenv("PUBLISH_PROPERTY_SELECTOR")
+
+	os.Setenv("CONFIG_RELOAD_DIR", "/missing/config")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid CONFIG_RELOAD_DIR [/missing/config].") {
+		t.Errorf("Expected error for invalid CONFIG_RELOAD_DIR Got: %s", result)
+	}
+	os.Unsetenv("CONFIG_RELOAD_DIR")
+
+	os.Setenv("CLUSTER_EVENT_WORKERS", "0")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Environment CLUSTER_EVENT_QPS and CLUSTER_EVENT_WORKERS") {
+		t.Errorf("Expected error for CLUSTER_EVENT_WORKERS=0 Got: %s", result)
+	}
+	os.Unsetenv("CLUSTER_EVENT_WORKERS")
+
+	os.Setenv("LEADER_RENEW_DEADLINE_MS", "15000")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid leader election timings.") {
+		t.Errorf("Expected error for LEADER_RENEW_DEADLINE_MS equal to LEADER_LEASE_DURATION_MS Got: %s", result)
+	}
+	os.Unsetenv("LEADER_RENEW_DEADLINE_MS")
+
+	os.Setenv("STORAGE_BACKEND", "invalid")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid STORAGE_BACKEND [invalid].") {
+		t.Errorf("Expected error for invalid STORAGE_BACKEND Got: %s", result)
+	}
+	os.Setenv("FEATURE_GATES", "OpenSearchStore=true")
+	os.Setenv("STORAGE_BACKEND", "opensearch")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || result.Error() != "Required environment OPENSEARCH_URL is not set." {
+		t.Errorf("Expected error for missing OPENSEARCH_URL Got: %s", result)
+	}
+	os.Unsetenv("FEATURE_GATES")
+	os.Unsetenv("STORAGE_BACKEND")
+
+	os.Setenv("DB_REQUEST_BATCH_WORKERS", "0")
+	conf = new()
+	result = conf.Validate()
+	if result == nil ||
+		result.Error() != "Environment DB_BATCH_WORKERS and DB_REQUEST_BATCH_WORKERS must be greater than 0." {
+		t.Errorf("Expected error for DB_REQUEST_BATCH_WORKERS=0 Got: %s", result)
+	}
+	os.Unsetenv("DB_REQUEST_BATCH_WORKERS")
+
+	// Password isn't required with client certificate authentication.
+	os.Setenv("DB_PASS", "")
+	os.Setenv("DB_SSLCERT", "/certs/tls.crt")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || result.Error() != "Environment DB_SSLCERT and DB_SSLKEY must be set together." {
+		t.Errorf("Expected error when DB_SSLKEY is missing Got: %s", result)
+	}
+	os.Setenv("DB_SSLKEY", "/certs/tls.key")
+	conf = new()
+	result = conf.Validate()
+	if result != nil {
+		t.Errorf("Expected %v Got: %+v", nil, result)
+	}
+	os.Unsetenv("DB_SSLCERT")
+	os.Unsetenv("DB_SSLKEY")
+
+	// RDS IAM auth token is generated for a single host.
+	os.Setenv("DB_IAM_AUTH", "true")
+	os.Setenv("AWS_REGION", "us-east-1")
+	os.Setenv("DB_HOST", "primary.example.com,standby.example.com")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || result.Error() != "Environment DB_HOST must be a single host when DB_IAM_AUTH is enabled." {
+		t.Errorf("Expected error for multiple hosts with DB_IAM_AUTH Got: %s", result)
+	}
+	os.Unsetenv("DB_IAM_AUTH")
+	os.Unsetenv("AWS_REGION")
+	os.Unsetenv("DB_HOST")
+
+	// The credentials can be read from files instead of the environment.
+	os.Setenv("DB_PASS", "")
+	os.Setenv("DB_PASS_FILE", "/missing/password")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || !strings.HasPrefix(result.Error(), "Invalid DB_PASS_FILE [/missing/password].") {
+		t.Errorf("Expected error for missing DB_PASS_FILE Got: %s", result)
+	}
+	passFile := filepath.Join(t.TempDir(), "password")
+	_ = os.WriteFile(passFile, []byte("test"), 0600)
+	os.Setenv("DB_PASS_FILE", passFile)
+	conf = new()
+	result = conf.Validate()
+	if result != nil {
+		t.Errorf("Expected %v Got: %+v", nil, result)
+	}
+	os.Setenv("DB_IAM_AUTH", "true")
+	os.Setenv("AWS_REGION", "us-east-1")
+	conf = new()
+	result = conf.Validate()
+	if result == nil || result.Error() != "Environment DB_USER_FILE and DB_PASS_FILE can't be used with DB_IAM_AUTH." {
+		t.Errorf("Expected error for DB_PASS_FILE with DB_IAM_AUTH Got: %s", result)
+	}
+	os.Unsetenv("DB_IAM_AUTH")
+	os.Unsetenv("AWS_REGION")
+	os.Unsetenv("DB_PASS_FILE")
+
 	os.Setenv("DB_PASS", "")
 	conf = new()
 	result = conf.Validate()
@@ -94,6 +526,15 @@ func Test_Validate(t *testing.T) {
 		t.Errorf("Expected %s Got: %s", "Required environment DB_PASS is not set.", result)
 	}
 
+	// Password isn't required when connecting to a unix socket.
+	os.Setenv("DB_HOST", "/var/run/postgresql")
+	conf = new()
+	result = conf.Validate()
+	if result != nil {
+		t.Errorf("Expected %v Got: %+v", nil, result)
+	}
+	os.Unsetenv("DB_HOST")
+
 	os.Setenv("DB_USER", "")
 	conf = new()
 	result = conf.Validate()
@@ -0,0 +1,105 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feature gates.
+// The subsystems that aren't stable are registered here, so they can ship disabled and be enabled per environment
+// with FEATURE_GATES, a comma-separated list of <feature>=<true|false> like Kubernetes. For example:
+//   FEATURE_GATES=ChangeStream=true,KafkaSyncEvents=true
+// An alpha feature is disabled by default, a beta feature is enabled by default. The gate is removed when the
+// feature is GA. Check a gate with Cfg.FeatureEnabled() where the subsystem starts, not on every request.
+
+type Feature string
+
+const (
+	// Adjust the batch size to the database latency with DB_BATCH_ADAPTIVE. See database/adaptiveBatch.go
+	AdaptiveBatching Feature = "AdaptiveBatching"
+	// Publish the resource changes to Kafka or NATS. See kafka/producer.go
+	ChangeStream Feature = "ChangeStream"
+	// Consume the sync events of the collectors from Kafka. See kafka/consumer.go
+	KafkaSyncEvents Feature = "KafkaSyncEvents"
+	// Store the data in memory with STORAGE_BACKEND=memory. See memory/store.go
+	MemoryStore Feature = "MemoryStore"
+	// Store the data in OpenSearch with STORAGE_BACKEND=opensearch. See opensearch/store.go
+	OpenSearchStore Feature = "OpenSearchStore"
+	// Buffer the batches during a database outage with DB_OUTAGE_BUFFER_SIZE. See database/outageBuffer.go
+	OutageBuffer Feature = "OutageBuffer"
+)
+
+type featureSpec struct {
+	stage   string // alpha or beta
+	enabled bool   // Default.
+}
+
+var features = map[Feature]featureSpec{
+	AdaptiveBatching: {stage: "alpha", enabled: false},
+	ChangeStream:     {stage: "alpha", enabled: false},
+	KafkaSyncEvents:  {stage: "alpha", enabled: false},
+	MemoryStore:      {stage: "alpha", enabled: false},
+	OpenSearchStore:  {stage: "alpha", enabled: false},
+	OutageBuffer:     {stage: "alpha", enabled: false},
+}
+
+// Returns true if the feature is enabled with FEATURE_GATES, or by default.
+func (cfg *Config) FeatureEnabled(feature Feature) bool {
+	if enabled, ok := cfg.featureGates[feature]; ok {
+		return enabled
+	}
+	return features[feature].enabled
+}
+
+// Returns the state of every feature, enabled with FEATURE_GATES or by default.
+func (cfg *Config) FeatureStates() map[Feature]bool {
+	states := make(map[Feature]bool, len(features))
+	for feature := range features {
+		states[feature] = cfg.FeatureEnabled(feature)
+	}
+	return states
+}
+
+// Replaces the feature gates, in the FEATURE_GATES format.
+func (cfg *Config) SetFeatureGates(gates string) error {
+	featureGates, err := parseFeatureGates(gates)
+	if err != nil {
+		return err
+	}
+	cfg.FeatureGates, cfg.featureGates = gates, featureGates
+	return nil
+}
+
+func parseFeatureGates(gates string) (map[Feature]bool, error) {
+	featureGates := map[Feature]bool{}
+	for _, gate := range strings.Split(gates, ",") {
+		if gate = strings.TrimSpace(gate); gate == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(gate, "=")
+		feature := Feature(strings.TrimSpace(name))
+		if _, ok := features[feature]; !ok {
+			return nil, fmt.Errorf("Invalid FEATURE_GATES [%s]. Unknown feature %s, must be one of: %s.", gates,
+				feature, strings.Join(featureNames(), ", "))
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid FEATURE_GATES [%s]. Must be <feature>=<true|false>.", gates)
+		}
+		featureGates[feature] = enabled
+	}
+	return featureGates, nil
+}
+
+func featureNames() []string {
+	names := make([]string, 0, len(features))
+	for feature := range features {
+		names = append(names, string(feature))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Should use the default of the features not set in FEATURE_GATES.
+func Test_FeatureEnabled(t *testing.T) {
+	os.Setenv("FEATURE_GATES", "ChangeStream=true, ")
+	defer os.Unsetenv("FEATURE_GATES")
+
+	conf := new()
+
+	assert.True(t, conf.FeatureEnabled(ChangeStream))
+	assert.False(t, conf.FeatureEnabled(KafkaSyncEvents))
+	assert.False(t, conf.FeatureEnabled("Unknown"))
+}
+
+// Should not publish the changes with the ChangeStream feature disabled.
+func Test_FeatureEnabled_publishesChanges(t *testing.T) {
+	conf := new()
+	conf.KafkaRestURL, conf.KafkaTopic = "https://kafka-rest:8082", "search-changes"
+	assert.False(t, conf.PublishesChanges())
+
+	assert.Nil(t, conf.SetFeatureGates("ChangeStream=true"))
+
+	assert.True(t, conf.PublishesChanges())
+}
+
+// Should reject the unknown features and the invalid values.
+func Test_SetFeatureGates_invalid(t *testing.T) {
+	conf := new()
+
+	err := conf.SetFeatureGates("DeltaSync=true")
+	assert.EqualError(t, err, "Invalid FEATURE_GATES [DeltaSync=true]. Unknown feature DeltaSync, must be one of: "+
+		"AdaptiveBatching, ChangeStream, KafkaSyncEvents, MemoryStore, OpenSearchStore, OutageBuffer.")
+	err = conf.SetFeatureGates("ChangeStream")
+	assert.EqualError(t, err, "Invalid FEATURE_GATES [ChangeStream]. Must be <feature>=<true|false>.")
+	assert.Equal(t, "", conf.FeatureGates)
+}
+
+// Should require the feature gates of the experimental subsystems.
+func Test_Validate_featureGates(t *testing.T) {
+	conf := new()
+	conf.DBPass = "secret"
+	conf.StorageBackend = "memory"
+	assert.EqualError(t, conf.Validate(), "The memory STORAGE_BACKEND requires the MemoryStore feature gate.")
+
+	assert.Nil(t, conf.SetFeatureGates("MemoryStore=true"))
+	assert.Nil(t, conf.Validate())
+
+	conf.StorageBackend = "postgres"
+	conf.DBOutageBuffer = 1000
+	assert.EqualError(t, conf.Validate(), "Environment DB_OUTAGE_BUFFER_SIZE requires the OutageBuffer feature gate.")
+}
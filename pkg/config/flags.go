@@ -0,0 +1,68 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Command-line flags.
+// The main settings can be set with flags, which override the environment variables and the config file. Each flag
+// is named like its environment variable, in lowercase with '-' instead of '_', for example --db-host=localhost.
+// The other settings are only read from the environment or the config file. The passwords can't be set with a
+// flag, the command line is visible to the other processes, use --db-pass-file instead.
+
+// Settings from the flags, by environment variable. Set by LoadFlags()
+var flagSettings = map[string]string{}
+
+// Settings that can be set with a flag, with the flag usage.
+var flagUsages = []struct{ env, usage string }{
+	{"DB_BATCH_SIZE", "Batch size used to write to the database."},
+	{"DB_HOST", "Comma-separated list of database hosts, or a unix socket directory."},
+	{"DB_MAX_CONNS", "Max database connections."},
+	{"DB_NAME", "Database name."},
+	{"DB_PASS_FILE", "File with the database password."},
+	{"DB_PORT", "Database port."},
+	{"DB_SCHEMA", "Schema for the search tables."},
+	{"DB_SSLMODE", "Postgres sslmode."},
+	{"DB_USER", "Database user."},
+	{"EVENT_TRANSPORT", "Transport of the resource changes: kafka or nats."},
+	{"FEATURE_GATES", "Comma-separated <feature>=<true|false>."},
+	{"KAFKA_REST_URL", "Kafka REST Proxy URL to publish the resource changes."},
+	{"KAFKA_TOPIC", "Kafka topic for the resource changes."},
+	{"LOG_FORMAT", "Format of the logs: text or json."},
+	{"NATS_URL", "NATS URL to publish the resource changes."},
+	{"REQUEST_LIMIT", "Max concurrent sync requests."},
+	{"RUN_MODE", "Components to run: all, server, or clustersync."},
+	{"SLOW_LOG", "Log the operations slower than this time in ms."},
+	{"STORAGE_BACKEND", "Store for the indexed data: postgres, opensearch, or memory."},
+}
+
+// Adds the --config flag and the flags of the settings to the flag set.
+func AddFlags(fs *pflag.FlagSet) {
+	fs.String("config", "", "YAML or JSON file with the settings. Overrides CONFIG_FILE.")
+	for _, f := range flagUsages {
+		fs.String(flagName(f.env), "", f.usage+" Overrides "+f.env+".")
+	}
+}
+
+// Reads the config with the flags set in the parsed flag set, which override the environment and the config file.
+func LoadFlags(fs *pflag.FlagSet) *Config {
+	settings := map[string]string{}
+	for _, f := range flagUsages {
+		if flag := fs.Lookup(flagName(f.env)); flag != nil && flag.Changed {
+			settings[f.env] = flag.Value.String()
+		}
+	}
+	settingsMux.Lock()
+	flagSettings = settings
+	settingsMux.Unlock()
+	file, _ := fs.GetString("config")
+	return Load(file)
+}
+
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(env), "_", "-")
+}
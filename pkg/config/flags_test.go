@@ -0,0 +1,41 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should read the settings from the flags, overriding the environment and the config file.
+func Test_LoadFlags(t *testing.T) {
+	file := writeConfigFile(t, "DB_HOST: file.example.com\nDB_NAME: filedb\nDB_PORT: 5433\n")
+	os.Setenv("DB_NAME", "envdb")
+	os.Setenv("DB_PORT", "5434")
+	defer os.Unsetenv("DB_NAME")
+	defer os.Unsetenv("DB_PORT")
+	defer restoreCfg()()
+	defer func() { flagSettings = map[string]string{} }()
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(fs)
+	err := fs.Parse([]string{"migrate", "--config", file, "--db-port=6000", "--run-mode", "server"})
+	assert.Nil(t, err)
+
+	conf := LoadFlags(fs)
+
+	assert.Equal(t, "migrate", fs.Arg(0))
+	assert.Equal(t, file, conf.ConfigFile)
+	assert.Equal(t, "file.example.com", conf.DBHost)
+	assert.Equal(t, "envdb", conf.DBName)
+	assert.Equal(t, 6000, conf.DBPort)
+	assert.Equal(t, "server", conf.RunMode)
+}
+
+// Should name the flags like the environment variables.
+func Test_flagName(t *testing.T) {
+	assert.Equal(t, "db-pass-file", flagName("DB_PASS_FILE"))
+}
@@ -12,6 +12,7 @@ import (
 
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
+	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
 )
 
 // If env KUBECONFIG is defined, use it. Otherise use default location ~/.kube/config
@@ -71,3 +72,13 @@ func GetDynamicClient() dynamic.Interface {
 
 	return newDynamicClient
 }
+
+// Get the typed client for the cluster.open-cluster-management.io resources.
+func GetClusterClient() clusterclientset.Interface {
+	newClusterClient, err := clusterclientset.NewForConfig(getKubeConfig())
+	if err != nil {
+		klog.Fatal("Cannot Construct Cluster Client ", err)
+	}
+
+	return newClusterClient
+}
@@ -0,0 +1,120 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+)
+
+// Range checks.
+// Validate() checks the numeric settings against these ranges, and reports the malformed values that
+// getEnvAsInt() and getEnvAsBool() replaced with the default, instead of starting with a setting that isn't the
+// one configured. All these problems are reported together, so a deployment with several mistakes is fixed in one
+// pass. The settings with a dedicated check in Validate(), like the leader election timings, aren't listed here.
+
+type settingRange struct {
+	env   string
+	value int
+	min   int
+	max   int
+}
+
+// Malformed values read by readSettings(). See invalidSetting()
+var malformedSettings []string
+
+func (cfg *Config) settingRanges() []settingRange {
+	const noMax = math.MaxInt
+	return []settingRange{
+		{"BACKPRESSURE_INFLIGHT_BATCHES", cfg.BackpressureBatches, 0, noMax},
+		{"BACKPRESSURE_LATENCY_MS", cfg.BackpressureLatency, 0, noMax},
+		{"CLUSTER_CACHE_SYNC_MS", cfg.ClusterCacheSyncMS, 0, noMax},
+		{"CLUSTER_CACHE_TTL_MS", cfg.ClusterCacheTTL, 0, noMax},
+		{"CLUSTER_DELETE_GRACE_MS", cfg.ClusterDeleteGrace, 0, noMax},
+		{"CLUSTER_TOTALS_TTL_MS", cfg.ClusterTotalsTTL, 0, noMax},
+		{"CONSISTENCY_CHECK_MS", cfg.ConsistencyCheckMS, 0, noMax},
+		{"DATA_GIN_INDEX_MAX_SIZE_MB", cfg.DataGINMaxSizeMB, 0, noMax},
+		{"DB_BATCH_LINGER_MS", cfg.DBBatchLingerMS, 0, noMax},
+		{"DB_BATCH_MAX_SIZE", cfg.DBBatchMaxSize, 1, noMax},
+		{"DB_BATCH_MIN_SIZE", cfg.DBBatchMinSize, 1, cfg.DBBatchMaxSize},
+		{"DB_BATCH_SIZE", cfg.DBBatchSize, 1, noMax},
+		{"DB_BATCH_TARGET_MS", cfg.DBBatchTargetMS, 1, noMax},
+		{"DB_COPY_THRESHOLD", cfg.DBCopyThreshold, 0, noMax},
+		{"DB_MAX_CONNS", int(cfg.DBMaxConns), 1, noMax},
+		{"DB_MAX_CONN_IDLE_TIME", cfg.DBMaxConnIdleTime, 0, noMax},
+		{"DB_MAX_CONN_LIFE_JITTER", cfg.DBMaxConnLifeJitter, 0, noMax},
+		{"DB_MAX_CONN_LIFE_TIME", cfg.DBMaxConnLifeTime, 0, noMax},
+		{"DB_MIN_CONNS", int(cfg.DBMinConns), 0, int(cfg.DBMaxConns)},
+		{"DB_OUTAGE_BUFFER_SIZE", cfg.DBOutageBuffer, 0, noMax},
+		{"DB_PORT", cfg.DBPort, 1, 65535},
+		{"DB_STATEMENT_CACHE_CAPACITY", cfg.DBStmtCacheCapacity, 0, noMax},
+		{"DB_STATEMENT_TIMEOUT", cfg.DBStatementTimeout, 0, noMax},
+		{"DEAD_LETTER_MAX_ROWS", cfg.DeadLetterMaxRows, 0, noMax},
+		{"DEAD_LETTER_RETENTION_HOURS", cfg.DeadLetterRetention, 1, noMax},
+		{"HTTP_TIMEOUT", cfg.HTTPTimeout, 1000, noMax},
+		{"KAFKA_PARTITION", cfg.KafkaPartition, -1, noMax},
+		{"LARGE_REQUEST_LIMIT", cfg.LargeRequestLimit, 1, noMax},
+		{"LARGE_REQUEST_SIZE", cfg.LargeRequestSize, 1, noMax},
+		{"LOG_SAMPLE_RATE", cfg.LogSampleRate, 1, noMax},
+		{"MAINTENANCE_INTERVAL_MS", cfg.MaintenanceMS, 0, noMax},
+		{"MAINTENANCE_THRESHOLD_PCT", cfg.MaintenancePct, 1, noMax},
+		{"MAX_BACKOFF_MS", cfg.MaxBackoffMS, 0, noMax},
+		{"MAX_PROPERTY_SIZE", cfg.MaxPropertySize, 0, noMax},
+		{"MAX_RESOURCE_SIZE", cfg.MaxResourceSize, 0, noMax},
+		{"OFFLINE_CLUSTER_PURGE_GRACE_MS", cfg.OfflinePurgeGrace, 0, noMax},
+		{"ORPHAN_EDGE_CLEANUP_MS", cfg.OrphanEdgeCleanupMS, 0, noMax},
+		{"REDISCOVER_RATE_MS", cfg.RediscoverRateMS, 1000, noMax},
+		{"REQUEST_LIMIT", cfg.RequestLimit, 1, noMax},
+		{"RESOURCE_HISTORY_RETENTION_HOURS", cfg.HistoryRetention, 1, noMax},
+		{"RESYNC_PERIOD_MS", cfg.ResyncPeriodMS, 0, noMax},
+		{"SLOW_LOG", cfg.SlowLog, 1, noMax},
+		{"SOFT_DELETE_RETENTION_HOURS", cfg.SoftDeleteRetention, 1, noMax},
+		{"STALE_CLUSTER_TTL_HOURS", cfg.StaleClusterTTL, 0, noMax},
+		{"STALE_DATA_WINDOW_MS", cfg.StaleDataWindowMS, 0, noMax},
+		{"TRACING_SAMPLE_PCT", cfg.TracingSamplePct, 0, 100},
+	}
+}
+
+// Returns the malformed values, the settings out of range, and the invalid URLs.
+func (cfg *Config) settingProblems() []string {
+	problems := append([]string{}, cfg.malformed...)
+	for _, r := range cfg.settingRanges() {
+		if r.value >= r.min && r.value <= r.max {
+			continue
+		}
+		if r.max == math.MaxInt {
+			problems = append(problems, fmt.Sprintf("Invalid %s [%d]. Must be at least %d.", r.env, r.value, r.min))
+		} else {
+			problems = append(problems, fmt.Sprintf("Invalid %s [%d]. Must be between %d and %d.", r.env, r.value,
+				r.min, r.max))
+		}
+	}
+	for env, value := range map[string]string{"KAFKA_REST_URL": cfg.KafkaRestURL,
+		"KAFKA_OAUTH_TOKEN_URL": cfg.KafkaOAuthTokenURL, "OPENSEARCH_URL": cfg.OpenSearchURL,
+		"OTEL_EXPORTER_OTLP_ENDPOINT": cfg.TracingEndpoint} {
+		if u, err := url.Parse(value); value != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "") {
+			problems = append(problems, fmt.Sprintf("Invalid %s [%s]. Must be an http:// or https:// URL.", env,
+				value))
+		}
+	}
+	return problems
+}
+
+// Returns the problems as a single error, with one problem per line when there are several.
+func problemsError(problems []string) error {
+	if len(problems) == 1 {
+		return errors.New(problems[0])
+	}
+	return fmt.Errorf("Found %d invalid settings:\n  %s", len(problems), strings.Join(problems, "\n  "))
+}
+
+// Records a value that can't be parsed, getEnvAsInt() and getEnvAsBool() use the default instead.
+func invalidSetting(env, value, expected string) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	malformedSettings = append(malformedSettings, fmt.Sprintf("Invalid %s [%s]. Must be %s.", env, value, expected))
+}
@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Should report the malformed values and the settings out of range together.
+func Test_Validate_settingProblems(t *testing.T) {
+	os.Setenv("DB_BATCH_SIZE", "0")
+	os.Setenv("DB_PORT", "5432x")
+	os.Setenv("RESOURCE_HISTORY", "yes")
+	os.Setenv("DB_MIN_CONNS", "20")
+	os.Setenv("KAFKA_REST_URL", "kafka-rest:8082")
+	defer func() {
+		for _, env := range []string{"DB_BATCH_SIZE", "DB_PORT", "RESOURCE_HISTORY", "DB_MIN_CONNS", "KAFKA_REST_URL"} {
+			os.Unsetenv(env)
+		}
+	}()
+
+	conf := new()
+	err := conf.Validate()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Found 5 invalid settings:\n")
+	assert.Contains(t, err.Error(), "\n  Invalid DB_PORT [5432x]. Must be an integer.")
+	assert.Contains(t, err.Error(), "\n  Invalid RESOURCE_HISTORY [yes]. Must be true or false.")
+	assert.Contains(t, err.Error(), "\n  Invalid DB_BATCH_SIZE [0]. Must be at least 1.")
+	assert.Contains(t, err.Error(), "\n  Invalid DB_MIN_CONNS [20]. Must be between 0 and 10.")
+	assert.Contains(t, err.Error(), "\n  Invalid KAFKA_REST_URL [kafka-rest:8082]. Must be an http:// or https:// URL.")
+	// The malformed values use the default.
+	assert.Equal(t, 5432, conf.DBPort)
+}
+
+// Should return a single problem without the summary.
+func Test_Validate_settingProblem(t *testing.T) {
+	os.Setenv("SLOW_LOG", "0")
+	defer os.Unsetenv("SLOW_LOG")
+
+	err := new().Validate()
+
+	assert.EqualError(t, err, "Invalid SLOW_LOG [0]. Must be at least 1.")
+}
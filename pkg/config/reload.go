@@ -0,0 +1,129 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Config reload.
+// With CONFIG_RELOAD_DIR, the indexer reads the tunables below from a directory with a mounted ConfigMap, and
+// applies the changes without a restart. Each file is named like the environment variable and contains the value,
+// for example a ConfigMap with the key REQUEST_LIMIT. The files are read every configReloadInterval.
+//   - DB_BATCH_SIZE         Applies to the next batch.
+//   - LARGE_REQUEST_LIMIT   Applies to the next request.
+//   - LARGE_REQUEST_SIZE    Applies to the next request.
+//   - REDISCOVER_RATE_MS    Applies after the next rediscover, and to the informers started after the change.
+//   - REQUEST_LIMIT         Applies to the next request.
+//   - SLOW_LOG              Applies to the operations completed after the change.
+// A tunable without a file keeps the value from the environment. An invalid value is logged and ignored. The other
+// settings are read once at startup. Use Live() to read the tunables, the fields of Cfg keep the startup values.
+
+const configReloadInterval = 10 * time.Second
+
+// Settings that can change at runtime. See Live()
+type Tunables struct {
+	DBBatchSize       int
+	LargeRequestLimit int
+	LargeRequestSize  int
+	RediscoverRateMS  int
+	RequestLimit      int
+	SlowLog           int
+}
+
+var liveTunables atomic.Pointer[Tunables]
+
+// Returns the current tunables. The values from Cfg until they're reloaded.
+func Live() Tunables {
+	if tunables := liveTunables.Load(); tunables != nil {
+		return *tunables
+	}
+	return Cfg.tunables()
+}
+
+// Replaces the current tunables. Use nil to restore the values from Cfg.
+func SetTunables(tunables *Tunables) {
+	liveTunables.Store(tunables)
+}
+
+func (cfg *Config) tunables() Tunables {
+	return Tunables{
+		DBBatchSize:       cfg.DBBatchSize,
+		LargeRequestLimit: cfg.LargeRequestLimit,
+		LargeRequestSize:  cfg.LargeRequestSize,
+		RediscoverRateMS:  cfg.RediscoverRateMS,
+		RequestLimit:      cfg.RequestLimit,
+		SlowLog:           cfg.SlowLog,
+	}
+}
+
+// Reloads the tunables from CONFIG_RELOAD_DIR until the context is cancelled.
+func WatchReload(ctx context.Context) {
+	klog.Infof("Reloading the tunables from %s.", Cfg.ConfigReloadDir)
+	for {
+		reload(Cfg.ConfigReloadDir)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(configReloadInterval):
+		}
+	}
+}
+
+// Fields of the tunables, by environment variable.
+var tunableFields = map[string]func(*Tunables) *int{
+	"DB_BATCH_SIZE":       func(t *Tunables) *int { return &t.DBBatchSize },
+	"LARGE_REQUEST_LIMIT": func(t *Tunables) *int { return &t.LargeRequestLimit },
+	"LARGE_REQUEST_SIZE":  func(t *Tunables) *int { return &t.LargeRequestSize },
+	"REDISCOVER_RATE_MS":  func(t *Tunables) *int { return &t.RediscoverRateMS },
+	"REQUEST_LIMIT":       func(t *Tunables) *int { return &t.RequestLimit },
+	"SLOW_LOG":            func(t *Tunables) *int { return &t.SlowLog },
+}
+
+// Reads the tunables from the directory, and replaces the current tunables if they changed.
+func reload(dir string) {
+	current := Live()
+	tunables := Cfg.tunables()
+	for env, field := range tunableFields {
+		value, err := readTunable(dir, env)
+		switch {
+		case err != nil:
+			// Keep the current value, so an invalid edit doesn't restore the startup value.
+			klog.Warningf("Ignoring the reloaded %s. %s", env, err)
+			*field(&tunables) = *field(&current)
+		case value > 0:
+			*field(&tunables) = value
+		}
+	}
+	if tunables != current {
+		klog.Infof("Reloaded the tunables from %s. %+v", dir, tunables)
+		SetTunables(&tunables)
+	}
+}
+
+// Returns the value in the file named env, 0 if the file doesn't exist.
+func readTunable(dir, env string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, env))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("Must be an integer greater than 0, got [%s].", strings.TrimSpace(string(data)))
+	}
+	return value, nil
+}
@@ -0,0 +1,44 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Should read the tunables from the files, and keep the environment values without a file.
+func Test_reload(t *testing.T) {
+	defer SetTunables(nil)
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "REQUEST_LIMIT"), []byte("40\n"), 0600)
+	_ = os.WriteFile(filepath.Join(dir, "DB_BATCH_SIZE"), []byte("1000"), 0600)
+
+	reload(dir)
+
+	tunables := Live()
+	assert.Equal(t, 40, tunables.RequestLimit)
+	assert.Equal(t, 1000, tunables.DBBatchSize)
+	assert.Equal(t, Cfg.SlowLog, tunables.SlowLog)
+	assert.Equal(t, 25, Cfg.RequestLimit)
+}
+
+// Should keep the current value when the file has an invalid value, and restore the environment value when the
+// file is removed.
+func Test_reload_invalid(t *testing.T) {
+	defer SetTunables(nil)
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "REQUEST_LIMIT"), []byte("40"), 0600)
+	reload(dir)
+
+	_ = os.WriteFile(filepath.Join(dir, "REQUEST_LIMIT"), []byte("forty"), 0600)
+	reload(dir)
+	assert.Equal(t, 40, Live().RequestLimit)
+
+	_ = os.Remove(filepath.Join(dir, "REQUEST_LIMIT"))
+	reload(dir)
+	assert.Equal(t, Cfg.RequestLimit, Live().RequestLimit)
+}
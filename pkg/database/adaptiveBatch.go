@@ -0,0 +1,73 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/metrics"
+)
+
+// Adaptive batch size.
+// With DB_BATCH_ADAPTIVE, the batch size is adjusted after each batch sent to the database, within
+// DB_BATCH_MIN_SIZE and DB_BATCH_MAX_SIZE, so a small database stays responsive and a large one gets bigger batches.
+//   - A batch that fails is split to isolate the error, see batch.go. The size is halved, so the retries are cheaper.
+//   - A batch slower than DB_BATCH_TARGET_MS shrinks the size in proportion, at most by half.
+//   - A full batch faster than half the target grows the size by 25%. The batches flushed after the linger time
+//     aren't full, and don't grow the size.
+// DB_BATCH_SIZE is the initial size, a reloaded DB_BATCH_SIZE is ignored. The current size is reported with the
+// search_indexer_batch_size metric. The OpenSearch store uses DB_BATCH_SIZE.
+
+type adaptiveBatchSize struct {
+	mu     sync.Mutex
+	size   int
+	min    int
+	max    int
+	target time.Duration // Batch latency to stay under.
+}
+
+func newAdaptiveBatchSize(initial, min, max int, target time.Duration) *adaptiveBatchSize {
+	a := &adaptiveBatchSize{size: initial, min: min, max: max, target: target}
+	a.clamp()
+	metrics.BatchSize.Set(float64(a.size))
+	return a
+}
+
+// Returns the current batch size.
+func (a *adaptiveBatchSize) get() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size
+}
+
+// Adjusts the size after sending a batch of the items.
+func (a *adaptiveBatchSize) observe(items int, latency time.Duration, failed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case failed:
+		a.size /= 2
+	case latency > a.target:
+		size := int(float64(a.size) * float64(a.target) / float64(latency))
+		if size < a.size/2 {
+			size = a.size / 2
+		}
+		a.size = size
+	case latency < a.target/2 && items >= a.size:
+		a.size += a.size/4 + 1
+	default:
+		return
+	}
+	a.clamp()
+	metrics.BatchSize.Set(float64(a.size))
+}
+
+func (a *adaptiveBatchSize) clamp() {
+	if a.size < a.min {
+		a.size = a.min
+	}
+	if a.size > a.max {
+		a.size = a.max
+	}
+}
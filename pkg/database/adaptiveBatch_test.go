@@ -0,0 +1,49 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Should grow the size after a fast full batch, and not after a partial batch.
+func Test_adaptiveBatchSize_grow(t *testing.T) {
+	a := newAdaptiveBatchSize(100, 10, 1000, time.Second)
+
+	a.observe(50, 100*time.Millisecond, false)
+	assert.Equal(t, 100, a.get())
+
+	a.observe(100, 100*time.Millisecond, false)
+	assert.Equal(t, 126, a.get())
+}
+
+// Should shrink the size in proportion to the latency over the target, at most by half.
+func Test_adaptiveBatchSize_shrink(t *testing.T) {
+	a := newAdaptiveBatchSize(100, 10, 1000, time.Second)
+
+	a.observe(100, 1250*time.Millisecond, false)
+	assert.Equal(t, 80, a.get())
+
+	a.observe(80, 10*time.Second, false)
+	assert.Equal(t, 40, a.get())
+
+	a.observe(40, 100*time.Millisecond, true)
+	assert.Equal(t, 20, a.get())
+}
+
+// Should keep the size within the bounds.
+func Test_adaptiveBatchSize_bounds(t *testing.T) {
+	a := newAdaptiveBatchSize(5000, 10, 1000, time.Second)
+	assert.Equal(t, 1000, a.get())
+
+	a.observe(1000, time.Millisecond, false)
+	assert.Equal(t, 1000, a.get())
+
+	for i := 0; i < 10; i++ {
+		a.observe(10, 100*time.Millisecond, true)
+	}
+	assert.Equal(t, 10, a.get())
+}
@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+// Weight of the latest batch in the average latency.
+const latencyWeight = 0.2
+
+// Tracks the batches sent to the database for all requests. Used to apply backpressure to the sync requests
+// when the database falls behind, for example during a resync of all the managed clusters.
+type batchLoad struct {
+	mu         sync.Mutex
+	inFlight   int           // Batches waiting for a worker or processing.
+	avgLatency time.Duration // Moving average of the time to process a batch.
+}
+
+func (l *batchLoad) start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight++
+}
+
+func (l *batchLoad) done(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if l.avgLatency == 0 {
+		l.avgLatency = latency
+	} else {
+		l.avgLatency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(l.avgLatency))
+	}
+}
+
+// Checks if the database is falling behind the sync requests. When overloaded, returns the estimated
+// time to process the in-flight batches, which the server uses to tell the collector when to retry.
+func (dao *DAO) Backpressure() (overloaded bool, retryAfter time.Duration) {
+	if dao.load == nil {
+		return false, 0
+	}
+	dao.load.mu.Lock()
+	inFlight, avgLatency := dao.load.inFlight, dao.load.avgLatency
+	dao.load.mu.Unlock()
+
+	if (dao.maxInFlight > 0 && inFlight >= dao.maxInFlight) || (dao.maxLatency > 0 && avgLatency >= dao.maxLatency) {
+		workers := cap(dao.batchSlots)
+		if workers < 1 {
+			workers = 1
+		}
+		retryAfter = time.Duration(inFlight/workers+1) * avgLatency
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		return true, retryAfter
+	}
+	return false, 0
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Should apply backpressure when the in-flight batches exceed the limit.
+func Test_Backpressure_inFlight(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.maxInFlight = 2
+	dao.maxLatency = 0
+
+	overloaded, _ := dao.Backpressure()
+	assert.False(t, overloaded)
+
+	dao.load.start()
+	dao.load.start()
+	overloaded, retryAfter := dao.Backpressure()
+
+	assert.True(t, overloaded)
+	assert.Equal(t, time.Second, retryAfter) // Minimum retry when the latency is unknown.
+}
+
+// Should apply backpressure when the average batch latency exceeds the limit.
+func Test_Backpressure_latency(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.maxInFlight = 0
+	dao.maxLatency = 5 * time.Second
+
+	dao.load.start()
+	dao.load.done(3 * time.Second)
+	overloaded, _ := dao.Backpressure()
+	assert.False(t, overloaded)
+
+	dao.load.start()
+	dao.load.done(20 * time.Second) // Average: 0.2*20s + 0.8*3s = 6.4s
+	overloaded, retryAfter := dao.Backpressure()
+
+	assert.True(t, overloaded)
+	assert.Equal(t, 6400*time.Millisecond, retryAfter)
+}
@@ -5,33 +5,51 @@ package database
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
+	"time"
 
-	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/klog/v2"
 )
 
 // This is a wrapper for pgx.Batch. It add the following.
 //  - The Queue() function checks the size of the queued items and automatically triggers the batch processing.
+//  - With DB_BATCH_LINGER_MS, partially filled batches are processed after the linger time, so items aren't held
+//    in memory indefinitely.
+//  - Bounds the concurrent batches sent to the database per request and for all requests.
 //  - Retry after a batch operation fails. It sends smaller batches to isolate the query producing the error.
 //  - Report queries that resulted in errors.
+//  - Report the retries, how many times a batch was split, and the isolated errors in the SyncResponse and metrics.
+//  - Optionally buffer the items when the database is unavailable, see outageBuffer.go
+//  - Optionally adjust the batch size to the database latency, see adaptiveBatch.go
 
 type batchItem struct {
-	query  string
+	query  string // Values must be passed as positional parameters ($1, $2, ...) in args, never formatted into the query.
 	args   []interface{}
-	action string // Used to report errors.
-	uid    string // Used to report errors.
+	action string         // Used to report errors.
+	uid    string         // Used to report errors.
+	retry  retryStatement // Saved in dead_letter when the item fails permanently. See deadLetter.go
 }
 
 type batchWithRetry struct {
-	connError    error
-	ctx          context.Context
-	items        []batchItem
-	dao          *DAO
-	wg           *sync.WaitGroup
-	syncResponse *model.SyncResponse
+	connError      error
+	ctx            context.Context
+	items          []batchItem
+	dao            *DAO
+	wg             *sync.WaitGroup
+	mu             *sync.Mutex   // Protects items and lingerTimer.
+	lingerTimer    *time.Timer   // Processes a partially filled batch after the linger time.
+	slots          chan struct{} // Limits the concurrent batches for this request.
+	resultMu       *sync.Mutex   // Protects connError, and the statistics and errors in syncResponse.
+	bufferOnOutage bool          // Buffer the items when the database is unavailable.
+	syncResponse   *model.SyncResponse
 }
 
 func NewBatchWithRetry(ctx context.Context, dao *DAO, syncResponse *model.SyncResponse) batchWithRetry {
@@ -39,6 +57,9 @@ func NewBatchWithRetry(ctx context.Context, dao *DAO, syncResponse *model.SyncRe
 		ctx:          ctx,
 		items:        make([]batchItem, 0),
 		wg:           &sync.WaitGroup{},
+		mu:           &sync.Mutex{},
+		slots:        make(chan struct{}, dao.requestWorkers),
+		resultMu:     &sync.Mutex{},
 		dao:          dao,
 		syncResponse: syncResponse,
 	}
@@ -47,77 +68,94 @@ func NewBatchWithRetry(ctx context.Context, dao *DAO, syncResponse *model.SyncRe
 
 // Adds a query to the queue and check if there's enough items to process the batch.
 func (b *batchWithRetry) Queue(item batchItem) error {
-	if b.connError != nil { // Can't queue more items after DB connection error.
-		return b.connError
+	if connError := b.getConnError(); connError != nil { // Can't queue more items after DB connection error.
+		return connError
 	}
+	b.mu.Lock()
 	b.items = append(b.items, item)
 
-	if len(b.items) >= b.dao.batchSize {
-		items := b.items               // Create a snapshot of the items to process.
-		b.items = make([]batchItem, 0) // Reset the queue.
-		b.wg.Add(1)
-		go b.sendBatch(items) // nolint: errcheck
+	var items []batchItem
+	if len(b.items) >= b.dao.getBatchSize() {
+		items = b.takeQueued()
+	} else if len(b.items) == 1 && b.dao.batchLinger > 0 {
+		b.lingerTimer = time.AfterFunc(b.dao.batchLinger, b.flush)
 	}
+	b.mu.Unlock()
+	b.send(items)
 	return nil
 }
 
 // Sends a batch to the database. If the batch results in an error, we divide
 // the batch into smaller batches and retry until we isolate the erroring query.
-func (b *batchWithRetry) sendBatch(items []batchItem) error {
+// The depth is the number of times the batch was divided.
+func (b *batchWithRetry) sendBatch(items []batchItem, depth int) error {
 	defer b.wg.Done()
 
 	batch := &pgx.Batch{}
 	for _, item := range items {
 		batch.Queue(item.query, item.args...)
 	}
-	br := b.dao.pool.SendBatch(b.ctx, batch)
+	ctx, span := tracing.Start(b.ctx, "sendBatch")
+	defer span.End()
+	span.SetAttributes(attribute.Int("items", len(items)), attribute.Int("depth", depth))
+	ctx, cancel := b.dao.withTimeout(ctx)
+	defer cancel()
+	slowLog := metrics.SlowDBOperation("batch", fmt.Sprintf("Slow batch of %d items.", len(items)))
+	start := time.Now()
+	// The batch is pipelined: the statements are sent together and run in an implicit transaction. Exec() returns
+	// the result of the first statement, and Close() reads the rest and returns the first error.
+	br := b.dao.pool.SendBatch(ctx, batch)
 	_, execErr := br.Exec()
-
 	closeErr := br.Close()
-	if closeErr != nil {
-		if strings.Contains(closeErr.Error(), "unexpected EOF") || strings.Contains(closeErr.Error(), "failed to connect") {
-			b.connError = closeErr
-			klog.Error("Send batch failed because database is unavailable. Won't retry.")
-			return errors.New("Failed to connect to database.")
+	slowLog()
+	metrics.BatchDuration.Observe(time.Since(start).Seconds())
+	metrics.BatchStatements.Observe(float64(len(items)))
+	if execErr == nil {
+		execErr = closeErr
+	}
+	tracing.SetError(span, execErr)
+	if depth == 0 && b.dao.adaptiveBatch != nil {
+		// The retries of the split batches don't adjust the size again. See adaptiveBatch.go
+		b.dao.adaptiveBatch.observe(len(items), time.Since(start), execErr != nil)
+	}
+	if execErr != nil && isConnectionError(execErr) {
+		if b.bufferOnOutage {
+			if b.dao.bufferItems(items) {
+				b.recordBuffered(len(items))
+				return nil
+			}
+			execErr = ErrOutageBufferFull
 		}
-		klog.Error("Error closing batch result. ", closeErr)
-		return closeErr
+		b.setConnError(execErr)
+		logging.SampledErrorf("Send batch failed because database is unavailable. Won't retry.")
+		metrics.Errors.WithLabelValues("database", "connection").Inc()
+		return errors.New("Failed to connect to database.")
 	}
 
 	// Process errors.
-	// pgx.Batch is processed as a transaction, so in case of an error, the entire batch will fail.
+	// The batch is processed as a transaction, so in case of an error, the entire batch will fail.
 	if execErr != nil && len(items) == 1 {
 
 		errorItem := items[0]
 		klog.Errorf("ERROR processing batchItem. %+v", errorItem)
-
-		var errorArray *[]model.SyncError
-		switch errorItem.action {
-		case "addResource":
-			errorArray = &b.syncResponse.AddErrors
-		case "updateResource":
-			errorArray = &b.syncResponse.UpdateErrors
-		case "deleteResource":
-			errorArray = &b.syncResponse.DeleteErrors
-		case "addEdge":
-			errorArray = &b.syncResponse.AddEdgeErrors
-		case "deleteEdge":
-			errorArray = &b.syncResponse.DeleteEdgeErrors
-		default:
-			klog.Error("Unable to process sync error with type: ", errorItem.action)
+		b.recordFailedItem(errorItem)
+		if b.dao.deadLetter {
+			b.dao.saveDeadLetter(b.ctx, errorItem, execErr)
 		}
-		*errorArray = append(*errorArray,
-			model.SyncError{ResourceUID: errorItem.uid, Message: "Resource generated an error while updating the database."})
 
 		return nil // We have processed the error, so don't return an error here to stop the recursion.
 
 	} else if execErr != nil {
 		// Error in send batch, resend queries using smaller batches.
 		// Use a binary search recursively until we find the error.
+		if depth == 0 {
+			metrics.Errors.WithLabelValues("database", "batch_exec").Inc()
+		}
 
+		b.recordRetry(depth + 1)
 		b.wg.Add(2)
-		err1 := b.sendBatch(items[:len(items)/2])
-		err2 := b.sendBatch(items[len(items)/2:])
+		err1 := b.sendBatch(items[:len(items)/2], depth+1)
+		err2 := b.sendBatch(items[len(items)/2:], depth+1)
 
 		// Returns error only if we fail processing either retry.
 		if err1 != nil && err2 != nil {
@@ -127,12 +165,125 @@ func (b *batchWithRetry) sendBatch(items []batchItem) error {
 	return execErr
 }
 
+// Returns true when the error is caused by the database connection instead of a statement.
+func isConnectionError(err error) bool {
+	return strings.Contains(err.Error(), "unexpected EOF") || strings.Contains(err.Error(), "failed to connect")
+}
+
 // Process all queued items.
 func (b *batchWithRetry) flush() {
-	if len(b.items) > 0 {
-		items := b.items               // Create a snapshot of the items to process.
-		b.items = make([]batchItem, 0) // Reset the queue.
-		b.wg.Add(1)
-		go b.sendBatch(items) // nolint: errcheck
+	b.mu.Lock()
+	items := b.takeQueued()
+	b.mu.Unlock()
+	b.send(items)
+}
+
+// Takes the queued items to send in a new batch. Returns nil if there aren't items to send. The caller must hold
+// the lock, and send the items with send() after releasing it.
+func (b *batchWithRetry) takeQueued() []batchItem {
+	if b.lingerTimer != nil {
+		b.lingerTimer.Stop()
+		b.lingerTimer = nil
+	}
+	if len(b.items) == 0 {
+		return nil
 	}
+	items := b.items               // Create a snapshot of the items to process.
+	b.items = make([]batchItem, 0) // Reset the queue.
+
+	// Add to the items waiting for the database, so the changes are written in order.
+	if b.bufferOnOutage && b.dao.buffer.pending() {
+		if b.dao.bufferItems(items) {
+			b.recordBuffered(len(items))
+		} else {
+			b.setConnError(ErrOutageBufferFull)
+		}
+		return nil
+	}
+	// Add to the wait group while holding the lock, so a flush from another goroutine waits for this batch.
+	b.wg.Add(1)
+	metrics.BatchQueueDepth.Inc()
+	b.dao.load.start()
+	return items
+}
+
+// Sends the items taken from the queue in a new batch.
+func (b *batchWithRetry) send(items []batchItem) {
+	if len(items) == 0 {
+		return
+	}
+	// Wait for a slot for this request before starting the goroutine, so a large request doesn't start a
+	// goroutine for each batch. Then wait for a slot shared by all requests. The lock isn't held while waiting,
+	// so the other goroutines of the request can queue items.
+	b.slots <- struct{}{}
+	go func() {
+		b.dao.batchSlots <- struct{}{}
+		metrics.BatchQueueDepth.Dec()
+		start := time.Now()
+		defer func() {
+			b.dao.load.done(time.Since(start))
+			<-b.dao.batchSlots
+			<-b.slots
+		}()
+		b.sendBatch(items, 0) // nolint: errcheck
+	}()
+}
+
+// Records a batch sent again as two smaller batches after an error.
+func (b *batchWithRetry) recordRetry(depth int) {
+	b.resultMu.Lock()
+	defer b.resultMu.Unlock()
+	b.syncResponse.BatchRetries++
+	if depth > b.syncResponse.BatchSplitDepth {
+		b.syncResponse.BatchSplitDepth = depth
+	}
+	metrics.BatchRetries.Inc()
+	metrics.BatchSplitDepth.Observe(float64(depth))
+}
+
+// Records an item that failed after isolating it in a batch of one, and reports the error in the sync response.
+func (b *batchWithRetry) recordFailedItem(item batchItem) {
+	b.resultMu.Lock()
+	defer b.resultMu.Unlock()
+	b.syncResponse.BatchFailedItems++
+	metrics.BatchFailedItems.Inc()
+	metrics.Errors.WithLabelValues("database", "batch_item").Inc()
+
+	var errorArray *[]model.SyncError
+	switch item.action {
+	case "addResource":
+		errorArray = &b.syncResponse.AddErrors
+	case "updateResource":
+		errorArray = &b.syncResponse.UpdateErrors
+	case "deleteResource":
+		errorArray = &b.syncResponse.DeleteErrors
+	case "addEdge":
+		errorArray = &b.syncResponse.AddEdgeErrors
+	case "deleteEdge":
+		errorArray = &b.syncResponse.DeleteEdgeErrors
+	default:
+		klog.Error("Unable to process sync error with type: ", item.action)
+		return
+	}
+	*errorArray = append(*errorArray,
+		model.SyncError{ResourceUID: item.uid, Message: "Resource generated an error while updating the database."})
+}
+
+// Records the items kept in the outage buffer.
+func (b *batchWithRetry) recordBuffered(count int) {
+	b.resultMu.Lock()
+	defer b.resultMu.Unlock()
+	b.syncResponse.Buffered += count
+}
+
+func (b *batchWithRetry) setConnError(err error) {
+	b.resultMu.Lock()
+	defer b.resultMu.Unlock()
+	b.connError = err
+}
+
+func (b *batchWithRetry) getConnError() error {
+	b.resultMu.Lock()
+	defer b.resultMu.Unlock()
+	return b.connError
 }
@@ -3,18 +3,144 @@
 package database
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 )
 
 func Test_QueueWithErrors(t *testing.T) {
 	mock := &batchWithRetry{
 		connError: errors.New("failed to connect"),
+		resultMu:  &sync.Mutex{},
 	}
 
 	result := mock.Queue(batchItem{})
 
 	assert.NotNil(t, result)
 }
+
+// Should process a partially filled batch after the linger time.
+func Test_QueueWithLinger(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 10
+	dao.batchLinger = 10 * time.Millisecond
+	expectBatch(mockPool, 1, "INSERT", nil)
+	batch := NewBatchWithRetry(context.Background(), &dao, &model.SyncResponse{})
+
+	err := batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-1"})
+
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return mockPool.ExpectationsWereMet() == nil }, time.Second,
+		5*time.Millisecond, "Expected the batch to be sent after the linger time.")
+	batch.wg.Wait()
+}
+
+// Should report the retries, split depth, and failed items after dividing a failing batch.
+func Test_sendBatch_retryStats(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 4
+	dao.deadLetter = false
+	// The failed batches are split and sent again depth first: 1 batch of 4, 2 batches of 2, 4 batches of 1.
+	mockPool.MatchExpectationsInOrder(true)
+	for _, size := range []int{4, 2, 1, 1, 2, 1, 1} {
+		expectBatch(mockPool, size, "INSERT", errors.New("mocking error on exec"))
+	}
+	syncResponse := &model.SyncResponse{}
+	batch := NewBatchWithRetry(context.Background(), &dao, syncResponse)
+	defer testutils.SupressConsoleOutput()()
+
+	for _, uid := range []string{"uid-1", "uid-2", "uid-3", "uid-4"} {
+		assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: uid}))
+	}
+	batch.wg.Wait()
+
+	assert.Equal(t, 3, syncResponse.BatchRetries)
+	assert.Equal(t, 2, syncResponse.BatchSplitDepth)
+	assert.Equal(t, 4, syncResponse.BatchFailedItems)
+	assert.Len(t, syncResponse.AddErrors, 4)
+}
+
+// Should report the errors of all the batches sent concurrently.
+func Test_sendBatch_concurrentErrors(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 1
+	dao.deadLetter = false
+	dao.requestWorkers = 4
+	dao.batchSlots = make(chan struct{}, 4)
+	for i := 0; i < 10; i++ {
+		expectBatch(mockPool, 1, "INSERT", errors.New("mocking error on exec"))
+		expectBatch(mockPool, 1, "DELETE", errors.New("mocking error on exec"))
+	}
+	syncResponse := &model.SyncResponse{}
+	batch := NewBatchWithRetry(context.Background(), &dao, syncResponse)
+	defer testutils.SupressConsoleOutput()()
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid"}))
+		assert.Nil(t, batch.Queue(batchItem{action: "deleteEdge", query: "DELETE", uid: "uid"}))
+	}
+	batch.flush()
+	batch.wg.Wait()
+
+	assert.Equal(t, 20, syncResponse.BatchFailedItems)
+	assert.Len(t, syncResponse.AddErrors, 10)
+	assert.Len(t, syncResponse.DeleteEdgeErrors, 10)
+}
+
+// Returns the samples and the sum observed by the histogram.
+func histogramSamples(name string) (uint64, float64) {
+	families, _ := metrics.PromRegistry.Gather()
+	for _, family := range families {
+		if family.GetName() == name {
+			histogram := family.GetMetric()[0].GetHistogram()
+			return histogram.GetSampleCount(), histogram.GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+// Should record the duration and statements of each batch sent, including the retries.
+func Test_sendBatch_histograms(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 2
+	dao.deadLetter = false
+	for _, size := range []int{2, 1, 1} { // 1 batch of 2, 2 batches of 1.
+		expectBatch(mockPool, size, "INSERT", errors.New("mocking error on exec"))
+	}
+	batch := NewBatchWithRetry(context.Background(), &dao, &model.SyncResponse{})
+	defer testutils.SupressConsoleOutput()()
+	durations, _ := histogramSamples("search_indexer_batch_duration")
+	batches, statements := histogramSamples("search_indexer_batch_statements")
+
+	for _, uid := range []string{"uid-1", "uid-2"} {
+		assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: uid}))
+	}
+	batch.wg.Wait()
+
+	newDurations, _ := histogramSamples("search_indexer_batch_duration")
+	newBatches, newStatements := histogramSamples("search_indexer_batch_statements")
+	assert.Equal(t, durations+3, newDurations)
+	assert.Equal(t, batches+3, newBatches)
+	assert.Equal(t, statements+4, newStatements)
+}
+
+// Should adjust the adaptive batch size after sending a batch.
+func Test_sendBatch_adaptive(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.adaptiveBatch = newAdaptiveBatchSize(2, 1, 100, time.Second)
+	expectBatch(mockPool, 2, "INSERT", nil)
+	batch := NewBatchWithRetry(context.Background(), &dao, &model.SyncResponse{})
+
+	_ = batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-1"})
+	_ = batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-2"})
+	batch.wg.Wait()
+
+	assert.Equal(t, 3, dao.getBatchSize())
+}
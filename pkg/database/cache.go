@@ -2,18 +2,31 @@ package database
 
 import (
 	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 )
 
+// Clusters cache.
+// Keeps the properties of the Cluster nodes, so the leader skips the writes of the Cluster nodes that didn't change.
+// With CLUSTER_CACHE_TTL_MS, the entries expire and the Cluster node is read again from the database, so stale
+// properties aren't trusted forever. The entries are invalidated when the Cluster node is deleted, and the whole cache
+// when the replica stops leading. The size is exposed with search_indexer_clusters_cache_size.
+
 var existingClustersCache map[string]interface{} // a map to hold Current clusters and properties
+var clustersCacheExpiry = map[string]time.Time{} // Expiration of the entries, when CLUSTER_CACHE_TTL_MS is set.
 var mux sync.RWMutex
 
 func ReadClustersCache(uid string) (interface{}, bool) {
 	mux.RLock()
-	defer mux.RUnlock()
-	if existingClustersCache == nil {
-		existingClustersCache = make(map[string]interface{})
-	}
 	data, ok := existingClustersCache[uid]
+	expires, hasExpiry := clustersCacheExpiry[uid]
+	mux.RUnlock()
+	if ok && hasExpiry && time.Now().After(expires) {
+		DeleteClustersCache(uid)
+		return nil, false
+	}
 	return data, ok
 }
 
@@ -25,11 +38,28 @@ func UpdateClustersCache(uid string, data interface{}) {
 	}
 	if uid != "" {
 		existingClustersCache[uid] = data
+		if config.Cfg.ClusterCacheTTL > 0 {
+			clustersCacheExpiry[uid] = time.Now().Add(time.Duration(config.Cfg.ClusterCacheTTL) * time.Millisecond)
+		} else {
+			delete(clustersCacheExpiry, uid)
+		}
 	}
+	metrics.ClustersCacheSize.Set(float64(len(existingClustersCache)))
 }
 
 func DeleteClustersCache(uid string) {
 	mux.Lock()
 	defer mux.Unlock()
 	delete(existingClustersCache, uid)
+	delete(clustersCacheExpiry, uid)
+	metrics.ClustersCacheSize.Set(float64(len(existingClustersCache)))
+}
+
+// Removes all the entries. The Cluster nodes are read again from the database when needed.
+func InvalidateClustersCache() {
+	mux.Lock()
+	defer mux.Unlock()
+	existingClustersCache = make(map[string]interface{})
+	clustersCacheExpiry = map[string]time.Time{}
+	metrics.ClustersCacheSize.Set(0)
 }
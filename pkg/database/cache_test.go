@@ -0,0 +1,54 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should read the cluster from the database again after the entry expires.
+func Test_ClustersCache_expires(t *testing.T) {
+	config.Cfg.ClusterCacheTTL = 10
+	defer func() { config.Cfg.ClusterCacheTTL = 60 * 60 * 1000 }()
+	defer InvalidateClustersCache()
+
+	UpdateClustersCache("cluster__cluster-a", map[string]interface{}{"name": "cluster-a"})
+	_, ok := ReadClustersCache("cluster__cluster-a")
+	assert.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = ReadClustersCache("cluster__cluster-a")
+	assert.False(t, ok, "Expected the entry to expire.")
+}
+
+// Should keep the entry until it's deleted when the TTL is disabled.
+func Test_ClustersCache_noTTL(t *testing.T) {
+	config.Cfg.ClusterCacheTTL = 0
+	defer func() { config.Cfg.ClusterCacheTTL = 60 * 60 * 1000 }()
+	defer InvalidateClustersCache()
+
+	UpdateClustersCache("cluster__cluster-a", map[string]interface{}{"name": "cluster-a"})
+	time.Sleep(5 * time.Millisecond)
+	_, ok := ReadClustersCache("cluster__cluster-a")
+	assert.True(t, ok)
+
+	DeleteClustersCache("cluster__cluster-a")
+	_, ok = ReadClustersCache("cluster__cluster-a")
+	assert.False(t, ok)
+}
+
+// Should remove all the entries.
+func Test_InvalidateClustersCache(t *testing.T) {
+	UpdateClustersCache("cluster__cluster-a", map[string]interface{}{"name": "cluster-a"})
+	UpdateClustersCache("cluster__cluster-b", map[string]interface{}{"name": "cluster-b"})
+
+	InvalidateClustersCache()
+
+	_, ok := ReadClustersCache("cluster__cluster-a")
+	assert.False(t, ok)
+	assert.Empty(t, existingClustersCache)
+}
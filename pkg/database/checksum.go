@@ -0,0 +1,55 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+)
+
+// Cluster checksum.
+// Each resource is stored with a hash of its uid and data, updated with every change to the resource. The
+// cluster checksum is the sum of the hashes of the cluster resources, so it doesn't depend on the order and
+// collectors can update their own checksum incrementally as resources change. When the collector sends its
+// checksum, the indexer compares it with the database and responds if a full resync is needed, instead of
+// the collector resyncing blindly.
+
+// Hash of a resource. FNV-1a (32 bit) of the uid followed by the JSON properties (encoding/json, sorted keys).
+// Uses 32 bits, so the sum of the hashes doesn't overflow a BIGINT.
+func ResourceHash(uid string, data []byte) int64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(uid))
+	_, _ = h.Write(data)
+	return int64(h.Sum32())
+}
+
+// Returns the checksum of the cluster resources in the database.
+// Resources written before the hash was tracked have a NULL hash, so the checksum doesn't match until a resync.
+func (dao *DAO) ClusterChecksum(ctx context.Context, clusterName string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "DAO.ClusterChecksum")
+	defer span.End()
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, "SELECT COALESCE(SUM(hash), 0)::BIGINT FROM resources "+
+		"WHERE cluster=$1 AND deleted_at IS NULL", clusterName)
+	if err != nil {
+		logging.SampledErrorf("Error querying checksum for cluster %s. %s", clusterName, err)
+		return 0, err
+	}
+	defer rows.Close()
+
+	var checksum int64
+	if rows.Next() {
+		err = rows.Scan(&checksum)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		logging.SampledErrorf("Error reading checksum for cluster %s. %s", clusterName, err)
+	}
+	return checksum, err
+}
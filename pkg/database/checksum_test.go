@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should hash the uid and the data.
+func Test_resourceHash(t *testing.T) {
+	hash := ResourceHash("uid-1", []byte(`{"kind":"Pod"}`))
+
+	assert.Equal(t, int64(1237752304), hash)
+	assert.Equal(t, hash, ResourceHash("uid-1", []byte(`{"kind":"Pod"}`)))
+	assert.NotEqual(t, hash, ResourceHash("uid-2", []byte(`{"kind":"Pod"}`)))
+	assert.NotEqual(t, hash, ResourceHash("uid-1", []byte(`{"kind":"Deployment"}`)))
+}
+
+const checksumSql = "SELECT COALESCE(SUM(hash), 0)::BIGINT FROM resources " +
+	"WHERE cluster=$1 AND deleted_at IS NULL"
+
+func Test_ClusterChecksum(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"checksum"}).AddRow(int64(12345))
+	mockPool.ExpectQuery(checksumSql).WithArgs("cluster-a").WillReturnRows(rows)
+
+	checksum, err := dao.ClusterChecksum(context.Background(), "cluster-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(12345), checksum)
+}
+
+func Test_ClusterChecksum_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectQuery(checksumSql).WithArgs("cluster-a").WillReturnError(errors.New("connection refused"))
+
+	_, err := dao.ClusterChecksum(context.Background(), "cluster-a")
+
+	assert.NotNil(t, err)
+}
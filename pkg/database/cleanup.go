@@ -0,0 +1,27 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Runs the task immediately and then at every interval until the context is cancelled.
+// Used by the background jobs cleaning up old data.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, task func(context.Context)) {
+	klog.Infof("Starting %s. Interval: %s", name, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		task(ctx)
+		select {
+		case <-ctx.Done():
+			klog.V(2).Infof("Stopping %s.", name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
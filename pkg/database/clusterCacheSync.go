@@ -0,0 +1,116 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Clusters cache sync.
+// The leader keeps the properties of the Cluster nodes in existingClustersCache to skip the writes of unchanged
+// Cluster nodes, see clusterPropsUpToDate(). The cache drifts from the database when the rows are changed by someone
+// else, e.g. a previous leader or a manual change, and then the leader skips a write the database needs. With
+// CLUSTER_CACHE_SYNC_MS, the leader periodically compares the cached entries with the rows in the database:
+//   - changed: the cached properties don't match the row. The entry is replaced with the properties in the database.
+//   - deleted: the row doesn't exist. The entry is removed, the Cluster node is written with the next upsert.
+// The properties written by the sync requests aren't compared, see clusterSyncPropNames. The rows that aren't in the
+// cache are loaded when needed, see clusterInDB(). Each discrepancy is logged and counted with the
+// search_indexer_cluster_cache_discrepancies metric.
+// An upsert running at the same time can be written again with the next event, the result is the same.
+
+const selectClustersSql = "SELECT uid, data FROM clusters"
+
+// Periodically reconciles the clusters cache with the database. Runs until the context is cancelled.
+func (dao *DAO) StartClusterCacheSync(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "clusters cache sync", interval, func(ctx context.Context) {
+		_, _ = dao.syncClusterCache(ctx)
+	})
+}
+
+// Compares the cached Cluster nodes with the database and fixes the entries that don't match.
+// Returns the number of entries fixed.
+func (dao *DAO) syncClusterCache(ctx context.Context) (int, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, selectClustersSql)
+	if err != nil {
+		logging.SampledErrorf("Error reading the clusters to sync the clusters cache. %s", err)
+		return 0, err
+	}
+	defer rows.Close()
+	dbClusters := map[string]map[string]interface{}{}
+	for rows.Next() {
+		var uid string
+		var data map[string]interface{}
+		if err = rows.Scan(&uid, &data); err != nil {
+			klog.Errorf("Error reading cluster row to sync the clusters cache. %s", err)
+			continue
+		}
+		dbClusters[uid] = data
+	}
+	if err = rows.Err(); err != nil {
+		logging.SampledErrorf("Error reading the clusters to sync the clusters cache. %s", err)
+		return 0, err
+	}
+
+	mux.RLock()
+	cached := make(map[string]interface{}, len(existingClustersCache))
+	for uid, data := range existingClustersCache {
+		cached[uid] = data
+	}
+	mux.RUnlock()
+
+	discrepancies := 0
+	for uid, cachedData := range cached {
+		dbData, ok := dbClusters[uid]
+		switch {
+		case !ok:
+			klog.Warningf("Cluster %s is in the clusters cache but not in the database. Removing from the cache.",
+				strings.TrimPrefix(uid, "cluster__"))
+			DeleteClustersCache(uid)
+			metrics.ClusterCacheDiscrepancies.WithLabelValues("deleted").Inc()
+		case !sameClusterProps(cachedData, dbData):
+			klog.Warningf("Cluster %s in the clusters cache doesn't match the database. Updating the cache.",
+				strings.TrimPrefix(uid, "cluster__"))
+			UpdateClustersCache(uid, withoutClusterSyncProps(dbData))
+			metrics.ClusterCacheDiscrepancies.WithLabelValues("changed").Inc()
+		default:
+			continue
+		}
+		discrepancies++
+	}
+	klog.V(2).Infof("Synced the clusters cache. Cached: %d Discrepancies: %d", len(cached), discrepancies)
+	return discrepancies, nil
+}
+
+// Compares the cached properties with the database row, ignoring the properties written by the sync requests.
+// Both are compared as JSON because the numbers read from the database are float64. The map keys are sorted.
+func sameClusterProps(cachedData interface{}, dbData map[string]interface{}) bool {
+	cachedProps, ok := cachedData.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	cachedJSON, cachedErr := json.Marshal(withoutClusterSyncProps(cachedProps))
+	dbJSON, dbErr := json.Marshal(withoutClusterSyncProps(dbData))
+	return cachedErr == nil && dbErr == nil && bytes.Equal(cachedJSON, dbJSON)
+}
+
+// Returns a copy of the properties without the properties written by the sync requests.
+func withoutClusterSyncProps(props map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(props))
+	for key, value := range props {
+		result[key] = value
+	}
+	for _, key := range clusterSyncPropNames {
+		delete(result, key)
+	}
+	return result
+}
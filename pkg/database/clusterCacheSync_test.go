@@ -0,0 +1,57 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should fix the cached entries that don't match the database and keep the ones that match.
+func Test_syncClusterCache(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	UpdateClustersCache("cluster__cluster-a", map[string]interface{}{"name": "cluster-a", "nodes": 3})
+	UpdateClustersCache("cluster__cluster-b", map[string]interface{}{"name": "cluster-b", "nodes": 3})
+	UpdateClustersCache("cluster__cluster-c", map[string]interface{}{"name": "cluster-c"})
+	defer func() {
+		DeleteClustersCache("cluster__cluster-a")
+		DeleteClustersCache("cluster__cluster-b")
+		DeleteClustersCache("cluster__cluster-c")
+	}()
+	rows := pgxmock.NewRows([]string{"uid", "data"}).
+		AddRow("cluster__cluster-a", map[string]interface{}{"name": "cluster-a", "nodes": float64(3),
+			"lastSyncTime": "2026-10-15T10:00:00Z"}).
+		AddRow("cluster__cluster-b", map[string]interface{}{"name": "cluster-b", "nodes": float64(5)}).
+		AddRow("cluster__cluster-d", map[string]interface{}{"name": "cluster-d"})
+	mockPool.ExpectQuery(selectClustersSql).WillReturnRows(rows)
+
+	discrepancies, err := dao.syncClusterCache(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, discrepancies)
+	clusterA, _ := ReadClustersCache("cluster__cluster-a")
+	assert.Equal(t, map[string]interface{}{"name": "cluster-a", "nodes": 3}, clusterA, "Expected to keep the entry.")
+	clusterB, _ := ReadClustersCache("cluster__cluster-b")
+	assert.Equal(t, map[string]interface{}{"name": "cluster-b", "nodes": float64(5)}, clusterB)
+	_, ok := ReadClustersCache("cluster__cluster-c")
+	assert.False(t, ok, "Expected to remove the cluster deleted from the database.")
+	_, ok = ReadClustersCache("cluster__cluster-d")
+	assert.False(t, ok, "Expected the clusters not in the cache to be loaded when needed.")
+}
+
+func Test_syncClusterCache_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectQuery(selectClustersSql).WillReturnError(errors.New("connection refused"))
+
+	discrepancies, err := dao.syncClusterCache(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, discrepancies)
+}
@@ -0,0 +1,53 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"k8s.io/klog/v2"
+)
+
+// Cluster identity.
+// The Cluster node keeps the UID of the ManagedCluster (_managedClusterUID) and the cluster ID claim
+// (clusterClaim.id.k8s.io), so the leader can detect a cluster that was detached and imported again with a new
+// ManagedCluster or under a different name. See clustersync/clusterIdentity.go
+
+// Identity of a Cluster node in the database.
+type ClusterIdentity struct {
+	Name              string
+	ManagedClusterUID string // Empty for the nodes written before the UID was kept.
+	ClusterID         string // Empty when the cluster doesn't have the id.k8s.io claim.
+}
+
+const clusterIdentitiesSql = "SELECT name, coalesce(data->>'_managedClusterUID', ''), " +
+	"coalesce(data->'clusterClaim'->>'id.k8s.io', '') FROM clusters " +
+	"WHERE uid = $1 OR ($2 != '' AND data->'clusterClaim'->>'id.k8s.io' = $2)"
+
+// Returns the identity of the Cluster node with the name and of the Cluster nodes with the same cluster ID.
+func (dao *DAO) ClusterIdentities(ctx context.Context, clusterName, clusterID string) ([]ClusterIdentity, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, clusterIdentitiesSql, "cluster__"+clusterName, clusterID)
+	if err != nil {
+		logging.SampledErrorf("Error querying the identity of cluster %s. %s", clusterName, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]ClusterIdentity, 0)
+	for rows.Next() {
+		var identity ClusterIdentity
+		if err = rows.Scan(&identity.Name, &identity.ManagedClusterUID, &identity.ClusterID); err != nil {
+			klog.Errorf("Error reading the identity of cluster %s. %s", clusterName, err)
+			continue
+		}
+		identities = append(identities, identity)
+	}
+	if err = rows.Err(); err != nil {
+		logging.SampledErrorf("Error querying the identity of cluster %s. %s", clusterName, err)
+		return nil, err
+	}
+	return identities, nil
+}
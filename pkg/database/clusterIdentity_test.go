@@ -0,0 +1,31 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should return the Cluster node with the name and the Cluster nodes with the same cluster ID.
+func Test_ClusterIdentities(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"name", "managed_cluster_uid", "cluster_id"}).
+		AddRow("cluster-a", "uid-a", "cluster-id-1").
+		AddRow("cluster-b", "", "cluster-id-1")
+	mockPool.ExpectQuery("SELECT name, coalesce(data->>'_managedClusterUID', ''), "+
+		"coalesce(data->'clusterClaim'->>'id.k8s.io', '') FROM clusters "+
+		"WHERE uid = $1 OR ($2 != '' AND data->'clusterClaim'->>'id.k8s.io' = $2)").
+		WithArgs("cluster__cluster-a", "cluster-id-1").WillReturnRows(rows)
+
+	identities, err := dao.ClusterIdentities(context.Background(), "cluster-a", "cluster-id-1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ClusterIdentity{
+		{Name: "cluster-a", ManagedClusterUID: "uid-a", ClusterID: "cluster-id-1"},
+		{Name: "cluster-b", ClusterID: "cluster-id-1"},
+	}, identities)
+}
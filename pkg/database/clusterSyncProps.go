@@ -0,0 +1,75 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+)
+
+// Cluster sync properties.
+// The Cluster node has the time of the last successful sync and the version of the collector, so users can search
+// for the clusters whose data is stale and dashboards can show the indexing lag of each cluster.
+//   - lastSyncTime: time of the last successful sync, in RFC3339 format.
+//   - collectorVersion: version sent by the collector, if any.
+//   - searchDataStale: set by the stale data check, see staleData.go
+// The properties are merged into the Cluster node written by the leader, see goquUpsertCluster(), because the sync
+// requests are received by all the replicas. To avoid rewriting the Cluster node on every sync, lastSyncTime is
+// written at most once per clusterSyncPropsInterval unless the collector version changes.
+
+const clusterSyncPropsInterval = time.Minute
+
+// The collector version is only set when it's sent. The sync clears searchDataStale.
+const updateClusterSyncPropsSql = "UPDATE clusters SET data = (data - 'searchDataStale') || jsonb_strip_nulls(" +
+	"jsonb_build_object('lastSyncTime', $2::text, 'collectorVersion', NULLIF($3, ''))) WHERE uid = $1"
+
+// Keeps the properties written by the sync requests and by the stale data check when the leader updates the
+// Cluster node.
+const keepClusterSyncPropsSql = `EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object(` +
+	`'lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', ` +
+	`'searchDataStale', "c".data->'searchDataStale'))`
+
+// Properties of the Cluster node that aren't written by the leader, see clusterCacheSync.go
+var clusterSyncPropNames = []string{"lastSyncTime", "collectorVersion", "searchDataStale"}
+
+type clusterSyncWrite struct {
+	time             time.Time
+	collectorVersion string
+}
+
+var clusterSyncWrites = map[string]clusterSyncWrite{} // Last write of the sync properties by this replica.
+var clusterSyncWritesMux sync.Mutex
+
+// Writes lastSyncTime and collectorVersion to the Cluster node. Errors are logged.
+func (dao *DAO) updateClusterSyncProps(ctx context.Context, clusterName, collectorVersion string) {
+	now := time.Now()
+	clusterSyncWritesMux.Lock()
+	last, ok := clusterSyncWrites[clusterName]
+	if ok && now.Sub(last.time) < clusterSyncPropsInterval && last.collectorVersion == collectorVersion {
+		clusterSyncWritesMux.Unlock()
+		return
+	}
+	clusterSyncWrites[clusterName] = clusterSyncWrite{time: now, collectorVersion: collectorVersion}
+	clusterSyncWritesMux.Unlock()
+
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	res, err := dao.pool.Exec(ctx, updateClusterSyncPropsSql, "cluster__"+clusterName,
+		now.UTC().Format(time.RFC3339), collectorVersion)
+	if err != nil {
+		logging.SampledErrorf("Error updating the sync properties of cluster %s. %s", clusterName, err)
+		forgetClusterSyncWrite(clusterName) // Retry on the next sync.
+	} else if res.RowsAffected() == 0 {
+		forgetClusterSyncWrite(clusterName) // The leader didn't write the Cluster node yet.
+	}
+}
+
+// Writes the sync properties on the next sync after the Cluster node is deleted.
+func forgetClusterSyncWrite(clusterName string) {
+	clusterSyncWritesMux.Lock()
+	defer clusterSyncWritesMux.Unlock()
+	delete(clusterSyncWrites, clusterName)
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should write the sync properties once per interval, unless the collector version changes.
+func Test_updateClusterSyncProps(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	defer forgetClusterSyncWrite("cluster-a")
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs("cluster__cluster-a", pgxmock.AnyArg(), "2.13.0").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs("cluster__cluster-a", pgxmock.AnyArg(), "2.14.0").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	dao.updateClusterSyncProps(context.Background(), "cluster-a", "2.13.0")
+	dao.updateClusterSyncProps(context.Background(), "cluster-a", "2.13.0") // Within the interval.
+	dao.updateClusterSyncProps(context.Background(), "cluster-a", "2.14.0")
+
+	assert.Equal(t, "2.14.0", clusterSyncWrites["cluster-a"].collectorVersion)
+}
+
+// Should write the sync properties again on the next sync when the Cluster node doesn't exist or the write fails.
+func Test_updateClusterSyncProps_retry(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	defer forgetClusterSyncWrite("cluster-a")
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs(anyArgs(3)...).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs(anyArgs(3)...).
+		WillReturnError(errors.New("conn closed"))
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs(anyArgs(3)...).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	dao.updateClusterSyncProps(context.Background(), "cluster-a", "")
+	dao.updateClusterSyncProps(context.Background(), "cluster-a", "")
+	dao.updateClusterSyncProps(context.Background(), "cluster-a", "")
+
+	assert.Contains(t, clusterSyncWrites, "cluster-a")
+}
@@ -0,0 +1,63 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+)
+
+// Cluster totals cache.
+// The response to each sync includes the total resources and edges of the cluster, so the collector can validate
+// its state. Counting the rows of a large cluster on every sync is slow, so when CLUSTER_TOTALS_TTL_MS is set the
+// totals are kept in memory and updated with the changes applied by each sync. The totals are counted again after
+// the TTL, which corrects the drift from syncs handled by other indexer replicas, and after a resync or delete.
+
+type cachedClusterTotals struct {
+	resources int
+	edges     int
+	countedAt time.Time
+}
+
+var totalsCache = map[string]cachedClusterTotals{}
+var totalsMux sync.Mutex
+
+// Returns the totals of the cluster if they were counted within the TTL.
+func cachedTotals(clusterName string, ttl time.Duration) (cachedClusterTotals, bool) {
+	totalsMux.Lock()
+	defer totalsMux.Unlock()
+	totals, ok := totalsCache[clusterName]
+	if !ok || time.Since(totals.countedAt) > ttl {
+		return cachedClusterTotals{}, false
+	}
+	return totals, true
+}
+
+// Saves the totals counted from the database.
+func saveTotals(clusterName string, resources, edges int) {
+	totalsMux.Lock()
+	defer totalsMux.Unlock()
+	totalsCache[clusterName] = cachedClusterTotals{resources: resources, edges: edges, countedAt: time.Now()}
+}
+
+// Updates the cached totals with the changes applied by a sync.
+func applySyncToTotals(clusterName string, syncResponse *model.SyncResponse) {
+	totalsMux.Lock()
+	defer totalsMux.Unlock()
+	totals, ok := totalsCache[clusterName]
+	if !ok {
+		return
+	}
+	totals.resources += syncResponse.TotalAdded - syncResponse.TotalDeleted
+	totals.edges += syncResponse.TotalEdgesAdded - syncResponse.TotalEdgesDeleted
+	totalsCache[clusterName] = totals
+}
+
+// Removes the cluster totals, so they are counted from the database on the next sync.
+func invalidateTotals(clusterName string) {
+	totalsMux.Lock()
+	defer totalsMux.Unlock()
+	delete(totalsCache, clusterName)
+}
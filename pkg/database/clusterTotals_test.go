@@ -0,0 +1,51 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should count the totals once, then use the totals kept in memory updated with the synced changes.
+func Test_ClusterTotals_cached(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.totalsTTL = time.Minute
+	defer invalidateTotals("cluster-totals")
+	testutils.MockClusterTotals(mockPool, "cluster-totals", 10, 5)
+
+	resources, edges, err := dao.ClusterTotals(context.Background(), "cluster-totals")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, resources)
+	assert.Equal(t, 5, edges)
+
+	applySyncToTotals("cluster-totals",
+		&model.SyncResponse{TotalAdded: 3, TotalDeleted: 1, TotalEdgesAdded: 1, TotalEdgesDeleted: 2})
+	resources, edges, err = dao.ClusterTotals(context.Background(), "cluster-totals")
+	assert.Nil(t, err)
+	assert.Equal(t, 12, resources)
+	assert.Equal(t, 4, edges)
+}
+
+// Should count the totals again after the TTL or when invalidated.
+func Test_cachedTotals_expired(t *testing.T) {
+	saveTotals("cluster-totals", 10, 5)
+	_, ok := cachedTotals("cluster-totals", time.Minute)
+	assert.True(t, ok)
+	_, ok = cachedTotals("cluster-totals", 0)
+	assert.False(t, ok)
+
+	invalidateTotals("cluster-totals")
+	_, ok = cachedTotals("cluster-totals", time.Minute)
+	assert.False(t, ok)
+
+	// Shouldn't track the changes of a cluster without totals.
+	applySyncToTotals("cluster-totals", &model.SyncResponse{TotalAdded: 3})
+	_, ok = cachedTotals("cluster-totals", time.Minute)
+	assert.False(t, ok)
+}
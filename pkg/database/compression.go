@@ -0,0 +1,73 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// Compression of large resources.
+// Postgres compresses large values when it moves them to TOAST storage, so the compression is transparent to
+// search-api and the other readers of search.resources.
+//   - DB_DATA_COMPRESSION        Compression of the data column, pglz or lz4. lz4 is faster, requires Postgres 14.
+//   - DB_COMPRESSION_THRESHOLD   Rows larger than this size in bytes are compressed. Sets toast_tuple_target,
+//     the server default is ~2 KB.
+// The settings apply to the rows written after the change. Existing rows are compressed when they're updated.
+
+// Minimum server version to set the column compression.
+const columnCompressionVersion = 140000
+
+// Applies the compression settings to search.resources.
+func (dao *DAO) configureCompression(ctx context.Context) error {
+	if config.Cfg.DBCompression != "" {
+		version, err := dao.serverVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if version < columnCompressionVersion {
+			klog.Warningf("Ignoring DB_DATA_COMPRESSION=%s because it requires Postgres 14 or later.",
+				config.Cfg.DBCompression)
+		} else {
+			klog.Infof("Using %s compression for the resource data.", config.Cfg.DBCompression)
+			_, err = dao.pool.Exec(ctx, fmt.Sprintf("ALTER TABLE resources ALTER COLUMN data SET COMPRESSION %s",
+				config.Cfg.DBCompression))
+			if err != nil {
+				return fmt.Errorf("Error setting the compression of the resource data. %w", err)
+			}
+		}
+	}
+	if config.Cfg.DBCompressThreshold > 0 {
+		klog.Infof("Compressing the resources larger than %d bytes.", config.Cfg.DBCompressThreshold)
+		_, err := dao.pool.Exec(ctx, fmt.Sprintf("ALTER TABLE resources SET (toast_tuple_target = %d)",
+			config.Cfg.DBCompressThreshold))
+		if err != nil {
+			return fmt.Errorf("Error setting the compression threshold of the resources. %w", err)
+		}
+	}
+	return nil
+}
+
+// Returns the Postgres server version number. Example: 140005 for 14.5
+func (dao *DAO) serverVersion(ctx context.Context) (int, error) {
+	rows, err := dao.pool.Query(ctx, "SELECT current_setting('server_version_num')::int")
+	if err != nil {
+		return 0, fmt.Errorf("Error reading the server version. %w", err)
+	}
+	defer rows.Close()
+
+	var version int
+	if rows.Next() {
+		err = rows.Scan(&version)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Error reading the server version. %w", err)
+	}
+	return version, nil
+}
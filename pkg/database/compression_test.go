@@ -0,0 +1,62 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setCompressionConfig(t *testing.T, compression string, threshold int) {
+	originalCompression, originalThreshold := config.Cfg.DBCompression, config.Cfg.DBCompressThreshold
+	t.Cleanup(func() {
+		config.Cfg.DBCompression, config.Cfg.DBCompressThreshold = originalCompression, originalThreshold
+	})
+	config.Cfg.DBCompression, config.Cfg.DBCompressThreshold = compression, threshold
+}
+
+func mockServerVersion(mockPool pgxmock.PgxPoolIface, version int) {
+	mockPool.ExpectQuery("SELECT current_setting('server_version_num')::int").
+		WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func Test_configureCompression(t *testing.T) {
+	setCompressionConfig(t, "lz4", 1024)
+	dao, mockPool := buildMockDAO(t)
+	mockServerVersion(mockPool, 150002)
+	mockPool.ExpectExec("ALTER TABLE resources ALTER COLUMN data SET COMPRESSION lz4").
+		WillReturnResult(pgxmock.NewResult("ALTER", 0))
+	mockPool.ExpectExec("ALTER TABLE resources SET (toast_tuple_target = 1024)").
+		WillReturnResult(pgxmock.NewResult("ALTER", 0))
+
+	err := dao.configureCompression(context.Background())
+
+	assert.Nil(t, err)
+}
+
+// Should skip the column compression on Postgres versions older than 14.
+func Test_configureCompression_oldVersion(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	setCompressionConfig(t, "lz4", 0)
+	dao, mockPool := buildMockDAO(t)
+	mockServerVersion(mockPool, 130010)
+
+	err := dao.configureCompression(context.Background())
+
+	assert.Nil(t, err)
+}
+
+// Should not change the table with the default settings.
+func Test_configureCompression_disabled(t *testing.T) {
+	setCompressionConfig(t, "", 0)
+	dao, _ := buildMockDAO(t)
+
+	err := dao.configureCompression(context.Background())
+
+	assert.Nil(t, err)
+}
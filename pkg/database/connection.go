@@ -4,31 +4,100 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/driftprogramming/pgxpoolmock"
-	"github.com/jackc/pgx/v4"
-	pgxpool "github.com/jackc/pgx/v4/pgxpool"
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
+// Database connection pool used by the DAO. Implemented by *pgxpool.Pool, and by pgxmock.PgxPoolIface
+// in the unit tests. Lists only the methods used by the DAO to limit the code depending on the pgx version.
+type DBPool interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
 // Database Access Object. Use a DAO instance so we can replace the pool object in the unit tests.
 type DAO struct {
-	pool      pgxpoolmock.PgxPool
-	batchSize int
+	pool             DBPool
+	batchSize        int                // Overrides the reloadable DB_BATCH_SIZE when set. See getBatchSize()
+	adaptiveBatch    *adaptiveBatchSize // Nil unless DB_BATCH_ADAPTIVE. See adaptiveBatch.go
+	batchLinger      time.Duration
+	batchSlots       chan struct{} // Limits the concurrent batches for all requests.
+	requestWorkers   int
+	load             *batchLoad    // Tracks the in-flight batches and latency to apply backpressure.
+	buffer           *outageBuffer // Items waiting for the database to be available. See outageBuffer.go
+	maxInFlight      int
+	maxLatency       time.Duration
+	copyThreshold    int
+	deadLetter       bool
+	deferEdges       bool
+	notify           bool
+	softDelete       bool
+	statementTimeout time.Duration
+	totalsTTL        time.Duration // Use the cluster totals kept in memory within the TTL. See clusterTotals.go
+	stripRules       []stripRule
+	limits           sizeLimits
+	redact           redactRules
+	schema           string // Tenant schema with the search tables. See tenant.go
+}
+
+// Returns the max items in a batch.
+func (dao *DAO) getBatchSize() int {
+	if dao.batchSize > 0 {
+		return dao.batchSize
+	}
+	if dao.adaptiveBatch != nil {
+		return dao.adaptiveBatch.get()
+	}
+	return config.Live().DBBatchSize
 }
 
-var poolSingleton pgxpoolmock.PgxPool
+var poolSingleton DBPool
 
 // Creates new DAO instance.
-func NewDAO(p pgxpoolmock.PgxPool) DAO {
+func NewDAO(p DBPool) DAO {
 	// Crete DAO with default values.
 	dao := DAO{
-		batchSize: config.Cfg.DBBatchSize,
+		batchLinger:      time.Duration(config.Cfg.DBBatchLingerMS) * time.Millisecond,
+		batchSlots:       make(chan struct{}, config.Cfg.DBBatchWorkers),
+		requestWorkers:   config.Cfg.DBRequestWorkers,
+		load:             &batchLoad{},
+		buffer:           newOutageBuffer(config.Cfg.DBOutageBuffer),
+		maxInFlight:      config.Cfg.BackpressureBatches,
+		maxLatency:       time.Duration(config.Cfg.BackpressureLatency) * time.Millisecond,
+		copyThreshold:    config.Cfg.DBCopyThreshold,
+		deadLetter:       config.Cfg.DeadLetter,
+		deferEdges:       config.Cfg.DeferEdges,
+		notify:           config.Cfg.NotifyChanges,
+		softDelete:       config.Cfg.SoftDelete,
+		statementTimeout: time.Duration(config.Cfg.DBStatementTimeout) * time.Millisecond,
+		totalsTTL:        time.Duration(config.Cfg.ClusterTotalsTTL) * time.Millisecond,
+		stripRules:       newStripRules(config.Cfg.StripProperties),
+		limits: sizeLimits{
+			maxProperty: config.Cfg.MaxPropertySize,
+			maxResource: config.Cfg.MaxResourceSize,
+			reject:      config.Cfg.OversizedResources == "reject",
+		},
+		redact: newRedactRules(config.Cfg.RedactKinds, config.Cfg.RedactProperties, config.Cfg.RedactBase64),
+		schema: config.Cfg.DBSchema,
+	}
+	if config.Cfg.DBBatchAdaptive {
+		dao.adaptiveBatch = newAdaptiveBatchSize(config.Cfg.DBBatchSize, config.Cfg.DBBatchMinSize,
+			config.Cfg.DBBatchMaxSize, time.Duration(config.Cfg.DBBatchTargetMS)*time.Millisecond)
 	}
 	if p != nil {
 		dao.pool = p
@@ -42,6 +111,15 @@ func NewDAO(p pgxpoolmock.PgxPool) DAO {
 	return dao
 }
 
+// Returns a context with the deadline for a database operation. The statement_timeout set on the connection
+// cancels the statement in the database, the deadline releases the connection if the database doesn't respond.
+func (dao *DAO) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if dao.statementTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, dao.statementTimeout)
+}
+
 // Checks new connection is healthy before using it.
 func afterConnect(ctx context.Context, c *pgx.Conn) error {
 	if err := c.Ping(ctx); err != nil {
@@ -60,26 +138,36 @@ func beforeAcquire(ctx context.Context, c *pgx.Conn) bool {
 	return true
 }
 
-func initializePool() pgxpoolmock.PgxPool {
+func initializePool() DBPool {
 	cfg := config.Cfg
 
-	dbConnString := fmt.Sprint(
-		"host=", cfg.DBHost,
-		" port=", cfg.DBPort,
-		" user=", cfg.DBUser,
-		" password=", cfg.DBPass,
-		" dbname=", cfg.DBName,
-		" sslmode=require", // https://www.postgresql.org/docs/current/libpq-connect.html
-	)
+	dbConnString := buildConnString(cfg)
 
 	// Remove password from connection log.
-	redactedDbConn := strings.ReplaceAll(dbConnString, cfg.DBPass, "[REDACTED]")
+	redactedDbConn := dbConnString
+	if cfg.DBPass != "" {
+		redactedDbConn = strings.ReplaceAll(dbConnString, cfg.DBPass, "[REDACTED]")
+	}
 	klog.Infof("Connecting to PostgreSQL using: %s", redactedDbConn)
 
 	config, configErr := pgxpool.ParseConfig(dbConnString)
 	if configErr != nil {
 		klog.Fatal("Error parsing database connection configuration. ", configErr)
 	}
+	if cfg.DBSSLCert != "" {
+		// Load the client certificate on each new connection to use the rotated certificate without restarting.
+		setClientCertificateLoader(config.ConnConfig, cfg.DBSSLCert, cfg.DBSSLKey)
+	}
+	if cfg.DBIAMAuth {
+		// Use a short-lived RDS IAM auth token as the password for each new connection.
+		tokenProvider := newRDSTokenProvider(cfg.DBHost, cfg.DBPort, cfg.AWSRegion, cfg.DBUser)
+		config.BeforeConnect = tokenProvider.beforeConnect
+	} else if cfg.DBUserFile != "" || cfg.DBPassFile != "" {
+		// Read the user and password from the mounted Secret for each new connection. See credentialFiles.go
+		config.BeforeConnect = newCredentialFiles(cfg.DBUserFile, cfg.DBPassFile).beforeConnect
+	}
+	// Records the queries in the trace of the operation. See tracing/tracing.go
+	config.ConnConfig.Tracer = otelpgx.NewTracer()
 	config.AfterConnect = afterConnect   // Checks new connection health before using it.
 	config.BeforeAcquire = beforeAcquire // Checks idle connection health before using it.
 	// Add jitter to prevent all connections from being closed at same time.
@@ -88,6 +176,24 @@ func initializePool() pgxpoolmock.PgxPool {
 	config.MaxConnIdleTime = time.Duration(cfg.DBMaxConnIdleTime) * time.Millisecond
 	config.MaxConnLifetime = time.Duration(cfg.DBMaxConnLifeTime) * time.Millisecond
 	config.MinConns = cfg.DBMinConns
+	if cfg.HistoryEnabled {
+		// Enables the trigger recording the resource history. See history.go
+		config.ConnConfig.RuntimeParams["search.resource_history"] = "on"
+	}
+	if cfg.PublishesFromOutbox() {
+		// Enables the trigger recording the changes in search.outbox. See outbox.go
+		config.ConnConfig.RuntimeParams["search.change_outbox"] = "on"
+	}
+	if cfg.FullTextSearch {
+		// Enables the trigger maintaining the search_text column. See fullTextSearch.go
+		config.ConnConfig.RuntimeParams["search.full_text_search"] = "on"
+	}
+	// Resolve the search objects in the tenant schema. See tenant.go
+	config.ConnConfig.RuntimeParams["search_path"] = searchPath(cfg.DBSchema)
+	if cfg.DBStatementTimeout > 0 {
+		// Abort any statement that takes longer than the timeout.
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(cfg.DBStatementTimeout)
+	}
 
 	klog.Infof("Using pgxpool.Config %+v", config)
 
@@ -95,16 +201,18 @@ func initializePool() pgxpoolmock.PgxPool {
 	var conn *pgxpool.Pool
 	var err error
 	for {
-		conn, err = pgxpool.ConnectConfig(context.TODO(), config)
+		conn, err = connectPool(context.TODO(), config)
 		if err != nil {
 			// Max wait time is 30 sec
 			waitMS := int(math.Min(float64(retry*500), float64(cfg.MaxBackoffMS/10)))
 			timeToSleep := time.Duration(waitMS) * time.Millisecond
 			retry++
-			klog.Errorf("Unable to connect to database: %+v. Will retry in %s\n", err, timeToSleep)
+			logging.SampledErrorf("Unable to connect to database: %+v. Will retry in %s\n", err, timeToSleep)
+			metrics.Errors.WithLabelValues("database", "connection").Inc()
 			time.Sleep(timeToSleep)
 		} else {
 			klog.Info("Successfully connected to database!")
+			metrics.RegisterDBPoolStats(func() metrics.DBPoolStats { return conn.Stat() })
 			break
 		}
 	}
@@ -112,61 +220,113 @@ func initializePool() pgxpoolmock.PgxPool {
 	return conn
 }
 
-func (dao *DAO) InitializeTables(ctx context.Context) {
+// Creates the pool and checks the database is available. The pool doesn't open a connection until it's used.
+func connectPool(ctx context.Context, config *pgxpool.Config) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Replaces the client certificate loaded when parsing the connection string with a loader that reads
+// the certificate files when establishing a new connection.
+func setClientCertificateLoader(connConfig *pgx.ConnConfig, certFile, keyFile string) {
+	loader := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			logging.SampledErrorf("Error loading the database client certificate. %s", err)
+			return nil, err
+		}
+		return &cert, nil
+	}
+	tlsConfigs := []*tls.Config{connConfig.TLSConfig}
+	for _, fallback := range connConfig.Fallbacks {
+		tlsConfigs = append(tlsConfigs, fallback.TLSConfig)
+	}
+	for _, tlsConfig := range tlsConfigs {
+		if tlsConfig != nil {
+			tlsConfig.Certificates = nil
+			tlsConfig.GetClientCertificate = loader
+		}
+	}
+}
+
+// Builds the connection string from the configuration.
+// https://www.postgresql.org/docs/current/libpq-connect.html
+func buildConnString(cfg *config.Config) string {
+	hosts := strings.Split(cfg.DBHost, ",")
+	for i := range hosts {
+		hosts[i] = strings.TrimSpace(hosts[i])
+	}
+	dbConnString := fmt.Sprint(
+		"host=", strings.Join(hosts, ","),
+		" port=", cfg.DBPort,
+	)
+	if cfg.DBUser != "" { // The user can be read from DB_USER_FILE instead. See credentialFiles.go
+		dbConnString += fmt.Sprint(" user=", cfg.DBUser)
+	}
+	if cfg.DBPass != "" { // Password isn't needed when using client certificate authentication.
+		dbConnString += fmt.Sprint(" password=", cfg.DBPass)
+	}
+	dbConnString += fmt.Sprint(
+		" dbname=", cfg.DBName,
+		" sslmode=", cfg.DBSSLMode,
+	)
+	if len(hosts) > 1 {
+		// Connect only to the primary (read-write) host. Standby hosts are skipped until promoted after a failover.
+		dbConnString += " target_session_attrs=read-write"
+	}
+	if cfg.DBSSLRootCert != "" {
+		dbConnString += fmt.Sprint(" sslrootcert=", cfg.DBSSLRootCert)
+	}
+	if cfg.DBSSLCert != "" {
+		dbConnString += fmt.Sprint(" sslcert=", cfg.DBSSLCert, " sslkey=", cfg.DBSSLKey)
+	}
+	// Cache prepared statements per connection, so the hot queries are parsed and planned once.
+	// With describe, only the statement descriptions are cached, so it works with pgbouncer in transaction mode.
+	switch {
+	case cfg.DBStmtCacheCapacity <= 0:
+		dbConnString += " default_query_exec_mode=describe_exec"
+	case cfg.DBStmtCacheMode == "describe":
+		dbConnString += fmt.Sprint(" default_query_exec_mode=cache_describe",
+			" description_cache_capacity=", cfg.DBStmtCacheCapacity)
+	default:
+		dbConnString += fmt.Sprint(" default_query_exec_mode=cache_statement",
+			" statement_cache_capacity=", cfg.DBStmtCacheCapacity)
+	}
+	return dbConnString
+}
+
+// Creates or updates the search schema by applying the schema migrations.
+// Returns an error when the schema can't be migrated or it's incompatible with this indexer version.
+func (dao *DAO) InitializeTables(ctx context.Context) error {
+	unlock, err := dao.lockSchema(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if config.Cfg.DevelopmentMode {
 		klog.Warning("Dropping search schema for development only. We must not see this message in production.")
-		_, err := dao.pool.Exec(ctx, "DROP SCHEMA IF EXISTS search CASCADE")
-		checkError(err, "Error dropping schema search.")
-	}
-
-	_, err := dao.pool.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS search")
-	checkError(err, "Error creating schema.")
-	_, err = dao.pool.Exec(ctx,
-		"CREATE TABLE IF NOT EXISTS search.resources (uid TEXT PRIMARY KEY, cluster TEXT, data JSONB)")
-	checkError(err, "Error creating table search.resources.")
-	_, err = dao.pool.Exec(ctx,
-		"CREATE TABLE IF NOT EXISTS search.edges (sourceId TEXT, sourceKind TEXT,destId TEXT,destKind TEXT,edgeType TEXT,cluster TEXT, PRIMARY KEY(sourceId, destId, edgeType))")
-	checkError(err, "Error creating table search.edges.")
-
-	// Jsonb indexing data keys:
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS data_kind_idx ON search.resources USING GIN ((data -> 'kind'))")
-	checkError(err, "Error creating index on search.resources data key kind.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS data_namespace_idx ON search.resources USING GIN ((data -> 'namespace'))")
-	checkError(err, "Error creating index on search.resources data key namespace.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS data_name_idx ON search.resources USING GIN ((data ->  'name'))")
-	checkError(err, "Error creating index on search.resources data key name.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS data_cluster_idx ON search.resources USING btree (cluster)")
-	checkError(err, "Error creating index on search.resources cluster.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS data_composite_idx ON search.resources USING GIN "+
-			"((data -> '_hubClusterResource'::text), (data -> 'namespace'::text), "+
-			"(data -> 'apigroup'::text), (data -> 'kind_plural'::text))")
-	checkError(err, "Error creating index on search.resources data composite.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS data_hubCluster_idx ON search.resources USING GIN "+
-			"((data ->  '_hubClusterResource')) WHERE data ? '_hubClusterResource'")
-	checkError(err, "Error creating index on search.resources data key _hubClusterResource.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS edges_sourceid_idx ON search.edges USING btree (sourceid)")
-	checkError(err, "Error creating index on search.edges key sourceid.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS edges_destid_idx ON search.edges USING btree (destid)")
-	checkError(err, "Error creating index on search.edges key destid.")
-
-	_, err = dao.pool.Exec(ctx,
-		"CREATE INDEX IF NOT EXISTS edges_cluster_idx ON search.edges USING btree (cluster)")
-	checkError(err, "Error creating index on search.edges key cluster.")
+		_, err := dao.pool.Exec(ctx, "DROP SCHEMA IF EXISTS "+dao.tenantSchema()+" CASCADE")
+		checkError(err, "Error dropping schema "+dao.tenantSchema()+".")
+	}
+
+	if err := dao.migrate(ctx); err != nil {
+		return fmt.Errorf("Error initializing the search schema. %w", err)
+	}
+
+	err = dao.configureCompression(ctx)
+	checkError(err, "Error configuring the compression of the resource data.")
+
+	err = dao.reconcileIndexes(ctx)
+	checkError(err, "Error reconciling the indexes declared in INDEX_DEFINITIONS.")
+	return nil
 }
 
 func checkError(err error, logMessage string) {
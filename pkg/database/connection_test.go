@@ -4,32 +4,55 @@ package database
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/golang/mock/gomock"
-	"github.com/pashagolub/pgxmock"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_initializeTables(t *testing.T) {
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE SCHEMA IF NOT EXISTS search")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE TABLE IF NOT EXISTS search.resources (uid TEXT PRIMARY KEY, cluster TEXT, data JSONB)")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE TABLE IF NOT EXISTS search.edges (sourceId TEXT, sourceKind TEXT,destId TEXT,destKind TEXT,edgeType TEXT,cluster TEXT, PRIMARY KEY(sourceId, destId, edgeType))")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS data_kind_idx ON search.resources USING GIN ((data -> 'kind'))")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS data_namespace_idx ON search.resources USING GIN ((data -> 'namespace'))")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS data_name_idx ON search.resources USING GIN ((data ->  'name'))")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS data_cluster_idx ON search.resources USING btree (cluster)")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS data_composite_idx ON search.resources USING GIN ((data -> '_hubClusterResource'::text), (data -> 'namespace'::text), (data -> 'apigroup'::text), (data -> 'kind_plural'::text))")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS data_hubCluster_idx ON search.resources USING GIN ((data ->  '_hubClusterResource')) WHERE data ? '_hubClusterResource'")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS edges_sourceid_idx ON search.edges USING btree (sourceid)")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS edges_destid_idx ON search.edges USING btree (destid)")).Return(nil, nil)
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Eq("CREATE INDEX IF NOT EXISTS edges_cluster_idx ON search.edges USING btree (cluster)")).Return(nil, nil)
+	mockSchemaLock(mockPool, true)
+	mockMigrationsTable(mockPool)
+	// Mock all migrations applied except the initial schema.
+	migrations, _ := loadMigrations()
+	appliedRows := pgxmock.NewRows([]string{"version", "name", "breaking"})
+	for _, m := range migrations[1:] {
+		appliedRows.AddRow(m.version, m.name, false)
+	}
+	mockPool.ExpectQuery("SELECT version, name, breaking FROM schema_migrations").WillReturnRows(appliedRows)
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec("SELECT pg_advisory_xact_lock($1)").WithArgs(migrationLockId).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mockPool.ExpectExec("SET LOCAL statement_timeout = 0").WillReturnResult(pgxmock.NewResult("SET", 0))
+	mockPool.ExpectQuery("SELECT count(*) FROM schema_migrations WHERE version=$1").
+		WithArgs(1).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(0))
+	mockPool.ExpectExec(migrations[0].sql).WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("INSERT INTO schema_migrations (version, name, breaking) VALUES ($1, $2, $3)").
+		WithArgs(1, "initial_schema", false).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
 
 	// Execute function test.
-	dao.InitializeTables(context.Background())
+	err := dao.InitializeTables(context.Background())
 
+	assert.Nil(t, err)
 }
 
 func Test_checkErrorAndRollback(t *testing.T) {
@@ -77,3 +100,123 @@ func Test_beforeAcquire(t *testing.T) {
 	assert.True(t, result)
 }
 */
+
+func Test_buildConnString(t *testing.T) {
+	cfg := &config.Config{DBHost: "localhost", DBPort: 5432, DBUser: "user", DBPass: "pass", DBName: "search",
+		DBSSLMode: "require"}
+
+	assert.Equal(t, "host=localhost port=5432 user=user password=pass dbname=search sslmode=require "+
+		"default_query_exec_mode=describe_exec", buildConnString(cfg))
+
+	cfg.DBSSLMode = "verify-full"
+	cfg.DBSSLRootCert = "/certs/ca.crt"
+	assert.Equal(t,
+		"host=localhost port=5432 user=user password=pass dbname=search sslmode=verify-full sslrootcert=/certs/ca.crt "+
+			"default_query_exec_mode=describe_exec", buildConnString(cfg))
+}
+
+// Should connect to the read-write host when a list of hosts is configured.
+func Test_buildConnString_failoverHosts(t *testing.T) {
+	cfg := &config.Config{DBHost: "primary.example.com, standby.example.com", DBPort: 5432, DBUser: "user",
+		DBPass: "pass", DBName: "search", DBSSLMode: "require"}
+
+	connString := buildConnString(cfg)
+	assert.Equal(t, "host=primary.example.com,standby.example.com port=5432 user=user password=pass dbname=search "+
+		"sslmode=require target_session_attrs=read-write default_query_exec_mode=describe_exec", connString)
+
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	assert.Nil(t, err)
+	assert.Equal(t, "primary.example.com", poolConfig.ConnConfig.Host)
+	assert.Equal(t, "standby.example.com", poolConfig.ConnConfig.Fallbacks[len(poolConfig.ConnConfig.Fallbacks)-1].Host)
+	assert.NotNil(t, poolConfig.ConnConfig.ValidateConnect)
+}
+
+// Should connect to the unix socket when the host is a directory.
+func Test_buildConnString_unixSocket(t *testing.T) {
+	cfg := &config.Config{DBHost: "/var/run/postgresql", DBPort: 6432, DBUser: "user", DBName: "search",
+		DBSSLMode: "require"}
+
+	poolConfig, err := pgxpool.ParseConfig(buildConnString(cfg))
+	assert.Nil(t, err)
+	network, address := pgconn.NetworkAddress(poolConfig.ConnConfig.Host, poolConfig.ConnConfig.Port)
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/var/run/postgresql/.s.PGSQL.6432", address)
+	assert.Nil(t, poolConfig.ConnConfig.TLSConfig) // TLS isn't used with unix sockets.
+}
+
+// Should set a deadline for the database operation, unless the timeout is disabled.
+func Test_withTimeout(t *testing.T) {
+	dao := DAO{statementTimeout: time.Minute}
+	ctx, cancel := dao.withTimeout(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	dao.statementTimeout = 0
+	ctx, cancel = dao.withTimeout(context.Background())
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+}
+
+// Should configure the prepared statement cache.
+func Test_buildConnString_statementCache(t *testing.T) {
+	cfg := &config.Config{DBHost: "localhost", DBPort: 5432, DBUser: "user", DBPass: "pass", DBName: "search",
+		DBSSLMode: "require", DBStmtCacheMode: "describe", DBStmtCacheCapacity: 256}
+
+	assert.Equal(t, "host=localhost port=5432 user=user password=pass dbname=search sslmode=require "+
+		"default_query_exec_mode=cache_describe description_cache_capacity=256", buildConnString(cfg))
+}
+
+// Should use client certificate instead of password.
+func Test_buildConnString_clientCertificate(t *testing.T) {
+	cfg := &config.Config{DBHost: "localhost", DBPort: 5432, DBUser: "user", DBName: "search",
+		DBSSLMode: "verify-full", DBSSLCert: "/certs/tls.crt", DBSSLKey: "/certs/tls.key"}
+
+	assert.Equal(t, "host=localhost port=5432 user=user dbname=search sslmode=verify-full "+
+		"sslcert=/certs/tls.crt sslkey=/certs/tls.key default_query_exec_mode=describe_exec", buildConnString(cfg))
+}
+
+// Should read the client certificate files when a new connection requests the certificate.
+func Test_setClientCertificateLoader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	connConfig := &pgx.ConnConfig{}
+	connConfig.TLSConfig = &tls.Config{} // #nosec G402 - Test only.
+
+	setClientCertificateLoader(connConfig, certFile, keyFile)
+
+	// Files don't exist yet.
+	defer testutils.SupressConsoleOutput()()
+	_, err := connConfig.TLSConfig.GetClientCertificate(nil)
+	assert.NotNil(t, err)
+
+	// Write (rotate) the certificate files.
+	writeTestCertificate(t, certFile, keyFile)
+	cert, err := connConfig.TLSConfig.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, cert)
+}
+
+// Writes a self-signed certificate and key to the given files.
+func writeTestCertificate(t *testing.T, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Consistency check.
+// Collectors can report their resource and edge totals on each sync, see model.SyncEvent. A periodic check
+// compares the data in the database with the last totals reported by each collector. Clusters that drifted are
+// flagged with the search_indexer_cluster_drifted metric and, optionally, asked to resync on the next sync
+// response. The check runs only on the leader, see clustersync.syncClusters().
+
+const consistencyCheckSql = "SELECT s.cluster, s.reported_resources, s.reported_edges, " +
+	"(SELECT count(*) FROM resources r WHERE r.cluster=s.cluster AND r.deleted_at IS NULL), " +
+	"(SELECT count(*) FROM edges e WHERE e.cluster=s.cluster AND e.edgetype!='interCluster' " +
+	"AND e.deleted_at IS NULL) " +
+	"FROM cluster_sync s WHERE s.reported_resources IS NOT NULL"
+
+// Totals for a cluster in the database and reported by the collector.
+type clusterTotals struct {
+	cluster           string
+	reportedResources int
+	reportedEdges     int
+	resources         int
+	edges             int
+}
+
+// Periodically checks that the data in the database matches the totals reported by the collectors.
+// Runs until the context is cancelled.
+func (dao *DAO) StartConsistencyCheck(ctx context.Context, interval time.Duration, requestResync bool) {
+	runPeriodically(ctx, "consistency check", interval, func(ctx context.Context) {
+		_, _ = dao.checkConsistency(ctx, requestResync)
+	})
+}
+
+// Compares the data in the database with the totals reported by the collectors. With requestResync, the clusters
+// that drifted are asked to resync. Returns the clusters that drifted.
+// A sync in progress while checking can cause a false positive, the resync only restores the same data.
+func (dao *DAO) checkConsistency(ctx context.Context, requestResync bool) ([]string, error) {
+	totals, err := dao.clusterTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drifted := make([]string, 0)
+	metrics.ClusterDrifted.Reset()
+	for _, t := range totals {
+		if t.resources == t.reportedResources && t.edges == t.reportedEdges {
+			continue
+		}
+		klog.Warningf("Data for cluster %s doesn't match the collector. Resources: %d (reported %d) "+
+			"Edges: %d (reported %d)", t.cluster, t.resources, t.reportedResources, t.edges, t.reportedEdges)
+		metrics.ClusterDrifted.WithLabelValues(t.cluster).Set(1)
+		drifted = append(drifted, t.cluster)
+	}
+
+	if requestResync && len(drifted) > 0 {
+		err = dao.RequestResync(ctx, drifted)
+	}
+	return drifted, err
+}
+
+// Returns the resource and edge totals in the database for the clusters that reported their totals.
+func (dao *DAO) clusterTotals(ctx context.Context) ([]clusterTotals, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, consistencyCheckSql)
+	if err != nil {
+		logging.SampledErrorf("Error querying totals for the consistency check. %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make([]clusterTotals, 0)
+	for rows.Next() {
+		var t clusterTotals
+		var reportedEdges *int
+		if err = rows.Scan(&t.cluster, &t.reportedResources, &reportedEdges, &t.resources, &t.edges); err != nil {
+			klog.Errorf("Error reading totals for the consistency check. %s", err)
+			continue
+		}
+		if reportedEdges != nil {
+			t.reportedEdges = *reportedEdges
+		}
+		totals = append(totals, t)
+	}
+	return totals, nil
+}
+
+// Flags the clusters to request a resync on the next sync response.
+func (dao *DAO) RequestResync(ctx context.Context, clusters []string) error {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	_, err := dao.pool.Exec(ctx, "UPDATE cluster_sync SET resync_requested=true WHERE cluster=ANY($1)",
+		clusters)
+	if err != nil {
+		logging.SampledErrorf("Error requesting resync for clusters %v. %s", clusters, err)
+		return err
+	}
+	klog.Infof("Requested resync for clusters %v.", clusters)
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockClusterTotals(mockPool pgxmock.PgxPoolIface) {
+	reportedEdges := 4
+	columns := []string{"cluster", "reported_resources", "reported_edges", "resources", "edges"}
+	rows := pgxmock.NewRows(columns).
+		AddRow("cluster-a", 10, &reportedEdges, 10, 4).
+		AddRow("cluster-b", 10, &reportedEdges, 8, 4)
+	mockPool.ExpectQuery("SELECT s.cluster, s.reported_resources, s.reported_edges, " +
+		"(SELECT count(*) FROM resources r WHERE r.cluster=s.cluster AND r.deleted_at IS NULL), " +
+		"(SELECT count(*) FROM edges e WHERE e.cluster=s.cluster AND e.edgetype!='interCluster' " +
+		"AND e.deleted_at IS NULL) " +
+		"FROM cluster_sync s WHERE s.reported_resources IS NOT NULL").WillReturnRows(rows)
+}
+
+// Should find the clusters with data that doesn't match the collector totals.
+func Test_checkConsistency(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockClusterTotals(mockPool)
+
+	drifted, err := dao.checkConsistency(context.Background(), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cluster-b"}, drifted)
+}
+
+// Should request a resync from the clusters that drifted.
+func Test_checkConsistency_requestResync(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockClusterTotals(mockPool)
+	mockPool.ExpectExec("UPDATE cluster_sync SET resync_requested=true WHERE cluster=ANY($1)").
+		WithArgs([]string{"cluster-b"}).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	drifted, err := dao.checkConsistency(context.Background(), true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cluster-b"}, drifted)
+}
+
+func Test_checkConsistency_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectQuery(consistencyCheckSql).WillReturnError(errors.New("connection refused"))
+
+	drifted, err := dao.checkConsistency(context.Background(), true)
+
+	assert.NotNil(t, err)
+	assert.Empty(t, drifted)
+}
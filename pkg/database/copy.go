@@ -0,0 +1,90 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/klog/v2"
+)
+
+var resourceColumns = []string{"uid", "cluster", "data", "hash"}
+var edgeColumns = []string{"sourceid", "sourcekind", "destid", "destkind", "edgetype", "cluster", "properties"}
+
+// Unique key of the search tables, used to resolve conflicts with the existing rows.
+var copyConflictKey = map[string]string{
+	"resources": "uid",
+	"edges":     "sourceid, destid, edgetype",
+}
+
+// Rows conflicting with the copied rows were soft deleted, remove the tombstone. Edges conflict also when the
+// properties have changed.
+var copyOnConflict = map[string]string{
+	"resources": "DO UPDATE SET data=EXCLUDED.data, hash=EXCLUDED.hash, deleted_at=NULL " +
+		"WHERE resources.deleted_at IS NOT NULL",
+	"edges": "DO UPDATE SET properties=EXCLUDED.properties, deleted_at=NULL " +
+		"WHERE edges.deleted_at IS NOT NULL OR edges.properties IS DISTINCT FROM EXCLUDED.properties",
+}
+
+// Inserts rows using the Postgres COPY protocol. This is much faster than batched INSERTs for a large number
+// of rows, like the full resync of a large cluster.
+// COPY doesn't support ON CONFLICT, so the rows are copied into a temporary staging table first and then
+// inserted into the search table within the same transaction. Duplicated rows are inserted once, otherwise the
+// ON CONFLICT DO UPDATE would fail trying to update the same row twice.
+// Returns the number of rows inserted.
+func (dao *DAO) copyWithStaging(ctx context.Context, tableName string, columns []string,
+	rows [][]interface{}) (int64, error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "DAO.copy")
+	defer span.End()
+	span.SetAttributes(attribute.String("table", tableName), attribute.Int("rows", len(rows)))
+	stagingTable := tableName + "_staging"
+	columnList := strings.Join(columns, ",")
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := dao.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(
+		"CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", stagingTable, tableName))
+	if err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error creating staging table %s.", stagingTable), tx, ctx)
+		return 0, err
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{stagingTable}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error copying rows into staging table %s.", stagingTable), tx, ctx)
+		return 0, err
+	}
+
+	res, err := tx.Exec(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT DISTINCT ON (%s) %s FROM %s ON CONFLICT (%s) %s",
+		tableName, columnList, copyConflictKey[tableName], columnList, stagingTable, copyConflictKey[tableName],
+		copyOnConflict[tableName]))
+	if err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error inserting rows from staging table %s.", stagingTable), tx, ctx)
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error committing copy into %s.", tableName), tx, ctx)
+		return 0, err
+	}
+	klog.V(3).Infof("Copied %d rows into %s in %s.", res.RowsAffected(), tableName, time.Since(start))
+	return res.RowsAffected(), nil
+}
+
+// Use the COPY protocol when the number of rows to insert reaches the configured threshold.
+func (dao *DAO) useCopy(rowCount int) bool {
+	return dao.copyThreshold > 0 && rowCount >= dao.copyThreshold
+}
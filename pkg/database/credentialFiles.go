@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"k8s.io/klog/v2"
+)
+
+// Credential files.
+// With DB_USER_FILE and DB_PASS_FILE, the user and password are read from files, for example the keys of a mounted
+// Secret, instead of the environment. The files are read before opening each new connection, so the password
+// rotated in the Secret is used without restarting. The open connections aren't closed, they're replaced within
+// DB_MAX_CONN_LIFETIME. The client certificate (DB_SSLCERT and DB_SSLKEY) is also read for each new connection,
+// see setClientCertificateLoader(). The trailing newline of the files is ignored.
+
+type credentialFiles struct {
+	userFile string
+	passFile string
+	user     string // Last user read, to log the rotation.
+	pass     string // Last password read, to log the rotation.
+	lock     sync.Mutex
+}
+
+func newCredentialFiles(userFile, passFile string) *credentialFiles {
+	return &credentialFiles{userFile: userFile, passFile: passFile}
+}
+
+// Sets the user and password from the files before opening a new connection. Used as the pgxpool BeforeConnect hook.
+func (c *credentialFiles) beforeConnect(ctx context.Context, connConfig *pgx.ConnConfig) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.userFile != "" {
+		user, err := readCredentialFile(c.userFile)
+		if err != nil {
+			return err
+		}
+		if c.user != "" && user != c.user {
+			klog.Infof("The database user in %s changed, using it for the new connections.", c.userFile)
+		}
+		c.user = user
+		connConfig.User = user
+	}
+	if c.passFile != "" {
+		pass, err := readCredentialFile(c.passFile)
+		if err != nil {
+			return err
+		}
+		if c.pass != "" && pass != c.pass {
+			klog.Infof("The database password in %s changed, using it for the new connections.", c.passFile)
+		}
+		c.pass = pass
+		connConfig.Password = pass
+	}
+	return nil
+}
+
+func readCredentialFile(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("Error reading the database credentials. %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
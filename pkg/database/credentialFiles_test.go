@@ -0,0 +1,43 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should read the credentials from the files for each new connection, so the rotated password is used.
+func Test_credentialFiles_beforeConnect(t *testing.T) {
+	dir := t.TempDir()
+	userFile, passFile := filepath.Join(dir, "username"), filepath.Join(dir, "password")
+	_ = os.WriteFile(userFile, []byte("search\n"), 0600)
+	_ = os.WriteFile(passFile, []byte("first\n"), 0600)
+	credentials := newCredentialFiles(userFile, passFile)
+
+	connConfig := &pgx.ConnConfig{}
+	err := credentials.beforeConnect(context.Background(), connConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "search", connConfig.User)
+	assert.Equal(t, "first", connConfig.Password)
+
+	_ = os.WriteFile(passFile, []byte("second"), 0600)
+	connConfig = &pgx.ConnConfig{}
+	err = credentials.beforeConnect(context.Background(), connConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", connConfig.Password)
+}
+
+// Should fail to connect if the file can't be read.
+func Test_credentialFiles_missing(t *testing.T) {
+	credentials := newCredentialFiles("", filepath.Join(t.TempDir(), "password"))
+
+	err := credentials.beforeConnect(context.Background(), &pgx.ConnConfig{})
+
+	assert.NotNil(t, err)
+}
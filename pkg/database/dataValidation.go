@@ -7,20 +7,31 @@ import (
 	"fmt"
 
 	"github.com/doug-martin/goqu/v9"
-	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/tracing"
 	"k8s.io/klog/v2"
 )
 
 // Query resource and edge count for a cluster. Used for data validation.
+// Uses the totals kept in memory when CLUSTER_TOTALS_TTL_MS is set, see clusterTotals.go
 func (dao *DAO) ClusterTotals(ctx context.Context, clusterName string) (resources int, edges int, e error) {
+	if dao.totalsTTL > 0 {
+		if totals, ok := cachedTotals(clusterName, dao.totalsTTL); ok {
+			return totals.resources, totals.edges, nil
+		}
+	}
+	ctx, span := tracing.Start(ctx, "DAO.ClusterTotals")
+	defer span.End()
+	defer metrics.SlowDBOperation("count",
+		fmt.Sprintf("Slow count of resources and edges in cluster %s.", clusterName))()
 	batch := &pgx.Batch{}
 
 	// Sample query: SELECT count(*) FROM search.resources WHERE cluster=$1
-	resourceCountSql, params, err := goqu.From(goqu.S("search").Table("resources")).
+	resourceCountSql, params, err := goqu.Dialect("postgres").From(goqu.T("resources")).Prepared(true).
 		Select(goqu.COUNT("*")).
-		Where(
-			goqu.C("cluster").Eq(clusterName),
-			goqu.C("uid").Neq(string("cluster__"+clusterName))). // Ignore cluster pseudo-node, not a kube resource.
+		Where(goqu.C("cluster").Eq(clusterName), goqu.C("deleted_at").IsNull()).
 		ToSQL()
 
 	checkError(err, fmt.Sprintf("Error creating query to count resources in cluster %s:%s ",
@@ -30,31 +41,37 @@ func (dao *DAO) ClusterTotals(ctx context.Context, clusterName string) (resource
 	batch.Queue(resourceCountSql, params...)
 
 	// Sample query: SELECT count(*) FROM search.edges WHERE cluster=$1 and edgetype<>'interCluster'
-	edgeCountSql, params, err := goqu.From(goqu.S("search").Table("edges")).
+	edgeCountSql, params, err := goqu.Dialect("postgres").From(goqu.T("edges")).Prepared(true).
 		Select(goqu.COUNT("*")).
 		Where(goqu.C("cluster").Eq(clusterName),
-			goqu.C("edgetype").Neq("interCluster")).ToSQL()
+			goqu.C("edgetype").Neq("interCluster"),
+			goqu.C("deleted_at").IsNull()).ToSQL()
 	klog.V(4).Infof("Data validation query for edge count in cluster %s - sql: %s args: %+v",
 		clusterName, edgeCountSql, params)
 	checkError(err, fmt.Sprintf("Error creating query to count edges in cluster %s:%s ",
 		clusterName, err))
 	batch.Queue(edgeCountSql, params...)
 
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
 	br := dao.pool.SendBatch(ctx, batch)
 	defer br.Close()
 
 	resourcesRow := br.QueryRow()
 	resourcesErr := resourcesRow.Scan(&resources)
 	if resourcesErr != nil {
-		klog.Error("Error reading total resources for cluster ", clusterName, " err: ", resourcesErr)
+		logging.SampledErrorf("Error reading total resources for cluster %s err: %s", clusterName, resourcesErr)
 		return resources, edges, resourcesErr
 	}
 	edgesRow := br.QueryRow()
 	edgesErr := edgesRow.Scan(&edges)
 	if edgesErr != nil {
-		klog.Error("Error reading total edges for cluster ", clusterName, " err: ", edgesErr)
+		logging.SampledErrorf("Error reading total edges for cluster %s err: %s", clusterName, edgesErr)
 		return resources, edges, edgesErr
 	}
 
+	if dao.totalsTTL > 0 {
+		saveTotals(clusterName, resources, edges)
+	}
 	return resources, edges, nil
 }
@@ -7,8 +7,7 @@ import (
 	"errors"
 	"testing"
 
-	"github.com/golang/mock/gomock"
-	pgx "github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/testutils"
 
 	"github.com/stretchr/testify/assert"
@@ -17,18 +16,8 @@ import (
 func Test_ClusterTotals(t *testing.T) {
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
-	batch := &pgx.Batch{}
-	// mock Result
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 10}, {"count": 5}},
-		},
-	}
 	// mock queries
-	batch.Queue(`SELECT COUNT(*) FROM "search"."resources" WHERE (("cluster" = 'cluster_foo') AND ("uid" != 'cluster__cluster_foo'))`, []interface{}{}...)
-	batch.Queue(`SELECT COUNT(*) FROM "search"."edges" WHERE (("cluster" = 'cluster_foo') AND ("edgetype" != 'interCluster'))`, []interface{}{}...)
-
-	mockPool.EXPECT().SendBatch(context.Background(), batch).Return(br)
+	testutils.MockClusterTotals(mockPool, "cluster_foo", 10, 5)
 	// Execute function test.
 	resourceCount, edgeCount, err := dao.ClusterTotals(context.Background(), "cluster_foo")
 
@@ -41,15 +30,15 @@ func Test_ClusterTotals_withErrorQueryingResources(t *testing.T) {
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
 
-	// mock Result
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData:        []map[string]interface{}{{"count": 10}},
-			MockErrorOnScan: errors.New("unexpected EOF"),
-		},
-	}
 	// mock queries
-	mockPool.EXPECT().SendBatch(context.Background(), gomock.Any()).Return(br)
+	batch := mockPool.ExpectBatch()
+	batch.ExpectQuery(
+		`SELECT COUNT(*) FROM "resources" WHERE (("cluster" = $1) AND ("deleted_at" IS NULL))`).
+		WithArgs("cluster_foo").WillReturnError(errors.New("unexpected EOF"))
+	batch.ExpectQuery(`SELECT COUNT(*) FROM "edges" `+
+		`WHERE (("cluster" = $1) AND ("edgetype" != $2) AND ("deleted_at" IS NULL))`).
+		WithArgs("cluster_foo", "interCluster").WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(5)).
+		Maybe() // Not read after the error.
 
 	// Execute function test.
 	resourceCount, edgeCount, err := dao.ClusterTotals(context.Background(), "cluster_foo")
@@ -0,0 +1,251 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jackc/pgx/v5"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"k8s.io/klog/v2"
+)
+
+// Dead letter.
+// When a batch item fails after it's isolated by sendBatch(), the item is saved in search.dead_letter so the data
+// isn't lost. The items can be listed and retried with the admin endpoints, see server.StartAndListen().
+// The table never stores SQL. An item keeps the name of its statement and the args, and the query is rebuilt from
+// the allowlist in retryQuery() when the item is retried.
+// The leader deletes the items older than DEAD_LETTER_RETENTION_HOURS, and the oldest items above
+// DEAD_LETTER_MAX_ROWS. See StartDeadLetterCleanup().
+
+var ErrDeadLetterNotFound = errors.New("Dead letter item not found.")
+
+// Statements of the batch items that can be retried, with their args.
+const (
+	retryAddResource         = "addResource"         // uid, cluster, data, hash
+	retryUpdateResource      = "updateResource"      // uid, data, hash
+	retryDeleteResources     = "deleteResources"     // uids
+	retryDeleteResourceEdges = "deleteResourceEdges" // uids
+	retryAddEdge             = "addEdge"             // sourceid, sourcekind, destid, destkind, edgetype, cluster, props
+	retryDeleteEdge          = "deleteEdge"          // sourceid, destid, edgetype
+)
+
+const deadLetterCleanupInterval = time.Hour
+
+// Statement to retry a batch item, saved in dead_letter instead of the query.
+type retryStatement struct {
+	name string
+	args []interface{}
+}
+
+// A batch item that failed permanently.
+type DeadLetter struct {
+	ID        int64         `json:"id"`
+	Action    string        `json:"action"`
+	UID       string        `json:"uid"`
+	Args      []interface{} `json:"args"`
+	Error     string        `json:"error"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// Saves the failed batch item. Errors are logged, the item is already reported in the sync response.
+func (dao *DAO) saveDeadLetter(ctx context.Context, item batchItem, itemErr error) {
+	if item.retry.name == "" {
+		klog.Warningf("Batch item %s of %s can't be retried, it isn't saved to dead_letter.", item.action, item.uid)
+		return
+	}
+	args, _ := json.Marshal(item.retry.args)
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	_, err := dao.pool.Exec(ctx,
+		"INSERT INTO dead_letter (action, uid, args, error) VALUES ($1, $2, $3, $4)",
+		item.retry.name, item.uid, string(args), itemErr.Error())
+	if err != nil {
+		logging.SampledErrorf("Error saving batch item to dead_letter. uid: %s %s", item.uid, err)
+	}
+}
+
+// Returns a page of dead letter items sorted by id. Fetches limit+1 items, see keysetPage().
+func (dao *DAO) DeadLetters(ctx context.Context, after []string, limit int) ([]DeadLetter, error) {
+	ds := goqu.Dialect("postgres").From(goqu.T("dead_letter")).Prepared(true).
+		Select("id", "action", "uid", "args", "error", "created_at")
+	ds, err := keysetPage(ds, []string{"id"}, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	query, params, err := ds.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, query, params...)
+	if err != nil {
+		logging.SampledErrorf("Error querying dead_letter. %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]DeadLetter, 0)
+	for rows.Next() {
+		var item DeadLetter
+		var uid, args, itemErr *string
+		if err = rows.Scan(&item.ID, &item.Action, &uid, &args, &itemErr, &item.CreatedAt); err != nil {
+			klog.Errorf("Error reading dead_letter. %s", err)
+			continue
+		}
+		if uid != nil {
+			item.UID = *uid
+		}
+		if itemErr != nil {
+			item.Error = *itemErr
+		}
+		if args != nil {
+			_ = json.Unmarshal([]byte(*args), &item.Args)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Rebuilds the query of a dead letter item from its statement and args. Returns an error if the statement isn't
+// in the allowlist or the args don't match the statement.
+func (dao *DAO) retryQuery(statement string, args []interface{}) (string, []interface{}, error) {
+	invalidArgs := fmt.Errorf("Invalid args for statement [%s].", statement)
+	expectArgs := func(n int) error {
+		if len(args) != n {
+			return invalidArgs
+		}
+		return nil
+	}
+	// The hash is a bigint, the JSON number is converted to keep all the digits.
+	int64Arg := func(i int) error {
+		number, ok := args[i].(json.Number)
+		if !ok {
+			return invalidArgs
+		}
+		value, err := number.Int64()
+		args[i] = value
+		return err
+	}
+
+	switch statement {
+	case retryAddResource:
+		if err := expectArgs(4); err != nil {
+			return "", nil, err
+		}
+		return addResourceQuery, args, int64Arg(3)
+	case retryUpdateResource:
+		if err := expectArgs(3); err != nil {
+			return "", nil, err
+		}
+		return updateResourceQuery, args, int64Arg(2)
+	case retryDeleteResources:
+		if len(args) == 0 {
+			return "", nil, invalidArgs
+		}
+		return dao.deleteResourcesQuery(len(args)), args, nil
+	case retryDeleteResourceEdges:
+		if len(args) == 0 {
+			return "", nil, invalidArgs
+		}
+		return dao.deleteResourceEdgesQuery(len(args)), args, nil
+	case retryAddEdge:
+		return dao.addEdgeQuery(), args, expectArgs(7)
+	case retryDeleteEdge:
+		return dao.deleteEdgeQuery(), args, expectArgs(3)
+	}
+	return "", nil, fmt.Errorf("Statement [%s] can't be retried.", statement)
+}
+
+// Runs the statement of a dead letter item again and deletes the item if it succeeds.
+func (dao *DAO) RetryDeadLetter(ctx context.Context, id int64) error {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, "SELECT action, args FROM dead_letter WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	var statement string
+	var argsJSON *string
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&statement, &argsJSON)
+	}
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrDeadLetterNotFound
+	}
+	var args []interface{}
+	if argsJSON != nil {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(*argsJSON)))
+		decoder.UseNumber()
+		if err = decoder.Decode(&args); err != nil {
+			return err
+		}
+	}
+	query, args, err := dao.retryQuery(statement, args)
+	if err != nil {
+		return err
+	}
+
+	tx, err := dao.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error retrying dead letter item %d.", id), tx, ctx)
+		return err
+	}
+	if _, err = tx.Exec(ctx, "DELETE FROM dead_letter WHERE id=$1", id); err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error deleting dead letter item %d.", id), tx, ctx)
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		checkErrorAndRollback(err, fmt.Sprintf("Error committing retry of dead letter item %d.", id), tx, ctx)
+		return err
+	}
+	klog.Infof("Retried dead letter item %d.", id)
+	return nil
+}
+
+// Periodically deletes the dead letter items older than the retention period, and the oldest items above maxRows.
+// Runs until the context is cancelled.
+func (dao *DAO) StartDeadLetterCleanup(ctx context.Context, retention time.Duration, maxRows int) {
+	runPeriodically(ctx, "dead letter cleanup", deadLetterCleanupInterval, func(ctx context.Context) {
+		_, _ = dao.deleteDeadLetters(ctx, retention, maxRows)
+	})
+}
+
+// Deletes the dead letter items older than the retention period, then the oldest items above maxRows.
+// Returns the number of items deleted.
+func (dao *DAO) deleteDeadLetters(ctx context.Context, retention time.Duration, maxRows int) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	res, err := dao.pool.Exec(ctx, "DELETE FROM dead_letter WHERE created_at < $1", time.Now().Add(-retention))
+	if err != nil {
+		logging.SampledErrorf("Error deleting expired dead letter items. %s", err)
+		return 0, err
+	}
+	rowsDeleted := res.RowsAffected()
+	res, err = dao.pool.Exec(ctx, "DELETE FROM dead_letter WHERE id <= "+
+		"(SELECT id FROM dead_letter ORDER BY id DESC OFFSET $1 LIMIT 1)", maxRows)
+	if err != nil {
+		logging.SampledErrorf("Error deleting dead letter items above the max rows. %s", err)
+		return rowsDeleted, err
+	}
+	rowsDeleted += res.RowsAffected()
+	klog.V(2).Infof("Deleted %d dead letter items older than %s or above %d items.", rowsDeleted, retention,
+		maxRows)
+	return rowsDeleted, nil
+}
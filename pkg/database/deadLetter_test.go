@@ -0,0 +1,135 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DeadLetters(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	uid, args, itemErr := "uid-1", `["uid-1"]`, "mock error"
+	createdAt := time.Now()
+	columns := []string{"id", "action", "uid", "args", "error", "created_at"}
+	rows := pgxmock.NewRows(columns).AddRow(int64(6), "deleteResources", &uid, &args, &itemErr, createdAt)
+	mockPool.ExpectQuery(`SELECT "id", "action", "uid", "args", "error", "created_at" FROM "dead_letter" `+
+		`WHERE (id) > ($1) ORDER BY "id" ASC LIMIT $2`).WithArgs("5", int64(11)).WillReturnRows(rows)
+
+	items, err := dao.DeadLetters(context.Background(), []string{"5"}, 10)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []DeadLetter{{ID: 6, Action: "deleteResources", UID: "uid-1", Args: []interface{}{"uid-1"},
+		Error: "mock error", CreatedAt: createdAt}}, items)
+}
+
+// Should save the statement and args of the failed item, never the query.
+func Test_saveDeadLetter(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("INSERT INTO dead_letter (action, uid, args, error) VALUES ($1, $2, $3, $4)").
+		WithArgs("updateResource", "uid-1", `["uid-1","{}",1234567890123456789]`, "mock error").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	args := []interface{}{"uid-1", "{}", int64(1234567890123456789)}
+
+	dao.saveDeadLetter(context.Background(), batchItem{action: "updateResource", query: updateResourceQuery,
+		uid: "uid-1", args: args, retry: retryStatement{retryUpdateResource, args}}, errors.New("mock error"))
+
+	assert.Nil(t, mockPool.ExpectationsWereMet())
+}
+
+// Should rebuild the query from the statement and delete the item.
+func Test_RetryDeadLetter(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	args := `["uid-1","{}",1234567890123456789]`
+	rows := pgxmock.NewRows([]string{"action", "args"}).AddRow("updateResource", &args)
+	mockPool.ExpectQuery("SELECT action, args FROM dead_letter WHERE id=$1").WithArgs(int64(6)).
+		WillReturnRows(rows)
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(updateResourceQuery).WithArgs("uid-1", "{}", int64(1234567890123456789)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectExec("DELETE FROM dead_letter WHERE id=$1").WithArgs(int64(6)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectCommit()
+
+	err := dao.RetryDeadLetter(context.Background(), 6)
+
+	assert.Nil(t, err)
+}
+
+// Should delete the resources, or add the tombstone with SOFT_DELETE.
+func Test_retryQuery_deleteResources(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+
+	query, args, err := dao.retryQuery(retryDeleteResources, []interface{}{"uid-1", "uid-2"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "DELETE from resources WHERE uid IN ($1,$2)", query)
+	assert.Equal(t, []interface{}{"uid-1", "uid-2"}, args)
+
+	dao.softDelete = true
+	query, _, err = dao.retryQuery(retryDeleteResources, []interface{}{"uid-1"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE resources SET deleted_at=now() WHERE uid IN ($1) AND deleted_at IS NULL", query)
+}
+
+// Should reject the statements that aren't in the allowlist, and the args that don't match the statement.
+func Test_retryQuery_invalid(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+
+	_, _, err := dao.retryQuery("DROP TABLE resources", nil)
+	assert.ErrorContains(t, err, "Statement [DROP TABLE resources] can't be retried.")
+
+	_, _, err = dao.retryQuery(retryDeleteEdge, []interface{}{"uid-1"})
+	assert.ErrorContains(t, err, "Invalid args for statement [deleteEdge].")
+
+	_, _, err = dao.retryQuery(retryDeleteResources, nil)
+	assert.ErrorContains(t, err, "Invalid args for statement [deleteResources].")
+
+	_, _, err = dao.retryQuery(retryAddResource, []interface{}{"uid-1", "cluster-a", "{}", "not a hash"})
+	assert.ErrorContains(t, err, "Invalid args for statement [addResource].")
+}
+
+func Test_RetryDeadLetter_notFound(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"action", "args"})
+	mockPool.ExpectQuery("SELECT action, args FROM dead_letter WHERE id=$1").WithArgs(int64(6)).WillReturnRows(rows)
+
+	err := dao.RetryDeadLetter(context.Background(), 6)
+
+	assert.Equal(t, ErrDeadLetterNotFound, err)
+}
+
+// Should delete the expired items, then the oldest items above the max rows.
+func Test_deleteDeadLetters(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM dead_letter WHERE created_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	mockPool.ExpectExec("DELETE FROM dead_letter WHERE id <= " +
+		"(SELECT id FROM dead_letter ORDER BY id DESC OFFSET $1 LIMIT 1)").WithArgs(100).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+
+	deleted, err := dao.deleteDeadLetters(context.Background(), 24*time.Hour, 100)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), deleted)
+}
+
+func Test_deleteDeadLetters_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM dead_letter WHERE created_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnError(errors.New("connection refused"))
+
+	deleted, err := dao.deleteDeadLetters(context.Background(), 24*time.Hour, 100)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
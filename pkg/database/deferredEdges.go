@@ -0,0 +1,114 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Deferred edges.
+// The resources and edges from a sync are sent in concurrent batches, so an edge can be written before its source
+// or destination resource, or point to a resource that failed to write. When DEFER_EDGES is enabled, the resources
+// are written first, and the edges with an endpoint that isn't one of the resources written by the sync are held.
+// At flush, the held edges are checked against the resources in the database. The resolved edges are written, and
+// the edges that remain unresolved are reported in SyncResponse.UnresolvedEdges instead of leaving dangling edges.
+
+const existingUidsSql = "SELECT uid FROM resources WHERE uid = ANY($1) AND deleted_at IS NULL"
+
+type edgeDeferral struct {
+	known    map[string]bool // Resources written by the sync.
+	deferred []model.Edge    // Edges with a source or destination resource that isn't known.
+}
+
+// Creates the deferral with the resources written by the sync, excluding the resources that failed to write.
+// Must be called after the resource batches complete.
+func newEdgeDeferral(event model.SyncEvent, syncResponse *model.SyncResponse) *edgeDeferral {
+	failed := make(map[string]bool)
+	for _, syncErrors := range [][]model.SyncError{syncResponse.AddErrors, syncResponse.UpdateErrors} {
+		for _, syncError := range syncErrors {
+			failed[syncError.ResourceUID] = true
+		}
+	}
+	known := make(map[string]bool, len(event.AddResources)+len(event.UpdateResources))
+	for _, resources := range [][]model.Resource{event.AddResources, event.UpdateResources} {
+		for _, resource := range resources {
+			if !failed[resource.UID] {
+				known[resource.UID] = true
+			}
+		}
+	}
+	for _, resource := range event.DeleteResources {
+		delete(known, resource.UID)
+	}
+	return &edgeDeferral{known: known}
+}
+
+// Returns true if both resources of the edge are known. Otherwise holds the edge until resolveDeferred().
+func (d *edgeDeferral) ready(edge model.Edge) bool {
+	if d.known[edge.SourceUID] && d.known[edge.DestUID] {
+		return true
+	}
+	d.deferred = append(d.deferred, edge)
+	return false
+}
+
+// Checks the deferred edges against the resources in the database.
+// Returns the edges with both resources in the database, and reports the rest in SyncResponse.UnresolvedEdges.
+func (dao *DAO) resolveDeferred(ctx context.Context, d *edgeDeferral, clusterName string,
+	syncResponse *model.SyncResponse) []model.Edge {
+	if len(d.deferred) == 0 {
+		return nil
+	}
+	uids := make([]string, 0, len(d.deferred))
+	for _, edge := range d.deferred {
+		for _, uid := range []string{edge.SourceUID, edge.DestUID} {
+			if !d.known[uid] {
+				uids = append(uids, uid)
+			}
+		}
+	}
+
+	queryCtx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(queryCtx, existingUidsSql, uids)
+	if err != nil {
+		// Don't drop the edges because we can't validate them, the orphan edge cleanup removes the dangling edges.
+		logging.SampledErrorf("Error resolving deferred edges for cluster %12s. Writing them without validation. %s",
+			clusterName, err)
+		return d.deferred
+	}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			klog.Warningf("Error scanning resource uid. Error: %+v", err)
+			continue
+		}
+		d.known[uid] = true
+	}
+	rows.Close()
+
+	resolved := make([]model.Edge, 0, len(d.deferred))
+	for _, edge := range d.deferred {
+		if d.known[edge.SourceUID] && d.known[edge.DestUID] {
+			resolved = append(resolved, edge)
+			continue
+		}
+		syncResponse.UnresolvedEdges = append(syncResponse.UnresolvedEdges, model.SyncError{
+			ResourceUID: edge.SourceUID,
+			Message: fmt.Sprintf("Edge %s to %s wasn't stored because the source or destination resource doesn't exist.",
+				edge.EdgeType, edge.DestUID),
+		})
+	}
+	if len(syncResponse.UnresolvedEdges) > 0 {
+		metrics.UnresolvedEdges.Add(float64(len(syncResponse.UnresolvedEdges)))
+		klog.V(2).Infof("Skipped %d unresolved edges from cluster %12s.", len(syncResponse.UnresolvedEdges),
+			clusterName)
+	}
+	return resolved
+}
@@ -0,0 +1,58 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should write the edges with resources from the sync or the database, and report the unresolved edges.
+func Test_SyncData_deferEdges(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.deferEdges = true
+	addResource := batchStatement{sql: addResourceSQL, args: anyArgs(4)}
+	expectBatchStatements(mockPool, nil, addResource, addResource)
+	mockPool.ExpectQuery(existingUidsSql).WithArgs([]string{"uid-c", "uid-d"}).
+		WillReturnRows(pgxmock.NewRows([]string{"uid"}).AddRow("uid-c"))
+	addEdge := batchStatement{sql: addEdgeSQL, args: anyArgs(7)}
+	expectBatchStatements(mockPool, nil, addEdge, addEdge)
+
+	event := model.SyncEvent{
+		AddResources: []model.Resource{
+			{UID: "uid-a", Properties: map[string]interface{}{"kind": "Pod"}},
+			{UID: "uid-b", Properties: map[string]interface{}{"kind": "Node"}},
+		},
+		AddEdges: []model.Edge{
+			{SourceUID: "uid-a", DestUID: "uid-b", EdgeType: "runsOn"},
+			{SourceUID: "uid-a", DestUID: "uid-c", EdgeType: "ownedBy"}, // Resolved from the database.
+			{SourceUID: "uid-a", DestUID: "uid-d", EdgeType: "usedBy"},  // Unresolved.
+		},
+	}
+	response := &model.SyncResponse{}
+	err := dao.SyncData(context.Background(), event, "test-cluster", response)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, response.TotalEdgesAdded)
+	assert.Equal(t, []model.SyncError{{ResourceUID: "uid-a",
+		Message: "Edge usedBy to uid-d wasn't stored because the source or destination resource doesn't exist."}},
+		response.UnresolvedEdges)
+}
+
+// Should exclude the resources that failed to write or were deleted by the sync.
+func Test_newEdgeDeferral(t *testing.T) {
+	event := model.SyncEvent{
+		AddResources:    []model.Resource{{UID: "uid-a"}, {UID: "uid-b"}},
+		UpdateResources: []model.Resource{{UID: "uid-c"}},
+		DeleteResources: []model.DeleteResourceEvent{{UID: "uid-c"}},
+	}
+	deferral := newEdgeDeferral(event, &model.SyncResponse{AddErrors: []model.SyncError{{ResourceUID: "uid-b"}}})
+
+	assert.Equal(t, map[string]bool{"uid-a": true}, deferral.known)
+	assert.False(t, deferral.ready(model.Edge{SourceUID: "uid-a", DestUID: "uid-b"}))
+	assert.Len(t, deferral.deferred, 1)
+}
@@ -0,0 +1,39 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Edge properties.
+// The collector can send properties with an edge, for example the owner kind or the reason of an interCluster
+// edge, so graph queries can filter the relationships. The properties are stored in the edges.properties JSONB
+// column, NULL when the edge doesn't have properties. Adding an existing edge updates its properties.
+
+// Returns the edge properties serialized for the properties column, or nil if the edge doesn't have properties.
+func edgeProperties(edge model.Edge) interface{} {
+	if len(edge.Properties) == 0 {
+		return nil
+	}
+	props, err := json.Marshal(edge.Properties)
+	if err != nil {
+		klog.Warningf("Error serializing properties of edge %s %s %s. Storing the edge without properties. %s",
+			edge.SourceUID, edge.EdgeType, edge.DestUID, err)
+		return nil
+	}
+	return string(props)
+}
+
+// Compares the properties of an existing edge with the incoming edge.
+// Edges without properties are equal to edges with empty properties.
+func sameEdgeProperties(existing, incoming map[string]interface{}) bool {
+	if len(existing) == 0 || len(incoming) == 0 {
+		return len(existing) == len(incoming)
+	}
+	return reflect.DeepEqual(existing, incoming)
+}
@@ -0,0 +1,26 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_edgeProperties(t *testing.T) {
+	assert.Nil(t, edgeProperties(model.Edge{SourceUID: "uid-1"}))
+	assert.Nil(t, edgeProperties(model.Edge{SourceUID: "uid-1", Properties: map[string]interface{}{}}))
+	assert.Equal(t, `{"ownerKind":"ReplicaSet"}`,
+		edgeProperties(model.Edge{SourceUID: "uid-1", Properties: map[string]interface{}{"ownerKind": "ReplicaSet"}}))
+}
+
+func Test_sameEdgeProperties(t *testing.T) {
+	assert.True(t, sameEdgeProperties(nil, map[string]interface{}{}))
+	assert.True(t, sameEdgeProperties(map[string]interface{}{"replicas": float64(2)},
+		map[string]interface{}{"replicas": float64(2)}))
+	assert.False(t, sameEdgeProperties(nil, map[string]interface{}{"ownerKind": "ReplicaSet"}))
+	assert.False(t, sameEdgeProperties(map[string]interface{}{"ownerKind": "ReplicaSet"},
+		map[string]interface{}{"ownerKind": "Deployment"}))
+}
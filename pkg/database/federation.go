@@ -0,0 +1,42 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"strings"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+)
+
+// Federation.
+// With FEDERATION_HUBS, this indexer also receives the cluster data of other hubs, so a global search hub can
+// aggregate several hubs in one database. The other hubs send the sync requests of their clusters to
+// /aggregator/hubs/{hub}/clusters/{cluster}/sync. The data is stored under the cluster name <hub>/<cluster>, because
+// the cluster names, e.g. local-cluster, aren't unique across hubs and a resync replaces all the data of the
+// cluster. The resources are tagged with the source hub in the hub property. The federated clusters don't have a
+// ManagedCluster in this hub, so clustersync doesn't delete their data, see clustersync.findStaleClusterResources().
+// Each hub authenticates with the token of its user in FEDERATION_HUB_USERS, see server/federationAuth.go
+
+const federatedClusterSeparator = "/" // Not allowed in cluster names.
+
+// Returns the name used to store the data of a cluster from another hub.
+func FederatedClusterName(hub, clusterName string) string {
+	return hub + federatedClusterSeparator + clusterName
+}
+
+// Returns true if the data of the cluster was received from another hub.
+func IsFederatedCluster(clusterName string) bool {
+	return strings.Contains(clusterName, federatedClusterSeparator)
+}
+
+// Sets the hub property of the resources added or updated by the sync event.
+func TagSourceHub(event *model.SyncEvent, hub string) {
+	for _, resources := range [][]model.Resource{event.AddResources, event.UpdateResources} {
+		for i := range resources {
+			if resources[i].Properties == nil {
+				resources[i].Properties = map[string]interface{}{}
+			}
+			resources[i].Properties["hub"] = hub
+		}
+	}
+}
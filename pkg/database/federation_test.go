@@ -0,0 +1,31 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FederatedClusterName(t *testing.T) {
+	clusterName := FederatedClusterName("hub-a", "local-cluster")
+
+	assert.Equal(t, "hub-a/local-cluster", clusterName)
+	assert.True(t, IsFederatedCluster(clusterName))
+	assert.False(t, IsFederatedCluster("local-cluster"))
+}
+
+// Should set the hub property of the added and updated resources.
+func Test_TagSourceHub(t *testing.T) {
+	event := model.SyncEvent{
+		AddResources:    []model.Resource{{UID: "uid-1", Properties: map[string]interface{}{"name": "a"}}},
+		UpdateResources: []model.Resource{{UID: "uid-2"}},
+	}
+
+	TagSourceHub(&event, "hub-a")
+
+	assert.Equal(t, map[string]interface{}{"name": "a", "hub": "hub-a"}, event.AddResources[0].Properties)
+	assert.Equal(t, map[string]interface{}{"hub": "hub-a"}, event.UpdateResources[0].Properties)
+}
@@ -0,0 +1,55 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"k8s.io/klog/v2"
+)
+
+// Full-text search.
+// When FULL_TEXT_SEARCH is enabled, a trigger maintains the search_text tsvector column over the resource name,
+// namespace, labels, and annotations. The trigger only runs for connections with the setting
+// search.full_text_search=on, see initializePool(). The GIN index on search_text lets search-api use
+// full-text queries (search_text @@ plainto_tsquery('simple', 'foo')) instead of ILIKE scans.
+
+// Rows updated per statement when filling the search_text column, to stay under the statement timeout.
+const searchTextBackfillSize = 10000
+
+// Fills the search_text column for the rows written before FULL_TEXT_SEARCH was enabled.
+// Runs in the background until all rows are filled or the context is cancelled.
+func (dao *DAO) StartSearchTextBackfill(ctx context.Context) {
+	total := int64(0)
+	for {
+		filled, err := dao.backfillSearchText(ctx)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+				continue
+			}
+		}
+		total += filled
+		if filled < searchTextBackfillSize {
+			klog.Infof("Completed filling search_text for %d resources.", total)
+			return
+		}
+	}
+}
+
+// Fills the search_text column for the next set of rows. Returns the number of rows updated.
+func (dao *DAO) backfillSearchText(ctx context.Context) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	res, err := dao.pool.Exec(ctx, "UPDATE resources SET search_text = resource_search_text(data) "+
+		"WHERE uid IN (SELECT uid FROM resources WHERE search_text IS NULL LIMIT $1)", searchTextBackfillSize)
+	if err != nil {
+		logging.SampledErrorf("Error filling search_text. %s", err)
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
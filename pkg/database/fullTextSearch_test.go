@@ -0,0 +1,39 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should fill the search_text column until there are no rows left.
+func Test_StartSearchTextBackfill(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	query := "UPDATE resources SET search_text = resource_search_text(data) " +
+		"WHERE uid IN (SELECT uid FROM resources WHERE search_text IS NULL LIMIT $1)"
+	mockPool.ExpectExec(query).WithArgs(searchTextBackfillSize).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 10000))
+	mockPool.ExpectExec(query).WithArgs(searchTextBackfillSize).WillReturnResult(pgxmock.NewResult("UPDATE", 5))
+
+	dao.StartSearchTextBackfill(context.Background())
+}
+
+// Should stop retrying when the context is cancelled.
+func Test_StartSearchTextBackfill_cancelled(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mockPool.ExpectExec("UPDATE resources SET search_text = resource_search_text(data) " +
+		"WHERE uid IN (SELECT uid FROM resources WHERE search_text IS NULL LIMIT $1)").
+		WithArgs(searchTextBackfillSize).WillReturnError(context.Canceled)
+
+	dao.StartSearchTextBackfill(ctx)
+
+	assert.NotNil(t, ctx.Err())
+}
@@ -4,16 +4,18 @@ package database
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/doug-martin/goqu/v9/exp"
 	"k8s.io/klog/v2"
 )
 
 func useGoqu(query string, params []interface{}) (q string, p []interface{}, er error) {
 	dialect := goqu.Dialect("postgres")
-	resources := goqu.S("search").Table("resources")
-	edges := goqu.S("search").Table("edges")
+	resources := goqu.T("resources")
+	edges := goqu.T("edges")
 
 	validateParams := func(expectedParams int) bool {
 		if len(params) != expectedParams {
@@ -24,51 +26,86 @@ func useGoqu(query string, params []interface{}) (q string, p []interface{}, er
 	}
 
 	switch query {
-	case "SELECT uid, data FROM search.resources WHERE cluster=$1 AND uid!='cluster__$1'":
+	case "SELECT uid, data, hash FROM resources WHERE cluster=$1 AND deleted_at IS NULL":
 		q, p, er = dialect.From(resources).Prepared(true).
-			Select("uid", "data").Where(
-			goqu.C("cluster").Eq(params[0]),
-			goqu.C("uid").Neq(fmt.Sprintf("cluster__%s", params[0]))). // Exclude the cluster pseudo-node.
-			ToSQL()
+			Select("uid", "data", "hash").Where(goqu.C("cluster").Eq(params[0]), goqu.C("deleted_at").IsNull()).ToSQL()
 
-	case "INSERT into search.resources values($1,$2,$3) ON CONFLICT (uid) DO NOTHING":
-		if !validateParams(3) {
+	case "INSERT into resources values($1,$2,$3,$4) ON CONFLICT (uid) " +
+		"DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE deleted_at IS NOT NULL":
+		if !validateParams(4) {
 			break
 		}
+		// Only conflicts with a soft deleted resource, because the existing resources were already selected.
 		q, p, er = dialect.From(resources).Prepared(true).
-			Insert().Rows(goqu.Record{"uid": params[0], "cluster": params[1], "data": params[2]}).
-			OnConflict(goqu.DoNothing()).ToSQL()
+			Insert().Rows(goqu.Record{"uid": params[0], "cluster": params[1], "data": params[2], "hash": params[3]}).
+			OnConflict(goqu.DoUpdate("uid", goqu.Record{"data": goqu.L("EXCLUDED.data"),
+				"hash": goqu.L("EXCLUDED.hash"), "deleted_at": goqu.L("NULL")}).
+				Where(goqu.T("resources").Col("deleted_at").IsNotNull())).ToSQL()
 
-	case "UPDATE search.resources SET data=$2 WHERE uid=$1":
-		if !validateParams(2) {
+	case "UPDATE resources SET data=$2, hash=$3, deleted_at=NULL WHERE uid=$1":
+		if !validateParams(3) {
 			break
 		}
 		q, p, er = dialect.From(resources).Prepared(true).
-			Update().Set(goqu.Record{"data": params[1].(string)}).Where(goqu.C("uid").Eq(params[0])).ToSQL()
+			Update().Set(goqu.Record{"data": params[1].(string), "hash": params[2], "deleted_at": goqu.L("NULL")}).
+			Where(goqu.C("uid").Eq(params[0])).ToSQL()
 
-	case "DELETE from search.resources WHERE uid IN ($1)":
-		q, p, er = dialect.From(resources).
+	case "DELETE from resources WHERE uid IN ($1)":
+		q, p, er = dialect.From(resources).Prepared(true).
 			Delete().Where(goqu.C("uid").In(params)).ToSQL()
 
-	case "DELETE from search.edges WHERE sourceid IN ($1) OR destid IN ($1)":
-		q, p, er = dialect.From(edges).
+	case "UPDATE resources SET deleted_at=now() WHERE uid IN ($1) AND deleted_at IS NULL":
+		q, p, er = dialect.From(resources).Prepared(true).
+			Update().Set(goqu.Record{"deleted_at": goqu.L("now()")}).
+			Where(goqu.C("uid").In(params), goqu.C("deleted_at").IsNull()).ToSQL()
+
+	case "DELETE from edges WHERE sourceid IN ($1) OR destid IN ($1)":
+		q, p, er = dialect.From(edges).Prepared(true).
 			Delete().Where(
 			goqu.Or(goqu.C("sourceid").In(params),
 				goqu.C("destid").In(params))).ToSQL()
 
+	case "UPDATE edges SET deleted_at=now() WHERE (sourceid IN ($1) OR destid IN ($1)) AND deleted_at IS NULL":
+		q, p, er = dialect.From(edges).Prepared(true).
+			Update().Set(goqu.Record{"deleted_at": goqu.L("now()")}).
+			Where(goqu.Or(goqu.C("sourceid").In(params), goqu.C("destid").In(params)),
+				goqu.C("deleted_at").IsNull()).ToSQL()
+
 	// Queries for EDGES table.
-	case "SELECT sourceid, edgetype, destid FROM search.edges WHERE edgetype!='interCluster' AND cluster=$1":
+	case "SELECT sourceid, edgetype, destid, properties FROM edges " +
+		"WHERE edgetype!='interCluster' AND cluster=$1 AND deleted_at IS NULL":
 		q, p, er = dialect.From(edges).Prepared(true).
-			Select("sourceid", "edgetype", "destid").Where(
+			Select("sourceid", "edgetype", "destid", "properties").Where(
 			goqu.C("edgetype").Neq("interCluster"),
-			goqu.C("cluster").Eq(params[0])).ToSQL()
+			goqu.C("cluster").Eq(params[0]),
+			goqu.C("deleted_at").IsNull()).ToSQL()
 
-	case "INSERT into search.edges values($1,$2,$3,$4,$5,$6) ON CONFLICT (sourceid, destid, edgetype) DO NOTHING":
+	case "INSERT into edges values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype) " +
+		"DO UPDATE SET properties=$7 WHERE properties IS DISTINCT FROM $7":
+		if !validateParams(7) {
+			break
+		}
 		q, p, er = dialect.From(edges).Prepared(true).
-			Insert().Cols("sourceid", "sourcekind", "destid", "destkind", "edgetype", "cluster").Vals(params).
-			OnConflict(goqu.DoNothing()).ToSQL()
-
-	case "DELETE from search.edges WHERE sourceid=$1 AND destid=$2 AND edgetype=$3":
+			Insert().Cols("sourceid", "sourcekind", "destid", "destkind", "edgetype", "cluster", "properties").
+			Vals(params).
+			OnConflict(goqu.DoUpdate("sourceid, destid, edgetype",
+				goqu.Record{"properties": goqu.L("EXCLUDED.properties")}).
+				Where(goqu.L(`"edges"."properties" IS DISTINCT FROM EXCLUDED.properties`))).ToSQL()
+
+	case "INSERT into edges values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype) " +
+		"DO UPDATE SET properties=$7, deleted_at=NULL WHERE properties IS DISTINCT FROM $7 OR deleted_at IS NOT NULL":
+		if !validateParams(7) {
+			break
+		}
+		q, p, er = dialect.From(edges).Prepared(true).
+			Insert().Cols("sourceid", "sourcekind", "destid", "destkind", "edgetype", "cluster", "properties").
+			Vals(params).
+			OnConflict(goqu.DoUpdate("sourceid, destid, edgetype",
+				goqu.Record{"properties": goqu.L("EXCLUDED.properties"), "deleted_at": goqu.L("NULL")}).
+				Where(goqu.Or(goqu.L(`"edges"."properties" IS DISTINCT FROM EXCLUDED.properties`),
+					goqu.T("edges").Col("deleted_at").IsNotNull()))).ToSQL()
+
+	case "DELETE from edges WHERE sourceid=$1 AND destid=$2 AND edgetype=$3":
 		if !validateParams(3) {
 			break
 		}
@@ -78,6 +115,17 @@ func useGoqu(query string, params []interface{}) (q string, p []interface{}, er
 			goqu.C("destid").Eq(params[1]),
 			goqu.C("edgetype").Eq(params[2])).ToSQL()
 
+	case "UPDATE edges SET deleted_at=now() WHERE sourceid=$1 AND destid=$2 AND edgetype=$3 AND deleted_at IS NULL":
+		if !validateParams(3) {
+			break
+		}
+		q, p, er = dialect.From(edges).Prepared(true).
+			Update().Set(goqu.Record{"deleted_at": goqu.L("now()")}).Where(
+			goqu.C("sourceid").Eq(params[0]),
+			goqu.C("destid").Eq(params[1]),
+			goqu.C("edgetype").Eq(params[2]),
+			goqu.C("deleted_at").IsNull()).ToSQL()
+
 	default:
 		er = fmt.Errorf("Unable to build goqu query for [%s]", query)
 	}
@@ -88,3 +136,32 @@ func useGoqu(query string, params []interface{}) (q string, p []interface{}, er
 
 	return q, p, er
 }
+
+// Applies keyset pagination to a select query. Sorts by the key columns and selects the rows after the given key.
+// Fetches limit+1 rows so the caller can detect if there's a next page.
+// Sample query:
+//
+//	SELECT ... WHERE (<col1>, <col2>) > ($1, $2) ORDER BY <col1> ASC, <col2> ASC LIMIT <limit+1>
+func keysetPage(ds *goqu.SelectDataset, keyColumns []string, after []string, limit int) (*goqu.SelectDataset,
+	error) {
+	order := make([]exp.OrderedExpression, len(keyColumns))
+	for i, column := range keyColumns {
+		order[i] = goqu.C(column).Asc()
+	}
+	ds = ds.Order(order...).Limit(uint(limit + 1))
+
+	if len(after) == 0 {
+		return ds, nil
+	}
+	if len(after) != len(keyColumns) {
+		return ds, fmt.Errorf("Invalid pagination key %v for columns %v", after, keyColumns)
+	}
+	placeholders := make([]string, len(after))
+	values := make([]interface{}, len(after))
+	for i, val := range after {
+		placeholders[i] = "?"
+		values[i] = val
+	}
+	return ds.Where(goqu.L(fmt.Sprintf("(%s) > (%s)",
+		strings.Join(keyColumns, ", "), strings.Join(placeholders, ", ")), values...)), nil
+}
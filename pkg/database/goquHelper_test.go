@@ -5,21 +5,131 @@ package database
 import (
 	"testing"
 
+	"github.com/doug-martin/goqu/v9"
+
 	"github.com/stretchr/testify/assert"
 )
 
 func Test_useGoqu(t *testing.T) {
-	q, p, er := useGoqu("SELECT uid, data FROM search.resources WHERE cluster=$1 AND uid!='cluster__$1'", []interface{}{"test-cluster"})
+	q, p, er := useGoqu("SELECT uid, data, hash FROM resources WHERE cluster=$1 AND deleted_at IS NULL",
+		[]interface{}{"test-cluster"})
 
-	assert.Equal(t, "SELECT \"uid\", \"data\" FROM \"search\".\"resources\" WHERE ((\"cluster\" = $1) AND (\"uid\" != $2))", q)
-	assert.Equal(t, []interface{}{"test-cluster", "cluster__test-cluster"}, p)
+	assert.Equal(t, "SELECT \"uid\", \"data\", \"hash\" FROM \"resources\" "+
+		"WHERE ((\"cluster\" = $1) AND (\"deleted_at\" IS NULL))", q)
+	assert.Equal(t, []interface{}{"test-cluster"}, p)
 	assert.Nil(t, er)
 }
 
 func Test_useGoqu_invalidParams(t *testing.T) {
-	q, p, er := useGoqu("INSERT into search.resources values($1,$2,$3) ON CONFLICT (uid) DO NOTHING", []interface{}{"fakeUid", "fakeCluster"})
+	q, p, er := useGoqu("INSERT into resources values($1,$2,$3,$4) ON CONFLICT (uid) "+
+		"DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE deleted_at IS NOT NULL",
+		[]interface{}{"fakeUid", "fakeCluster"})
 
 	assert.Equal(t, "", q)
 	assert.Nil(t, p)
 	assert.NotNil(t, er)
 }
+
+func Test_keysetPage(t *testing.T) {
+	ds := goqu.Dialect("postgres").From(goqu.T("resources")).Prepared(true).Select("uid")
+
+	// First page.
+	firstPage, err := keysetPage(ds, []string{"cluster", "uid"}, nil, 10)
+	assert.Nil(t, err)
+	q, p, _ := firstPage.ToSQL()
+	assert.Equal(t, "SELECT \"uid\" FROM \"resources\" ORDER BY \"cluster\" ASC, \"uid\" ASC LIMIT $1", q)
+	assert.Equal(t, []interface{}{int64(11)}, p)
+
+	// Next page.
+	nextPage, err := keysetPage(ds, []string{"cluster", "uid"}, []string{"cluster-a", "uid-1"}, 10)
+	assert.Nil(t, err)
+	q, p, _ = nextPage.ToSQL()
+	assert.Equal(t, "SELECT \"uid\" FROM \"resources\" WHERE (cluster, uid) > ($1, $2) "+
+		"ORDER BY \"cluster\" ASC, \"uid\" ASC LIMIT $3", q)
+	assert.Equal(t, []interface{}{"cluster-a", "uid-1", int64(11)}, p)
+
+	// Key doesn't match the columns.
+	_, err = keysetPage(ds, []string{"cluster", "uid"}, []string{"cluster-a"}, 10)
+	assert.NotNil(t, err)
+}
+
+// Should pass the resource values as positional parameters.
+func Test_useGoqu_deleteWithParams(t *testing.T) {
+	q, p, er := useGoqu("DELETE from resources WHERE uid IN ($1)", []interface{}{"uid-1", "uid-'2"})
+
+	assert.Equal(t, "DELETE FROM \"resources\" WHERE (\"uid\" IN ($1, $2))", q)
+	assert.Equal(t, []interface{}{"uid-1", "uid-'2"}, p)
+	assert.Nil(t, er)
+
+	q, p, er = useGoqu("DELETE from edges WHERE sourceid IN ($1) OR destid IN ($1)", []interface{}{"uid-1"})
+
+	assert.Equal(t, "DELETE FROM \"edges\" WHERE ((\"sourceid\" IN ($1)) OR (\"destid\" IN ($2)))", q)
+	assert.Equal(t, []interface{}{"uid-1", "uid-1"}, p)
+	assert.Nil(t, er)
+}
+
+// Should remove the tombstone when inserting a soft deleted resource or edge.
+func Test_useGoqu_insertRemovesTombstone(t *testing.T) {
+	q, p, er := useGoqu("INSERT into resources values($1,$2,$3,$4) ON CONFLICT (uid) "+
+		"DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE deleted_at IS NOT NULL",
+		[]interface{}{"uid-1", "cluster-a", `{"kind":"Pod"}`, int64(42)})
+
+	assert.Equal(t, "INSERT INTO \"resources\" (\"cluster\", \"data\", \"hash\", \"uid\") "+
+		"VALUES ($1, $2, $3, $4) ON CONFLICT (uid) DO UPDATE SET \"data\"=EXCLUDED.data,\"deleted_at\"=NULL,"+
+		"\"hash\"=EXCLUDED.hash WHERE (\"resources\".\"deleted_at\" IS NOT NULL)", q)
+	assert.Equal(t, []interface{}{"cluster-a", `{"kind":"Pod"}`, int64(42), "uid-1"}, p)
+	assert.Nil(t, er)
+
+	q, _, er = useGoqu("INSERT into edges values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype) "+
+		"DO UPDATE SET properties=$7, deleted_at=NULL WHERE properties IS DISTINCT FROM $7 OR deleted_at IS NOT NULL",
+		[]interface{}{"uid-1", "Pod", "uid-2", "Node", "runsOn", "cluster-a", nil})
+
+	assert.Equal(t, "INSERT INTO \"edges\" "+
+		"(\"sourceid\", \"sourcekind\", \"destid\", \"destkind\", \"edgetype\", \"cluster\", \"properties\") "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (sourceid, destid, edgetype) "+
+		"DO UPDATE SET \"deleted_at\"=NULL,\"properties\"=EXCLUDED.properties "+
+		"WHERE (\"edges\".\"properties\" IS DISTINCT FROM EXCLUDED.properties OR (\"edges\".\"deleted_at\" IS NOT NULL))", q)
+	assert.Nil(t, er)
+}
+
+// Should update the properties of the edges that already exist.
+func Test_useGoqu_insertEdgeProperties(t *testing.T) {
+	q, p, er := useGoqu("INSERT into edges values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype) "+
+		"DO UPDATE SET properties=$7 WHERE properties IS DISTINCT FROM $7",
+		[]interface{}{"uid-1", "Pod", "uid-2", "ReplicaSet", "ownedBy", "cluster-a", `{"controller":true}`})
+
+	assert.Equal(t, "INSERT INTO \"edges\" "+
+		"(\"sourceid\", \"sourcekind\", \"destid\", \"destkind\", \"edgetype\", \"cluster\", \"properties\") "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (sourceid, destid, edgetype) "+
+		"DO UPDATE SET \"properties\"=EXCLUDED.properties "+
+		"WHERE \"edges\".\"properties\" IS DISTINCT FROM EXCLUDED.properties", q)
+	assert.Equal(t, []interface{}{"uid-1", "Pod", "uid-2", "ReplicaSet", "ownedBy", "cluster-a", `{"controller":true}`}, p)
+	assert.Nil(t, er)
+}
+
+// Should mark the resources and edges with a tombstone.
+func Test_useGoqu_softDelete(t *testing.T) {
+	q, p, er := useGoqu("UPDATE resources SET deleted_at=now() WHERE uid IN ($1) AND deleted_at IS NULL",
+		[]interface{}{"uid-1", "uid-2"})
+
+	assert.Equal(t, "UPDATE \"resources\" SET \"deleted_at\"=now() "+
+		"WHERE ((\"uid\" IN ($1, $2)) AND (\"deleted_at\" IS NULL))", q)
+	assert.Equal(t, []interface{}{"uid-1", "uid-2"}, p)
+	assert.Nil(t, er)
+
+	q, _, er = useGoqu("UPDATE edges SET deleted_at=now() "+
+		"WHERE (sourceid IN ($1) OR destid IN ($1)) AND deleted_at IS NULL", []interface{}{"uid-1"})
+
+	assert.Equal(t, "UPDATE \"edges\" SET \"deleted_at\"=now() "+
+		"WHERE (((\"sourceid\" IN ($1)) OR (\"destid\" IN ($2))) AND (\"deleted_at\" IS NULL))", q)
+	assert.Nil(t, er)
+
+	q, p, er = useGoqu("UPDATE edges SET deleted_at=now() "+
+		"WHERE sourceid=$1 AND destid=$2 AND edgetype=$3 AND deleted_at IS NULL",
+		[]interface{}{"uid-1", "uid-2", "ownedBy"})
+
+	assert.Equal(t, "UPDATE \"edges\" SET \"deleted_at\"=now() WHERE ((\"sourceid\" = $1) AND "+
+		"(\"destid\" = $2) AND (\"edgetype\" = $3) AND (\"deleted_at\" IS NULL))", q)
+	assert.Equal(t, []interface{}{"uid-1", "uid-2", "ownedBy"}, p)
+	assert.Nil(t, er)
+}
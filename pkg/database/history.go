@@ -0,0 +1,39 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"k8s.io/klog/v2"
+)
+
+// Resource history.
+// When RESOURCE_HISTORY is enabled, a trigger records the previous version of a resource in
+// search.resources_history when the resource is updated or deleted. The trigger only records the history for
+// connections with the setting search.resource_history=on, see initializePool().
+
+const historyCleanupInterval = time.Hour
+
+// Periodically deletes the resource history older than the retention period. Runs until the context is cancelled.
+func (dao *DAO) StartHistoryCleanup(ctx context.Context, retention time.Duration) {
+	runPeriodically(ctx, "resource history cleanup", historyCleanupInterval, func(ctx context.Context) {
+		_, _ = dao.deleteHistory(ctx, retention)
+	})
+}
+
+// Deletes the resource history older than the retention period. Returns the number of rows deleted.
+func (dao *DAO) deleteHistory(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	res, err := dao.pool.Exec(ctx, "DELETE FROM resources_history WHERE changed_at < $1",
+		time.Now().Add(-retention))
+	if err != nil {
+		logging.SampledErrorf("Error deleting resource history. %s", err)
+		return 0, err
+	}
+	klog.V(2).Infof("Deleted %d rows from resources_history older than %s.", res.RowsAffected(), retention)
+	return res.RowsAffected(), nil
+}
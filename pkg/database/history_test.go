@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deleteHistory(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM resources_history WHERE changed_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 5))
+
+	deleted, err := dao.deleteHistory(context.Background(), 24*time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), deleted)
+}
+
+func Test_deleteHistory_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM resources_history WHERE changed_at < $1").WithArgs(pgxmock.AnyArg()).WillReturnError(errors.New("connection refused"))
+
+	deleted, err := dao.deleteHistory(context.Background(), 24*time.Hour)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
+
+// Should stop when the context is cancelled.
+func Test_StartHistoryCleanup(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM resources_history WHERE changed_at < $1").WithArgs(pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		dao.StartHistoryCleanup(ctx, 24*time.Hour)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected history cleanup to stop after the context is cancelled.")
+	}
+}
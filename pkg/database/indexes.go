@@ -0,0 +1,213 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// Declarative index management.
+// The indexes created by the schema migrations are the same for every environment. Additional indexes are
+// declared with INDEX_DEFINITIONS, which can be read from a ConfigMap, and reconciled at startup.
+//   - Missing indexes are created concurrently, so the tables aren't locked while the index is built.
+//   - Invalid indexes, left behind by a failed concurrent build, are dropped and created again.
+//   - With INDEX_DROP_UNDECLARED, the managed indexes no longer declared are dropped.
+// Managed indexes are marked with a comment, so we never drop the indexes created by the schema migrations.
+// To change the definition of an index, declare it with a new name.
+// DATA_GIN_INDEX declares a GIN index over the entire data column, used by arbitrary property filters.
+// TRIGRAM_INDEX declares a trigram index on the resource name, see trigram.go
+//
+// Example: INDEX_DEFINITIONS='[{"name":"edges_type_idx","table":"edges","definition":"USING btree (edgetype)"}]'
+
+const managedIndexComment = "Managed by search-indexer INDEX_DEFINITIONS."
+
+// Supports containment filters (data @> '{"label":"app=foo"}') for any property, at the cost of a large index and
+// slower writes. Building it on a large table can take hours, so it's skipped above DATA_GIN_INDEX_MAX_SIZE_MB.
+var dataGINIndex = IndexDefinition{
+	Name:       "data_gin_idx",
+	Table:      "resources",
+	Definition: "USING GIN (data jsonb_path_ops)",
+}
+
+var indexNameRegex = regexp.MustCompile("^[a-z_][a-z0-9_]{0,62}$")
+
+type IndexDefinition struct {
+	Name       string `json:"name"`
+	Table      string `json:"table"`      // resources or edges
+	Definition string `json:"definition"` // Index method, columns and predicate. Example: USING btree (cluster)
+}
+
+type existingIndex struct {
+	valid   bool
+	managed bool
+}
+
+// Parses and validates the JSON list of index definitions.
+func parseIndexDefinitions(definitions string) ([]IndexDefinition, error) {
+	indexes := []IndexDefinition{}
+	if definitions == "" {
+		return indexes, nil
+	}
+	if err := json.Unmarshal([]byte(definitions), &indexes); err != nil {
+		return nil, fmt.Errorf("Invalid INDEX_DEFINITIONS. %w", err)
+	}
+	for _, index := range indexes {
+		if !indexNameRegex.MatchString(index.Name) {
+			return nil, fmt.Errorf("Invalid index name [%s]. Must be a lowercase identifier.", index.Name)
+		}
+		if index.Table != "resources" && index.Table != "edges" {
+			return nil, fmt.Errorf("Invalid table [%s] for index %s. Must be one of: resources, edges.",
+				index.Table, index.Name)
+		}
+		if index.Definition == "" {
+			return nil, fmt.Errorf("Missing definition for index %s.", index.Name)
+		}
+	}
+	return indexes, nil
+}
+
+// Creates the declared indexes and drops the managed indexes no longer declared.
+func (dao *DAO) reconcileIndexes(ctx context.Context) error {
+	if config.Cfg.IndexDefinitions == "" && !config.Cfg.IndexDropUndeclared && !config.Cfg.DataGINIndex &&
+		!config.Cfg.TrigramIndex {
+		return nil
+	}
+	declared, err := parseIndexDefinitions(config.Cfg.IndexDefinitions)
+	if err != nil {
+		return err
+	}
+	existing, err := dao.existingIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	if config.Cfg.DataGINIndex {
+		if _, found := existing[dataGINIndex.Name]; found {
+			declared = append(declared, dataGINIndex)
+		} else if tooLarge, err := dao.resourcesLargerThan(ctx, config.Cfg.DataGINMaxSizeMB); err != nil {
+			return err
+		} else if tooLarge {
+			klog.Warningf("Skipping index %s because resources is larger than %d MB. Building the index "+
+				"would take too long, increase DATA_GIN_INDEX_MAX_SIZE_MB to create it.",
+				dataGINIndex.Name, config.Cfg.DataGINMaxSizeMB)
+		} else {
+			declared = append(declared, dataGINIndex)
+		}
+	}
+	if config.Cfg.TrigramIndex {
+		if _, found := existing[trigramIndex.Name]; found {
+			declared = append(declared, trigramIndex)
+		} else if available, err := dao.setupTrigramExtension(ctx); err != nil {
+			return err
+		} else if available {
+			declared = append(declared, trigramIndex)
+		}
+	}
+
+	declaredNames := make(map[string]bool, len(declared))
+	for _, index := range declared {
+		declaredNames[index.Name] = true
+		current, found := existing[index.Name]
+		if found && current.valid {
+			if !current.managed {
+				klog.Warningf("Skipping declared index %s because an index with the same name isn't managed by "+
+					"INDEX_DEFINITIONS.", index.Name)
+			}
+			continue
+		}
+		if found {
+			// A failed concurrent build leaves an invalid index, before it's marked as managed.
+			klog.Warningf("Index %s is invalid, dropping it to create it again.", index.Name)
+			if err := dao.dropIndex(ctx, index.Name); err != nil {
+				return err
+			}
+		}
+		if err := dao.createIndex(ctx, index); err != nil {
+			return err
+		}
+	}
+
+	if config.Cfg.IndexDropUndeclared {
+		for name, current := range existing {
+			if current.managed && !declaredNames[name] {
+				if err := dao.dropIndex(ctx, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the indexes in the tenant schema.
+func (dao *DAO) existingIndexes(ctx context.Context) (map[string]existingIndex, error) {
+	rows, err := dao.pool.Query(ctx, "SELECT c.relname, i.indisvalid, "+
+		"coalesce(obj_description(c.oid, 'pg_class'), '') = $1 FROM pg_index i "+
+		"JOIN pg_class c ON c.oid = i.indexrelid JOIN pg_namespace n ON n.oid = c.relnamespace "+
+		"WHERE n.nspname = current_schema()", managedIndexComment)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the search indexes. %w", err)
+	}
+	defer rows.Close()
+	indexes := make(map[string]existingIndex)
+	for rows.Next() {
+		var name string
+		var index existingIndex
+		if err := rows.Scan(&name, &index.valid, &index.managed); err != nil {
+			return nil, fmt.Errorf("Error reading the search indexes. %w", err)
+		}
+		indexes[name] = index
+	}
+	return indexes, nil
+}
+
+// Checks if the size of the search.resources table is larger than the given size in MB.
+func (dao *DAO) resourcesLargerThan(ctx context.Context, sizeMB int) (bool, error) {
+	rows, err := dao.pool.Query(ctx, "SELECT pg_total_relation_size('resources')")
+	if err != nil {
+		return false, fmt.Errorf("Error reading the size of resources. %w", err)
+	}
+	defer rows.Close()
+
+	var size int64
+	if rows.Next() {
+		err = rows.Scan(&size)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error reading the size of resources. %w", err)
+	}
+	return size > int64(sizeMB)*1024*1024, nil
+}
+
+// Builds the index without locking writes to the table. The index is marked as managed after it's created.
+// Note that DB_STATEMENT_TIMEOUT applies to the index build. A build that times out leaves an invalid index,
+// which is created again on the next start.
+func (dao *DAO) createIndex(ctx context.Context, index IndexDefinition) error {
+	klog.Infof("Creating index %s ON %s %s", index.Name, index.Table, index.Definition)
+	_, err := dao.pool.Exec(ctx, fmt.Sprintf("CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s %s",
+		index.Name, index.Table, index.Definition))
+	if err != nil {
+		return fmt.Errorf("Error creating index %s. %w", index.Name, err)
+	}
+	_, err = dao.pool.Exec(ctx, fmt.Sprintf("COMMENT ON INDEX %s IS '%s'", index.Name, managedIndexComment))
+	if err != nil {
+		return fmt.Errorf("Error marking index %s as managed. %w", index.Name, err)
+	}
+	return nil
+}
+
+func (dao *DAO) dropIndex(ctx context.Context, name string) error {
+	klog.Infof("Dropping index %s", name)
+	if _, err := dao.pool.Exec(ctx, fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", name)); err != nil {
+		return fmt.Errorf("Error dropping index %s. %w", name, err)
+	}
+	return nil
+}
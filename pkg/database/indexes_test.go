@@ -0,0 +1,118 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const existingIndexesSql = "SELECT c.relname, i.indisvalid, " +
+	"coalesce(obj_description(c.oid, 'pg_class'), '') = $1 FROM pg_index i " +
+	"JOIN pg_class c ON c.oid = i.indexrelid JOIN pg_namespace n ON n.oid = c.relnamespace " +
+	"WHERE n.nspname = current_schema()"
+
+func Test_parseIndexDefinitions(t *testing.T) {
+	indexes, err := parseIndexDefinitions(
+		`[{"name":"edges_type_idx","table":"edges","definition":"USING btree (edgetype)"}]`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []IndexDefinition{{Name: "edges_type_idx", Table: "edges", Definition: "USING btree (edgetype)"}},
+		indexes)
+}
+
+func Test_parseIndexDefinitions_invalid(t *testing.T) {
+	_, err := parseIndexDefinitions(`not json`)
+	assert.NotNil(t, err)
+
+	_, err = parseIndexDefinitions(`[{"name":"idx; DROP TABLE x","table":"edges","definition":"(edgetype)"}]`)
+	assert.Equal(t, "Invalid index name [idx; DROP TABLE x]. Must be a lowercase identifier.", err.Error())
+
+	_, err = parseIndexDefinitions(`[{"name":"idx","table":"clusters","definition":"(edgetype)"}]`)
+	assert.Equal(t, "Invalid table [clusters] for index idx. Must be one of: resources, edges.", err.Error())
+
+	_, err = parseIndexDefinitions(`[{"name":"idx","table":"edges"}]`)
+	assert.Equal(t, "Missing definition for index idx.", err.Error())
+}
+
+// Should create missing and invalid indexes, skip unmanaged indexes, and drop managed indexes no longer declared.
+func Test_reconcileIndexes(t *testing.T) {
+	originalDefinitions, originalDrop := config.Cfg.IndexDefinitions, config.Cfg.IndexDropUndeclared
+	defer func() {
+		config.Cfg.IndexDefinitions, config.Cfg.IndexDropUndeclared = originalDefinitions, originalDrop
+	}()
+	config.Cfg.IndexDefinitions = `[
+		{"name":"new_idx","table":"edges","definition":"USING btree (edgetype)"},
+		{"name":"valid_idx","table":"resources","definition":"USING btree (cluster)"},
+		{"name":"invalid_idx","table":"resources","definition":"USING btree (hash)"},
+		{"name":"edges_cluster_idx","table":"edges","definition":"USING btree (cluster)"}]`
+	config.Cfg.IndexDropUndeclared = true
+	dao, mockPool := buildMockDAO(t)
+
+	rows := pgxmock.NewRows([]string{"relname", "indisvalid", "managed"}).
+		AddRow("valid_idx", true, true).
+		AddRow("invalid_idx", false, false).
+		AddRow("edges_cluster_idx", true, false). // Created by the schema migrations.
+		AddRow("undeclared_idx", true, true)
+	mockPool.ExpectQuery(existingIndexesSql).WithArgs(managedIndexComment).WillReturnRows(rows)
+	mockPool.ExpectExec("CREATE INDEX CONCURRENTLY IF NOT EXISTS new_idx ON edges USING btree (edgetype)").
+		WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("COMMENT ON INDEX new_idx IS 'Managed by search-indexer INDEX_DEFINITIONS.'").
+		WillReturnResult(pgxmock.NewResult("COMMENT", 0))
+	mockPool.ExpectExec("DROP INDEX CONCURRENTLY IF EXISTS invalid_idx").
+		WillReturnResult(pgxmock.NewResult("DROP", 0))
+	mockPool.ExpectExec("CREATE INDEX CONCURRENTLY IF NOT EXISTS invalid_idx ON resources USING btree (hash)").
+		WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("COMMENT ON INDEX invalid_idx IS 'Managed by search-indexer INDEX_DEFINITIONS.'").
+		WillReturnResult(pgxmock.NewResult("COMMENT", 0))
+	mockPool.ExpectExec("DROP INDEX CONCURRENTLY IF EXISTS undeclared_idx").
+		WillReturnResult(pgxmock.NewResult("DROP", 0))
+
+	err := dao.reconcileIndexes(context.Background())
+
+	assert.Nil(t, err)
+}
+
+// Should create the data GIN index when the resources table is smaller than the threshold.
+func Test_reconcileIndexes_dataGINIndex(t *testing.T) {
+	originalGIN, originalSize := config.Cfg.DataGINIndex, config.Cfg.DataGINMaxSizeMB
+	defer func() { config.Cfg.DataGINIndex, config.Cfg.DataGINMaxSizeMB = originalGIN, originalSize }()
+	config.Cfg.DataGINIndex = true
+	config.Cfg.DataGINMaxSizeMB = 1
+	dao, mockPool := buildMockDAO(t)
+
+	mockPool.ExpectQuery(existingIndexesSql).WithArgs(managedIndexComment).
+		WillReturnRows(pgxmock.NewRows([]string{"relname", "indisvalid", "managed"}))
+	mockPool.ExpectQuery("SELECT pg_total_relation_size('resources')").
+		WillReturnRows(pgxmock.NewRows([]string{"size"}).AddRow(int64(1024)))
+	mockPool.ExpectExec("CREATE INDEX CONCURRENTLY IF NOT EXISTS data_gin_idx ON resources " +
+		"USING GIN (data jsonb_path_ops)").WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("COMMENT ON INDEX data_gin_idx IS 'Managed by search-indexer INDEX_DEFINITIONS.'").
+		WillReturnResult(pgxmock.NewResult("COMMENT", 0))
+
+	err := dao.reconcileIndexes(context.Background())
+
+	assert.Nil(t, err)
+}
+
+// Should skip the data GIN index when the resources table is larger than the threshold.
+func Test_reconcileIndexes_dataGINIndexTooLarge(t *testing.T) {
+	originalGIN, originalSize := config.Cfg.DataGINIndex, config.Cfg.DataGINMaxSizeMB
+	defer func() { config.Cfg.DataGINIndex, config.Cfg.DataGINMaxSizeMB = originalGIN, originalSize }()
+	config.Cfg.DataGINIndex = true
+	config.Cfg.DataGINMaxSizeMB = 1
+	dao, mockPool := buildMockDAO(t)
+
+	mockPool.ExpectQuery(existingIndexesSql).WithArgs(managedIndexComment).
+		WillReturnRows(pgxmock.NewRows([]string{"relname", "indisvalid", "managed"}))
+	mockPool.ExpectQuery("SELECT pg_total_relation_size('resources')").
+		WillReturnRows(pgxmock.NewRows([]string{"size"}).AddRow(int64(2 * 1024 * 1024)))
+
+	err := dao.reconcileIndexes(context.Background())
+
+	assert.Nil(t, err)
+}
@@ -0,0 +1,52 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+)
+
+// Kafka offsets.
+// The offset of the last sync event applied from each Kafka partition is saved in search.kafka_offsets after the
+// event is written. The Kafka consumer skips the events up to the saved offset, so the events consumed again after
+// a restart or a rebalance aren't applied twice. See kafka/consumer.go
+
+// Returns the offset of the last sync event applied from the partition, or -1 if none.
+func (dao *DAO) AppliedOffset(ctx context.Context, topic string, partition int) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx,
+		`SELECT "offset" FROM kafka_offsets WHERE topic = $1 AND partition = $2`, topic, partition)
+	if err != nil {
+		logging.SampledErrorf("Error reading the Kafka offset of %s/%d. %s", topic, partition, err)
+		return -1, err
+	}
+	defer rows.Close()
+	offset := int64(-1)
+	if rows.Next() {
+		err = rows.Scan(&offset)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		logging.SampledErrorf("Error reading the Kafka offset of %s/%d. %s", topic, partition, err)
+		return -1, err
+	}
+	return offset, nil
+}
+
+// Saves the offset of the last sync event applied from the partition.
+func (dao *DAO) SaveOffset(ctx context.Context, topic string, partition int, offset int64) error {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	_, err := dao.pool.Exec(ctx, `INSERT INTO kafka_offsets (topic, partition, "offset") VALUES ($1, $2, $3) `+
+		`ON CONFLICT (topic, partition) DO UPDATE SET "offset" = EXCLUDED."offset", updated_at = now()`,
+		topic, partition, offset)
+	if err != nil {
+		logging.SampledErrorf("Error saving the Kafka offset of %s/%d. %s", topic, partition, err)
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AppliedOffset(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"offset"}).AddRow(int64(42))
+	mockPool.ExpectQuery(`SELECT "offset" FROM kafka_offsets WHERE topic = $1 AND partition = $2`).
+		WithArgs("search-sync", 1).WillReturnRows(rows)
+
+	offset, err := dao.AppliedOffset(context.Background(), "search-sync", 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), offset)
+}
+
+// Should return -1 when no event was applied from the partition.
+func Test_AppliedOffset_none(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"offset"})
+	mockPool.ExpectQuery(`SELECT "offset" FROM kafka_offsets WHERE topic = $1 AND partition = $2`).WithArgs("search-sync", 0).WillReturnRows(rows)
+
+	offset, err := dao.AppliedOffset(context.Background(), "search-sync", 0)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), offset)
+}
+
+func Test_SaveOffset(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec(`INSERT INTO kafka_offsets (topic, partition, "offset") VALUES ($1, $2, $3) `+
+		`ON CONFLICT (topic, partition) DO UPDATE SET "offset" = EXCLUDED."offset", updated_at = now()`).
+		WithArgs("search-sync", 1, int64(42)).WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	assert.Nil(t, dao.SaveOffset(context.Background(), "search-sync", 1, 42))
+}
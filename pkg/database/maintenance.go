@@ -0,0 +1,102 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Table maintenance.
+// Large resyncs and cluster deletes leave many dead rows in the search tables, and make the planner statistics
+// stale until autovacuum catches up. A periodic job checks the table statistics, and runs VACUUM (ANALYZE) when the
+// dead rows exceed MAINTENANCE_THRESHOLD_PCT of the live rows, or ANALYZE when the rows modified since the last
+// analyze exceed it. VACUUM without FULL doesn't block reads or writes, and it's skipped while another vacuum is
+// running on the table. The job runs only on the leader, see clustersync.syncClusters().
+
+// Skip the maintenance when there are few dead or modified rows, autovacuum is enough for small changes.
+const minMaintenanceRows = 10000
+
+const tableStatsSql = "SELECT s.relname, s.n_live_tup, s.n_dead_tup, s.n_mod_since_analyze, " +
+	"EXISTS (SELECT 1 FROM pg_stat_progress_vacuum p WHERE p.relid = s.relid) " +
+	"FROM pg_stat_user_tables s WHERE s.schemaname = current_schema() AND s.relname IN ('resources', 'edges')"
+
+type tableStats struct {
+	name      string
+	live      int64
+	dead      int64
+	modified  int64 // Rows modified since the last analyze.
+	vacuuming bool
+}
+
+// Periodically runs VACUUM or ANALYZE on the search tables that need it.
+// Runs until the context is cancelled.
+func (dao *DAO) StartTableMaintenance(ctx context.Context, interval time.Duration, thresholdPct int) {
+	runPeriodically(ctx, "table maintenance", interval, func(ctx context.Context) {
+		dao.maintainTables(ctx, thresholdPct)
+	})
+}
+
+// Runs VACUUM or ANALYZE on the search tables with dead or modified rows over the threshold.
+func (dao *DAO) maintainTables(ctx context.Context, thresholdPct int) {
+	stats, err := dao.tableStats(ctx)
+	if err != nil {
+		logging.SampledErrorf("Error reading the search table statistics. %s", err)
+		return
+	}
+	for _, table := range stats {
+		operation := ""
+		switch {
+		case table.vacuuming:
+			klog.V(2).Infof("Skipping maintenance of %s, a vacuum is running.", table.name)
+		case overThreshold(table.dead, table.live, thresholdPct):
+			operation = "VACUUM (ANALYZE)"
+		case overThreshold(table.modified, table.live, thresholdPct):
+			operation = "ANALYZE"
+		}
+		if operation == "" {
+			continue
+		}
+
+		klog.Infof("Running %s on %s. Live rows: %d Dead rows: %d Modified rows: %d",
+			operation, table.name, table.live, table.dead, table.modified)
+		start := time.Now()
+		// Not limited by DB_STATEMENT_TIMEOUT, a vacuum of a large table can take longer.
+		if _, err := dao.pool.Exec(ctx, fmt.Sprintf("%s %s", operation, table.name)); err != nil {
+			logging.SampledErrorf("Error running %s on %s. %s", operation, table.name, err)
+			continue
+		}
+		metrics.MaintenanceDuration.WithLabelValues(table.name, operation).Observe(time.Since(start).Seconds())
+		klog.Infof("Completed %s on %s in %s.", operation, table.name, time.Since(start))
+	}
+}
+
+func overThreshold(rows, live int64, thresholdPct int) bool {
+	return rows >= minMaintenanceRows && rows*100 >= live*int64(thresholdPct)
+}
+
+// Returns the statistics of the search tables.
+func (dao *DAO) tableStats(ctx context.Context) ([]tableStats, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, tableStatsSql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []tableStats{}
+	for rows.Next() {
+		var table tableStats
+		if err := rows.Scan(&table.name, &table.live, &table.dead, &table.modified, &table.vacuuming); err != nil {
+			return nil, err
+		}
+		stats = append(stats, table)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,44 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockTableStats(mockPool pgxmock.PgxPoolIface, rows *pgxmock.Rows) {
+	mockPool.ExpectQuery(tableStatsSql).WillReturnRows(rows)
+}
+
+// Should VACUUM the tables with many dead rows, and ANALYZE the tables with many modified rows.
+func Test_maintainTables(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockTableStats(mockPool, pgxmock.NewRows([]string{"relname", "live", "dead", "modified", "vacuuming"}).
+		AddRow("resources", int64(100000), int64(50000), int64(60000), false).
+		AddRow("edges", int64(200000), int64(1000), int64(50000), false))
+	mockPool.ExpectExec("VACUUM (ANALYZE) resources").WillReturnResult(pgxmock.NewResult("VACUUM", 0))
+	mockPool.ExpectExec("ANALYZE edges").WillReturnResult(pgxmock.NewResult("ANALYZE", 0))
+
+	dao.maintainTables(context.Background(), 20)
+}
+
+// Should skip the tables under the threshold, and the tables with a vacuum running.
+func Test_maintainTables_skip(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockTableStats(mockPool, pgxmock.NewRows([]string{"relname", "live", "dead", "modified", "vacuuming"}).
+		AddRow("resources", int64(100000), int64(50000), int64(60000), true).
+		AddRow("edges", int64(1000000), int64(20000), int64(20000), false))
+
+	dao.maintainTables(context.Background(), 20)
+}
+
+func Test_overThreshold(t *testing.T) {
+	assert.True(t, overThreshold(20000, 100000, 20))
+	assert.False(t, overThreshold(19999, 100000, 20))
+	// Should skip small changes, even when over the threshold.
+	assert.False(t, overThreshold(100, 10, 20))
+}
@@ -0,0 +1,233 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"k8s.io/klog/v2"
+)
+
+// Schema migrations.
+// Each file in the migrations directory is a versioned migration named <version>_<description>.sql
+// Migrations are applied in order, each one within a transaction, and recorded in search.schema_migrations.
+// To change the schema add a new migration file, never edit a migration that was already released.
+// Older indexer versions can run against the schema with newer migrations, for example after a rollback, unless a
+// migration declares a breaking change with a "-- breaking: <reason>" line. Then the older versions refuse to start.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Lock used to prevent multiple indexer instances from applying migrations at the same time.
+const migrationLockId = 7277345
+
+// Lock used to initialize the schema from one indexer instance at a time. See lockSchema()
+const schemaLockId = 7277346
+
+type migration struct {
+	version  int
+	name     string
+	sql      string
+	breaking bool // Older indexer versions can't run against the schema after this migration.
+}
+
+type appliedMigration struct {
+	name     string
+	breaking bool
+}
+
+// ErrIncompatibleSchema is returned when the schema was migrated by a newer indexer version with a breaking change.
+var ErrIncompatibleSchema = errors.New("The search schema is incompatible with this indexer version.")
+
+// Reads the embedded migration files sorted by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		versionStr, name, found := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(versionStr)
+		if !found || err != nil {
+			return nil, fmt.Errorf("Invalid migration file name [%s]. Expected <version>_<description>.sql",
+				entry.Name())
+		}
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(sql),
+			breaking: isBreaking(string(sql))})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+func isBreaking(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "-- breaking:") {
+			return true
+		}
+	}
+	return false
+}
+
+// Acquires the lock to initialize the schema. Replicas starting at the same time wait for the first one to
+// initialize the schema, instead of racing on the DDL. The lock is held by a transaction and released when it ends.
+// The DDL runs on other connections, because CREATE INDEX CONCURRENTLY can't run within a transaction.
+// Call the returned function to release the lock.
+func (dao *DAO) lockSchema(ctx context.Context) (func(), error) {
+	tx, err := dao.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error acquiring the schema lock. %w", err)
+	}
+	unlock := func() {
+		if err := tx.Rollback(ctx); err != nil {
+			klog.Warning("Error releasing the schema lock. ", err)
+		}
+	}
+
+	// Waiting for the lock can take longer than DB_STATEMENT_TIMEOUT.
+	if _, err = tx.Exec(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		unlock()
+		return nil, fmt.Errorf("Error acquiring the schema lock. %w", err)
+	}
+	var acquired bool
+	if err = tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", schemaLockId).Scan(&acquired); err == nil &&
+		!acquired {
+		klog.Info("Waiting for another indexer instance to initialize the search schema.")
+		_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", schemaLockId)
+	}
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("Error acquiring the schema lock. %w", err)
+	}
+	return unlock, nil
+}
+
+// Applies the migrations that haven't been applied to the database.
+func (dao *DAO) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	// The schema must exist before the migrations, otherwise the search_path skips it and the objects are created
+	// in the public schema. DB_SCHEMA is a validated identifier, so it doesn't need quoting.
+	_, err = dao.pool.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+dao.tenantSchema())
+	if err != nil {
+		return fmt.Errorf("Error creating schema. %w", err)
+	}
+	_, err = dao.pool.Exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations "+
+		"(version INTEGER PRIMARY KEY, name TEXT, applied_at TIMESTAMPTZ DEFAULT now())")
+	if err != nil {
+		return fmt.Errorf("Error creating table schema_migrations. %w", err)
+	}
+	_, err = dao.pool.Exec(ctx, "ALTER TABLE schema_migrations "+
+		"ADD COLUMN IF NOT EXISTS breaking BOOLEAN NOT NULL DEFAULT false")
+	if err != nil {
+		return fmt.Errorf("Error updating table schema_migrations. %w", err)
+	}
+
+	applied, err := dao.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if err = checkSchemaCompatibility(migrations, applied); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if _, found := applied[m.version]; found {
+			continue
+		}
+		if err = dao.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("Error applying schema migration %d_%s. %w", m.version, m.name, err)
+		}
+	}
+	klog.Infof("Search schema is at version %d.", migrations[len(migrations)-1].version)
+	return nil
+}
+
+// Returns the migrations applied to the database, keyed by version.
+func (dao *DAO) appliedMigrations(ctx context.Context) (map[int]appliedMigration, error) {
+	applied := make(map[int]appliedMigration)
+	rows, err := dao.pool.Query(ctx, "SELECT version, name, breaking FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading applied schema migrations. %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var m appliedMigration
+		if err := rows.Scan(&version, &m.name, &m.breaking); err != nil {
+			return nil, fmt.Errorf("Error reading applied schema migrations. %w", err)
+		}
+		applied[version] = m
+	}
+	return applied, nil
+}
+
+// Verifies this indexer version can run against the schema. Migrations that aren't known by this version were
+// applied by a newer version, for example before a rollback. These are compatible unless declared as breaking.
+func checkSchemaCompatibility(migrations []migration, applied map[int]appliedMigration) error {
+	latest := migrations[len(migrations)-1].version
+	for version, m := range applied {
+		if version <= latest {
+			continue
+		}
+		if m.breaking {
+			return fmt.Errorf("%w Schema migration %d_%s was applied by a newer indexer version and it's breaking. "+
+				"Upgrade the indexer to a version including this migration.", ErrIncompatibleSchema, version, m.name)
+		}
+		klog.Warningf("Schema migration %d_%s was applied by a newer indexer version. It's compatible with this "+
+			"version, continuing.", version, m.name)
+	}
+	return nil
+}
+
+// Applies a migration within a transaction.
+func (dao *DAO) applyMigration(ctx context.Context, m migration) error {
+	tx, err := dao.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // nolint: errcheck
+
+	// Wait for other instances applying migrations, then check if this migration was applied meanwhile.
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockId); err != nil {
+		return err
+	}
+	// Migrations can take longer than DB_STATEMENT_TIMEOUT on large tables, for example when creating an index.
+	if _, err = tx.Exec(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		return err
+	}
+	var count int
+	err = tx.QueryRow(ctx, "SELECT count(*) FROM schema_migrations WHERE version=$1", m.version).
+		Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		klog.V(2).Infof("Schema migration %d_%s was applied by another instance.", m.version, m.name)
+		return tx.Commit(ctx)
+	}
+
+	klog.Infof("Applying schema migration %d_%s.", m.version, m.name)
+	if _, err = tx.Exec(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, breaking) VALUES ($1, $2, $3)",
+		m.version, m.name, m.breaking); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
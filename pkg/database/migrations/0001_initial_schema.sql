@@ -0,0 +1,17 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Initial schema. Uses IF NOT EXISTS because it was created with ad-hoc DDL before migrations were introduced.
+
+CREATE TABLE IF NOT EXISTS resources (uid TEXT PRIMARY KEY, cluster TEXT, data JSONB);
+CREATE TABLE IF NOT EXISTS edges (sourceId TEXT, sourceKind TEXT,destId TEXT,destKind TEXT,edgeType TEXT,cluster TEXT, PRIMARY KEY(sourceId, destId, edgeType));
+
+-- Jsonb indexing data keys.
+CREATE INDEX IF NOT EXISTS data_kind_idx ON resources USING GIN ((data -> 'kind'));
+CREATE INDEX IF NOT EXISTS data_namespace_idx ON resources USING GIN ((data -> 'namespace'));
+CREATE INDEX IF NOT EXISTS data_name_idx ON resources USING GIN ((data ->  'name'));
+CREATE INDEX IF NOT EXISTS data_cluster_idx ON resources USING btree (cluster);
+CREATE INDEX IF NOT EXISTS data_composite_idx ON resources USING GIN ((data -> '_hubClusterResource'::text), (data -> 'namespace'::text), (data -> 'apigroup'::text), (data -> 'kind_plural'::text));
+CREATE INDEX IF NOT EXISTS data_hubCluster_idx ON resources USING GIN ((data ->  '_hubClusterResource')) WHERE data ? '_hubClusterResource';
+
+CREATE INDEX IF NOT EXISTS edges_sourceid_idx ON edges USING btree (sourceid);
+CREATE INDEX IF NOT EXISTS edges_destid_idx ON edges USING btree (destid);
+CREATE INDEX IF NOT EXISTS edges_cluster_idx ON edges USING btree (cluster);
@@ -0,0 +1,25 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Move the cluster nodes (uid cluster__<name>) from resources into a dedicated table.
+-- The readers expecting the cluster nodes in resources can select from the resources_with_clusters view instead.
+-- breaking: older indexer versions write and read the cluster nodes in resources.
+
+CREATE TABLE clusters (
+    uid TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    console_url TEXT,
+    status TEXT,
+    kubernetes_version TEXT,
+    data JSONB
+);
+
+INSERT INTO clusters (uid, name, console_url, status, kubernetes_version, data)
+    SELECT uid, data->>'name', data->>'consoleURL', data->>'ManagedClusterConditionAvailable',
+        data->>'kubernetesVersion', data
+    FROM resources WHERE uid LIKE 'cluster\_\_%' AND data ? 'name';
+
+DELETE FROM resources WHERE uid LIKE 'cluster\_\_%';
+
+CREATE VIEW resources_with_clusters AS
+    SELECT uid, cluster, data FROM resources
+    UNION ALL
+    SELECT uid, name AS cluster, data FROM clusters;
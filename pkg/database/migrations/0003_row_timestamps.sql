@@ -0,0 +1,27 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Track when rows are created and last updated. Existing rows get the time of the migration.
+
+ALTER TABLE resources
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE edges
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE clusters
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Set updated_at on every update, so it's maintained for all the queries writing to the tables.
+CREATE FUNCTION set_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER resources_updated_at BEFORE UPDATE ON resources
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+CREATE TRIGGER edges_updated_at BEFORE UPDATE ON edges
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+CREATE TRIGGER clusters_updated_at BEFORE UPDATE ON clusters
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,30 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Optional history of resource changes. Previous versions of a resource are recorded when the resource is
+-- updated or deleted, only for connections with the setting search.resource_history=on (RESOURCE_HISTORY).
+
+CREATE TABLE resources_history (
+    uid TEXT NOT NULL,
+    cluster TEXT,
+    data JSONB,
+    operation TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX resources_history_uid_idx ON resources_history USING btree (uid, changed_at);
+CREATE INDEX resources_history_changed_at_idx ON resources_history USING btree (changed_at);
+
+CREATE FUNCTION record_resource_history() RETURNS trigger AS $$
+BEGIN
+    IF coalesce(current_setting('search.resource_history', true), '') <> 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'UPDATE' AND OLD.data IS NOT DISTINCT FROM NEW.data THEN
+        RETURN NULL;
+    END IF;
+    INSERT INTO resources_history (uid, cluster, data, operation)
+        VALUES (OLD.uid, OLD.cluster, OLD.data, TG_OP);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER resources_history AFTER UPDATE OR DELETE ON resources
+    FOR EACH ROW EXECUTE FUNCTION record_resource_history();
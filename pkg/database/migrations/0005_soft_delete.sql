@@ -0,0 +1,14 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Tombstones for soft deleted resources and edges (SOFT_DELETE). Rows with deleted_at are excluded from reads
+-- and hard deleted after the retention period.
+
+ALTER TABLE resources ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE edges ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX resources_deleted_at_idx ON resources USING btree (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX edges_deleted_at_idx ON edges USING btree (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE OR REPLACE VIEW resources_with_clusters AS
+    SELECT uid, cluster, data FROM resources WHERE deleted_at IS NULL
+    UNION ALL
+    SELECT uid, name AS cluster, data FROM clusters;
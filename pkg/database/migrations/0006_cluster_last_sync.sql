@@ -0,0 +1,12 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Time of the last successful sync from each cluster. Used to find and clean up clusters that stopped syncing.
+
+CREATE TABLE cluster_sync (
+    cluster TEXT PRIMARY KEY,
+    last_sync TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX cluster_sync_last_sync_idx ON cluster_sync USING btree (last_sync);
+
+-- Start tracking the existing clusters from now, so they aren't cleaned up before they get a chance to sync.
+INSERT INTO cluster_sync (cluster)
+    SELECT DISTINCT cluster FROM resources WHERE cluster IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Totals reported by the collector on the last sync, used by the consistency check. A cluster with data that
+-- doesn't match the reported totals is flagged and, optionally, asked to resync.
+
+ALTER TABLE cluster_sync
+    ADD COLUMN reported_resources INTEGER,
+    ADD COLUMN reported_edges INTEGER,
+    ADD COLUMN resync_requested BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Hash of each resource, used to calculate the cluster checksum. Existing rows get the hash on the next resync.
+
+ALTER TABLE resources ADD COLUMN hash BIGINT;
@@ -0,0 +1,14 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Batch items that failed permanently, kept to inspect and retry them instead of losing the data.
+-- The items keep the name of the statement and its args, the query is rebuilt when an item is retried.
+
+CREATE TABLE dead_letter (
+    id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    uid TEXT,
+    args JSONB,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX dead_letter_created_at_idx ON dead_letter USING btree (created_at);
@@ -0,0 +1,28 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Optional full-text search over the resource name, namespace, labels, and annotations. The search_text column
+-- is maintained only for connections with the setting search.full_text_search=on (FULL_TEXT_SEARCH).
+-- Existing rows are filled in the background when the feature is enabled, see fullTextSearch.go
+
+ALTER TABLE resources ADD COLUMN search_text tsvector;
+CREATE INDEX resources_search_text_idx ON resources USING GIN (search_text);
+
+-- Uses the simple configuration because resource names and labels aren't natural language.
+CREATE FUNCTION resource_search_text(data JSONB) RETURNS tsvector AS $$
+    SELECT to_tsvector('simple'::regconfig,
+        coalesce(data ->> 'name', '') || ' ' ||
+        coalesce(data ->> 'namespace', '') || ' ' ||
+        coalesce((data -> 'label')::text, '') || ' ' ||
+        coalesce((data -> 'annotation')::text, ''));
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION set_search_text() RETURNS trigger AS $$
+BEGIN
+    IF coalesce(current_setting('search.full_text_search', true), '') = 'on' THEN
+        NEW.search_text = resource_search_text(NEW.data);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER resources_search_text BEFORE INSERT OR UPDATE OF data ON resources
+    FOR EACH ROW EXECUTE FUNCTION set_search_text();
@@ -0,0 +1,5 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Optional properties of a relationship, for example the owner kind or the reason of an interCluster edge.
+-- NULL when the collector doesn't send properties for the edge.
+
+ALTER TABLE edges ADD COLUMN properties JSONB;
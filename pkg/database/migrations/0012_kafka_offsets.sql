@@ -0,0 +1,10 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Offset of the last sync event applied from each Kafka partition. Used to skip the sync events consumed again.
+
+CREATE TABLE kafka_offsets (
+    topic TEXT NOT NULL,
+    partition INTEGER NOT NULL,
+    "offset" BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (topic, partition)
+);
@@ -0,0 +1,51 @@
+-- Copyright Contributors to the Open Cluster Management project
+-- Outbox of resource changes to publish to Kafka. The trigger writes the changes in the same transaction as the
+-- resources, only for connections with the setting search.change_outbox=on (KAFKA_OUTBOX).
+
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    cluster TEXT NOT NULL,
+    action TEXT NOT NULL,
+    uid TEXT NOT NULL,
+    kind TEXT,
+    data JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ
+);
+CREATE INDEX outbox_unpublished_idx ON outbox USING btree (id) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at_idx ON outbox USING btree (published_at) WHERE published_at IS NOT NULL;
+
+CREATE FUNCTION record_outbox_event() RETURNS trigger AS $$
+DECLARE
+    event TEXT;
+BEGIN
+    IF coalesce(current_setting('search.change_outbox', true), '') <> 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        -- Soft deleted resources were published when the tombstone was set.
+        IF OLD.deleted_at IS NULL THEN
+            INSERT INTO outbox (cluster, action, uid, kind) VALUES (OLD.cluster, 'delete', OLD.uid, OLD.data->>'kind');
+        END IF;
+        RETURN NULL;
+    END IF;
+    IF NEW.deleted_at IS NOT NULL THEN
+        IF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL THEN
+            INSERT INTO outbox (cluster, action, uid, kind) VALUES (NEW.cluster, 'delete', NEW.uid, NEW.data->>'kind');
+        END IF;
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'INSERT' OR OLD.deleted_at IS NOT NULL THEN
+        event := 'add';
+    ELSIF OLD.data IS DISTINCT FROM NEW.data THEN
+        event := 'update';
+    ELSE
+        RETURN NULL;
+    END IF;
+    INSERT INTO outbox (cluster, action, uid, kind, data) VALUES (NEW.cluster, event, NEW.uid, NEW.data->>'kind', NEW.data);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER resources_outbox AFTER INSERT OR UPDATE OR DELETE ON resources
+    FOR EACH ROW EXECUTE FUNCTION record_outbox_event();
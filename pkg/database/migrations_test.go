@@ -0,0 +1,137 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should load the embedded migrations sorted by version.
+func Test_loadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, migrations[0].version)
+	assert.Equal(t, "initial_schema", migrations[0].name)
+	for i := 1; i < len(migrations); i++ {
+		assert.Greater(t, migrations[i].version, migrations[i-1].version)
+	}
+}
+
+// Mocks the statements creating the search schema and the search.schema_migrations table.
+func mockMigrationsTable(mockPool pgxmock.PgxPoolIface) {
+	mockPool.ExpectExec("CREATE SCHEMA IF NOT EXISTS search").WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations " +
+		"(version INTEGER PRIMARY KEY, name TEXT, applied_at TIMESTAMPTZ DEFAULT now())").
+		WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("ALTER TABLE schema_migrations " +
+		"ADD COLUMN IF NOT EXISTS breaking BOOLEAN NOT NULL DEFAULT false").
+		WillReturnResult(pgxmock.NewResult("ALTER", 0))
+}
+
+// Should not apply migrations that were already applied.
+func Test_migrate_alreadyApplied(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	migrations, _ := loadMigrations()
+	rows := pgxmock.NewRows([]string{"version", "name", "breaking"})
+	for _, m := range migrations {
+		rows.AddRow(m.version, m.name, false)
+	}
+
+	mockMigrationsTable(mockPool)
+	mockPool.ExpectQuery("SELECT version, name, breaking FROM schema_migrations").WillReturnRows(rows)
+
+	err := dao.migrate(context.Background())
+
+	assert.Nil(t, err)
+}
+
+// Should refuse to run against a schema with a breaking migration from a newer version.
+func Test_migrate_incompatibleSchema(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	migrations, _ := loadMigrations()
+	latest := migrations[len(migrations)-1].version
+	rows := pgxmock.NewRows([]string{"version", "name", "breaking"})
+	for _, m := range migrations {
+		rows.AddRow(m.version, m.name, false)
+	}
+	rows.AddRow(latest+1, "future_change", true)
+
+	mockMigrationsTable(mockPool)
+	mockPool.ExpectQuery("SELECT version, name, breaking FROM schema_migrations").WillReturnRows(rows)
+
+	err := dao.migrate(context.Background())
+
+	assert.True(t, errors.Is(err, ErrIncompatibleSchema))
+}
+
+// Should run against a schema with compatible migrations from a newer version.
+func Test_checkSchemaCompatibility_newerCompatible(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	migrations := []migration{{version: 1, name: "initial_schema"}}
+	applied := map[int]appliedMigration{1: {name: "initial_schema"}, 2: {name: "future_change"}}
+
+	assert.Nil(t, checkSchemaCompatibility(migrations, applied))
+}
+
+func Test_isBreaking(t *testing.T) {
+	assert.True(t, isBreaking("-- Drops a column.\n-- breaking: search-api reads the column.\nALTER TABLE x;"))
+	assert.False(t, isBreaking("-- Adds a column.\nALTER TABLE x;"))
+}
+
+// Should refuse to run older versions after moving the cluster nodes out of resources.
+func Test_loadMigrations_clustersTableBreaking(t *testing.T) {
+	migrations, err := loadMigrations()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "clusters_table", migrations[1].name)
+	assert.True(t, migrations[1].breaking)
+	assert.Contains(t, migrations[1].sql, "CREATE VIEW resources_with_clusters")
+}
+
+// Mocks the transaction holding the schema lock.
+func mockSchemaLock(mockPool pgxmock.PgxPoolIface, acquired bool) {
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec("SET LOCAL statement_timeout = 0").WillReturnResult(pgxmock.NewResult("SET", 0))
+	mockPool.ExpectQuery("SELECT pg_try_advisory_xact_lock($1)").WithArgs(schemaLockId).
+		WillReturnRows(pgxmock.NewRows([]string{"acquired"}).AddRow(acquired))
+	if !acquired {
+		mockPool.ExpectExec("SELECT pg_advisory_xact_lock($1)").WithArgs(schemaLockId).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	}
+	mockPool.ExpectRollback()
+}
+
+// Should wait for the lock when another instance is initializing the schema, and release it when done.
+func Test_lockSchema_wait(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockSchemaLock(mockPool, false)
+
+	unlock, err := dao.lockSchema(context.Background())
+	assert.Nil(t, err)
+	unlock()
+}
+
+// Should skip a migration applied by another instance while waiting for the lock.
+func Test_applyMigration_appliedByAnotherInstance(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec("SELECT pg_advisory_xact_lock($1)").WithArgs(migrationLockId).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mockPool.ExpectExec("SET LOCAL statement_timeout = 0").WillReturnResult(pgxmock.NewResult("SET", 0))
+	mockPool.ExpectQuery("SELECT count(*) FROM schema_migrations WHERE version=$1").
+		WithArgs(5).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+	mockPool.ExpectCommit()
+
+	err := dao.applyMigration(context.Background(), migration{version: 5, name: "test", sql: "SELECT 1"})
+
+	assert.Nil(t, err)
+}
@@ -0,0 +1,96 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Change notifications.
+// When NOTIFY_CHANGES is enabled, the DAO sends a NOTIFY on a per-cluster channel after writing the changes from
+// a sync request, so search-api and other consumers can invalidate their caches instead of polling.
+//   - Channel: search_<cluster>, or search_<fnv hash of cluster> if the cluster name is too long for a channel.
+//     With DB_SCHEMA, the channel starts with the tenant schema instead of search.
+//   - Payload: {"cluster":"<cluster>","clearAll":false,"uids":["<uid>",...]}
+// Postgres limits the payload to 8000 bytes. When the changed uids don't fit, the uids are omitted and
+// truncated is set, so consumers must invalidate everything for the cluster, same as with clearAll.
+
+const maxNotifyPayload = 8000
+
+// Postgres channel names are identifiers, limited to 63 bytes.
+const maxChannelLength = 63
+
+type changeNotification struct {
+	Cluster   string   `json:"cluster"`
+	ClearAll  bool     `json:"clearAll"`
+	UIDs      []string `json:"uids,omitempty"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// Returns the NOTIFY channel for the cluster.
+func notifyChannel(schema, clusterName string) string {
+	channel := schema + "_" + clusterName
+	if len(channel) > maxChannelLength {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(clusterName))
+		channel = fmt.Sprintf("%s_%x", schema, h.Sum64())
+	}
+	return channel
+}
+
+// Builds the notification payload, omitting the uids if the payload doesn't fit the NOTIFY limit.
+func notifyPayload(clusterName string, event model.SyncEvent) ([]byte, error) {
+	notification := changeNotification{Cluster: clusterName, ClearAll: event.ClearAll}
+	if !event.ClearAll {
+		uids := make([]string, 0, len(event.AddResources)+len(event.UpdateResources)+len(event.DeleteResources))
+		for _, r := range event.AddResources {
+			uids = append(uids, r.UID)
+		}
+		for _, r := range event.UpdateResources {
+			uids = append(uids, r.UID)
+		}
+		for _, r := range event.DeleteResources {
+			uids = append(uids, r.UID)
+		}
+		for _, e := range event.AddEdges {
+			uids = append(uids, e.SourceUID)
+		}
+		for _, e := range event.DeleteEdges {
+			uids = append(uids, e.SourceUID)
+		}
+		notification.UIDs = uids
+	}
+
+	payload, err := json.Marshal(notification)
+	if err == nil && len(payload) > maxNotifyPayload {
+		notification.UIDs = nil
+		notification.Truncated = true
+		payload, err = json.Marshal(notification)
+	}
+	return payload, err
+}
+
+// Notifies the consumers listening to the cluster channel that the cluster data changed.
+// Errors are logged, but don't fail the sync because the data was written.
+func (dao *DAO) notifyChanges(ctx context.Context, clusterName string, event model.SyncEvent) {
+	if !dao.notify {
+		return
+	}
+	payload, err := notifyPayload(clusterName, event)
+	if err != nil {
+		klog.Errorf("Error building change notification for cluster %s. %s", clusterName, err)
+		return
+	}
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	if _, err = dao.pool.Exec(ctx, "SELECT pg_notify($1, $2)", notifyChannel(dao.schema, clusterName), string(payload)); err != nil {
+		logging.SampledErrorf("Error sending change notification for cluster %s. %s", clusterName, err)
+	}
+}
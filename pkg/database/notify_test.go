@@ -0,0 +1,57 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_notifyChannel(t *testing.T) {
+	assert.Equal(t, "search_cluster-a", notifyChannel("search", "cluster-a"))
+
+	channel := notifyChannel("search", strings.Repeat("a", 63))
+	assert.True(t, strings.HasPrefix(channel, "search_"))
+	assert.LessOrEqual(t, len(channel), maxChannelLength)
+}
+
+func Test_notifyPayload(t *testing.T) {
+	event := model.SyncEvent{
+		AddResources:    []model.Resource{{UID: "uid-1"}},
+		DeleteResources: []model.DeleteResourceEvent{{UID: "uid-2"}},
+	}
+
+	payload, err := notifyPayload("cluster-a", event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"cluster":"cluster-a","clearAll":false,"uids":["uid-1","uid-2"]}`, string(payload))
+}
+
+// Should omit the uids when the payload exceeds the NOTIFY limit.
+func Test_notifyPayload_truncated(t *testing.T) {
+	event := model.SyncEvent{}
+	for i := 0; i < 1000; i++ {
+		event.UpdateResources = append(event.UpdateResources, model.Resource{UID: fmt.Sprintf("cluster-a/uid-%d", i)})
+	}
+
+	payload, err := notifyPayload("cluster-a", event)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"cluster":"cluster-a","clearAll":false,"truncated":true}`, string(payload))
+}
+
+func Test_notifyChanges(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.notify = true
+	mockPool.ExpectExec("SELECT pg_notify($1, $2)").
+		WithArgs("search_cluster-a", `{"cluster":"cluster-a","clearAll":true}`).
+		WillReturnResult(pgxmock.NewResult("SELECT", 0))
+
+	dao.notifyChanges(context.Background(), "cluster-a", model.SyncEvent{ClearAll: true})
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Orphaned edges.
+// Edges pointing to a resource that no longer exists can be left behind after partial failures, and make
+// queries return relationships to resources that don't exist. With ORPHAN_EDGE_CLEANUP_MS, a periodic job deletes
+// them. The job runs only on the leader, see clustersync.syncClusters().
+
+const deleteOrphanEdgesSql = "DELETE FROM edges e " +
+	"WHERE NOT EXISTS (SELECT 1 FROM resources r WHERE r.uid=e.sourceid) " +
+	"OR NOT EXISTS (SELECT 1 FROM resources r WHERE r.uid=e.destid)"
+
+// Periodically deletes the edges with a source or destination resource that doesn't exist.
+// Runs until the context is cancelled.
+func (dao *DAO) StartOrphanEdgeCleanup(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, "orphan edge cleanup", interval, func(ctx context.Context) {
+		_, _ = dao.deleteOrphanEdges(ctx)
+	})
+}
+
+// Deletes the edges with a source or destination resource that doesn't exist.
+// Returns the number of edges deleted.
+func (dao *DAO) deleteOrphanEdges(ctx context.Context) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	res, err := dao.pool.Exec(ctx, deleteOrphanEdgesSql)
+	if err != nil {
+		logging.SampledErrorf("Error deleting orphan edges. %s", err)
+		return 0, err
+	}
+	if res.RowsAffected() > 0 {
+		klog.Infof("Deleted %d orphan edges from edges.", res.RowsAffected())
+	}
+	metrics.OrphanEdgesDeleted.Add(float64(res.RowsAffected()))
+	return res.RowsAffected(), nil
+}
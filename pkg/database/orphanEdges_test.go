@@ -0,0 +1,39 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deleteOrphanEdges(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM edges e " +
+		"WHERE NOT EXISTS (SELECT 1 FROM resources r WHERE r.uid=e.sourceid) " +
+		"OR NOT EXISTS (SELECT 1 FROM resources r WHERE r.uid=e.destid)").
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+
+	deleted, err := dao.deleteOrphanEdges(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), deleted)
+}
+
+func Test_deleteOrphanEdges_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM edges e " +
+		"WHERE NOT EXISTS (SELECT 1 FROM resources r WHERE r.uid=e.sourceid) " +
+		"OR NOT EXISTS (SELECT 1 FROM resources r WHERE r.uid=e.destid)").WillReturnError(errors.New("connection refused"))
+
+	deleted, err := dao.deleteOrphanEdges(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
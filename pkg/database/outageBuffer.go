@@ -0,0 +1,112 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Outage buffer.
+// When the database is unavailable, the batch drops the rest of the sync and the collector has to send it again.
+// With DB_OUTAGE_BUFFER_SIZE, the items of the batches that fail to connect are kept in memory instead, and replayed
+// in order when the database is available. While items are waiting, new batches are added to the buffer, so the
+// changes are written in the same order they were received. Syncs are rejected with ErrOutageBufferFull when the
+// buffer doesn't have room for the items. Resyncs aren't buffered because they need to read the existing data.
+// Buffered items are lost if the indexer restarts before they're replayed.
+
+// ErrOutageBufferFull is returned when the database is unavailable and the outage buffer can't hold more items.
+var ErrOutageBufferFull = errors.New("Database is unavailable and the outage buffer is full.")
+
+// Time to wait before replaying the buffered items again while the database is unavailable.
+var outageReplayInterval = 5 * time.Second
+
+type outageBuffer struct {
+	mu        sync.Mutex
+	items     []batchItem
+	capacity  int
+	replaying bool
+}
+
+func newOutageBuffer(capacity int) *outageBuffer {
+	if capacity <= 0 {
+		return nil
+	}
+	return &outageBuffer{capacity: capacity}
+}
+
+// Returns true if there are items waiting to be replayed.
+func (ob *outageBuffer) pending() bool {
+	if ob == nil {
+		return false
+	}
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return len(ob.items) > 0
+}
+
+// Adds the items to the buffer and starts replaying them. Returns false if the buffer doesn't have room for them.
+func (dao *DAO) bufferItems(items []batchItem) bool {
+	ob := dao.buffer
+	if ob == nil {
+		return false
+	}
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if len(ob.items)+len(items) > ob.capacity {
+		return false
+	}
+	ob.items = append(ob.items, items...)
+	metrics.OutageBufferItems.Set(float64(len(ob.items)))
+	if !ob.replaying {
+		ob.replaying = true
+		klog.Warning("Database is unavailable. Buffering the sync changes to write them when it's available.")
+		go dao.replayBuffer()
+	}
+	return true
+}
+
+// Writes the buffered items in order, waiting while the database is unavailable.
+// Items that fail for other reasons are logged and saved in the dead letter table, same as the sync batches.
+func (dao *DAO) replayBuffer() {
+	ob := dao.buffer
+	replayed := 0
+	for {
+		ob.mu.Lock()
+		if len(ob.items) == 0 {
+			ob.replaying = false
+			klog.Infof("Database is available. Replayed %d buffered items.", replayed)
+			ob.mu.Unlock()
+			return
+		}
+		size := len(ob.items)
+		if batchSize := dao.getBatchSize(); size > batchSize {
+			size = batchSize
+		}
+		items := make([]batchItem, size)
+		copy(items, ob.items)
+		ob.mu.Unlock()
+
+		batch := NewBatchWithRetry(context.Background(), dao, &model.SyncResponse{})
+		batch.wg.Add(1)
+		dao.batchSlots <- struct{}{}
+		batch.sendBatch(items, 0) // nolint: errcheck
+		<-dao.batchSlots
+		if batch.getConnError() != nil {
+			time.Sleep(outageReplayInterval)
+			continue
+		}
+
+		ob.mu.Lock()
+		ob.items = ob.items[len(items):]
+		metrics.OutageBufferItems.Set(float64(len(ob.items)))
+		ob.mu.Unlock()
+		replayed += len(items)
+	}
+}
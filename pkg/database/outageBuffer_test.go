@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should keep the items in the buffer when the database is unavailable, then replay them.
+func Test_sendBatch_outageBuffered(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 2
+	dao.buffer = newOutageBuffer(10)
+	outageReplayInterval = 10 * time.Millisecond
+	defer func() { outageReplayInterval = 5 * time.Second }()
+	expectBatch(mockPool, 2, "INSERT", errors.New("failed to connect to host"))
+	expectBatch(mockPool, 2, "INSERT", errors.New("failed to connect to host"))
+	expectBatch(mockPool, 2, "INSERT", nil)
+	syncResponse := &model.SyncResponse{}
+	batch := NewBatchWithRetry(context.Background(), &dao, syncResponse)
+	batch.bufferOnOutage = true
+	defer testutils.SupressConsoleOutput()()
+
+	assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-1"}))
+	assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-2"}))
+	batch.wg.Wait()
+
+	assert.Nil(t, batch.getConnError())
+	assert.Equal(t, 2, syncResponse.Buffered)
+	assert.Eventually(t, func() bool {
+		dao.buffer.mu.Lock()
+		defer dao.buffer.mu.Unlock()
+		return !dao.buffer.replaying
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, dao.buffer.pending())
+}
+
+// Should return ErrOutageBufferFull when the buffer doesn't have room for the items.
+func Test_sendBatch_outageBufferFull(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 2
+	dao.buffer = newOutageBuffer(1)
+	expectBatch(mockPool, 2, "INSERT", errors.New("failed to connect to host"))
+	syncResponse := &model.SyncResponse{}
+	batch := NewBatchWithRetry(context.Background(), &dao, syncResponse)
+	batch.bufferOnOutage = true
+	defer testutils.SupressConsoleOutput()()
+
+	assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-1"}))
+	assert.Nil(t, batch.Queue(batchItem{action: "addResource", query: "INSERT", uid: "uid-2"}))
+	batch.wg.Wait()
+
+	assert.Equal(t, ErrOutageBufferFull, batch.getConnError())
+	assert.Equal(t, 0, syncResponse.Buffered)
+	assert.False(t, dao.buffer.pending())
+}
+
+// Should not create the buffer when the size isn't configured.
+func Test_newOutageBuffer_disabled(t *testing.T) {
+	ob := newOutageBuffer(0)
+
+	assert.Nil(t, ob)
+	assert.False(t, ob.pending())
+}
@@ -0,0 +1,126 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"k8s.io/klog/v2"
+)
+
+// Change outbox.
+// When KAFKA_OUTBOX or NATS_OUTBOX is enabled, a trigger records the resource changes in search.outbox, in the same
+// transaction that writes the resources. The changes are recorded for every write path (sync, resync, COPY, cluster
+// delete), only for connections with the setting search.change_outbox=on, see initializePool().
+// The relay reads the unpublished changes in order, publishes them, and marks them published in one
+// transaction, so a change is never lost or published without being written. If the indexer stops after
+// publishing and before the commit, the changes are published again, consumers can use the id to skip them.
+// The relay holds an advisory lock in the transaction, so the replicas don't publish the changes out of order.
+// The published changes are deleted after outboxRetention. See kafka/outbox.go
+
+const (
+	outboxLockId          = 7277347
+	outboxRetention       = time.Hour
+	outboxCleanupInterval = 10 * time.Minute
+	outboxSelectQuery     = "SELECT id, cluster, action, uid, kind, data, created_at FROM outbox " +
+		"WHERE published_at IS NULL ORDER BY id LIMIT $1"
+)
+
+// Resource change recorded in the outbox.
+type OutboxEvent struct {
+	ID        int64
+	Cluster   string
+	Action    string // add, update, or delete
+	UID       string
+	Kind      string
+	Data      map[string]interface{} // Nil for delete.
+	CreatedAt time.Time
+}
+
+// Reads up to limit unpublished changes and calls publish with them. The changes are marked published if publish
+// succeeds. Returns the number of changes published, 0 if another replica holds the outbox lock.
+func (dao *DAO) RelayOutbox(ctx context.Context, limit int, publish func([]OutboxEvent) error) (int, error) {
+	tx, err := dao.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	// The lock is per schema, the tenants relay their changes independently.
+	var acquired bool
+	if err = tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1, hashtext($2))", outboxLockId,
+		dao.tenantSchema()).Scan(&acquired); err != nil || !acquired {
+		_ = tx.Rollback(ctx)
+		return 0, err
+	}
+	events, err := readOutbox(ctx, tx, limit)
+	if err == nil && len(events) > 0 {
+		err = publish(events)
+		if err == nil {
+			// The ids aren't contiguous, a transaction with a lower id can commit after the changes are read.
+			ids := make([]int64, len(events))
+			for i, event := range events {
+				ids[i] = event.ID
+			}
+			_, err = tx.Exec(ctx, "UPDATE outbox SET published_at=now() WHERE id = ANY($1)", ids)
+		}
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		checkErrorAndRollback(err, "Error relaying the change outbox.", tx, ctx)
+		return 0, err
+	}
+	return len(events), nil
+}
+
+func readOutbox(ctx context.Context, tx pgx.Tx, limit int) ([]OutboxEvent, error) {
+	rows, err := tx.Query(ctx, outboxSelectQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]OutboxEvent, 0, limit)
+	for rows.Next() {
+		var event OutboxEvent
+		var kind, data *string
+		if err = rows.Scan(&event.ID, &event.Cluster, &event.Action, &event.UID, &kind, &data,
+			&event.CreatedAt); err != nil {
+			return nil, err
+		}
+		if kind != nil {
+			event.Kind = *kind
+		}
+		if data != nil {
+			if err = json.Unmarshal([]byte(*data), &event.Data); err != nil {
+				return nil, fmt.Errorf("Error parsing the data of outbox event %d. %w", event.ID, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Periodically deletes the changes published before the retention period. Runs until the context is cancelled.
+func (dao *DAO) StartOutboxCleanup(ctx context.Context) {
+	runPeriodically(ctx, "change outbox cleanup", outboxCleanupInterval, func(ctx context.Context) {
+		_, _ = dao.deletePublishedOutbox(ctx, outboxRetention)
+	})
+}
+
+// Deletes the changes published before the retention period. Returns the number of rows deleted.
+func (dao *DAO) deletePublishedOutbox(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	res, err := dao.pool.Exec(ctx, "DELETE FROM outbox WHERE published_at < $1", time.Now().Add(-retention))
+	if err != nil {
+		logging.SampledErrorf("Error deleting the published changes from the outbox. %s", err)
+		return 0, err
+	}
+	klog.V(2).Infof("Deleted %d published changes from outbox.", res.RowsAffected())
+	return res.RowsAffected(), nil
+}
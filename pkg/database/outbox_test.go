@@ -0,0 +1,93 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Mocks the transaction and the lock to relay the outbox.
+func mockOutboxLock(mockPool pgxmock.PgxPoolIface, acquired bool) {
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectQuery("SELECT pg_try_advisory_xact_lock($1, hashtext($2))").
+		WithArgs(outboxLockId, "search").WillReturnRows(pgxmock.NewRows([]string{"acquired"}).AddRow(acquired))
+}
+
+// Should publish the unpublished changes and mark them published in the same transaction.
+func Test_RelayOutbox(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockOutboxLock(mockPool, true)
+	createdAt := time.Now()
+	kind, data := "Pod", `{"kind":"Pod","name":"pod-1"}`
+	mockPool.ExpectQuery(outboxSelectQuery).WithArgs(100).WillReturnRows(
+		pgxmock.NewRows([]string{"id", "cluster", "action", "uid", "kind", "data", "created_at"}).
+			AddRow(int64(3), "cluster-a", "add", "uid-1", &kind, &data, createdAt).
+			AddRow(int64(5), "cluster-a", "delete", "uid-2", &kind, nil, createdAt))
+	mockPool.ExpectExec("UPDATE outbox SET published_at=now() WHERE id = ANY($1)").
+		WithArgs([]int64{3, 5}).WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	mockPool.ExpectCommit()
+
+	var published []OutboxEvent
+	count, err := dao.RelayOutbox(context.Background(), 100, func(events []OutboxEvent) error {
+		published = events
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []OutboxEvent{
+		{ID: 3, Cluster: "cluster-a", Action: "add", UID: "uid-1", Kind: "Pod",
+			Data: map[string]interface{}{"kind": "Pod", "name": "pod-1"}, CreatedAt: createdAt},
+		{ID: 5, Cluster: "cluster-a", Action: "delete", UID: "uid-2", Kind: "Pod", CreatedAt: createdAt},
+	}, published)
+}
+
+// Should not read the outbox while another replica holds the lock.
+func Test_RelayOutbox_locked(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockOutboxLock(mockPool, false)
+	mockPool.ExpectRollback()
+
+	count, err := dao.RelayOutbox(context.Background(), 100, func(events []OutboxEvent) error {
+		t.Error("Expected the changes not to be published.")
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// Should keep the changes unpublished if publishing fails.
+func Test_RelayOutbox_publishError(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockOutboxLock(mockPool, true)
+	mockPool.ExpectQuery(outboxSelectQuery).WithArgs(100).WillReturnRows(
+		pgxmock.NewRows([]string{"id", "cluster", "action", "uid", "kind", "data", "created_at"}).
+			AddRow(int64(3), "cluster-a", "delete", "uid-1", nil, nil, time.Now()))
+	mockPool.ExpectRollback()
+
+	count, err := dao.RelayOutbox(context.Background(), 100, func(events []OutboxEvent) error {
+		return errors.New("mock error")
+	})
+
+	assert.EqualError(t, err, "mock error")
+	assert.Equal(t, 0, count)
+}
+
+func Test_deletePublishedOutbox(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM outbox WHERE published_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 4))
+
+	deleted, err := dao.deletePublishedOutbox(context.Background(), time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), deleted)
+}
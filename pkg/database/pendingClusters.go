@@ -0,0 +1,108 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Pending cluster upserts.
+// The Cluster node is written when the hub resources change, so a Cluster node that fails to write would be missing
+// or stale until the next informer resync. The failed Cluster nodes are kept in memory and written again with
+// exponential backoff, up to MAX_BACKOFF_MS. A newer version of the Cluster node replaces the pending one, and
+// deleting the cluster node cancels the retry.
+// Cluster operations that keep failing are reported with OnClusterFailure, see clustersync/clusterEvents.go
+
+const pendingClusterMinBackoff = 500 * time.Millisecond
+
+// Failed attempts before reporting the failure of a cluster operation.
+const clusterFailureAttempts = 3
+
+// Reports a cluster operation that keeps failing. Set by clustersync to create a Kubernetes event.
+var OnClusterFailure func(clusterName, reason, message string)
+
+type pendingCluster struct {
+	resource model.Resource
+	attempts int
+	timer    *time.Timer // Set while a retry is scheduled.
+}
+
+var pendingClusters = map[string]*pendingCluster{}
+var pendingClustersMux sync.Mutex
+
+// Keeps the Cluster node that failed to write and schedules a retry.
+func (dao *DAO) retryUpsertCluster(resource model.Resource, err error) {
+	pendingClustersMux.Lock()
+	defer pendingClustersMux.Unlock()
+	pending, ok := pendingClusters[resource.UID]
+	if !ok {
+		pending = &pendingCluster{}
+		pendingClusters[resource.UID] = pending
+		metrics.PendingClusterUpserts.Set(float64(len(pendingClusters)))
+	}
+	pending.resource = resource
+	if pending.timer != nil {
+		return // The scheduled retry writes the latest version.
+	}
+
+	wait := pendingClusterBackoff(pending.attempts)
+	pending.attempts++
+	if pending.attempts == clusterFailureAttempts {
+		clusterName, _ := resource.Properties["name"].(string)
+		reportClusterFailure(clusterName, "ClusterWriteFailed", err)
+	}
+	klog.Warningf("Retrying to write cluster %s in %s. Attempt: %d", resource.UID, wait, pending.attempts)
+	pending.timer = time.AfterFunc(wait, func() {
+		pendingClustersMux.Lock()
+		if pendingClusters[resource.UID] != pending {
+			pendingClustersMux.Unlock()
+			return // Written by another upsert, or deleted.
+		}
+		pending.timer = nil
+		retry := pending.resource
+		pendingClustersMux.Unlock()
+		dao.UpsertCluster(context.Background(), retry)
+	})
+}
+
+// Removes the pending retry after the Cluster node is written or deleted.
+func clearPendingCluster(clusterUID string) {
+	pendingClustersMux.Lock()
+	defer pendingClustersMux.Unlock()
+	pending, ok := pendingClusters[clusterUID]
+	if !ok {
+		return
+	}
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	delete(pendingClusters, clusterUID)
+	metrics.PendingClusterUpserts.Set(float64(len(pendingClusters)))
+}
+
+// Doubles the wait after each attempt, up to MAX_BACKOFF_MS.
+func pendingClusterBackoff(attempts int) time.Duration {
+	maxBackoff := time.Duration(config.Cfg.MaxBackoffMS) * time.Millisecond
+	wait := pendingClusterMinBackoff
+	for i := 0; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+func reportClusterFailure(clusterName, reason string, err error) {
+	if OnClusterFailure != nil {
+		OnClusterFailure(clusterName, reason, fmt.Sprintf("Search indexer failed to update the cluster data. %s", err))
+	}
+}
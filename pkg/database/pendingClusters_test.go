@@ -0,0 +1,89 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should retry to write the Cluster node after a database error.
+func Test_UpsertCluster_retryAfterError(t *testing.T) {
+	config.Cfg.MaxBackoffMS = 10
+	defer func() { config.Cfg.MaxBackoffMS = 5 * 60 * 1000 }()
+	existingClustersCache = map[string]interface{}{"cluster__name-foo": map[string]interface{}{"name": "name-foo"}}
+	cluster := model.Resource{Kind: "Cluster", UID: "cluster__name-foo",
+		Properties: map[string]interface{}{"name": "name-foo", "cpu": 10}}
+
+	dao, mockPool := buildMockDAO(t)
+	sql := fmt.Sprintf(`INSERT INTO "clusters" AS "c" ("console_url", "data", "kubernetes_version", "name", `+
+		`"status", "uid") VALUES (NULL, '%[1]s', NULL, 'name-foo', NULL, '%[2]s') ON CONFLICT (uid) DO UPDATE SET `+
+		`"console_url"=NULL,"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object('lastSyncTime', `+
+		`"c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', `+
+		`"c".data->'searchDataStale')),"kubernetes_version"=NULL,"name"='name-foo',"status"=NULL `+
+		`WHERE ("c".uid = '%[2]s')`, `{"cpu":10,"name":"name-foo"}`, "cluster__name-foo")
+	mockPool.ExpectExec(sql).WillReturnError(errors.New("conn closed"))
+	mockPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	dao.UpsertCluster(context.Background(), cluster)
+	pendingClustersMux.Lock()
+	assert.Contains(t, pendingClusters, "cluster__name-foo")
+	pendingClustersMux.Unlock()
+
+	assert.Eventually(t, func() bool {
+		pendingClustersMux.Lock()
+		defer pendingClustersMux.Unlock()
+		return len(pendingClusters) == 0
+	}, time.Second, 5*time.Millisecond)
+	props, _ := ReadClustersCache("cluster__name-foo")
+	assert.Equal(t, 10, props.(map[string]interface{})["cpu"])
+}
+
+// Should cancel the retry when the cluster node is deleted.
+func Test_clearPendingCluster(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.retryUpsertCluster(model.Resource{UID: "cluster__name-foo",
+		Properties: map[string]interface{}{"name": "name-foo"}}, errors.New("conn closed"))
+
+	clearPendingCluster("cluster__name-foo")
+
+	assert.NotContains(t, pendingClusters, "cluster__name-foo")
+}
+
+func Test_pendingClusterBackoff(t *testing.T) {
+	config.Cfg.MaxBackoffMS = 3000
+	defer func() { config.Cfg.MaxBackoffMS = 5 * 60 * 1000 }()
+
+	assert.Equal(t, 500*time.Millisecond, pendingClusterBackoff(0))
+	assert.Equal(t, 2*time.Second, pendingClusterBackoff(2))
+	assert.Equal(t, 3*time.Second, pendingClusterBackoff(10))
+}
+
+// Should report the failure after the Cluster node fails to write a few times.
+func Test_retryUpsertCluster_reportFailure(t *testing.T) {
+	config.Cfg.MaxBackoffMS = 5 * 60 * 1000
+	var reported []string
+	OnClusterFailure = func(clusterName, reason, message string) {
+		reported = append(reported, clusterName+" "+reason+" "+message)
+	}
+	defer func() { OnClusterFailure = nil }()
+	defer clearPendingCluster("cluster__name-foo")
+
+	dao, _ := buildMockDAO(t)
+	cluster := model.Resource{UID: "cluster__name-foo", Properties: map[string]interface{}{"name": "name-foo"}}
+	for i := 0; i < clusterFailureAttempts; i++ {
+		dao.retryUpsertCluster(cluster, errors.New("conn closed"))
+		pendingClusters["cluster__name-foo"].timer.Stop() // Simulate the failed retry.
+		pendingClusters["cluster__name-foo"].timer = nil
+	}
+
+	assert.Equal(t, []string{"name-foo ClusterWriteFailed Search indexer failed to update the cluster data. conn closed"}, reported)
+}
@@ -0,0 +1,81 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/jackc/pgx/v5"
+	"k8s.io/klog/v2"
+)
+
+// AWS RDS IAM authentication.
+// Instead of a static password, connect using a short-lived auth token signed with the AWS credentials.
+// Tokens are valid for 15 minutes and only used to open new connections, so we refresh the token before it expires.
+// https://docs.aws.amazon.com/AmazonRDS/latest/UserGuide/UsingWithRDS.IAMDBAuth.Connecting.html
+//
+// The credentials are loaded with the default AWS credential chain: the environment variables, the web identity
+// token of IAM roles for service accounts (IRSA) on EKS, the shared config files, and the instance metadata.
+
+const rdsTokenRefresh = 10 * time.Minute // Generate a new token before the current token expires.
+
+type rdsTokenProvider struct {
+	endpoint    string // host:port
+	region      string
+	user        string
+	credentials aws.CredentialsProvider // Loaded on the first connection.
+	token       string
+	generated   time.Time
+	now         func() time.Time // Replaced in unit tests.
+	lock        sync.Mutex
+}
+
+func newRDSTokenProvider(host string, port int, region, user string) *rdsTokenProvider {
+	return &rdsTokenProvider{
+		endpoint: fmt.Sprintf("%s:%d", host, port),
+		region:   region,
+		user:     user,
+		now:      time.Now,
+	}
+}
+
+// Sets the auth token as the password before opening a new connection. Used as the pgxpool BeforeConnect hook.
+func (p *rdsTokenProvider) beforeConnect(ctx context.Context, connConfig *pgx.ConnConfig) error {
+	token, err := p.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	connConfig.Password = token
+	return nil
+}
+
+// Returns the current auth token or generates a new token if the current one is about to expire.
+func (p *rdsTokenProvider) getToken(ctx context.Context) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.token != "" && p.now().Sub(p.generated) < rdsTokenRefresh {
+		return p.token, nil
+	}
+	if p.credentials == nil {
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(p.region))
+		if err != nil {
+			return "", fmt.Errorf("Error loading the AWS credentials to generate the RDS auth token. %w", err)
+		}
+		p.credentials = awsCfg.Credentials
+	}
+	token, err := auth.BuildAuthToken(ctx, p.endpoint, p.region, p.user, p.credentials)
+	if err != nil {
+		return "", fmt.Errorf("Error generating the RDS auth token. %w", err)
+	}
+	p.generated = p.now()
+	p.token = token
+	klog.V(3).Infof("Generated RDS auth token for %s", p.endpoint)
+	return p.token, nil
+}
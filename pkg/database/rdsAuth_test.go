@@ -0,0 +1,75 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should build a presigned token for the rds-db:connect action with the credentials of the default chain.
+func Test_rdsTokenProvider_getToken(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_SESSION_TOKEN", "session/token")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Unsetenv("AWS_SESSION_TOKEN")
+	p := newRDSTokenProvider("db.example.com", 5432, "us-east-1", "search_user")
+
+	token, err := p.getToken(context.Background())
+
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, "db.example.com:5432?Action=connect&DBUser=search_user&"))
+	assert.Contains(t, token, "X-Amz-Credential=AKIDEXAMPLE%2F")
+	assert.Contains(t, token, "%2Fus-east-1%2Frds-db%2Faws4_request")
+	assert.Contains(t, token, "X-Amz-Expires=900")
+	assert.Contains(t, token, "X-Amz-Security-Token=session%2Ftoken")
+	assert.Regexp(t, "X-Amz-Signature=[0-9a-f]{64}", token)
+}
+
+// Should reuse the token until it's time to refresh it.
+func Test_rdsTokenProvider_beforeConnect(t *testing.T) {
+	now := time.Now()
+	p := newRDSTokenProvider("db.example.com", 5432, "us-east-1", "search_user")
+	p.credentials = credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", "")
+	p.now = func() time.Time { return now }
+
+	connConfig := &pgx.ConnConfig{}
+	err := p.beforeConnect(context.Background(), connConfig)
+	assert.Nil(t, err)
+	firstToken := connConfig.Password
+	assert.NotEmpty(t, firstToken)
+
+	// Reuse token.
+	now = now.Add(time.Minute)
+	_ = p.beforeConnect(context.Background(), connConfig)
+	assert.Equal(t, firstToken, connConfig.Password)
+
+	// Refresh token before it expires. The signing time has a resolution of a second.
+	time.Sleep(time.Second)
+	now = now.Add(rdsTokenRefresh)
+	_ = p.beforeConnect(context.Background(), connConfig)
+	assert.NotEqual(t, firstToken, connConfig.Password)
+}
+
+// Should return error when the AWS credentials aren't available.
+func Test_rdsTokenProvider_missingCredentials(t *testing.T) {
+	p := newRDSTokenProvider("db.example.com", 5432, "us-east-1", "search_user")
+	p.credentials = aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{}, errors.New("no credentials")
+	})
+
+	err := p.beforeConnect(context.Background(), &pgx.ConnConfig{})
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,141 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"encoding/base64"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Secret redaction.
+// Collectors are expected to filter sensitive data, the indexer redacts it again before storing it.
+//   - REDACT_KINDS        Kinds where every property is redacted, except the identity and metadata. Default: Secret
+//   - REDACT_PROPERTIES   Patterns matching the property names to redact. Example: *password*,*token
+//   - REDACT_BASE64       Redact string values that look like base64 encoded blobs. Default: false
+//     Opt-in, the heuristic also matches legitimate values, like certificates, CA bundles, and digests.
+// The resource hash is calculated before redacting, so the cluster checksum still matches the collector.
+
+const redactedValue = "[REDACTED]"
+
+// Minimum length of a string value to be considered a base64 blob.
+const minBase64Length = 128
+
+var base64Regex = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+var hexRegex = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// Properties kept for the redacted kinds.
+var redactKeepProperties = map[string]bool{"created": true, "label": true, "type": true}
+
+type redactRules struct {
+	kinds      map[string]bool // Lowercase kinds.
+	properties []string        // Lowercase name patterns. See path.Match()
+	base64     bool
+}
+
+func newRedactRules(kinds, properties string, redactBase64 bool) redactRules {
+	rules := redactRules{kinds: map[string]bool{}, base64: redactBase64}
+	for _, kind := range strings.Split(kinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			rules.kinds[strings.ToLower(kind)] = true
+		}
+	}
+	for _, pattern := range strings.Split(properties, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			rules.properties = append(rules.properties, strings.ToLower(pattern))
+		}
+	}
+	return rules
+}
+
+func (r redactRules) enabled() bool {
+	return len(r.kinds) > 0 || len(r.properties) > 0 || r.base64
+}
+
+// Returns the properties with the sensitive values redacted. The properties are copied when a value is redacted,
+// so the incoming resource isn't modified.
+func redactProperties(resource model.Resource, props map[string]interface{}, rules redactRules) map[string]interface{} {
+	redacted := props
+	copied := false
+	redact := func(name string, value interface{}) {
+		if !copied {
+			redacted = make(map[string]interface{}, len(props))
+			for k, v := range props {
+				redacted[k] = v
+			}
+			copied = true
+		}
+		redacted[name] = value
+	}
+
+	kind, _ := props["kind"].(string)
+	if kind == "" {
+		kind = resource.Kind
+	}
+	redactKind := rules.kinds[strings.ToLower(kind)]
+	for name, value := range props {
+		if redactKind && !identityProperties[name] && !redactKeepProperties[name] && !strings.HasPrefix(name, "_") {
+			redact(name, redactedValue)
+		} else if rules.matchProperty(name) {
+			redact(name, redactedValue)
+		} else if rules.base64 {
+			if newValue, changed := redactBase64(value); changed {
+				redact(name, newValue)
+			}
+		}
+	}
+	if copied {
+		klog.V(3).Infof("Redacted sensitive properties of resource %s.", resource.UID)
+	}
+	return redacted
+}
+
+func (r redactRules) matchProperty(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range r.properties {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacts base64 blobs in a string value, or in the values of a map property like annotation.
+func redactBase64(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if isBase64Blob(v) {
+			return redactedValue, true
+		}
+	case map[string]interface{}:
+		var redacted map[string]interface{}
+		for key, item := range v {
+			if str, ok := item.(string); ok && isBase64Blob(str) {
+				if redacted == nil {
+					redacted = make(map[string]interface{}, len(v))
+					for k, val := range v {
+						redacted[k] = val
+					}
+				}
+				redacted[key] = redactedValue
+			}
+		}
+		if redacted != nil {
+			return redacted, true
+		}
+	}
+	return value, false
+}
+
+// Hex strings, like digests, use the base64 alphabet but aren't considered blobs.
+func isBase64Blob(str string) bool {
+	if len(str) < minBase64Length || len(str)%4 != 0 || !base64Regex.MatchString(str) || hexRegex.MatchString(str) {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(str)
+	return err == nil
+}
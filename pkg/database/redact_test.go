@@ -0,0 +1,74 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should redact every property of the redacted kinds, except the identity and metadata.
+func Test_redactProperties_kind(t *testing.T) {
+	rules := newRedactRules("secret", "", false)
+	props := map[string]interface{}{
+		"kind":      "Secret",
+		"name":      "secret-a",
+		"namespace": "default",
+		"label":     map[string]interface{}{"app": "a"},
+		"type":      "Opaque",
+		"data":      "c2VjcmV0",
+	}
+
+	redacted := redactProperties(model.Resource{UID: "uid-1"}, props, rules)
+
+	assert.Equal(t, redactedValue, redacted["data"])
+	assert.Equal(t, "secret-a", redacted["name"])
+	assert.Equal(t, "Opaque", redacted["type"])
+	// Should not modify the incoming properties.
+	assert.Equal(t, "c2VjcmV0", props["data"])
+}
+
+func Test_redactProperties_patterns(t *testing.T) {
+	rules := newRedactRules("", "*password*, *token", false)
+	props := map[string]interface{}{"kind": "ConfigMap", "dbPassword": "x", "apiToken": "y", "tokenCount": 1}
+
+	redacted := redactProperties(model.Resource{UID: "uid-1"}, props, rules)
+
+	assert.Equal(t, map[string]interface{}{
+		"kind": "ConfigMap", "dbPassword": redactedValue, "apiToken": redactedValue, "tokenCount": 1,
+	}, redacted)
+}
+
+func Test_redactProperties_base64(t *testing.T) {
+	rules := newRedactRules("", "", true)
+	blob := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("secret-value", 10)))
+	props := map[string]interface{}{
+		"kind":       "ConfigMap",
+		"blob":       blob,
+		"annotation": map[string]interface{}{"a": blob, "b": "c"},
+		"digest":     strings.Repeat("0123456789abcdef", 8),
+	}
+
+	redacted := redactProperties(model.Resource{UID: "uid-1"}, props, rules)
+
+	assert.Equal(t, redactedValue, redacted["blob"])
+	assert.Equal(t, map[string]interface{}{"a": redactedValue, "b": "c"}, redacted["annotation"])
+	assert.Equal(t, props["digest"], redacted["digest"])
+	assert.Equal(t, blob, props["annotation"].(map[string]interface{})["a"])
+}
+
+// Should store the redacted data, and calculate the hash with all the properties.
+func Test_resourceData_redacted(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.redact = newRedactRules("Secret", "", false)
+	resource := model.Resource{UID: "uid-1", Properties: map[string]interface{}{"kind": "Secret", "data": "x"}}
+
+	data, hash := dao.resourceData(resource)
+
+	assert.Equal(t, `{"data":"[REDACTED]","kind":"Secret"}`, data)
+	assert.False(t, dao.resourceChanged(resource, map[string]interface{}{"kind": "Secret", "data": redactedValue}, hash))
+}
@@ -6,11 +6,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"reflect"
 	"time"
 
 	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/klog/v2"
 )
 
@@ -19,8 +20,14 @@ func (dao *DAO) ResyncData(ctx context.Context, event model.SyncEvent,
 	clusterName string, syncResponse *model.SyncResponse) error {
 
 	defer metrics.SlowLog(fmt.Sprintf("Slow resync from %12s. RequestId: %d", clusterName, event.RequestId), 0)()
+	ctx, span := tracing.Start(ctx, "DAO.ResyncData")
+	defer span.End()
+	span.SetAttributes(attribute.String("cluster", clusterName))
+	dao = dao.forCluster(clusterName)
 	klog.Infof(
 		"Starting resync from %12s. This is normal, but it could be a problem if it happens often.", clusterName)
+	// Count the totals from the database after the resync.
+	defer invalidateTotals(clusterName)
 
 	// Reset resources
 	err := dao.resetResources(ctx, event.AddResources, clusterName, syncResponse)
@@ -37,6 +44,7 @@ func (dao *DAO) ResyncData(ctx context.Context, event model.SyncEvent,
 	}
 
 	klog.V(1).Infof("Completed resync of cluster %12s.\t RequestId: %d", clusterName, event.RequestId)
+	dao.notifyChanges(ctx, clusterName, event)
 	return nil
 }
 
@@ -50,9 +58,14 @@ func (dao *DAO) ResyncData(ctx context.Context, event model.SyncEvent,
 func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource, clusterName string,
 	syncResponse *model.SyncResponse) error {
 	timer := time.Now()
+	ctx, span := tracing.Start(ctx, "DAO.resetResources")
+	defer span.End()
+	span.SetAttributes(attribute.Int("resources", len(resources)))
 
 	batch := NewBatchWithRetry(ctx, dao, syncResponse)
 
+	// Resources rejected by the size limits are deleted, same as resources that don't exist in the collector.
+	resources = dao.checkSizeLimits(resources, "addResource", syncResponse)
 	incomingResMap := make(map[string]*model.Resource)
 	for i, resource := range resources {
 		incomingResMap[resource.UID] = &resources[i]
@@ -60,18 +73,23 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 	resourcesToDelete := make([]interface{}, 0)
 	resourcesToUpdate := make([]*model.Resource, 0)
 
-	// Get existing resources (UID and data) for the cluster.
+	// Get existing resources (UID, data, and hash) for the cluster.
 	query, params, err := useGoqu(
-		"SELECT uid, data FROM search.resources WHERE cluster=$1 AND uid!='cluster__$1'",
+		"SELECT uid, data, hash FROM resources WHERE cluster=$1 AND deleted_at IS NULL",
 		[]interface{}{clusterName})
 	if err == nil {
-		existingRows, err := dao.pool.Query(ctx, query, params...)
+		slowLog := metrics.SlowDBOperation("resyncSelect",
+			fmt.Sprintf("Slow query of existing resources during resync of cluster %s.", clusterName))
+		queryCtx, cancel := dao.withTimeout(ctx)
+		defer cancel()
+		existingRows, err := dao.pool.Query(queryCtx, query, params...)
 		if err != nil {
 			klog.Warningf("Error getting existing resource uids for cluster %12s. Error: %+v", clusterName, err)
 		}
 		for existingRows.Next() {
 			var id, data string
-			err := existingRows.Scan(&id, &data)
+			var hash *int64
+			err := existingRows.Scan(&id, &data, &hash)
 			if err != nil {
 				klog.Warningf("Error scanning existing resource row. Error: %+v", err)
 				continue
@@ -87,8 +105,8 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 			if !exists {
 				// Resource needs to be deleted.
 				resourcesToDelete = append(resourcesToDelete, id)
-			} else if !reflect.DeepEqual(incomingResource.Properties, props) {
-				// Resource needs to be updated.
+			} else if hash == nil || dao.resourceChanged(*incomingResource, props, *hash) {
+				// Resource needs to be updated. Also sets the hash on rows written before it was tracked.
 				resourcesToUpdate = append(resourcesToUpdate, incomingResource)
 				delete(incomingResMap, id)
 			} else {
@@ -97,21 +115,39 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 			}
 		}
 		existingRows.Close()
+		slowLog()
 	}
 	metrics.LogStepDuration(&timer, clusterName, "QUERY existing resources.")
 
 	// INSERT resources that weren't found in the database.
-	for uid, resource := range incomingResMap {
-		data, _ := json.Marshal(resource.Properties)
+	// Use the COPY protocol for a large number of resources. Fall back to batched INSERTs if COPY fails.
+	resourcesToInsert := incomingResMap
+	if dao.useCopy(len(incomingResMap)) {
+		rows := make([][]interface{}, 0, len(incomingResMap))
+		for uid, resource := range incomingResMap {
+			data, hash := dao.resourceData(*resource)
+			rows = append(rows, []interface{}{uid, clusterName, data, hash})
+		}
+		if _, copyErr := dao.copyWithStaging(ctx, "resources", resourceColumns, rows); copyErr != nil {
+			klog.Warningf("Error copying resources for cluster %12s. Retrying with batched INSERTs. Error: %+v",
+				clusterName, copyErr)
+		} else {
+			resourcesToInsert = nil
+		}
+	}
+	for uid, resource := range resourcesToInsert {
+		data, hash := dao.resourceData(*resource)
 		query, params, err := useGoqu(
-			"INSERT into search.resources values($1,$2,$3) ON CONFLICT (uid) DO NOTHING",
-			[]interface{}{uid, clusterName, string(data)})
+			"INSERT into resources values($1,$2,$3,$4) ON CONFLICT (uid) "+
+				"DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE deleted_at IS NOT NULL",
+			[]interface{}{uid, clusterName, data, hash})
 		if err == nil {
 			queueErr := batch.Queue(batchItem{
 				action: "addResource",
 				query:  query,
 				uid:    uid,
 				args:   params,
+				retry:  retryStatement{retryAddResource, []interface{}{uid, clusterName, data, hash}},
 			})
 			if queueErr != nil {
 				klog.Warningf("Error queuing resources to add. Error: %+v", queueErr)
@@ -123,16 +159,17 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 
 	// UPDATE resources that have changed.
 	for _, resource := range resourcesToUpdate {
-		data, _ := json.Marshal(resource.Properties)
+		data, hash := dao.resourceData(*resource)
 		query, params, err := useGoqu(
-			"UPDATE search.resources SET data=$2 WHERE uid=$1",
-			[]interface{}{resource.UID, string(data)})
+			"UPDATE resources SET data=$2, hash=$3, deleted_at=NULL WHERE uid=$1",
+			[]interface{}{resource.UID, data, hash})
 		if err == nil {
 			queueErr := batch.Queue(batchItem{
 				action: "updateResource",
 				query:  query,
 				uid:    resource.UID,
 				args:   params,
+				retry:  retryStatement{retryUpdateResource, []interface{}{resource.UID, data, hash}},
 			})
 			if queueErr != nil {
 				klog.Warningf("Error queuing resources to update. Error: %+v", queueErr)
@@ -144,15 +181,22 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 
 	// DELETE resources that no longer exist and their edges.
 	if len(resourcesToDelete) > 0 {
-		query, params, err := useGoqu(
-			"DELETE from search.resources WHERE uid IN ($1)",
-			resourcesToDelete)
+		deleteResourcesQuery := "DELETE from resources WHERE uid IN ($1)"
+		deleteEdgesQuery := "DELETE from edges WHERE sourceid IN ($1) OR destid IN ($1)"
+		if dao.softDelete {
+			deleteResourcesQuery = "UPDATE resources SET deleted_at=now() " +
+				"WHERE uid IN ($1) AND deleted_at IS NULL"
+			deleteEdgesQuery = "UPDATE edges SET deleted_at=now() " +
+				"WHERE (sourceid IN ($1) OR destid IN ($1)) AND deleted_at IS NULL"
+		}
+		query, params, err := useGoqu(deleteResourcesQuery, resourcesToDelete)
 		if err == nil {
 			queueErr := batch.Queue(batchItem{
 				action: "deleteResource",
 				query:  query,
 				uid:    fmt.Sprintf("%s", resourcesToDelete),
 				args:   params,
+				retry:  retryStatement{retryDeleteResources, resourcesToDelete},
 			})
 			if queueErr != nil {
 				klog.Warningf("Error queuing resources for deletion. Error: %+v", queueErr)
@@ -161,15 +205,14 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 		}
 
 		// DELETE edges that point to deleted resources.
-		query, _, err = useGoqu(
-			"DELETE from search.edges WHERE sourceid IN ($1) OR destid IN ($1)",
-			resourcesToDelete)
+		query, params, err = useGoqu(deleteEdgesQuery, resourcesToDelete)
 		if err == nil {
 			queueErr := batch.Queue(batchItem{
 				action: "deleteEdge",
 				query:  query,
 				uid:    fmt.Sprintf("%s", resourcesToDelete),
 				args:   params,
+				retry:  retryStatement{retryDeleteResourceEdges, resourcesToDelete},
 			})
 			if queueErr != nil {
 				klog.Warningf("Error queuing edges for deletion. Error: %+v", queueErr)
@@ -186,7 +229,7 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 			len(resources)-len(incomingResMap)-len(resourcesToUpdate),
 			syncResponse.TotalAdded, syncResponse.TotalUpdated, syncResponse.TotalDeleted))
 
-	return batch.connError
+	return batch.getConnError()
 }
 
 // Reset Edges
@@ -196,6 +239,9 @@ func (dao *DAO) resetResources(ctx context.Context, resources []model.Resource,
 func (dao *DAO) resetEdges(ctx context.Context, edges []model.Edge, clusterName string,
 	syncResponse *model.SyncResponse) error {
 	timer := time.Now()
+	ctx, span := tracing.Start(ctx, "DAO.resetEdges")
+	defer span.End()
+	span.SetAttributes(attribute.Int("edges", len(edges)))
 
 	batch := NewBatchWithRetry(ctx, dao, syncResponse)
 
@@ -204,17 +250,22 @@ func (dao *DAO) resetEdges(ctx context.Context, edges []model.Edge, clusterName
 
 	// Get all existing edges for the cluster.
 	query, params, err := useGoqu(
-		"SELECT sourceid, edgetype, destid FROM search.edges WHERE edgetype!='interCluster' AND cluster=$1",
+		"SELECT sourceid, edgetype, destid, properties FROM edges "+
+			"WHERE edgetype!='interCluster' AND cluster=$1 AND deleted_at IS NULL",
 		[]interface{}{clusterName})
 	if err == nil {
-		edgeRow, err := dao.pool.Query(ctx, query, params...)
+		slowLog := metrics.SlowDBOperation("resyncSelect",
+			fmt.Sprintf("Slow query of existing edges during resync of cluster %s.", clusterName))
+		queryCtx, cancel := dao.withTimeout(ctx)
+		defer cancel()
+		edgeRow, err := dao.pool.Query(queryCtx, query, params...)
 		if err != nil {
 			klog.Warningf("Error getting existing edges during resync of cluster %12s. Error: %+v", clusterName, err)
 		}
 
 		for edgeRow.Next() {
 			edge := model.Edge{}
-			err := edgeRow.Scan(&edge.SourceUID, &edge.EdgeType, &edge.DestUID)
+			err := edgeRow.Scan(&edge.SourceUID, &edge.EdgeType, &edge.DestUID, &edge.Properties)
 			if err != nil {
 				klog.Warningf("Error scanning edge row. Error: %+v", err)
 				continue
@@ -222,26 +273,59 @@ func (dao *DAO) resetEdges(ctx context.Context, edges []model.Edge, clusterName
 			existingEdgesMap[edge.SourceUID+edge.EdgeType+edge.DestUID] = edge
 		}
 		edgeRow.Close()
+		slowLog()
 	}
 	metrics.LogStepDuration(&timer, clusterName, "Resync QUERY existing edges")
 
 	// Now compare existing edges with the new edges.
+	edgesToAdd := make([]model.Edge, 0)
 	for _, edge := range edges {
-		// If the edge already exists, do nothing.
-		if _, ok := existingEdgesMap[edge.SourceUID+edge.EdgeType+edge.DestUID]; ok {
+		// If the edge already exists with the same properties, do nothing.
+		if existing, ok := existingEdgesMap[edge.SourceUID+edge.EdgeType+edge.DestUID]; ok {
 			delete(existingEdgesMap, edge.SourceUID+edge.EdgeType+edge.DestUID)
-			continue
+			if sameEdgeProperties(existing.Properties, edge.Properties) {
+				continue
+			}
 		}
-		// If the edge doesn't exist, add it.
-		query, params, err := useGoqu(
-			"INSERT into search.edges values($1,$2,$3,$4,$5,$6) ON CONFLICT (sourceid, destid, edgetype) DO NOTHING",
-			[]interface{}{edge.SourceUID, edge.SourceKind, edge.DestUID, edge.DestKind, edge.EdgeType, clusterName})
+		edgesToAdd = append(edgesToAdd, edge)
+	}
+
+	// Use the COPY protocol for a large number of edges. Fall back to batched INSERTs if COPY fails.
+	if dao.useCopy(len(edgesToAdd)) {
+		rows := make([][]interface{}, len(edgesToAdd))
+		for i, edge := range edgesToAdd {
+			rows[i] = []interface{}{edge.SourceUID, edge.SourceKind, edge.DestUID, edge.DestKind, edge.EdgeType,
+				clusterName, edgeProperties(edge)}
+		}
+		if _, copyErr := dao.copyWithStaging(ctx, "edges", edgeColumns, rows); copyErr != nil {
+			klog.Warningf("Error copying edges for cluster %12s. Retrying with batched INSERTs. Error: %+v",
+				clusterName, copyErr)
+		} else {
+			syncResponse.TotalEdgesAdded += len(edgesToAdd)
+			edgesToAdd = edgesToAdd[:0]
+		}
+	}
+
+	// If the edge doesn't exist or its properties have changed, add it.
+	// Conflicts with the edges with changed properties, a soft deleted edge, or an edge added by a sync running at
+	// the same time.
+	addEdgeQuery := "INSERT into edges values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype) " +
+		"DO UPDATE SET properties=$7 WHERE properties IS DISTINCT FROM $7"
+	if dao.softDelete {
+		addEdgeQuery = "INSERT into edges values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype) " +
+			"DO UPDATE SET properties=$7, deleted_at=NULL WHERE properties IS DISTINCT FROM $7 OR deleted_at IS NOT NULL"
+	}
+	for _, edge := range edgesToAdd {
+		args := []interface{}{edge.SourceUID, edge.SourceKind, edge.DestUID, edge.DestKind, edge.EdgeType,
+			clusterName, edgeProperties(edge)}
+		query, params, err := useGoqu(addEdgeQuery, args)
 		if err == nil {
 			queueErr = batch.Queue(batchItem{
 				action: "addEdge",
 				query:  query,
 				uid:    edge.SourceUID,
 				args:   params,
+				retry:  retryStatement{retryAddEdge, args},
 			})
 			if queueErr != nil {
 				klog.Warningf("Error queuing edges. Error: %+v", queueErr)
@@ -252,16 +336,21 @@ func (dao *DAO) resetEdges(ctx context.Context, edges []model.Edge, clusterName
 	}
 
 	// Delete existing edges that are not in the new sync event.
+	deleteEdgeQuery := "DELETE from edges WHERE sourceid=$1 AND destid=$2 AND edgetype=$3"
+	if dao.softDelete {
+		deleteEdgeQuery = "UPDATE edges SET deleted_at=now() " +
+			"WHERE sourceid=$1 AND destid=$2 AND edgetype=$3 AND deleted_at IS NULL"
+	}
 	for _, edge := range existingEdgesMap {
-		query, params, err := useGoqu(
-			"DELETE from search.edges WHERE sourceid=$1 AND destid=$2 AND edgetype=$3",
-			[]interface{}{edge.SourceUID, edge.DestUID, edge.EdgeType})
+		args := []interface{}{edge.SourceUID, edge.DestUID, edge.EdgeType}
+		query, params, err := useGoqu(deleteEdgeQuery, args)
 		if err == nil {
 			queueErr = batch.Queue(batchItem{
 				action: "deleteEdge",
 				query:  query,
 				uid:    edge.SourceUID,
 				args:   params,
+				retry:  retryStatement{retryDeleteEdge, args},
 			})
 			if queueErr != nil {
 				klog.Warningf("Error queuing edges. Error: %+v", queueErr)
@@ -275,5 +364,5 @@ func (dao *DAO) resetEdges(ctx context.Context, edges []model.Edge, clusterName
 	batch.wg.Wait()
 	metrics.LogStepDuration(&timer, clusterName, fmt.Sprintf("Reset edges stats: INSERT [%d] DELETE [%d]",
 		syncResponse.TotalEdgesAdded, syncResponse.TotalEdgesDeleted))
-	return batch.connError
+	return batch.getConnError()
 }
@@ -9,20 +9,50 @@ import (
 	"os"
 	"testing"
 
-	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/model"
 	"github.com/stolostron/search-indexer/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 )
 
+const resyncAddResourceSQL = `INSERT INTO "resources" ("cluster", "data", "hash", "uid") ` +
+	`VALUES ($1, $2, $3, $4) ON CONFLICT (uid) DO UPDATE SET "data"=EXCLUDED.data,"deleted_at"=NULL,` +
+	`"hash"=EXCLUDED.hash WHERE ("resources"."deleted_at" IS NOT NULL)`
+const resyncAddEdgeSQL = `INSERT INTO "edges" ("sourceid", "sourcekind", "destid", "destkind", ` +
+	`"edgetype", "cluster", "properties") VALUES ($1, $2, $3, $4, $5, $6, $7) ` +
+	`ON CONFLICT (sourceid, destid, edgetype) DO UPDATE SET "properties"=EXCLUDED.properties ` +
+	`WHERE "edges"."properties" IS DISTINCT FROM EXCLUDED.properties`
+
+// Statements queued by ResyncData() for mocks/simple.json and the state from testutils.MockDatabaseState().
+var (
+	resyncDeleteStatements = []batchStatement{
+		{sql: `DELETE FROM "resources" WHERE ("uid" IN ($1))`, args: []interface{}{"uid-123"}},
+		{sql: `DELETE FROM "edges" WHERE (("sourceid" IN ($1)) OR ("destid" IN ($2)))`,
+			args: []interface{}{"uid-123", "uid-123"}},
+	}
+	resyncDeleteEdgeStatement = batchStatement{
+		sql:  `DELETE FROM "edges" WHERE (("sourceid" = $1) AND ("destid" = $2) AND ("edgetype" = $3))`,
+		args: []interface{}{"sourceId1", "destId1", "edgeType1"},
+	}
+)
+
+// Expects the batches to update the resources, then the edges.
+func expectResyncBatches(mockPool pgxmock.PgxPoolIface) {
+	addResource := batchStatement{sql: resyncAddResourceSQL, args: anyArgs(4)}
+	expectBatchStatements(mockPool, nil, append([]batchStatement{addResource, addResource},
+		resyncDeleteStatements...)...)
+	expectBatchStatements(mockPool, nil, batchStatement{sql: resyncAddEdgeSQL, args: anyArgs(7)},
+		resyncDeleteEdgeStatement)
+}
+
 func Test_ResyncData(t *testing.T) {
 	// Prepare a mock DAO instance.
 	dao, mockPool := buildMockDAO(t)
 
 	testutils.MockDatabaseState(mockPool) // Mock Postgres state and SELECT queries.
 
-	br := &testutils.MockBatchResults{}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(2)
+	expectResyncBatches(mockPool)
 
 	// Prepare Request data.
 	data, _ := os.Open("./mocks/simple.json")
@@ -42,12 +72,13 @@ func Test_ResyncData(t *testing.T) {
 func Test_ResyncData_errors(t *testing.T) {
 	// Prepare a mock DAO instance.
 	dao, mockPool := buildMockDAO(t)
-	// Mock Postgres state and SELECT queries.
-	testutils.MockDatabaseState(mockPool)
+	// Mock Postgres state and SELECT queries. The edges aren't read after the error.
+	testutils.MockExistingResources(mockPool)
 
 	// Mock error on INSERT.
-	br := &testutils.MockBatchResults{MockErrorOnClose: errors.New("unexpected EOF")}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(2)
+	addResource := batchStatement{sql: resyncAddResourceSQL, args: anyArgs(4)}
+	expectBatchStatements(mockPool, errors.New("unexpected EOF"), append([]batchStatement{addResource, addResource},
+		resyncDeleteStatements...)...)
 
 	// Prepare Request data.
 	data, _ := os.Open("./mocks/simple.json")
@@ -63,3 +94,54 @@ func Test_ResyncData_errors(t *testing.T) {
 
 	assert.NotNil(t, err)
 }
+
+func Test_ResyncData_withCopy(t *testing.T) {
+	// Prepare a mock DAO instance.
+	dao, mockPool := buildMockDAO(t)
+	dao.copyThreshold = 1
+	testutils.MockDatabaseState(mockPool) // Mock Postgres state and SELECT queries.
+
+	// Mock COPY transactions for resources and edges.
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec("CREATE TEMP TABLE resources_staging (LIKE resources INCLUDING DEFAULTS) " +
+		"ON COMMIT DROP").WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectCopyFrom(pgx.Identifier{"resources_staging"}, resourceColumns).WillReturnResult(2)
+	mockPool.ExpectExec("INSERT INTO resources (uid,cluster,data,hash) " +
+		"SELECT DISTINCT ON (uid) uid,cluster,data,hash FROM resources_staging " +
+		"ON CONFLICT (uid) DO UPDATE SET data=EXCLUDED.data, hash=EXCLUDED.hash, deleted_at=NULL " +
+		"WHERE resources.deleted_at IS NOT NULL").
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mockPool.ExpectCommit()
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec("CREATE TEMP TABLE edges_staging (LIKE edges INCLUDING DEFAULTS) ON COMMIT DROP").
+		WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectCopyFrom(pgx.Identifier{"edges_staging"}, edgeColumns).WillReturnResult(1)
+	mockPool.ExpectExec("INSERT INTO edges " +
+		"(sourceid,sourcekind,destid,destkind,edgetype,cluster,properties) " +
+		"SELECT DISTINCT ON (sourceid, destid, edgetype) " +
+		"sourceid,sourcekind,destid,destkind,edgetype,cluster,properties FROM edges_staging " +
+		"ON CONFLICT (sourceid, destid, edgetype) DO UPDATE SET properties=EXCLUDED.properties, deleted_at=NULL " +
+		"WHERE edges.deleted_at IS NOT NULL OR edges.properties IS DISTINCT FROM EXCLUDED.properties").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mockPool.ExpectCommit()
+
+	// Only the DELETE statements use batches.
+	expectBatchStatements(mockPool, nil, resyncDeleteStatements...)
+	expectBatchStatements(mockPool, nil, resyncDeleteEdgeStatement)
+
+	// Prepare Request data.
+	data, _ := os.Open("./mocks/simple.json")
+	var syncEvent model.SyncEvent
+	json.NewDecoder(data).Decode(&syncEvent) //nolint: errcheck
+
+	// Supress console output to prevent log messages from polluting test output.
+	defer testutils.SupressConsoleOutput()()
+
+	// Execute function test.
+	response := &model.SyncResponse{}
+	err := dao.ResyncData(context.Background(), syncEvent, "test-cluster", response)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, response.TotalAdded)
+	assert.Equal(t, 1, response.TotalEdgesAdded)
+}
@@ -0,0 +1,150 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Resource size limits.
+// A single resource with a large property, like a ConfigMap with an embedded blob, bloats the batch and can break
+// the bulk INSERT. MAX_PROPERTY_SIZE limits the serialized size of each property value, and MAX_RESOURCE_SIZE
+// limits the serialized size of the resource data. Both limits are disabled by default, so an upgrade doesn't change
+// the stored data.
+// With OVERSIZED_RESOURCES=truncate, large strings are truncated and other large values are removed. If the resource
+// is still too large, the largest properties are removed. The resource is reported in SyncResponse.Truncated
+// With OVERSIZED_RESOURCES=reject, the resource isn't written and it's reported as an add or update error.
+
+type sizeLimits struct {
+	maxProperty int
+	maxResource int
+	reject      bool
+}
+
+func (l sizeLimits) enabled() bool {
+	return l.maxProperty > 0 || l.maxResource > 0
+}
+
+// Properties identifying the resource. Never removed to fit the resource size limit.
+var identityProperties = map[string]bool{
+	"apigroup": true, "apiversion": true, "cluster": true, "kind": true, "name": true, "namespace": true,
+}
+
+// Applies the size limits to the properties. The properties are copied when a limit changes them, so the incoming
+// resource isn't modified. Returns the names of the properties truncated or removed.
+func limitProperties(props map[string]interface{}, limits sizeLimits) (map[string]interface{}, []string) {
+	limited := props
+	changed := []string{}
+	change := func(name string) {
+		if len(changed) == 0 {
+			limited = make(map[string]interface{}, len(props))
+			for k, v := range props {
+				limited[k] = v
+			}
+		}
+		changed = append(changed, name)
+	}
+
+	sizes := make(map[string]int, len(props))
+	total := 1 // Braces, without the comma after the last property.
+	for name, value := range props {
+		encoded, _ := json.Marshal(value)
+		size := len(encoded)
+		if limits.maxProperty > 0 && size > limits.maxProperty {
+			change(name)
+			if str, ok := value.(string); ok {
+				limited[name] = truncateString(str, limits.maxProperty)
+				encoded, _ = json.Marshal(limited[name])
+				size = len(encoded)
+			} else {
+				delete(limited, name)
+				continue
+			}
+		}
+		encodedName, _ := json.Marshal(name)
+		sizes[name] = len(encodedName) + size + 2 // Colon and comma.
+		total += sizes[name]
+	}
+
+	if limits.maxResource > 0 && total > limits.maxResource {
+		names := make([]string, 0, len(sizes))
+		for name := range sizes {
+			if !identityProperties[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Slice(names, func(i, j int) bool { return sizes[names[i]] > sizes[names[j]] })
+		for _, name := range names {
+			if total <= limits.maxResource {
+				break
+			}
+			if !containsString(changed, name) {
+				change(name)
+			}
+			delete(limited, name)
+			total -= sizes[name]
+		}
+	}
+	sort.Strings(changed)
+	return limited, changed
+}
+
+// Truncates the string to max bytes, without splitting a multi-byte character.
+func truncateString(str string, max int) string {
+	if len(str) <= max {
+		return str
+	}
+	for max > 0 && !utf8.RuneStart(str[max]) {
+		max--
+	}
+	return str[:max]
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports the resources over the size limits. Returns the resources to write, without the rejected resources.
+func (dao *DAO) checkSizeLimits(resources []model.Resource, action string,
+	syncResponse *model.SyncResponse) []model.Resource {
+	if !dao.limits.enabled() {
+		return resources
+	}
+	accepted := make([]model.Resource, 0, len(resources))
+	for _, resource := range resources {
+		_, _, limited := dao.storedData(resource)
+		if len(limited) == 0 {
+			accepted = append(accepted, resource)
+			continue
+		}
+		properties := strings.Join(limited, ", ")
+		if dao.limits.reject {
+			klog.Warningf("Rejecting resource %s over the size limits. Large properties: %s", resource.UID, properties)
+			syncError := model.SyncError{ResourceUID: resource.UID,
+				Message: fmt.Sprintf("Resource exceeds the size limits. Large properties: %s", properties)}
+			if action == "updateResource" {
+				syncResponse.UpdateErrors = append(syncResponse.UpdateErrors, syncError)
+			} else {
+				syncResponse.AddErrors = append(syncResponse.AddErrors, syncError)
+			}
+			continue
+		}
+		klog.V(2).Infof("Truncating resource %s over the size limits. Properties: %s", resource.UID, properties)
+		syncResponse.Truncated = append(syncResponse.Truncated, model.SyncError{ResourceUID: resource.UID,
+			Message: fmt.Sprintf("Resource exceeds the size limits. Truncated or removed properties: %s", properties)})
+		accepted = append(accepted, resource)
+	}
+	return accepted
+}
@@ -0,0 +1,92 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_limitProperties_property(t *testing.T) {
+	props := map[string]interface{}{
+		"name":  "cm-a",
+		"blob":  strings.Repeat("x", 100),
+		"list":  []interface{}{strings.Repeat("y", 100)},
+		"small": "z",
+	}
+
+	limited, changed := limitProperties(props, sizeLimits{maxProperty: 10})
+
+	assert.Equal(t, []string{"blob", "list"}, changed)
+	assert.Equal(t, map[string]interface{}{"name": "cm-a", "blob": "xxxxxxxxxx", "small": "z"}, limited)
+	// Should not modify the incoming properties.
+	assert.Equal(t, 4, len(props))
+	assert.Equal(t, 100, len(props["blob"].(string)))
+}
+
+// Should remove the largest properties, but never the properties identifying the resource.
+func Test_limitProperties_resource(t *testing.T) {
+	props := map[string]interface{}{
+		"name":   strings.Repeat("n", 50),
+		"large":  strings.Repeat("x", 50),
+		"medium": strings.Repeat("y", 20),
+		"small":  "z",
+	}
+
+	limited, changed := limitProperties(props, sizeLimits{maxResource: 120})
+
+	assert.Equal(t, []string{"large"}, changed)
+	assert.Equal(t, 3, len(limited))
+	assert.NotContains(t, limited, "large")
+}
+
+func Test_truncateString(t *testing.T) {
+	assert.Equal(t, "abc", truncateString("abc", 5))
+	assert.Equal(t, "ab", truncateString("abcdef", 2))
+	// Should not split the 2-byte character.
+	assert.Equal(t, "a", truncateString("aé", 2))
+}
+
+func Test_checkSizeLimits_truncate(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.limits = sizeLimits{maxProperty: 10}
+	resources := []model.Resource{
+		{UID: "uid-1", Properties: map[string]interface{}{"name": "a"}},
+		{UID: "uid-2", Properties: map[string]interface{}{"name": "b", "blob": strings.Repeat("x", 100)}},
+	}
+	syncResponse := &model.SyncResponse{}
+
+	accepted := dao.checkSizeLimits(resources, "addResource", syncResponse)
+
+	assert.Equal(t, resources, accepted)
+	assert.Equal(t, 1, len(syncResponse.Truncated))
+	assert.Equal(t, "uid-2", syncResponse.Truncated[0].ResourceUID)
+	assert.Equal(t, 0, len(syncResponse.AddErrors))
+
+	// Should store the truncated data, and calculate the hash with all the properties.
+	data, hash := dao.resourceData(resources[1])
+	assert.Equal(t, `{"blob":"xxxxxxxxxx","name":"b"}`, data)
+	assert.False(t, dao.resourceChanged(resources[1], map[string]interface{}{"blob": "xxxxxxxxxx", "name": "b"}, hash))
+}
+
+func Test_checkSizeLimits_reject(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, _ := buildMockDAO(t)
+	dao.limits = sizeLimits{maxResource: 50, reject: true}
+	resources := []model.Resource{
+		{UID: "uid-1", Properties: map[string]interface{}{"name": "a"}},
+		{UID: "uid-2", Properties: map[string]interface{}{"name": "b", "blob": strings.Repeat("x", 100)}},
+	}
+	syncResponse := &model.SyncResponse{}
+
+	accepted := dao.checkSizeLimits(resources, "updateResource", syncResponse)
+
+	assert.Equal(t, resources[:1], accepted)
+	assert.Equal(t, []model.SyncError{{ResourceUID: "uid-2",
+		Message: "Resource exceeds the size limits. Large properties: blob"}}, syncResponse.UpdateErrors)
+	assert.Equal(t, 0, len(syncResponse.Truncated))
+}
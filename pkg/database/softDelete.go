@@ -0,0 +1,50 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"k8s.io/klog/v2"
+)
+
+// Soft delete.
+// When SOFT_DELETE is enabled, deleted resources and edges, and the edges pointing to the deleted resources, are
+// marked with a tombstone (deleted_at) instead of deleting the rows. Reads exclude the rows with a tombstone, and
+// inserts or updates of the resource or edge remove the tombstone. This protects the data from a collector bug
+// deleting resources by mistake, the rows can be restored by clearing deleted_at without waiting for a full resync.
+// The rows are deleted after the retention period.
+
+const tombstoneCleanupInterval = time.Hour
+
+// Periodically deletes the rows with a tombstone older than the retention period.
+// Runs until the context is cancelled.
+func (dao *DAO) StartTombstoneCleanup(ctx context.Context, retention time.Duration) {
+	runPeriodically(ctx, "tombstone cleanup", tombstoneCleanupInterval, func(ctx context.Context) {
+		_, _ = dao.deleteTombstones(ctx, retention)
+	})
+}
+
+// Deletes the resources and edges with a tombstone older than the retention period.
+// Returns the number of rows deleted.
+func (dao *DAO) deleteTombstones(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	deletedBefore := time.Now().Add(-retention)
+	var rowsDeleted int64
+	for _, table := range []string{"resources", "edges"} {
+		res, err := dao.pool.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE deleted_at < $1", table),
+			deletedBefore)
+		if err != nil {
+			logging.SampledErrorf("Error deleting tombstones from %s. %s", table, err)
+			return rowsDeleted, err
+		}
+		klog.V(2).Infof("Deleted %d rows with tombstone older than %s from %s.",
+			res.RowsAffected(), retention, table)
+		rowsDeleted += res.RowsAffected()
+	}
+	return rowsDeleted, nil
+}
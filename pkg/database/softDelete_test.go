@@ -0,0 +1,40 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deleteTombstones(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM resources WHERE deleted_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	mockPool.ExpectExec("DELETE FROM edges WHERE deleted_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+
+	deleted, err := dao.deleteTombstones(context.Background(), 24*time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), deleted)
+}
+
+// Should stop at the first error.
+func Test_deleteTombstones_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectExec("DELETE FROM resources WHERE deleted_at < $1").WithArgs(pgxmock.AnyArg()).
+		WillReturnError(errors.New("connection refused"))
+
+	deleted, err := dao.deleteTombstones(context.Background(), 24*time.Hour)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
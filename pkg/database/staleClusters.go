@@ -0,0 +1,138 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+	"k8s.io/klog/v2"
+)
+
+// Stale clusters.
+// The time of the last successful sync from each cluster is tracked in search.cluster_sync. When
+// STALE_CLUSTER_TTL_HOURS is set, a janitor deletes the resources and edges of the clusters that haven't synced
+// within the TTL. This cleans up the data from clusters that are gone when the ManagedCluster delete event
+// wasn't observed. Use STALE_CLUSTER_DRY_RUN to only log the clusters that would be cleaned up.
+
+const staleClusterCleanupInterval = time.Hour
+
+// The collector totals are optional, a zero total is stored as NULL (not reported).
+const updateLastSyncSql = "INSERT INTO cluster_sync AS s " +
+	"(cluster, last_sync, reported_resources, reported_edges) VALUES ($1, now(), NULLIF($2, 0), NULLIF($3, 0)) " +
+	"ON CONFLICT (cluster) DO UPDATE SET last_sync=now(), reported_resources=EXCLUDED.reported_resources, " +
+	"reported_edges=EXCLUDED.reported_edges, resync_requested=(s.resync_requested AND NOT $4) " +
+	"RETURNING s.resync_requested"
+
+// Records the time of a successful sync from the cluster and the totals reported by the collector, and updates the
+// sync properties of the Cluster node. Returns true if the consistency check requested a resync. The request is
+// cleared by the next resync.
+func (dao *DAO) UpdateLastSync(ctx context.Context, clusterName string, event model.SyncEvent) (bool, error) {
+	ctx, span := tracing.Start(ctx, "DAO.UpdateLastSync")
+	defer span.End()
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, updateLastSyncSql, clusterName, event.TotalResources, event.TotalEdges,
+		event.ClearAll)
+	if err != nil {
+		logging.SampledErrorf("Error updating the last sync time for cluster %s. %s", clusterName, err)
+		return false, err
+	}
+	defer rows.Close()
+
+	resyncRequested := false
+	if rows.Next() {
+		err = rows.Scan(&resyncRequested)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		logging.SampledErrorf("Error updating the last sync time for cluster %s. %s", clusterName, err)
+		return resyncRequested, err
+	}
+	// Release the connection before updating the Cluster node, see clusterSyncProps.go
+	rows.Close()
+	dao.updateClusterSyncProps(ctx, clusterName, event.CollectorVersion)
+	return resyncRequested, nil
+}
+
+// Periodically deletes the resources and edges of the clusters that haven't synced within the TTL.
+// Runs until the context is cancelled.
+func (dao *DAO) StartStaleClusterCleanup(ctx context.Context, ttl time.Duration, dryRun bool) {
+	runPeriodically(ctx, "stale cluster cleanup", staleClusterCleanupInterval, func(ctx context.Context) {
+		_, _ = dao.deleteStaleClusters(ctx, ttl, dryRun)
+	})
+}
+
+// Deletes the resources and edges of the clusters that haven't synced within the TTL. With dryRun, only logs
+// the stale clusters. Returns the number of clusters cleaned up.
+func (dao *DAO) deleteStaleClusters(ctx context.Context, ttl time.Duration, dryRun bool) (int, error) {
+	clusters, err := dao.staleClusters(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	metrics.StaleClusters.Set(float64(len(clusters)))
+
+	deleted := 0
+	for cluster, lastSync := range clusters {
+		if dryRun {
+			klog.Infof("[dry-run] Cluster %s hasn't synced since %s. Would delete its resources and edges.",
+				cluster, lastSync.Format(time.RFC3339))
+			continue
+		}
+		klog.Infof("Cluster %s hasn't synced since %s. Deleting its resources and edges.",
+			cluster, lastSync.Format(time.RFC3339))
+		// Errors are logged by DeleteClusterResourcesTxn. The cluster is retried on the next run.
+		if err = dao.DeleteClusterResourcesTxn(ctx, cluster); err != nil {
+			continue
+		}
+		if err = dao.deleteLastSync(ctx, cluster, lastSync); err != nil {
+			continue
+		}
+		metrics.StaleClustersDeleted.Inc()
+		deleted++
+	}
+	return deleted, err
+}
+
+// Returns the clusters that haven't synced within the TTL and the time of their last sync.
+func (dao *DAO) staleClusters(ctx context.Context, ttl time.Duration) (map[string]time.Time, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, "SELECT cluster, last_sync FROM cluster_sync WHERE last_sync < $1",
+		time.Now().Add(-ttl))
+	if err != nil {
+		logging.SampledErrorf("Error querying stale clusters. %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	clusters := map[string]time.Time{}
+	for rows.Next() {
+		var cluster string
+		var lastSync time.Time
+		if err = rows.Scan(&cluster, &lastSync); err != nil {
+			klog.Errorf("Error reading stale clusters. %s", err)
+			continue
+		}
+		clusters[cluster] = lastSync
+	}
+	return clusters, nil
+}
+
+// Stops tracking the cluster. Keeps the row if the cluster synced after it was found stale.
+func (dao *DAO) deleteLastSync(ctx context.Context, cluster string, lastSync time.Time) error {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	_, err := dao.pool.Exec(ctx, "DELETE FROM cluster_sync WHERE cluster=$1 AND last_sync<=$2",
+		cluster, lastSync)
+	if err != nil {
+		logging.SampledErrorf("Error deleting the last sync time for cluster %s. %s", cluster, err)
+	}
+	return err
+}
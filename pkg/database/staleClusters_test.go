@@ -0,0 +1,94 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+const staleClustersSql = "SELECT cluster, last_sync FROM cluster_sync WHERE last_sync < $1"
+
+func Test_UpdateLastSync(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"resync_requested"}).AddRow(false)
+	mockPool.ExpectQuery(updateLastSyncSql).WithArgs("cluster-a", 10, 5, false).WillReturnRows(rows)
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs("cluster__cluster-a", pgxmock.AnyArg(), "2.13.0").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	defer forgetClusterSyncWrite("cluster-a")
+
+	resyncRequired, err := dao.UpdateLastSync(context.Background(), "cluster-a",
+		model.SyncEvent{TotalResources: 10, TotalEdges: 5, CollectorVersion: "2.13.0"})
+
+	assert.Nil(t, err)
+	assert.False(t, resyncRequired)
+}
+
+// Should return the resync requested by the consistency check.
+func Test_UpdateLastSync_resyncRequested(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"resync_requested"}).AddRow(true)
+	mockPool.ExpectQuery(updateLastSyncSql).WithArgs("cluster-a", 0, 0, false).WillReturnRows(rows)
+	mockPool.ExpectExec(updateClusterSyncPropsSql).WithArgs(anyArgs(3)...).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	defer forgetClusterSyncWrite("cluster-a")
+
+	resyncRequired, err := dao.UpdateLastSync(context.Background(), "cluster-a", model.SyncEvent{})
+
+	assert.Nil(t, err)
+	assert.True(t, resyncRequired)
+}
+
+// Should delete the resources and edges of the stale cluster and stop tracking it.
+func Test_deleteStaleClusters(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	lastSync := time.Now().Add(-48 * time.Hour)
+	rows := pgxmock.NewRows([]string{"cluster", "last_sync"}).AddRow("cluster-a", lastSync)
+	mockPool.ExpectQuery(staleClustersSql).
+		WithArgs(pgxmock.AnyArg()).WillReturnRows(rows)
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(`DELETE FROM "resources" WHERE ("cluster" = 'cluster-a')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 10))
+	mockPool.ExpectExec(`DELETE FROM "edges" WHERE ("cluster" = 'cluster-a')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 5))
+	mockPool.ExpectCommit()
+	mockPool.ExpectExec("DELETE FROM cluster_sync WHERE cluster=$1 AND last_sync<=$2").
+		WithArgs("cluster-a", lastSync).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	deleted, err := dao.deleteStaleClusters(context.Background(), 24*time.Hour, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+// Should only log the stale clusters in dry-run mode.
+func Test_deleteStaleClusters_dryRun(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	rows := pgxmock.NewRows([]string{"cluster", "last_sync"}).
+		AddRow("cluster-a", time.Now().Add(-48*time.Hour))
+	mockPool.ExpectQuery(staleClustersSql).WithArgs(pgxmock.AnyArg()).WillReturnRows(rows)
+
+	deleted, err := dao.deleteStaleClusters(context.Background(), 24*time.Hour, true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, deleted)
+}
+
+func Test_deleteStaleClusters_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectQuery(staleClustersSql).WithArgs(pgxmock.AnyArg()).WillReturnError(errors.New("connection refused"))
+
+	deleted, err := dao.deleteStaleClusters(context.Background(), 24*time.Hour, false)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, deleted)
+}
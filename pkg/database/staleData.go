@@ -0,0 +1,93 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Stale search data.
+// When STALE_DATA_WINDOW_MS is set, a periodic check flags the Cluster nodes of the clusters that haven't synced
+// within the window with searchDataStale=true, so users can tell that the search results for the cluster are
+// outdated. The flag is removed by the next sync from the cluster, see clusterSyncProps.go. The number of flagged
+// clusters is exposed with the search_indexer_clusters_stale_data metric. Unlike STALE_CLUSTER_TTL_HOURS, the
+// data is kept. The check runs only on the leader, see clustersync.syncClusters().
+
+const staleDataCheckInterval = time.Minute
+
+// Sets or removes searchDataStale on the Cluster nodes with a sync time. Only the nodes that change are written.
+const markStaleDataSql = "UPDATE clusters c SET data = CASE WHEN s.last_sync < $1 " +
+	"THEN c.data || '{\"searchDataStale\":true}' ELSE c.data - 'searchDataStale' END " +
+	"FROM cluster_sync s WHERE c.uid = 'cluster__' || s.cluster " +
+	"AND (c.data ? 'searchDataStale') != (s.last_sync < $1) " +
+	"RETURNING s.cluster, s.last_sync < $1"
+
+const countStaleDataSql = "SELECT count(*) FROM clusters WHERE data ? 'searchDataStale'"
+
+// Periodically flags the Cluster nodes of the clusters that haven't synced within the window.
+// Runs until the context is cancelled.
+func (dao *DAO) StartStaleDataCheck(ctx context.Context, window time.Duration) {
+	runPeriodically(ctx, "stale data check", staleDataCheckInterval, func(ctx context.Context) {
+		_, _ = dao.markStaleData(ctx, window)
+	})
+}
+
+// Sets searchDataStale on the Cluster nodes of the clusters that haven't synced within the window, and removes it
+// from the clusters that synced again. Returns the number of clusters flagged.
+func (dao *DAO) markStaleData(ctx context.Context, window time.Duration) (int, error) {
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
+	rows, err := dao.pool.Query(ctx, markStaleDataSql, time.Now().Add(-window))
+	if err != nil {
+		logging.SampledErrorf("Error flagging clusters with stale search data. %s", err)
+		return 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cluster string
+		var stale bool
+		if err = rows.Scan(&cluster, &stale); err != nil {
+			klog.Errorf("Error reading clusters with stale search data. %s", err)
+			continue
+		}
+		if stale {
+			klog.Warningf("Cluster %s hasn't synced within %s. Flagged the search data as stale.", cluster, window)
+		} else {
+			klog.Infof("Cluster %s synced again. Removed the stale search data flag.", cluster)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logging.SampledErrorf("Error flagging clusters with stale search data. %s", err)
+		return 0, err
+	}
+	rows.Close()
+
+	return dao.countStaleData(ctx)
+}
+
+// Counts the Cluster nodes flagged with searchDataStale and updates the metric.
+func (dao *DAO) countStaleData(ctx context.Context) (int, error) {
+	rows, err := dao.pool.Query(ctx, countStaleDataSql)
+	if err == nil {
+		defer rows.Close()
+	}
+	stale := 0
+	if err == nil && rows.Next() {
+		err = rows.Scan(&stale)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		logging.SampledErrorf("Error counting clusters with stale search data. %s", err)
+		return 0, err
+	}
+	metrics.ClustersStaleData.Set(float64(stale))
+	return stale, nil
+}
@@ -0,0 +1,41 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should flag the clusters that haven't synced within the window.
+func Test_markStaleData(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	changed := pgxmock.NewRows([]string{"cluster", "stale"}).
+		AddRow("cluster-a", true).
+		AddRow("cluster-b", false)
+	mockPool.ExpectQuery(markStaleDataSql).WithArgs(pgxmock.AnyArg()).WillReturnRows(changed)
+	count := pgxmock.NewRows([]string{"count"}).AddRow(2)
+	mockPool.ExpectQuery("SELECT count(*) FROM clusters WHERE data ? 'searchDataStale'").WillReturnRows(count)
+
+	stale, err := dao.markStaleData(context.Background(), time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stale)
+}
+
+func Test_markStaleData_withError(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockPool.ExpectQuery(markStaleDataSql).WithArgs(pgxmock.AnyArg()).WillReturnError(errors.New("connection refused"))
+
+	stale, err := dao.markStaleData(context.Background(), time.Hour)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, stale)
+}
@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+)
+
+// Storage backend.
+// The server and clustersync write the data through the Store interface, so the indexer can be embedded with a
+// different store. The DAO is the Postgres implementation and the default store. Features that only apply to
+// Postgres, like the dead letter table and the cleanup jobs, are implemented by the DAO and checked with a type
+// assertion where they're used.
+
+type Store interface {
+	// Applies the changes from a sync event to the cluster data.
+	SyncData(ctx context.Context, event model.SyncEvent, clusterName string, syncResponse *model.SyncResponse) error
+	// Replaces the cluster data with the complete state in the sync event.
+	ResyncData(ctx context.Context, event model.SyncEvent, clusterName string, syncResponse *model.SyncResponse) error
+	// Returns the number of resources and edges stored for the cluster.
+	ClusterTotals(ctx context.Context, clusterName string) (resources int, edges int, e error)
+	// Returns the checksum of the cluster resources, see checksum.go
+	ClusterChecksum(ctx context.Context, clusterName string) (int64, error)
+	// Records a successful sync from the cluster. Returns true if a resync was requested for the cluster.
+	UpdateLastSync(ctx context.Context, clusterName string, event model.SyncEvent) (bool, error)
+	// Checks if the store is falling behind the sync requests. See backpressure.go
+	Backpressure() (overloaded bool, retryAfter time.Duration)
+
+	// Creates or updates the Cluster node.
+	UpsertCluster(ctx context.Context, resource model.Resource)
+	// Deletes the cluster resources and edges, and optionally the Cluster node.
+	DeleteClusterAndResources(ctx context.Context, clusterName string, deleteClusterNode bool)
+	// Returns the names of the clusters with data in the store.
+	GetManagedClusters(ctx context.Context) ([]string, error)
+}
+
+// Stores that keep the batch items that failed permanently. See deadLetter.go
+type DeadLetterStore interface {
+	DeadLetters(ctx context.Context, after []string, limit int) ([]DeadLetter, error)
+	RetryDeadLetter(ctx context.Context, id int64) error
+}
+
+// Stores that keep the offset of the sync events applied from Kafka. See kafkaOffsets.go
+type OffsetStore interface {
+	AppliedOffset(ctx context.Context, topic string, partition int) (int64, error)
+	SaveOffset(ctx context.Context, topic string, partition int, offset int64) error
+}
+
+// Stores that record the resource changes in an outbox. See outbox.go
+type OutboxStore interface {
+	RelayOutbox(ctx context.Context, limit int, publish func([]OutboxEvent) error) (int, error)
+}
+
+var _ Store = &DAO{}
+var _ DeadLetterStore = &DAO{}
+var _ OffsetStore = &DAO{}
+var _ OutboxStore = &DAO{}
@@ -0,0 +1,175 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Property stripping.
+// Some resource properties inflate the storage and indexes, but are never queried by search. STRIP_PROPERTIES
+// is a comma-separated list of rules applied before writing the resource data.
+//   - name        Removes the property.                   Example: managedFields
+//   - name[key]   Removes the key from a map property.    Example: annotation[kubectl.kubernetes.io/restartedAt]
+//   - name[:N]    Keeps the first N items of a list.      Example: condition[:5]
+// The resource hash is calculated before stripping, so the cluster checksum still matches the collector. The
+// stripProperties of the cluster overrides are added to these rules, see config/clusterOverrides.go
+
+type stripRule struct {
+	property string
+	key      string // Key removed from a map property.
+	maxItems int    // Items kept in a list property. Used when >= 0.
+}
+
+// Parses the STRIP_PROPERTIES rules.
+func parseStripRules(rules string) ([]stripRule, error) {
+	parsed := []stripRule{}
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		property, selector, hasSelector := strings.Cut(rule, "[")
+		if property == "" || (hasSelector && !strings.HasSuffix(selector, "]")) {
+			return nil, fmt.Errorf("Invalid STRIP_PROPERTIES rule [%s].", rule)
+		}
+		r := stripRule{property: property, maxItems: -1}
+		selector = strings.TrimSuffix(selector, "]")
+		if strings.HasPrefix(selector, ":") {
+			maxItems, err := strconv.Atoi(strings.TrimPrefix(selector, ":"))
+			if err != nil || maxItems < 0 {
+				return nil, fmt.Errorf("Invalid STRIP_PROPERTIES rule [%s]. Expected name[:N]", rule)
+			}
+			r.maxItems = maxItems
+		} else {
+			r.key = selector
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// Returns the properties after applying the strip rules. The properties are copied when a rule changes them,
+// so the incoming resource isn't modified.
+func stripProperties(props map[string]interface{}, rules []stripRule) map[string]interface{} {
+	stripped := props
+	copied := false
+	set := func(property string, value interface{}, remove bool) {
+		if !copied {
+			stripped = make(map[string]interface{}, len(props))
+			for k, v := range props {
+				stripped[k] = v
+			}
+			copied = true
+		}
+		if remove {
+			delete(stripped, property)
+		} else {
+			stripped[property] = value
+		}
+	}
+
+	for _, rule := range rules {
+		value, found := stripped[rule.property]
+		if !found {
+			continue
+		}
+		switch {
+		case rule.maxItems >= 0:
+			if list, ok := value.([]interface{}); ok && len(list) > rule.maxItems {
+				set(rule.property, list[:rule.maxItems], false)
+			}
+		case rule.key != "":
+			if m, ok := value.(map[string]interface{}); ok {
+				if _, found := m[rule.key]; found {
+					newMap := make(map[string]interface{}, len(m))
+					for k, v := range m {
+						if k != rule.key {
+							newMap[k] = v
+						}
+					}
+					set(rule.property, newMap, false)
+				}
+			}
+		default:
+			set(rule.property, nil, true)
+		}
+	}
+	return stripped
+}
+
+// Returns true if the data written for the resources may differ from the incoming properties.
+func (dao *DAO) transformsProperties() bool {
+	return len(dao.stripRules) > 0 || dao.redact.enabled() || dao.limits.enabled()
+}
+
+// Returns the properties and JSON data written for the resource, after applying the strip rules, redaction, and
+// size limits. Also returns the properties truncated or removed by the size limits.
+func (dao *DAO) storedData(resource model.Resource) (map[string]interface{}, []byte, []string) {
+	props := stripProperties(resource.Properties, dao.stripRules)
+	if dao.redact.enabled() {
+		props = redactProperties(resource, props, dao.redact)
+	}
+	data, _ := json.Marshal(props)
+	if !dao.limits.enabled() || ((dao.limits.maxProperty <= 0 || len(data) <= dao.limits.maxProperty) &&
+		(dao.limits.maxResource <= 0 || len(data) <= dao.limits.maxResource)) {
+		return props, data, nil // Fast path, every property is within the limits.
+	}
+	props, limited := limitProperties(props, dao.limits)
+	if len(limited) > 0 {
+		data, _ = json.Marshal(props)
+	}
+	return props, data, limited
+}
+
+// Returns the JSON data written for the resource, and the resource hash calculated with all the properties.
+func (dao *DAO) resourceData(resource model.Resource) (string, int64) {
+	data, _ := json.Marshal(resource.Properties)
+	hash := ResourceHash(resource.UID, data)
+	if dao.transformsProperties() {
+		_, data, _ = dao.storedData(resource)
+	}
+	return string(data), hash
+}
+
+// Compares the incoming resource with the stored data. The stored data may not have all the properties, so it's
+// compared with the stored version of the resource, and the hash detects changes to the stripped properties.
+func (dao *DAO) resourceChanged(resource model.Resource, stored map[string]interface{}, storedHash int64) bool {
+	if !dao.transformsProperties() {
+		return !reflect.DeepEqual(resource.Properties, stored)
+	}
+	if data, _ := json.Marshal(resource.Properties); ResourceHash(resource.UID, data) != storedHash {
+		return true
+	}
+	props, _, _ := dao.storedData(resource)
+	return !reflect.DeepEqual(props, stored)
+}
+
+// Parses the rules configured with STRIP_PROPERTIES. Invalid rules are rejected by config.Validate().
+func newStripRules(rules string) []stripRule {
+	parsed, err := parseStripRules(rules)
+	if err != nil {
+		klog.Error(err)
+	}
+	return parsed
+}
+
+// Returns the DAO to write the data of the cluster, with the strip rules of the cluster overrides. The DAO is only
+// copied when the cluster has its own rules.
+func (dao *DAO) forCluster(clusterName string) *DAO {
+	rules := config.ClusterOverrideFor(clusterName).StripProperties
+	if rules == "" {
+		return dao
+	}
+	clusterDAO := *dao
+	clusterDAO.stripRules = append(append([]stripRule{}, dao.stripRules...), newStripRules(rules)...)
+	return &clusterDAO
+}
@@ -0,0 +1,93 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseStripRules(t *testing.T) {
+	rules, err := parseStripRules(" managedFields, annotation[a/b] ,condition[:2],")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []stripRule{
+		{property: "managedFields", maxItems: -1},
+		{property: "annotation", key: "a/b", maxItems: -1},
+		{property: "condition", maxItems: 2},
+	}, rules)
+}
+
+func Test_parseStripRules_invalid(t *testing.T) {
+	for _, rule := range []string{"[key]", "annotation[key", "condition[:x]", "condition[:-1]"} {
+		_, err := parseStripRules(rule)
+		assert.NotNil(t, err, "Expected error for rule %s", rule)
+	}
+}
+
+func Test_stripProperties(t *testing.T) {
+	rules, _ := parseStripRules("managedFields,annotation[a/b],condition[:1],missing")
+	props := map[string]interface{}{
+		"name":          "pod-a",
+		"managedFields": []interface{}{"x"},
+		"annotation":    map[string]interface{}{"a/b": "large", "c": "d"},
+		"condition":     []interface{}{"Ready", "Scheduled"},
+	}
+
+	stripped := stripProperties(props, rules)
+
+	assert.Equal(t, map[string]interface{}{
+		"name":       "pod-a",
+		"annotation": map[string]interface{}{"c": "d"},
+		"condition":  []interface{}{"Ready"},
+	}, stripped)
+	// Should not modify the incoming properties.
+	assert.Equal(t, 4, len(props))
+	assert.Equal(t, 2, len(props["annotation"].(map[string]interface{})))
+}
+
+// Should store the stripped data, and calculate the hash with all the properties.
+func Test_resourceData(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.stripRules, _ = parseStripRules("managedFields")
+	resource := model.Resource{UID: "uid-1", Properties: map[string]interface{}{"name": "a", "managedFields": "x"}}
+
+	data, hash := dao.resourceData(resource)
+
+	fullData, _ := json.Marshal(resource.Properties)
+	assert.Equal(t, `{"name":"a"}`, data)
+	assert.Equal(t, ResourceHash("uid-1", fullData), hash)
+}
+
+func Test_resourceChanged(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.stripRules, _ = parseStripRules("managedFields")
+	resource := model.Resource{UID: "uid-1", Properties: map[string]interface{}{"name": "a", "managedFields": "x"}}
+	_, hash := dao.resourceData(resource)
+	stored := map[string]interface{}{"name": "a"}
+
+	assert.False(t, dao.resourceChanged(resource, stored, hash))
+	// A change to a stripped property changes the hash.
+	changed := model.Resource{UID: "uid-1", Properties: map[string]interface{}{"name": "a", "managedFields": "y"}}
+	assert.True(t, dao.resourceChanged(changed, stored, hash))
+}
+
+// Should add the strip rules of the cluster overrides to the global rules.
+func Test_forCluster(t *testing.T) {
+	dao, _ := buildMockDAO(t)
+	dao.stripRules, _ = parseStripRules("managedFields")
+	config.SetClusterOverrides(map[string]config.ClusterOverride{"cluster-a": {StripProperties: "status"}})
+	defer config.SetClusterOverrides(nil)
+	resource := model.Resource{UID: "uid-1",
+		Properties: map[string]interface{}{"name": "a", "managedFields": "x", "status": "Running"}}
+
+	data, _ := dao.forCluster("cluster-a").resourceData(resource)
+	assert.Equal(t, `{"name":"a"}`, data)
+	data, _ = dao.forCluster("cluster-b").resourceData(resource)
+	assert.Equal(t, `{"name":"a","status":"Running"}`, data)
+	assert.Len(t, dao.stripRules, 1)
+}
@@ -4,12 +4,13 @@ package database
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/klog/v2"
 )
 
@@ -17,58 +18,64 @@ func (dao *DAO) SyncData(ctx context.Context, event model.SyncEvent,
 	clusterName string, syncResponse *model.SyncResponse) error {
 
 	defer metrics.SlowLog(fmt.Sprintf("Slow Sync from cluster %s.", clusterName), 0)()
+	ctx, span := tracing.Start(ctx, "DAO.SyncData")
+	defer span.End()
+	span.SetAttributes(attribute.String("cluster", clusterName))
+	dao = dao.forCluster(clusterName)
 	batch := NewBatchWithRetry(ctx, dao, syncResponse)
+	batch.bufferOnOutage = dao.buffer != nil
 	var queueErr error
 
 	// ADD RESOURCES
-	// In case of conflict update only if data has changed
-	for _, resource := range event.AddResources {
-		data, _ := json.Marshal(resource.Properties)
+	for _, resource := range dao.checkSizeLimits(event.AddResources, "addResource", syncResponse) {
+		data, hash := dao.resourceData(resource)
+		args := []interface{}{resource.UID, clusterName, data, hash}
 		queueErr = batch.Queue(batchItem{
 			action: "addResource",
-			query: `INSERT into search.resources as r values($1,$2,$3) ON CONFLICT (uid) 
-			DO UPDATE SET data=$3 WHERE r.uid=$1 and r.data IS DISTINCT FROM $3`,
-			uid:  resource.UID,
-			args: []interface{}{resource.UID, clusterName, string(data)},
+			query:  addResourceQuery,
+			uid:    resource.UID,
+			args:   args,
+			retry:  retryStatement{retryAddResource, args},
 		})
 	}
 
 	// UPDATE RESOURCES
 	// The collector enforces that a resource isn't added and updated in the same sync event.
 	// The uid and cluster fields will never get updated for a resource.
-	for _, resource := range event.UpdateResources {
-		data, _ := json.Marshal(resource.Properties)
+	for _, resource := range dao.checkSizeLimits(event.UpdateResources, "updateResource", syncResponse) {
+		data, hash := dao.resourceData(resource)
+		args := []interface{}{resource.UID, data, hash}
 		queueErr = batch.Queue(batchItem{
 			action: "updateResource",
-			query:  "UPDATE search.resources SET data=$2 WHERE uid=$1",
+			query:  updateResourceQuery,
 			uid:    resource.UID,
-			args:   []interface{}{resource.UID, string(data)},
+			args:   args,
+			retry:  retryStatement{retryUpdateResource, args},
 		})
 	}
 
 	// DELETE RESOURCES and all edges pointing to the resource.
 	if len(event.DeleteResources) > 0 {
-		params := make([]string, len(event.DeleteResources))
 		uids := make([]interface{}, len(event.DeleteResources))
 		for i, resource := range event.DeleteResources {
-			params[i] = fmt.Sprintf("$%d", i+1)
 			uids[i] = resource.UID
 		}
-		paramStr := strings.Join(params, ",")
 
 		// TODO: Need better safety for delete errors.
 		// The current retry logic won't work well if there's an error here.
 		err := batch.Queue(batchItem{
 			action: "deleteResource",
-			query:  fmt.Sprintf("DELETE from search.resources WHERE uid IN (%s)", paramStr),
+			query:  dao.deleteResourcesQuery(len(uids)),
 			uid:    fmt.Sprintf("%s", uids),
 			args:   uids,
+			retry:  retryStatement{retryDeleteResources, uids},
 		})
 		queueErr = batch.Queue(batchItem{
 			action: "deleteResource",
-			query:  fmt.Sprintf("DELETE from search.edges WHERE sourceId IN (%s) OR destId IN (%s)", paramStr, paramStr),
+			query:  dao.deleteResourceEdgesQuery(len(uids)),
 			uid:    fmt.Sprintf("%s", uids),
 			args:   uids,
+			retry:  retryStatement{retryDeleteResourceEdges, uids},
 		})
 		if err != nil {
 			queueErr = err
@@ -76,25 +83,51 @@ func (dao *DAO) SyncData(ctx context.Context, event model.SyncEvent,
 	}
 
 	// ADD EDGES
-	// Nothing to update in case of conflict as resource kind cannot change
-	for _, edge := range event.AddEdges {
+	addEdgeQuery := dao.addEdgeQuery()
+	queueEdge := func(edge model.Edge) {
+		args := []interface{}{edge.SourceUID, edge.SourceKind, edge.DestUID, edge.DestKind, edge.EdgeType,
+			clusterName, edgeProperties(edge)}
 		queueErr = batch.Queue(batchItem{
 			action: "addEdge",
-			query:  "INSERT into search.edges values($1,$2,$3,$4,$5,$6) ON CONFLICT (sourceid, destid, edgetype) DO NOTHING",
+			query:  addEdgeQuery,
 			uid:    edge.SourceUID,
-			args:   []interface{}{edge.SourceUID, edge.SourceKind, edge.DestUID, edge.DestKind, edge.EdgeType, clusterName}})
+			args:   args,
+			retry:  retryStatement{retryAddEdge, args}})
+	}
+
+	// With DEFER_EDGES, write the resources before the edges and hold the edges with unknown resources.
+	var deferral *edgeDeferral
+	if dao.deferEdges {
+		batch.flush()
+		batch.wg.Wait()
+		deferral = newEdgeDeferral(event, syncResponse)
+	}
+	for _, edge := range event.AddEdges {
+		if deferral == nil || deferral.ready(edge) {
+			queueEdge(edge)
+		}
 	}
 
 	// UPDATE EDGES
 	// Edges are never updated. The collector only sends ADD and DELETE eveents for edges.
 
 	// DELETE EDGES
+	deleteEdgeQuery := dao.deleteEdgeQuery()
 	for _, edge := range event.DeleteEdges {
+		args := []interface{}{edge.SourceUID, edge.DestUID, edge.EdgeType}
 		queueErr = batch.Queue(batchItem{
 			action: "deleteEdge",
-			query:  "DELETE from search.edges WHERE sourceId=$1 AND destId=$2 AND edgeType=$3",
+			query:  deleteEdgeQuery,
 			uid:    edge.SourceUID,
-			args:   []interface{}{edge.SourceUID, edge.DestUID, edge.EdgeType}})
+			args:   args,
+			retry:  retryStatement{retryDeleteEdge, args}})
+	}
+
+	// Write the deferred edges with resources found in the database.
+	if deferral != nil {
+		for _, edge := range dao.resolveDeferred(ctx, deferral, clusterName, syncResponse) {
+			queueEdge(edge)
+		}
 	}
 
 	// Flush remaining items in the batch.
@@ -111,9 +144,75 @@ func (dao *DAO) SyncData(ctx context.Context, event model.SyncEvent,
 	syncResponse.TotalAdded = len(event.AddResources) - len(syncResponse.AddErrors)
 	syncResponse.TotalUpdated = len(event.UpdateResources) - len(syncResponse.UpdateErrors)
 	syncResponse.TotalDeleted = len(event.DeleteResources) - len(syncResponse.DeleteErrors)
-	syncResponse.TotalEdgesAdded = len(event.AddEdges) - len(syncResponse.AddEdgeErrors)
+	syncResponse.TotalEdgesAdded = len(event.AddEdges) - len(syncResponse.AddEdgeErrors) -
+		len(syncResponse.UnresolvedEdges)
 	syncResponse.TotalEdgesDeleted = len(event.DeleteEdges) - len(syncResponse.DeleteEdgeErrors)
 
 	klog.V(1).Infof("Completed sync of cluster %12s", clusterName)
-	return batch.connError
+	if connError := batch.getConnError(); connError != nil {
+		return connError
+	}
+	applySyncToTotals(clusterName, syncResponse)
+	dao.notifyChanges(ctx, clusterName, event)
+	return nil
+}
+
+// Queries of the sync event items. Also used to retry the dead letter items, see deadLetter.go
+// In case of conflict, the resource is updated only if data has changed or to remove the soft delete tombstone.
+const addResourceQuery = `INSERT into resources as r (uid, cluster, data, hash) values($1,$2,$3,$4) ON CONFLICT (uid) 
+	DO UPDATE SET data=$3, hash=$4, deleted_at=NULL
+	WHERE r.uid=$1 and (r.data IS DISTINCT FROM $3 OR r.hash IS DISTINCT FROM $4 OR r.deleted_at IS NOT NULL)`
+
+const updateResourceQuery = "UPDATE resources SET data=$2, hash=$3, deleted_at=NULL WHERE uid=$1"
+
+// Returns the positional parameters $1 to $n separated by commas.
+func positionalParams(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return strings.Join(params, ",")
+}
+
+// Returns the query deleting n resources, or adding the tombstone with SOFT_DELETE.
+func (dao *DAO) deleteResourcesQuery(n int) string {
+	if dao.softDelete {
+		return fmt.Sprintf("UPDATE resources SET deleted_at=now() WHERE uid IN (%s) AND deleted_at IS NULL",
+			positionalParams(n))
+	}
+	return fmt.Sprintf("DELETE from resources WHERE uid IN (%s)", positionalParams(n))
+}
+
+// Returns the query deleting the edges pointing to n resources, or adding the tombstone with SOFT_DELETE.
+func (dao *DAO) deleteResourceEdgesQuery(n int) string {
+	paramStr := positionalParams(n)
+	if dao.softDelete {
+		return fmt.Sprintf("UPDATE edges SET deleted_at=now() "+
+			"WHERE (sourceId IN (%s) OR destId IN (%s)) AND deleted_at IS NULL", paramStr, paramStr)
+	}
+	return fmt.Sprintf("DELETE from edges WHERE sourceId IN (%s) OR destId IN (%s)", paramStr, paramStr)
+}
+
+// Returns the query deleting an edge, or adding the tombstone with SOFT_DELETE.
+func (dao *DAO) deleteEdgeQuery() string {
+	if dao.softDelete {
+		return "UPDATE edges SET deleted_at=now() " +
+			"WHERE sourceId=$1 AND destId=$2 AND edgeType=$3 AND deleted_at IS NULL"
+	}
+	return "DELETE from edges WHERE sourceId=$1 AND destId=$2 AND edgeType=$3"
+}
+
+// Returns the query adding an edge. Edges overlap with the edges from previous syncs, so a conflict is expected
+// and must not fail the batch. The resource kind cannot change, in case of conflict update only if the properties
+// have changed or to remove the soft delete tombstone.
+func (dao *DAO) addEdgeQuery() string {
+	if dao.softDelete {
+		return `INSERT into edges as e (sourceid, sourcekind, destid, destkind, edgetype, cluster, properties)
+		values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype)
+		DO UPDATE SET properties=EXCLUDED.properties, deleted_at=NULL
+		WHERE e.properties IS DISTINCT FROM EXCLUDED.properties OR e.deleted_at IS NOT NULL`
+	}
+	return `INSERT into edges as e (sourceid, sourcekind, destid, destkind, edgetype, cluster, properties)
+		values($1,$2,$3,$4,$5,$6,$7) ON CONFLICT (sourceid, destid, edgetype)
+		DO UPDATE SET properties=EXCLUDED.properties WHERE e.properties IS DISTINCT FROM EXCLUDED.properties`
 }
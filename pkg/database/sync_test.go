@@ -8,7 +8,7 @@ import (
 	"os"
 	"testing"
 
-	"github.com/golang/mock/gomock"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/model"
 	"github.com/stolostron/search-indexer/pkg/testutils"
 	"github.com/stretchr/testify/assert"
@@ -20,8 +20,9 @@ func Test_SyncData(t *testing.T) {
 	dao.batchSize = 1
 
 	// Mock PosgreSQL calls
-	br := &testutils.MockBatchResults{}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(7)
+	for _, statement := range simpleSyncStatements() {
+		expectBatchStatements(mockPool, nil, statement)
+	}
 
 	// Prepare Request data
 	data, _ := os.Open("./mocks/simple.json")
@@ -46,12 +47,15 @@ func Test_Sync_With_Exec_Errors(t *testing.T) {
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
 	dao.batchSize = 1
+	dao.deadLetter = true
 
 	// Mock PosgreSQL calls
-	br := &testutils.MockBatchResults{
-		MockErrorOnExec: errors.New("mocking error on exec"),
+	for _, statement := range simpleSyncStatements() {
+		expectBatchStatements(mockPool, errors.New("mocking error on exec"), statement)
 	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(7)
+	// Failed items are saved in the dead letter table.
+	mockPool.ExpectExec("INSERT INTO dead_letter (action, uid, args, error) VALUES ($1, $2, $3, $4)").
+		WithArgs(anyArgs(4)...).WillReturnResult(pgxmock.NewResult("INSERT", 1)).Times(7)
 
 	// Prepare Request data
 	data, _ := os.Open("./mocks/simple.json")
@@ -72,18 +76,16 @@ func Test_Sync_With_Exec_Errors(t *testing.T) {
 	AssertEqual(t, len(response.DeleteErrors), 2, "Incorrect number of DeleteErrors.")
 	AssertEqual(t, len(response.AddEdgeErrors), 1, "Incorrect number of AddEdgeErrors.")
 	AssertEqual(t, len(response.DeleteEdgeErrors), 1, "Incorrect number of DeleteEdgeErrors.")
+	AssertEqual(t, response.BatchFailedItems, 7, "Incorrect number of BatchFailedItems.")
 }
 
 func Test_Sync_With_OnClose_Errors(t *testing.T) {
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
-	dao.batchSize = 1
+	dao.batchSize = 10
 
 	// Mock PosgreSQL calls
-	br := &testutils.MockBatchResults{
-		MockErrorOnClose: errors.New("unexpected EOF"),
-	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(7)
+	expectBatchStatements(mockPool, errors.New("unexpected EOF"), simpleSyncStatements()...)
 
 	// Prepare Request data
 	data, _ := os.Open("./mocks/simple.json")
@@ -100,3 +102,44 @@ func Test_Sync_With_OnClose_Errors(t *testing.T) {
 	// Assert
 	assert.NotNil(t, err)
 }
+
+// Should mark deleted resources and edges with a tombstone instead of deleting the rows.
+func Test_SyncData_softDelete(t *testing.T) {
+	// Prepare a mock DAO instance
+	dao, mockPool := buildMockDAO(t)
+	dao.batchSize = 1
+	dao.softDelete = true
+
+	// Mock PosgreSQL calls
+	uid := "local-cluster/e12c2ddd-4ac5-499d-b0e0-20242f508afd"
+	statements := simpleSyncStatements()
+	statements[3] = batchStatement{
+		sql:  "UPDATE resources SET deleted_at=now() WHERE uid IN ($1) AND deleted_at IS NULL",
+		args: []interface{}{uid}}
+	statements[4] = batchStatement{
+		sql:  "UPDATE edges SET deleted_at=now() WHERE (sourceId IN ($1) OR destId IN ($1)) AND deleted_at IS NULL",
+		args: []interface{}{uid}}
+	statements[5].sql = "INSERT into edges as e " +
+		"(sourceid, sourcekind, destid, destkind, edgetype, cluster, properties) values($1,$2,$3,$4,$5,$6,$7) " +
+		"ON CONFLICT (sourceid, destid, edgetype) DO UPDATE SET properties=EXCLUDED.properties, deleted_at=NULL " +
+		"WHERE e.properties IS DISTINCT FROM EXCLUDED.properties OR e.deleted_at IS NOT NULL"
+	statements[6].sql = "UPDATE edges SET deleted_at=now() " +
+		"WHERE sourceId=$1 AND destId=$2 AND edgeType=$3 AND deleted_at IS NULL"
+	for _, statement := range statements {
+		expectBatchStatements(mockPool, nil, statement)
+	}
+
+	// Prepare Request data
+	data, _ := os.Open("./mocks/simple.json")
+	var syncEvent model.SyncEvent
+	json.NewDecoder(data).Decode(&syncEvent) //nolint: errcheck
+
+	// Execute test
+	response := &model.SyncResponse{}
+	err := dao.SyncData(context.Background(), syncEvent, "test-cluster", response)
+
+	// Assert
+	assert.Nil(t, err)
+	AssertEqual(t, response.TotalDeleted, 1, "Incorrect number of resources deleted.")
+	AssertEqual(t, response.TotalEdgesDeleted, 1, "Incorrect number of edges deleted.")
+}
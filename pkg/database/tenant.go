@@ -0,0 +1,30 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+// Tenant schema.
+// Multiple hubs can share one Postgres instance by storing each hub in its own schema, set with DB_SCHEMA.
+// The queries and migrations don't qualify the search objects with the schema. Each connection sets its search_path
+// to the tenant schema, see initializePool(), so Postgres resolves the objects in the tenant schema. The extensions
+// are installed in the public schema, shared by all tenants. The setting parameters like search.resource_history
+// aren't schema objects, so they're shared by all tenants too.
+// The search_path is a connection parameter, so a pgbouncer in front of Postgres must use session pooling, or
+// one pool per tenant, when the hubs share the database.
+
+const defaultSchema = "search"
+
+// Returns the search_path for the connections to the tenant schema.
+func searchPath(schema string) string {
+	if schema == "" {
+		schema = defaultSchema
+	}
+	return schema + ", public"
+}
+
+// Returns the schema with the search tables.
+func (dao *DAO) tenantSchema() string {
+	if dao.schema == "" {
+		return defaultSchema
+	}
+	return dao.schema
+}
@@ -0,0 +1,77 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Matches the objects created or changed by a statement, and the objects it references.
+var migrationObjectRegex = regexp.MustCompile(`(?i)\b(?:CREATE(?:\s+OR\s+REPLACE)?(?:\s+UNIQUE)?\s+` +
+	`(?:TABLE|INDEX|FUNCTION|TRIGGER|VIEW|MATERIALIZED\s+VIEW|SEQUENCE|TYPE)(?:\s+CONCURRENTLY)?` +
+	`(?:\s+IF\s+NOT\s+EXISTS)?|ALTER\s+TABLE(?:\s+IF\s+EXISTS)?|DROP\s+(?:TABLE|INDEX|FUNCTION|TRIGGER)` +
+	`(?:\s+IF\s+EXISTS)?|ON|REFERENCES|INSERT\s+INTO|EXECUTE\s+(?:FUNCTION|PROCEDURE))\s+([\w."]+)`)
+
+var sqlCommentRegex = regexp.MustCompile(`--[^\n]*`)
+
+// Returns the objects qualified with a schema in the statements. They aren't resolved with the search_path, so
+// they aren't in the tenant schema.
+func qualifiedObjects(sql string) []string {
+	objects := []string{}
+	for _, match := range migrationObjectRegex.FindAllStringSubmatch(sqlCommentRegex.ReplaceAllString(sql, ""), -1) {
+		if strings.Contains(match[1], ".") {
+			objects = append(objects, match[1])
+		}
+	}
+	return objects
+}
+
+// Should create the objects of all the migrations in the tenant schema.
+func Test_migrations_tenantSchema(t *testing.T) {
+	migrations, err := loadMigrations()
+	assert.Nil(t, err)
+
+	for _, m := range migrations {
+		assert.Empty(t, qualifiedObjects(m.sql), "Migration %d_%s must not qualify the objects with a schema.",
+			m.version, m.name)
+	}
+}
+
+// Should find the objects qualified with a schema.
+func Test_qualifiedObjects(t *testing.T) {
+	assert.Equal(t, []string{"search.new_table"},
+		qualifiedObjects("CREATE TABLE IF NOT EXISTS search.new_table (uid TEXT)"))
+	assert.Equal(t, []string{"search.resources"},
+		qualifiedObjects("CREATE INDEX IF NOT EXISTS new_idx ON search.resources USING btree (cluster)"))
+	assert.Equal(t, []string{"search.set_new"},
+		qualifiedObjects("CREATE TRIGGER new_trigger BEFORE UPDATE ON edges FOR EACH ROW "+
+			"EXECUTE FUNCTION search.set_new()"))
+	assert.Empty(t, qualifiedObjects("-- Copied from search.resources\nCREATE TABLE new_table (uid TEXT)"))
+}
+
+// Should include the public schema with the extensions in the search_path.
+func Test_searchPath(t *testing.T) {
+	assert.Equal(t, "hub_a, public", searchPath("hub_a"))
+	assert.Equal(t, "search, public", searchPath(""))
+}
+
+// Should create the tenant schema before the migrations.
+func Test_migrate_tenantSchema(t *testing.T) {
+	mockPool := testutils.NewMockPool(t)
+	dao := NewDAO(mockPool)
+	dao.schema = "hub_a"
+	mockPool.ExpectExec("CREATE SCHEMA IF NOT EXISTS hub_a").WillReturnError(context.Canceled)
+
+	err := dao.migrate(context.Background())
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "hub_a", dao.tenantSchema())
+	dao.schema = ""
+	assert.Equal(t, "search", dao.tenantSchema())
+}
@@ -3,14 +3,11 @@
 package database
 
 import (
-	"encoding/json"
 	"reflect"
 	"testing"
 
-	"github.com/driftprogramming/pgxpoolmock"
-	"github.com/golang/mock/gomock"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/testutils"
-	"k8s.io/klog/v2"
 )
 
 // AssertEqual checks if values are equal
@@ -22,38 +19,69 @@ func AssertEqual(t *testing.T, a interface{}, b interface{}, message string) {
 }
 
 // Builds a DAO instance with a mock database connection.
-func buildMockDAO(t *testing.T) (DAO, *pgxpoolmock.MockPgxPool) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+func buildMockDAO(t *testing.T) (DAO, pgxmock.PgxPoolIface) {
+	mockPool := testutils.NewMockPool(t)
 	dao := NewDAO(mockPool)
 
 	return dao, mockPool
 }
 
-func newMockRows() *testutils.MockRows {
-	clusterResource := `{"uid":"cluster__name-foo", "data":{"apigroup":"internal.open-cluster-management.io", "consoleURL":"", "cpu":0, "created":"0001-01-01T00:00:00Z", "kind":"Cluster", "kubernetesVersion":"", "memory":0, "name":"name-foo", "nodes":0}}`
-	var columnHeaders []string
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(clusterResource), &data); err != nil {
-		klog.Error("Error unmarshaling mockrows")
-		panic(err)
+// Statement queued in a batch.
+type batchStatement struct {
+	sql  string
+	args []interface{}
+}
+
+// Statements queued by SyncData() for mocks/simple.json, with the whitespace collapsed.
+func simpleSyncStatements() []batchStatement {
+	uid := "local-cluster/e12c2ddd-4ac5-499d-b0e0-20242f508afd"
+	return []batchStatement{
+		{sql: addResourceSQL, args: anyArgs(4)},
+		{sql: addResourceSQL, args: anyArgs(4)},
+		{sql: "UPDATE resources SET data=$2, hash=$3, deleted_at=NULL WHERE uid=$1", args: anyArgs(3)},
+		{sql: "DELETE from resources WHERE uid IN ($1)", args: []interface{}{uid}},
+		{sql: "DELETE from edges WHERE sourceId IN ($1) OR destId IN ($1)", args: []interface{}{uid}},
+		{sql: addEdgeSQL, args: anyArgs(7)},
+		{sql: "DELETE from edges WHERE sourceId=$1 AND destId=$2 AND edgeType=$3", args: anyArgs(3)},
 	}
-	for k := range data {
-		columnHeaders = append(columnHeaders, k)
+}
 
+const addResourceSQL = "INSERT into resources as r (uid, cluster, data, hash) values($1,$2,$3,$4) " +
+	"ON CONFLICT (uid) DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE r.uid=$1 and " +
+	"(r.data IS DISTINCT FROM $3 OR r.hash IS DISTINCT FROM $4 OR r.deleted_at IS NOT NULL)"
+const addEdgeSQL = "INSERT into edges as e " +
+	"(sourceid, sourcekind, destid, destkind, edgetype, cluster, properties) values($1,$2,$3,$4,$5,$6,$7) " +
+	"ON CONFLICT (sourceid, destid, edgetype) DO UPDATE SET properties=EXCLUDED.properties " +
+	"WHERE e.properties IS DISTINCT FROM EXCLUDED.properties"
+
+// Matches any value for each of the args.
+func anyArgs(count int) []interface{} {
+	args := make([]interface{}, count)
+	for i := range args {
+		args[i] = pgxmock.AnyArg()
 	}
-	mockData := make([]map[string]interface{}, 0)
-	mockData = append(mockData, data)
+	return args
+}
 
-	return &testutils.MockRows{
-		MockData:      mockData,
-		Index:         1,
-		ColumnHeaders: columnHeaders,
+// Expects a batch with the statements. The first statement returns the error, or succeeds when nil.
+// The error fails the whole batch, same as the pipelined batch in Postgres.
+func expectBatchStatements(mockPool pgxmock.PgxPoolIface, err error, statements ...batchStatement) {
+	batch := mockPool.ExpectBatch()
+	for i, statement := range statements {
+		exec := batch.ExpectExec(statement.sql).WithArgs(statement.args...)
+		if err != nil && i == 0 {
+			exec.WillReturnError(err)
+		} else {
+			exec.WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}
 	}
 }
 
-func (dao *DAO) Query() (*testutils.MockRows, error) {
-	var e error
-	return newMockRows(), e
+// Expects a batch with the statement, without args, queued size times.
+func expectBatch(mockPool pgxmock.PgxPoolIface, size int, sql string, err error) {
+	statements := make([]batchStatement, size)
+	for i := range statements {
+		statements[i] = batchStatement{sql: sql}
+	}
+	expectBatchStatements(mockPool, err, statements...)
 }
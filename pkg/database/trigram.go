@@ -0,0 +1,58 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+// Trigram index.
+// When TRIGRAM_INDEX is enabled, we install the pg_trgm extension and declare a trigram index on the resource
+// name, so search-api can use substring (ILIKE '%foo%') and typo-tolerant (similarity) searches on the name.
+// The index is reconciled with the INDEX_DEFINITIONS indexes, see indexes.go
+
+var trigramIndex = IndexDefinition{
+	Name:       "data_name_trgm_idx",
+	Table:      "resources",
+	Definition: "USING GIN ((data ->> 'name') gin_trgm_ops)",
+}
+
+// Installs the pg_trgm extension if it's missing. Returns false when the extension isn't installed and the
+// database user doesn't have the privileges to install it. pg_trgm is a trusted extension, so it can be
+// installed by users with the CREATE privilege on the database.
+func (dao *DAO) setupTrigramExtension(ctx context.Context) (bool, error) {
+	rows, err := dao.pool.Query(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm'), "+
+		"has_database_privilege(current_database(), 'CREATE')")
+	if err != nil {
+		return false, fmt.Errorf("Error checking the pg_trgm extension. %w", err)
+	}
+	defer rows.Close()
+
+	var installed, canCreate bool
+	if rows.Next() {
+		err = rows.Scan(&installed, &canCreate)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error checking the pg_trgm extension. %w", err)
+	}
+	if installed {
+		return true, nil
+	}
+	if !canCreate {
+		klog.Warning("Skipping the trigram index because the pg_trgm extension isn't installed and the database " +
+			"user doesn't have the CREATE privilege to install it.")
+		return false, nil
+	}
+
+	klog.Info("Installing the pg_trgm extension.")
+	if _, err = dao.pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public"); err != nil {
+		return false, fmt.Errorf("Error installing the pg_trgm extension. %w", err)
+	}
+	return true, nil
+}
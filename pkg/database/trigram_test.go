@@ -0,0 +1,64 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockTrigramCheck(mockPool pgxmock.PgxPoolIface, installed, canCreate bool) {
+	rows := pgxmock.NewRows([]string{"installed", "can_create"}).AddRow(installed, canCreate)
+	mockPool.ExpectQuery("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE " +
+		"extname = 'pg_trgm'), has_database_privilege(current_database(), 'CREATE')").WillReturnRows(rows)
+}
+
+// Should install the extension when it's missing and the user has the privilege.
+func Test_setupTrigramExtension_install(t *testing.T) {
+	dao, mockPool := buildMockDAO(t)
+	mockTrigramCheck(mockPool, false, true)
+	mockPool.ExpectExec("CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public").WillReturnResult(pgxmock.NewResult("CREATE", 0))
+
+	available, err := dao.setupTrigramExtension(context.Background())
+
+	assert.Nil(t, err)
+	assert.True(t, available)
+}
+
+// Should skip the index when the extension is missing and the user can't install it.
+func Test_setupTrigramExtension_noPrivilege(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	dao, mockPool := buildMockDAO(t)
+	mockTrigramCheck(mockPool, false, false)
+
+	available, err := dao.setupTrigramExtension(context.Background())
+
+	assert.Nil(t, err)
+	assert.False(t, available)
+}
+
+// Should create the trigram index when the extension is installed.
+func Test_reconcileIndexes_trigramIndex(t *testing.T) {
+	originalTrigram := config.Cfg.TrigramIndex
+	defer func() { config.Cfg.TrigramIndex = originalTrigram }()
+	config.Cfg.TrigramIndex = true
+	dao, mockPool := buildMockDAO(t)
+
+	mockPool.ExpectQuery(existingIndexesSql).WithArgs(managedIndexComment).
+		WillReturnRows(pgxmock.NewRows([]string{"relname", "indisvalid", "managed"}))
+	mockTrigramCheck(mockPool, true, false)
+	mockPool.ExpectExec("CREATE INDEX CONCURRENTLY IF NOT EXISTS data_name_trgm_idx " +
+		"ON resources USING GIN ((data ->> 'name') gin_trgm_ops)").
+		WillReturnResult(pgxmock.NewResult("CREATE", 0))
+	mockPool.ExpectExec("COMMENT ON INDEX data_name_trgm_idx IS 'Managed by search-indexer INDEX_DEFINITIONS.'").
+		WillReturnResult(pgxmock.NewResult("COMMENT", 0))
+
+	err := dao.reconcileIndexes(context.Background())
+
+	assert.Nil(t, err)
+}
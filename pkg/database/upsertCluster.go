@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/doug-martin/goqu/v9"
-	"github.com/doug-martin/goqu/v9/exp"
-	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v5"
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stolostron/search-indexer/pkg/model"
 	"k8s.io/klog/v2"
 )
@@ -24,10 +26,12 @@ func (dao *DAO) DeleteClusterAndResources(ctx context.Context, clusterName strin
 	}
 
 	if deleteClusterNode {
+		clearPendingCluster(clusterUID)
+		forgetClusterSyncWrite(clusterName)
+		// Delete cluster from existing clusters cache
+		DeleteClustersCache(clusterUID)
 		if err := dao.deleteWithRetry(dao.DeleteClusterTxn, ctx, clusterUID); err == nil {
 			klog.V(2).Infof("Successfully deleted cluster node %s from database!", clusterName)
-			// Delete cluster from existing clusters cache
-			DeleteClustersCache(clusterUID)
 		}
 	}
 }
@@ -47,7 +51,10 @@ func (dao *DAO) deleteWithRetry(deleteFunction func(context.Context, string) err
 			waitMS := int(math.Min(float64(retry*500), float64(cfg.MaxBackoffMS)))
 			timetoSleep := time.Duration(waitMS) * time.Millisecond
 			retry++
-			klog.Errorf("Unable to process cluster delete transaction: %+v. Retry in %s\n", err, timetoSleep)
+			logging.SampledErrorf("Unable to process cluster delete transaction: %+v. Retry in %s\n", err, timetoSleep)
+			if retry == clusterFailureAttempts {
+				reportClusterFailure(strings.TrimPrefix(clusterName, "cluster__"), "ClusterDeleteFailed", err)
+			}
 			time.Sleep(timetoSleep)
 		} else {
 			break
@@ -61,9 +68,9 @@ func (dao *DAO) DeleteClusterResourcesTxn(ctx context.Context, clusterName strin
 	var rowsDeleted, resourcesDeleted, edgesDeleted int64
 
 	defer func() {
-		// Log a warning if delete is too slow.
-		// Note the 100ms is just an initial guess, we should adjust based on normal execution time.
-		if time.Since(start) > 100*time.Millisecond {
+		// Log a warning if delete is slower than the SLOW_LOG time.
+		metrics.DBOperationDuration.WithLabelValues("deleteCluster").Observe(time.Since(start).Seconds())
+		if time.Since(start) > metrics.DefaultSlowLog() {
 			klog.Warningf("Delete of %s took %s. Resources Deleted: %d, Edges Deleted: %d, Total RowsDeleted: %d",
 				clusterName, time.Since(start), resourcesDeleted, edgesDeleted, rowsDeleted)
 			return
@@ -71,6 +78,8 @@ func (dao *DAO) DeleteClusterResourcesTxn(ctx context.Context, clusterName strin
 		klog.V(4).Infof("Delete of %s took %s. Resources Deleted: %d, Edges Deleted: %d, Total RowsDeleted: %d",
 			clusterName, time.Since(start), resourcesDeleted, edgesDeleted, rowsDeleted)
 	}()
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
 	tx, txErr := dao.pool.BeginTx(ctx, pgx.TxOptions{})
 	if txErr != nil {
 		klog.Error("Error while beginning transaction block for deleting cluster ", clusterName)
@@ -88,7 +97,7 @@ func (dao *DAO) DeleteClusterResourcesTxn(ctx context.Context, clusterName strin
 
 		if res, err := tx.Exec(ctx, sql, args...); err != nil {
 			checkErrorAndRollback(err,
-				fmt.Sprintf("Error deleting resources from search.resources for clusterName %s.", clusterName), tx, ctx)
+				fmt.Sprintf("Error deleting resources from resources for clusterName %s.", clusterName), tx, ctx)
 			return err
 		} else {
 			resourcesDeleted = res.RowsAffected()
@@ -104,7 +113,7 @@ func (dao *DAO) DeleteClusterResourcesTxn(ctx context.Context, clusterName strin
 		// Delete edges for cluster from DB
 		if res, err := tx.Exec(ctx, sql, args...); err != nil {
 			checkErrorAndRollback(err,
-				fmt.Sprintf("Error deleting edges from search.edges for clusterName %s.", clusterName), tx, ctx)
+				fmt.Sprintf("Error deleting edges from edges for clusterName %s.", clusterName), tx, ctx)
 			return err
 		} else {
 			edgesDeleted = res.RowsAffected()
@@ -116,6 +125,9 @@ func (dao *DAO) DeleteClusterResourcesTxn(ctx context.Context, clusterName strin
 				fmt.Sprintf("Error committing delete cluster transaction for cluster: %s.", clusterName), tx, ctx)
 			return err
 		}
+		invalidateTotals(clusterName)
+		metrics.ClusterDeleteRows.WithLabelValues("resources").Add(float64(resourcesDeleted))
+		metrics.ClusterDeleteRows.WithLabelValues("edges").Add(float64(edgesDeleted))
 	}
 	return nil
 }
@@ -130,15 +142,17 @@ func (dao *DAO) DeleteClusterTxn(ctx context.Context, clusterUID string) error {
 	// Delete cluster node from DB.
 
 	// Create the query
-	sql, args, err := goquDelete("resources", "uid", clusterUID)
+	sql, args, err := goquDelete("clusters", "uid", clusterUID)
 	checkError(err, fmt.Sprintf("Error creating query to delete clusterNode for %s.", clusterUID))
 	if err != nil {
 		return err
 	}
 	klog.V(4).Infof("Query to delete clusterNode for %s - sql: %s args: %+v", clusterUID, sql, args)
 
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
 	if res, err := dao.pool.Exec(ctx, sql, args...); err != nil {
-		checkError(err, fmt.Sprintf("Error deleting cluster %s from search.resources.", clusterUID))
+		checkError(err, fmt.Sprintf("Error deleting cluster %s from clusters.", clusterUID))
 		return err
 	} else {
 		rowsDeleted = res.RowsAffected()
@@ -149,23 +163,29 @@ func (dao *DAO) DeleteClusterTxn(ctx context.Context, clusterUID string) error {
 func (dao *DAO) UpsertCluster(ctx context.Context, resource model.Resource) {
 	data, _ := json.Marshal(resource.Properties)
 	clusterName := resource.Properties["name"].(string)
-	sql, args, err := goquInsertUpdate("resources", []interface{}{resource.UID, clusterName, string(data)})
+	sql, args, err := goquUpsertCluster(resource.UID, clusterName, resource.Properties, string(data))
 	checkError(err, fmt.Sprintf("Error creating insert/update cluster query for %s", clusterName))
 	if err != nil {
-		//TO DO: store the pending cluster resource in cache and retry in case of error
 		return
 	}
 	klog.V(4).Infof("Query to insert/update cluster for %s - sql: %s args: %+v", clusterName, sql, args)
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
 	// Insert cluster node if cluster does not exist in the DB
 	if !dao.clusterInDB(ctx, resource.UID) || !dao.clusterPropsUpToDate(resource.UID, resource) {
+		slowLog := metrics.SlowDBOperation("upsert", fmt.Sprintf("Slow insert/update of cluster %s.", clusterName))
 		_, err := dao.pool.Exec(ctx, sql, args...)
+		slowLog()
 		if err != nil {
 			klog.Warningf("Error inserting/updating cluster with query %s, %s: %s ", sql, clusterName, err.Error())
+			dao.retryUpsertCluster(resource, err) // See pendingClusters.go
 		} else {
 			UpdateClustersCache(resource.UID, resource.Properties)
+			clearPendingCluster(resource.UID)
 		}
 	} else {
 		klog.V(4).Infof("Cluster %s already exists in DB and properties are up to date.", clusterName)
+		clearPendingCluster(resource.UID)
 		return
 	}
 
@@ -177,8 +197,8 @@ func (dao *DAO) clusterInDB(ctx context.Context, clusterUID string) bool {
 		klog.V(3).Infof("Cluster [%s] is not in existingClustersCache. Updating cache with latest state from database.",
 			clusterUID)
 
-		// Create the query
-		sql, args, err := goqu.From(goqu.S("search").Table("resources")).
+		// Create the query. Use a prepared statement so the query is parsed once per connection.
+		sql, args, err := goqu.Dialect("postgres").From(goqu.T("clusters")).Prepared(true).
 			Select(goqu.C("uid"), goqu.C("data")).
 			Where(goqu.C("uid").Eq(clusterUID)).ToSQL()
 		if err != nil {
@@ -189,7 +209,7 @@ func (dao *DAO) clusterInDB(ctx context.Context, clusterUID string) bool {
 			clusterUID, sql, args)
 		rows, err := dao.pool.Query(ctx, sql, args...)
 		if err != nil {
-			klog.Errorf("Error while fetching cluster %s from database: %s", clusterUID, err.Error())
+			logging.SampledErrorf("Error while fetching cluster %s from database: %s", clusterUID, err.Error())
 			return false // insert/update the cluster node in db
 		}
 
@@ -241,52 +261,70 @@ func (dao *DAO) clusterPropsUpToDate(clusterUID string, resource model.Resource)
 
 // Create a goqu query to delete a row.
 // Sample query:
-//   DELETE from <tableName> WHERE <columnName> = '<arg>' AND uid != 'cluster__<arg>'
+//   DELETE from <tableName> WHERE <columnName> = '<arg>'
 func goquDelete(tableName, columnName, arg string) (string, []interface{}, error) {
-	var whereDs []exp.Expression
-	whereDs = append(whereDs, goqu.C(columnName).Eq(arg))
-	if columnName == "cluster" && tableName == "resources" {
-		whereDs = append(whereDs, goqu.C("uid").Neq(string("cluster__"+arg))) // do not delete the cluster node
-	}
-
 	// Create the query
 	sql, args, err := goqu.From(
-		goqu.S("search").Table(tableName)).
+		goqu.T(tableName)).
 		Delete().
-		Where(whereDs...).ToSQL()
+		Where(goqu.C(columnName).Eq(arg)).ToSQL()
 	return sql, args, err
 }
 
-// Create the upsert query
-// query := "INSERT INTO search.resources as r (uid, cluster, data) values($1,'',$2)
-// ON CONFLICT (uid) DO UPDATE SET data=$2 WHERE r.uid=$1"
-func goquInsertUpdate(tableName string, args []interface{}) (string, []interface{}, error) {
+// Create the upsert query for the cluster node.
+// query := "INSERT INTO search.clusters as c (uid, name, console_url, status, kubernetes_version, data)
+// values($1,$2,$3,$4,$5,$6) ON CONFLICT (uid) DO UPDATE SET name=$2, console_url=$3, ... WHERE c.uid=$1"
+func goquUpsertCluster(uid, name string, props map[string]interface{}, data string) (string, []interface{},
+	error) {
+	columns := goqu.Record{
+		"name":               name,
+		"console_url":        clusterProperty(props, "consoleURL"),
+		"status":             clusterProperty(props, "ManagedClusterConditionAvailable"),
+		"kubernetes_version": clusterProperty(props, "kubernetesVersion"),
+		"data":               data,
+	}
+	row := goqu.Record{"uid": uid}
+	for key, val := range columns {
+		row[key] = val
+	}
+	columns["data"] = goqu.L(keepClusterSyncPropsSql) // See clusterSyncProps.go
 	sql, args, err := goqu.From(
-		goqu.S("search").Table(tableName).As("r")).
+		goqu.T("clusters").As("c")).
 		Insert().
-		Rows(goqu.Record{"uid": args[0], "cluster": args[1], "data": args[2]}).
-		OnConflict(goqu.DoUpdate("uid",
-			goqu.C("data").Set(args[2])).
-			Where(goqu.L(`"r".uid`).Eq(args[0]))).ToSQL()
+		Rows(row).
+		OnConflict(goqu.DoUpdate("uid", columns).
+			Where(goqu.L(`"c".uid`).Eq(uid))).ToSQL()
 
 	return sql, args, err
 }
 
+// Returns the cluster property as a string, or nil if the property isn't set.
+func clusterProperty(props map[string]interface{}, key string) interface{} {
+	if val, ok := props[key]; ok && val != nil {
+		return fmt.Sprint(val)
+	}
+	return nil
+}
+
 // Query database for managed clusters:
 func (dao *DAO) GetManagedClusters(ctx context.Context) ([]string, error) {
 
-	schemaTable := goqu.S("search").Table("resources")
+	schemaTable := goqu.T("resources")
 	ds := goqu.From(schemaTable)
 	var managedClusters []string
 
-	//select distinct cluster from search.resources;
-	query, params, err := ds.Select("cluster").Distinct().ToSQL()
+	// Clusters with resources or a cluster node.
+	// select cluster from search.resources union select name from search.clusters;
+	query, params, err := ds.Select("cluster").
+		Union(goqu.From(goqu.T("clusters")).Select("name")).ToSQL()
 	if err != nil {
 		klog.Errorf("Error building select distinct cluster query: %s", err.Error())
 		return nil, err
 	}
 	klog.V(4).Infof("Query database for managed clusters: [%s] ", query)
 
+	ctx, cancel := dao.withTimeout(ctx)
+	defer cancel()
 	rows, err := dao.pool.Query(ctx, query, params...)
 	if err != nil {
 		klog.Errorf("Error resolving managed clusters query [%s] with params [%+v]. Error: [%+v]", query, params, err)
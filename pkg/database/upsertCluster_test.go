@@ -7,20 +7,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"regexp"
 	"testing"
 
-	"github.com/driftprogramming/pgxpoolmock"
-	"github.com/golang/mock/gomock"
-	"github.com/jackc/pgconn"
-	pgx "github.com/jackc/pgx/v4"
-	"github.com/pashagolub/pgxmock"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/model"
 )
 
 var clusterProps map[string]interface{}
 var existingCluster map[string]interface{}
-var retryDel int
 
 func initializeVars() {
 	clusterProps = map[string]interface{}{
@@ -74,17 +69,11 @@ func Test_UpsertCluster_Update1(t *testing.T) {
 	currCluster := model.Resource{Kind: existingCluster["Kind"].(string), UID: existingCluster["UID"].(string), Properties: tmpProps}
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
-	mrows := newMockRows()
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT "uid", "data" FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(mrows, nil)
+	mockPool.ExpectQuery(`SELECT "uid", "data" FROM "clusters" WHERE ("uid" = $1)`).
+		WithArgs("cluster__name-foo").WillReturnRows(pgxmock.NewRows([]string{"uid", "data"}))
 	expectedProps, _ := json.Marshal(currCluster.Properties)
-	sql := fmt.Sprintf(`INSERT INTO "search"."resources" AS "r" ("cluster", "data", "uid") VALUES ('name-foo', '%[1]s', '%[2]s') ON CONFLICT (uid) DO UPDATE SET "data"='%[1]s' WHERE ("r".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(sql),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	sql := fmt.Sprintf(`INSERT INTO "clusters" AS "c" ("console_url", "data", "kubernetes_version", "name", "status", "uid") VALUES ('', '%[1]s', '', 'name-foo', NULL, '%[2]s') ON CONFLICT (uid) DO UPDATE SET "console_url"='',"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object('lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', "c".data->'searchDataStale')),"kubernetes_version"='',"name"='name-foo',"status"=NULL WHERE ("c".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
+	mockPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 	// Execute function test.
 	dao.UpsertCluster(context.Background(), currCluster)
@@ -121,18 +110,12 @@ func Test_UpsertCluster_Update2(t *testing.T) {
 	existingClustersCache = make(map[string]interface{})
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
-	mrows := newMockRows()
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT "uid", "data" FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(mrows, nil)
+	mockPool.ExpectQuery(`SELECT "uid", "data" FROM "clusters" WHERE ("uid" = $1)`).
+		WithArgs("cluster__name-foo").WillReturnRows(pgxmock.NewRows([]string{"uid", "data"}))
 	expectedProps, _ := json.Marshal(currCluster.Properties)
 
-	sql := fmt.Sprintf(`INSERT INTO "search"."resources" AS "r" ("cluster", "data", "uid") VALUES ('name-foo', '%[1]s', '%[2]s') ON CONFLICT (uid) DO UPDATE SET "data"='%[1]s' WHERE ("r".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(sql),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	sql := fmt.Sprintf(`INSERT INTO "clusters" AS "c" ("console_url", "data", "kubernetes_version", "name", "status", "uid") VALUES ('', '%[1]s', '', 'name-foo', NULL, '%[2]s') ON CONFLICT (uid) DO UPDATE SET "console_url"='',"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object('lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', "c".data->'searchDataStale')),"kubernetes_version"='',"name"='name-foo',"status"=NULL WHERE ("c".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
+	mockPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 	// Execute function test.
 	dao.UpsertCluster(context.Background(), currCluster)
@@ -169,17 +152,12 @@ func Test_UpsertCluster_Insert(t *testing.T) {
 	dao, mockPool := buildMockDAO(t)
 	//Clear cluster cache
 	existingClustersCache = make(map[string]interface{})
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT "uid", "data" FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool.ExpectQuery(`SELECT "uid", "data" FROM "clusters" WHERE ("uid" = $1)`).
+		WithArgs("cluster__name-foo").WillReturnRows(pgxmock.NewRows([]string{"uid", "data"}))
 	expectedProps, _ := json.Marshal(currCluster.Properties)
 
-	sql := fmt.Sprintf(`INSERT INTO "search"."resources" AS "r" ("cluster", "data", "uid") VALUES ('name-foo', '%[1]s', '%[2]s') ON CONFLICT (uid) DO UPDATE SET "data"='%[1]s' WHERE ("r".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(sql),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	sql := fmt.Sprintf(`INSERT INTO "clusters" AS "c" ("console_url", "data", "kubernetes_version", "name", "status", "uid") VALUES ('', '%[1]s', '', 'name-foo', NULL, '%[2]s') ON CONFLICT (uid) DO UPDATE SET "console_url"='',"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object('lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', "c".data->'searchDataStale')),"kubernetes_version"='',"name"='name-foo',"status"=NULL WHERE ("c".uid = '%[2]s')`, string(expectedProps), "cluster__name-foo")
+	mockPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	// Execute function test.
 	dao.UpsertCluster(context.Background(), currCluster)
 	AssertEqual(t, len(existingClustersCache), 1, "existingClustersCache should have length of 1")
@@ -202,10 +180,8 @@ func Test_clusterInDB_QueryErr(t *testing.T) {
 
 	// Prepare a mock DAO instance
 	dao, mockPool := buildMockDAO(t)
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT "uid", "data" FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo1')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, errors.New("Error fetching data"))
+	mockPool.ExpectQuery(`SELECT "uid", "data" FROM "clusters" WHERE ("uid" = $1)`).
+		WithArgs("cluster__name-foo1").WillReturnError(errors.New("Error fetching data"))
 	// Execute function test.
 	ok := dao.clusterInDB(context.Background(), "cluster__name-foo1")
 	AssertEqual(t, ok, false, "existingClustersCache should not have an entry for cluster foo1")
@@ -218,17 +194,12 @@ func Test_DelClusterResources(t *testing.T) {
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	UpdateClustersCache("cluster__name-foo", nil)
 
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer mockConn.Close(context.Background())
 	dao, mockPool := buildMockDAO(t)
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Return(mockConn, nil)
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(`DELETE FROM "resources" WHERE ("cluster" = 'name-foo')`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectExec(`DELETE FROM "edges" WHERE ("cluster" = 'name-foo')`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
 
-	mockConn.ExpectCommit()
+	mockPool.ExpectCommit()
 	// Execute function test.
 	dao.DeleteClusterAndResources(context.Background(), clusterName, false)
 
@@ -243,22 +214,15 @@ func Test_DelCluster(t *testing.T) {
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	UpdateClustersCache("cluster__name-foo", nil)
 
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer mockConn.Close(context.Background())
 	dao, mockPool := buildMockDAO(t)
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Return(mockConn, nil)
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(`DELETE FROM "resources" WHERE ("cluster" = 'name-foo')`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectExec(`DELETE FROM "edges" WHERE ("cluster" = 'name-foo')`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
 
-	mockConn.ExpectCommit()
+	mockPool.ExpectCommit()
 
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(`DELETE FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool.ExpectExec(`DELETE FROM "clusters" WHERE ("uid" = 'cluster__name-foo')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
 
 	// Execute function test.
 	dao.DeleteClusterAndResources(context.Background(), clusterName, true)
@@ -275,53 +239,21 @@ func Test_DelClusterResourcesError(t *testing.T) {
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	UpdateClustersCache("cluster__name-foo", nil)
 
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer mockConn.Close(context.Background())
 	dao, mockPool := buildMockDAO(t)
 
-	// Delete cluster resources and edges
-	retryDel = 0 //count to keep track of failures/executions
-
 	// Expect BeginTx to be called twice. First time, return error. Second time, return success.
-	mockPool.EXPECT().BeginTx(context.Background(), pgx.TxOptions{}).Times(2).
-		DoAndReturn(func(con context.Context, txo pgx.TxOptions) (pgxmock.PgxConnIface, error) {
-
-			if retryDel == 0 { // First try to begin transaction
-				retryDel++
-				return mockConn, errors.New("error deleting cluster resources from resources table") //return error
-			} else {
-				retryDel = 0         //reset retryDel
-				return mockConn, nil //return no error
-			}
-		})
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."resources" WHERE (("cluster" = 'name-foo') AND ("uid" != 'cluster__name-foo'))`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-	mockConn.ExpectExec(regexp.QuoteMeta(`DELETE FROM "search"."edges" WHERE ("cluster" = 'name-foo')`)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
-
-	mockConn.ExpectCommit()
-
-	mockPool.EXPECT().Exec(gomock.Any(),
-		gomock.Eq(`DELETE FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{}),
-	).Return(nil, nil)
+	mockPool.ExpectBeginTx(pgx.TxOptions{}).WillReturnError(errors.New("error deleting cluster resources from resources table"))
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(`DELETE FROM "resources" WHERE ("cluster" = 'name-foo')`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mockPool.ExpectExec(`DELETE FROM "edges" WHERE ("cluster" = 'name-foo')`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	mockPool.ExpectCommit()
 
 	// Expect deletecluster to be called twice. First time, return error. Second time, return success.
-	mockPool.EXPECT().Exec(context.Background(),
-		gomock.Eq(`DELETE FROM "search"."resources" WHERE ("uid" = 'cluster__name-foo')`),
-		gomock.Eq([]interface{}{})).
-		Times(2). //expect it to be called twice
-		DoAndReturn(func(con context.Context, sql string, clusterUID string) (pgconn.CommandTag, error) {
-
-			if retryDel == 0 { // First try to delete cluster
-				retryDel++
-				return nil, errors.New("error deleting cluster from resources")
-			} else {
-				retryDel = 0 //reset retryDel
-				return nil, nil
-			}
-		})
+	mockPool.ExpectExec(`DELETE FROM "clusters" WHERE ("uid" = 'cluster__name-foo')`).
+		WillReturnError(errors.New("error deleting cluster from resources"))
+	mockPool.ExpectExec(`DELETE FROM "clusters" WHERE ("uid" = 'cluster__name-foo')`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
 	// Execute function test.
 	dao.DeleteClusterAndResources(context.Background(), clusterName, true)
 
@@ -337,19 +269,12 @@ func Test_GetManagedCluster(t *testing.T) {
 	//Ensure there is an entry for cluster_foo in the cluster cache
 	UpdateClustersCache("cluster__name-foo", nil)
 
-	mockConn, err := pgxmock.NewConn()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer mockConn.Close(context.Background())
 	dao, mockPool := buildMockDAO(t)
 	columns := []string{"cluster"}
-	pgxRows := pgxpoolmock.NewRows(columns).AddRow(clusterName).ToPgxRows()
+	pgxRows := pgxmock.NewRows(columns).AddRow(clusterName)
 
-	mockPool.EXPECT().Query(gomock.Any(),
-		gomock.Eq(`SELECT DISTINCT "cluster" FROM "search"."resources"`),
-		gomock.Eq([]interface{}{}),
-	).Return(pgxRows, nil)
+	mockPool.ExpectQuery(`SELECT "cluster" FROM "resources" UNION (SELECT "name" FROM "clusters")`).
+		WillReturnRows(pgxRows)
 
 	// Execute function test.
 	mc, _ := dao.GetManagedClusters(context.Background())
@@ -359,3 +284,21 @@ func Test_GetManagedCluster(t *testing.T) {
 
 	}
 }
+
+// Should set the cluster columns from the cluster properties.
+func Test_goquUpsertCluster(t *testing.T) {
+	props := map[string]interface{}{"name": "name-foo", "consoleURL": "https://console.name-foo",
+		"ManagedClusterConditionAvailable": "True", "kubernetesVersion": "v1.27.6"}
+
+	sql, _, err := goquUpsertCluster("cluster__name-foo", "name-foo", props, `{"name":"name-foo"}`)
+
+	AssertEqual(t, err, nil, "goquUpsertCluster should not return an error")
+	AssertEqual(t, sql, `INSERT INTO "clusters" AS "c" `+
+		`("console_url", "data", "kubernetes_version", "name", "status", "uid") VALUES `+
+		`('https://console.name-foo', '{"name":"name-foo"}', 'v1.27.6', 'name-foo', 'True', 'cluster__name-foo') `+
+		`ON CONFLICT (uid) DO UPDATE SET "console_url"='https://console.name-foo',`+
+		`"data"=EXCLUDED.data || jsonb_strip_nulls(jsonb_build_object(`+
+		`'lastSyncTime', "c".data->'lastSyncTime', 'collectorVersion', "c".data->'collectorVersion', 'searchDataStale', "c".data->'searchDataStale')),`+
+		`"kubernetes_version"='v1.27.6',"name"='name-foo',"status"='True' WHERE ("c".uid = 'cluster__name-foo')`,
+		"goquUpsertCluster should set the cluster columns")
+}
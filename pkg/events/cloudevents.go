@@ -0,0 +1,93 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+)
+
+// CloudEvents.
+// The change records are CloudEvents 1.0 in the structured JSON format, so the consumers can read them with the
+// CloudEvents SDKs instead of parsing a custom shape. Every EVENT_TRANSPORT carries the same events.
+//   - id: the id of the change when it has one, otherwise a random id. Unique for the source.
+//   - source: /open-cluster-management/search-indexer/<POD_NAMESPACE>, with /<DB_SCHEMA> when the database is
+//     shared by several hubs.
+//   - type: io.open-cluster-management.search.resource.added, .resource.updated, .resource.deleted, or
+//     .cluster.resynced when the consumers must read the whole cluster again.
+//   - subject: <cluster>/<uid>, or <cluster> for cluster.resynced.
+//   - time: when the change was written, RFC3339.
+//   - data: {"cluster":"<cluster>","action":"add|update|delete|resync","uid":"<uid>","kind":"<kind>",
+//     "properties":{}}
+// The transports send the events with the ContentType, application/cloudevents+json, when they support headers.
+
+const (
+	ContentType = "application/cloudevents+json"
+
+	specVersion = "1.0"
+	typePrefix  = "io.open-cluster-management.search."
+)
+
+var eventTypes = map[string]string{
+	"add":    typePrefix + "resource.added",
+	"update": typePrefix + "resource.updated",
+	"delete": typePrefix + "resource.deleted",
+	"resync": typePrefix + "cluster.resynced",
+}
+
+// A resource change, the data of the CloudEvent.
+type Change struct {
+	ID         int64                  `json:"-"` // Stable id of the change, for example the outbox id. 0 if not set.
+	Cluster    string                 `json:"cluster"`
+	Action     string                 `json:"action"`
+	UID        string                 `json:"uid,omitempty"`
+	Kind       string                 `json:"kind,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Time       string                 `json:"-"` // Set in the envelope.
+}
+
+type CloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject"`
+	Time            string `json:"time"`
+	DataContentType string `json:"datacontenttype"`
+	Data            Change `json:"data"`
+}
+
+// Returns the source of the events published by this indexer.
+func Source() string {
+	source := "/open-cluster-management/search-indexer/" + config.Cfg.PodNamespace
+	if config.Cfg.DBSchema != "" && config.Cfg.DBSchema != "search" {
+		source += "/" + config.Cfg.DBSchema
+	}
+	return source
+}
+
+// Wraps the change in the CloudEvents envelope.
+func NewCloudEvent(source string, change Change) CloudEvent {
+	event := CloudEvent{
+		SpecVersion:     specVersion,
+		ID:              strconv.FormatInt(change.ID, 10),
+		Source:          source,
+		Type:            eventTypes[change.Action],
+		Subject:         change.Cluster,
+		Time:            change.Time,
+		DataContentType: "application/json",
+		Data:            change,
+	}
+	if change.ID == 0 {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		event.ID = hex.EncodeToString(id)
+	}
+	if change.UID != "" {
+		event.Subject += "/" + change.UID
+	}
+	return event
+}
@@ -0,0 +1,43 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should wrap the change in a structured CloudEvent.
+func Test_NewCloudEvent(t *testing.T) {
+	event := NewCloudEvent("/open-cluster-management/search-indexer/ocm", Change{ID: 12, Cluster: "cluster-a",
+		Action: "update", UID: "uid-1", Kind: "Pod", Time: "2024-05-01T10:00:00Z"})
+
+	encoded, err := json.Marshal(event)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"specversion":"1.0","id":"12","source":"/open-cluster-management/search-indexer/ocm",
+		"type":"io.open-cluster-management.search.resource.updated","subject":"cluster-a/uid-1",
+		"time":"2024-05-01T10:00:00Z","datacontenttype":"application/json",
+		"data":{"cluster":"cluster-a","action":"update","uid":"uid-1","kind":"Pod"}}`, string(encoded))
+}
+
+// Should publish a resync as cluster.resynced, with a random id without a change id.
+func Test_NewCloudEvent_resync(t *testing.T) {
+	event := NewCloudEvent("/test", Change{Cluster: "cluster-a", Action: "resync"})
+	other := NewCloudEvent("/test", Change{Cluster: "cluster-a", Action: "resync"})
+
+	assert.Equal(t, "io.open-cluster-management.search.cluster.resynced", event.Type)
+	assert.Equal(t, "cluster-a", event.Subject)
+	assert.Len(t, event.ID, 32)
+	assert.NotEqual(t, event.ID, other.ID)
+}
+
+// Should add the tenant schema to the source.
+func Test_Source(t *testing.T) {
+	config.Cfg.PodNamespace, config.Cfg.DBSchema = "ocm", "hub_a"
+	defer func() { config.Cfg.PodNamespace, config.Cfg.DBSchema = "open-cluster-management", "search" }()
+
+	assert.Equal(t, "/open-cluster-management/search-indexer/ocm/hub_a", Source())
+}
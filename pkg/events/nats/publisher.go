@@ -0,0 +1,145 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"k8s.io/klog/v2"
+)
+
+// NATS JetStream transport.
+// With EVENT_TRANSPORT=nats, the change records are published to NATS_SUBJECT instead of Kafka, for deployments
+// that standardize on NATS. The subjects must be captured by a JetStream stream created by the administrator.
+//   - The server is NATS_URL, with nats:// or tls://. NATS_CA_CERT verifies the server certificate, and
+//     NATS_USER and NATS_PASS authenticate the connection.
+//   - A message is the CloudEvent of the record, with the Content-Type header. The key is sent in the Search-Key
+//     header, and the event id in the Nats-Msg-Id header. With NATS_OUTBOX, the event id is the outbox id, so
+//     JetStream drops the changes published again within its duplicate window.
+//   - A batch is retried NATS_MAX_RETRY times, see kafka/producer.go
+// The messages of a batch are published asynchronously with the JetStream API of nats.go, and the publisher waits
+// for JetStream to acknowledge them after they're stored. A message is rejected if JetStream responds with an
+// error, or there isn't a stream capturing the subject. The client reconnects when the connection is lost.
+
+const (
+	publishTimeout = 10 * time.Second
+	keyHeader      = "Search-Key"
+)
+
+// Publishes the records to JetStream. Use NewPublisher().
+type Publisher struct {
+	url     string
+	options []nats.Option
+	mu      sync.Mutex // Protects the connection.
+	conn    *nats.Conn
+	js      jetstream.JetStream
+}
+
+var _ events.Publisher = &Publisher{}
+
+// Creates the publisher with the NATS_* config. Connects to the server with the first batch.
+func NewPublisher() *Publisher {
+	options := []nats.Option{
+		nats.Name("search-indexer"),
+		nats.Timeout(publishTimeout),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				klog.Warningf("Disconnected from NATS. Error: %s", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			klog.Infof("Reconnected to NATS at %s.", conn.ConnectedUrlRedacted())
+		}),
+	}
+	if config.Cfg.NatsUser != "" || config.Cfg.NatsPass != "" {
+		options = append(options, nats.UserInfo(config.Cfg.NatsUser, config.Cfg.NatsPass))
+	}
+	if config.Cfg.NatsCACert != "" {
+		options = append(options, nats.RootCAs(config.Cfg.NatsCACert))
+	}
+	return &Publisher{url: config.Cfg.NatsURL, options: options}
+}
+
+// Publishes the records to the subject and waits for the acks. Returns the number of records rejected.
+func (p *Publisher) Publish(ctx context.Context, subject string, batch []events.Record) (int, error) {
+	js, err := p.jetStream()
+	if err != nil {
+		return 0, err
+	}
+	futures := make([]jetstream.PubAckFuture, 0, len(batch))
+	for _, r := range batch {
+		msg := nats.NewMsg(subject)
+		msg.Header.Set("Content-Type", events.ContentType)
+		if r.Key != nil {
+			msg.Header.Set(keyHeader, *r.Key)
+		}
+		if msg.Data, err = json.Marshal(r.Value); err != nil {
+			return 0, err
+		}
+		future, err := js.PublishMsgAsync(msg, jetstream.WithMsgID(r.Value.ID))
+		if err != nil {
+			return 0, err
+		}
+		futures = append(futures, future)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	failed := 0
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			failed++
+			klog.V(3).Infof("JetStream rejected a message to %s. Error: %s", subject, err)
+		case <-ctx.Done():
+			return 0, fmt.Errorf("Timed out waiting for the JetStream acks. %w", ctx.Err())
+		}
+	}
+	return failed, nil
+}
+
+// Closes the connection.
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.js = nil, nil
+}
+
+// Returns the JetStream context, connecting to the server the first time.
+func (p *Publisher) jetStream() (jetstream.JetStream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.js != nil {
+		return p.js, nil
+	}
+	conn, err := nats.Connect(p.url, p.options...)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to NATS. %w", err)
+	}
+	if !conn.HeadersSupported() {
+		conn.Close()
+		return nil, errors.New("The NATS server doesn't support headers, NATS 2.2 or later is required.")
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	klog.Infof("Connected to NATS at %s.", conn.ConnectedUrlRedacted())
+	p.conn, p.js = conn, js
+	return js, nil
+}
@@ -0,0 +1,131 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package nats
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts a fake NATS server acknowledging the messages published, except to the rejected subject. Returns the
+// server URL and the messages received, with their headers.
+func newFakeNatsServer(t *testing.T, rejectedSubject string) (string, func() []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var received []string
+	var receivedMux sync.Mutex
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.WriteString(conn, `INFO {"server_id":"fake","version":"2.10.0","proto":1,"headers":true,`+
+			`"max_payload":1048576}`+"\r\n")
+		reader := bufio.NewReader(conn)
+		inboxSid := "1"
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "PING":
+				_, _ = io.WriteString(conn, "PONG\r\n")
+			case "SUB":
+				inboxSid = fields[len(fields)-1]
+			case "HPUB":
+				size, _ := strconv.Atoi(fields[4])
+				data := make([]byte, size+2)
+				_, _ = io.ReadFull(reader, data)
+				receivedMux.Lock()
+				received = append(received, string(data[:size]))
+				receivedMux.Unlock()
+				if fields[1] == rejectedSubject {
+					status := "NATS/1.0 503\r\n\r\n"
+					fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", fields[2], inboxSid, len(status), len(status),
+						status)
+				} else {
+					ack := `{"stream":"SEARCH","seq":1}`
+					fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", fields[2], inboxSid, len(ack), ack)
+				}
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), func() []string {
+		receivedMux.Lock()
+		defer receivedMux.Unlock()
+		return append([]string{}, received...)
+	}
+}
+
+func newTestPublisher(url string) *Publisher {
+	config.Cfg.NatsURL = url
+	defer func() { config.Cfg.NatsURL = "" }()
+	return NewPublisher()
+}
+
+// Should publish the messages with the content type, key, and id headers, and wait for the acks.
+func Test_Publisher_Publish(t *testing.T) {
+	url, received := newFakeNatsServer(t, "")
+	publisher := newTestPublisher(url)
+	defer publisher.Close()
+	key := "cluster-a/uid-1"
+
+	failed, err := publisher.Publish(context.Background(), "search.changes.cluster-a", []events.Record{
+		{Key: &key, Value: events.NewCloudEvent("/test", events.Change{ID: 7, Cluster: "cluster-a", UID: "uid-1"})},
+		{Value: events.NewCloudEvent("/test", events.Change{ID: 8, Cluster: "cluster-a", UID: "uid-2"})},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, failed)
+	messages := received()
+	assert.Len(t, messages, 2)
+	assert.Contains(t, messages[0], "Search-Key: cluster-a/uid-1\r\n")
+	assert.Contains(t, messages[0], "Nats-Msg-Id: 7\r\n")
+	assert.Contains(t, messages[0], "Content-Type: application/cloudevents+json\r\n")
+	assert.Contains(t, messages[0], `"id":"7"`)
+	assert.NotContains(t, messages[1], "Search-Key")
+}
+
+// Should count the messages rejected when no stream captures the subject.
+func Test_Publisher_noStream(t *testing.T) {
+	url, _ := newFakeNatsServer(t, "search.changes.cluster-b")
+	publisher := newTestPublisher(url)
+	defer publisher.Close()
+
+	failed, err := publisher.Publish(context.Background(), "search.changes.cluster-b", []events.Record{
+		{Value: events.NewCloudEvent("/test", events.Change{ID: 1, Cluster: "cluster-b"})}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, failed)
+}
+
+// Should return the error when the server isn't available.
+func Test_Publisher_connectError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	url := "nats://" + listener.Addr().String()
+	listener.Close()
+	publisher := newTestPublisher(url)
+
+	_, err = publisher.Publish(context.Background(), "search.changes.cluster-a", []events.Record{{}})
+
+	assert.ErrorContains(t, err, "Error connecting to NATS.")
+}
@@ -0,0 +1,20 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package events
+
+import "context"
+
+// A CloudEvent to publish, with the routing of the EVENT_TRANSPORT.
+type Record struct {
+	Key       *string    `json:"key,omitempty"`
+	Value     CloudEvent `json:"value"`
+	Partition *int       `json:"partition,omitempty"` // Kafka only.
+	Topic     string     `json:"-"`                   // Kafka topic or NATS subject.
+}
+
+// Sends the records to a topic of the EVENT_TRANSPORT. Implemented with the Kafka REST Proxy in kafka/rest.go, the
+// Kafka brokers in kafka/broker.go, and NATS JetStream in nats/publisher.go
+type Publisher interface {
+	// Returns the number of records rejected.
+	Publish(ctx context.Context, topic string, batch []Record) (int, error)
+}
@@ -0,0 +1,136 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"k8s.io/klog/v2"
+)
+
+// Kafka brokers.
+// With KAFKA_BROKERS, the changes are published directly to the brokers with the franz-go client, instead of the
+// REST Proxy. The connections to the brokers are secured with:
+//   - TLS: with KAFKA_TLS=true. KAFKA_CA_CERT verifies the broker certificates, and KAFKA_CLIENT_CERT and
+//     KAFKA_CLIENT_KEY are sent for mutual TLS.
+//   - SASL/SCRAM: KAFKA_SASL_MECHANISM=SCRAM-SHA-256 or SCRAM-SHA-512, with KAFKA_SASL_USER and KAFKA_SASL_PASS.
+//   - SASL/OAUTHBEARER: KAFKA_SASL_MECHANISM=OAUTHBEARER, with a token requested from KAFKA_OAUTH_TOKEN_URL like
+//     the REST Proxy.
+// The sync events are still consumed through the REST Proxy, see consumer.go
+
+// Publishes the records to the Kafka brokers.
+type brokerClient struct {
+	client *kgo.Client
+}
+
+var _ events.Publisher = &brokerClient{}
+
+func newBrokerClient() (*brokerClient, error) {
+	brokers := strings.Split(config.Cfg.KafkaBrokers, ",")
+	for i := range brokers {
+		brokers[i] = strings.TrimSpace(brokers[i])
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.ClientID("search-indexer"),
+	}
+	if config.Cfg.KafkaPartitioner == "fixed" {
+		opts = append(opts, kgo.RecordPartitioner(kgo.ManualPartitioner()))
+	} else {
+		// Same hash of the keys as the REST Proxy and the Java clients. The records without a key are spread over
+		// the partitions.
+		opts = append(opts, kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)))
+	}
+	tlsConfig, err := newTLSConfig(config.Cfg.KafkaCACert, config.Cfg.KafkaClientCert, config.Cfg.KafkaClientKey)
+	if err != nil {
+		return nil, err
+	}
+	if config.Cfg.KafkaTLS {
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	mechanism, err := saslMechanism(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating the Kafka client. %w", err)
+	}
+	return &brokerClient{client: client}, nil
+}
+
+// Returns the SASL mechanism of KAFKA_SASL_MECHANISM, or nil without SASL.
+func saslMechanism(tlsConfig *tls.Config) (sasl.Mechanism, error) {
+	user, pass := config.Cfg.KafkaSASLUser, config.Cfg.KafkaSASLPass
+	switch config.Cfg.KafkaSASLMechanism {
+	case "":
+		return nil, nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: user, Pass: pass}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: user, Pass: pass}.AsSha512Mechanism(), nil
+	case "OAUTHBEARER":
+		tokenSource := newOAuthTokenSource(&http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		})
+		return oauth.Oauth(func(ctx context.Context) (oauth.Auth, error) {
+			token, err := tokenSource.Token()
+			if err != nil {
+				return oauth.Auth{}, err
+			}
+			return oauth.Auth{Token: token.AccessToken}, nil
+		}), nil
+	}
+	return nil, fmt.Errorf("Unsupported KAFKA_SASL_MECHANISM [%s].", config.Cfg.KafkaSASLMechanism)
+}
+
+// Sends the batch to the topic and waits for the brokers to acknowledge it. Returns the number of records rejected
+// by Kafka, or an error if none of the records was written.
+func (c *brokerClient) Publish(ctx context.Context, topic string, batch []events.Record) (int, error) {
+	records := make([]*kgo.Record, 0, len(batch))
+	for _, r := range batch {
+		value, err := json.Marshal(r.Value)
+		if err != nil {
+			return 0, err
+		}
+		kr := &kgo.Record{
+			Topic:   topic,
+			Value:   value,
+			Headers: []kgo.RecordHeader{{Key: "content-type", Value: []byte(events.ContentType)}},
+		}
+		if r.Key != nil {
+			kr.Key = []byte(*r.Key)
+		}
+		if r.Partition != nil {
+			kr.Partition = int32(*r.Partition)
+		}
+		records = append(records, kr)
+	}
+	results := c.client.ProduceSync(ctx, records...)
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			klog.V(3).Infof("Kafka rejected a resource change. %s", result.Err)
+		}
+	}
+	if failed == len(batch) {
+		return 0, results.FirstErr()
+	}
+	return failed, nil
+}
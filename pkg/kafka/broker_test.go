@@ -0,0 +1,109 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should authenticate with SASL/SCRAM and the KAFKA_SASL_USER credentials.
+func Test_saslMechanism_scram(t *testing.T) {
+	config.Cfg.KafkaSASLUser, config.Cfg.KafkaSASLPass = "search", "secret"
+	defer func() {
+		config.Cfg.KafkaSASLMechanism, config.Cfg.KafkaSASLUser, config.Cfg.KafkaSASLPass = "", "", ""
+	}()
+
+	for _, name := range []string{"SCRAM-SHA-256", "SCRAM-SHA-512"} {
+		config.Cfg.KafkaSASLMechanism = name
+		mechanism, err := saslMechanism(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, name, mechanism.Name())
+
+		// The client-first message of RFC 5802.
+		_, message, err := mechanism.Authenticate(context.Background(), "kafka:9093")
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(string(message), "n,,n=search,r="), string(message))
+	}
+}
+
+// Should authenticate with SASL/OAUTHBEARER and the token from KAFKA_OAUTH_TOKEN_URL.
+func Test_saslMechanism_oauth(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+	config.Cfg.KafkaSASLMechanism = "OAUTHBEARER"
+	config.Cfg.KafkaOAuthTokenURL = tokenServer.URL
+	config.Cfg.KafkaOAuthClientID, config.Cfg.KafkaOAuthSecret = "search", "secret"
+	defer func() {
+		config.Cfg.KafkaSASLMechanism, config.Cfg.KafkaOAuthTokenURL = "", ""
+		config.Cfg.KafkaOAuthClientID, config.Cfg.KafkaOAuthSecret = "", ""
+	}()
+
+	mechanism, err := saslMechanism(nil)
+	assert.Nil(t, err)
+	_, message, err := mechanism.Authenticate(context.Background(), "kafka:9093")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "OAUTHBEARER", mechanism.Name())
+	assert.Equal(t, "n,,\x01auth=Bearer token-1\x01\x01", string(message))
+}
+
+func Test_saslMechanism_none(t *testing.T) {
+	mechanism, err := saslMechanism(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, mechanism)
+
+	config.Cfg.KafkaSASLMechanism = "PLAIN"
+	defer func() { config.Cfg.KafkaSASLMechanism = "" }()
+	_, err = saslMechanism(nil)
+	assert.ErrorContains(t, err, "Unsupported KAFKA_SASL_MECHANISM [PLAIN].")
+}
+
+// Should return the error when none of the records is written, so the batch is retried.
+func Test_brokerClient_publish_unavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	config.Cfg.KafkaBrokers = listener.Addr().String()
+	listener.Close()
+	defer func() { config.Cfg.KafkaBrokers = "" }()
+	client, err := newBrokerClient()
+	assert.Nil(t, err)
+	defer client.client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	key := "cluster-a/uid-1"
+
+	failed, err := client.Publish(ctx, "search-changes", []events.Record{
+		{Key: &key, Value: events.NewCloudEvent("/test", events.Change{Cluster: "cluster-a", Action: "add", UID: "uid-1"})}})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, failed)
+}
+
+// Should create the producer with the Kafka brokers instead of the REST Proxy.
+func Test_NewProducer_brokers(t *testing.T) {
+	config.Cfg.KafkaBrokers = "kafka-0:9093, kafka-1:9093"
+	_ = config.Cfg.SetFeatureGates("ChangeStream=true")
+	defer func() {
+		config.Cfg.KafkaBrokers = ""
+		_ = config.Cfg.SetFeatureGates("")
+	}()
+
+	producer, err := NewProducer()
+
+	assert.Nil(t, err)
+	assert.IsType(t, &brokerClient{}, producer.publisher)
+	producer.publisher.(*brokerClient).client.Close()
+}
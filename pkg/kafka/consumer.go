@@ -0,0 +1,333 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Kafka sync events.
+// When KAFKA_SYNC_TOPIC is set, the indexer consumes the sync events of the collectors from Kafka, in addition to
+// the /aggregator/clusters/{id}/sync endpoint. The collectors can send bursts of changes to Kafka while the indexer
+// is unavailable or busy, and the indexer applies them at its own pace.
+//   - Topics: KAFKA_SYNC_TOPIC with the events of all clusters keyed by the cluster name, or
+//     KAFKA_SYNC_TOPIC.<cluster> with the events of one cluster.
+//   - Value: the model.SyncEvent sent to the sync endpoint, as JSON.
+// The replicas consume in the KAFKA_GROUP consumer group through the REST Proxy, so each partition is consumed by
+// one replica, in order. The offsets are committed after the events are applied. With Postgres, the offset of each
+// applied event is also saved in search.kafka_offsets, and the events consumed again up to the saved offset are
+// skipped. When an event fails to apply, the consumer is created again and continues from the committed offset.
+// There isn't a response to the collector, a resync requested for the cluster is logged.
+// Anyone writing to the topics can send events, so the events are only applied for the managed clusters, the
+// clusters with a Cluster node or data in the store. The events of other clusters are rejected. The events wait for
+// the same limits as the sync requests before they're applied, see server/syncLimits.go
+
+const (
+	consumerPollTimeout  = 5 * time.Second
+	consumerRetryWait    = 10 * time.Second
+	knownClustersRefresh = time.Minute
+)
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type consumedRecord struct {
+	Topic     string          `json:"topic"`
+	Key       json.RawMessage `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+}
+
+type consumedOffset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// Limits applied to the sync events before they're applied. Implemented by server.ServerConfig.
+type SyncLimiter interface {
+	// Waits until the sync event can be applied. Returns the func to call after the event is applied, or an error
+	// if the event is rejected or the context is cancelled.
+	WaitForSync(ctx context.Context, clusterName string, size int) (func(), error)
+}
+
+// Consumes the sync events from Kafka and applies them to the store. Use NewConsumer() and Run().
+type Consumer struct {
+	client        *restClient
+	store         database.Store
+	offsets       database.OffsetStore // Nil if the store doesn't keep the offsets.
+	limiter       SyncLimiter          // Nil to apply the events without limits.
+	group         string
+	name          string
+	topic         string
+	applied       map[partitionKey]int64 // Offset of the last event applied from each partition.
+	knownClusters map[string]bool        // Managed clusters, read from the store at most every knownClustersRefresh.
+	clustersRead  time.Time
+}
+
+// Creates the consumer with the KAFKA_* config. Returns nil if KAFKA_SYNC_TOPIC isn't set, or the KafkaSyncEvents
+// feature is disabled.
+func NewConsumer(store database.Store, limiter SyncLimiter) (*Consumer, error) {
+	if config.Cfg.KafkaSyncTopic == "" || !config.Cfg.FeatureEnabled(config.KafkaSyncEvents) {
+		return nil, nil
+	}
+	client, err := newRestClient()
+	if err != nil {
+		return nil, err
+	}
+	name := config.Cfg.PodName
+	if name == "" {
+		name = "search-indexer"
+	}
+	offsets, _ := store.(database.OffsetStore)
+	return &Consumer{
+		client:  client,
+		store:   store,
+		offsets: offsets,
+		limiter: limiter,
+		group:   config.Cfg.KafkaGroup,
+		name:    name,
+		topic:   config.Cfg.KafkaSyncTopic,
+		applied: map[partitionKey]int64{},
+	}, nil
+}
+
+// Consumes the sync events until the context is cancelled.
+func (c *Consumer) Run(ctx context.Context) {
+	klog.Infof("Consuming the sync events from Kafka topic %s. Consumer group: %s", c.topic, c.group)
+	for ctx.Err() == nil {
+		instance, err := c.createInstance(ctx)
+		if err == nil {
+			err = c.consume(ctx, instance)
+			c.deleteInstance(instance)
+		}
+		if err != nil && ctx.Err() == nil {
+			logging.SampledErrorf("Error consuming the sync events from Kafka. Retrying in %s. %s",
+				consumerRetryWait, err)
+			metrics.Errors.WithLabelValues("kafka", "consume").Inc()
+			select {
+			case <-ctx.Done():
+			case <-time.After(consumerRetryWait):
+			}
+		}
+	}
+	klog.V(2).Info("Stopped consuming the sync events from Kafka.")
+}
+
+// Creates the consumer instance and subscribes to the sync topics. Returns the URI of the instance.
+func (c *Consumer) createInstance(ctx context.Context) (string, error) {
+	var instance struct {
+		BaseURI string `json:"base_uri"`
+	}
+	err := c.client.do(ctx, http.MethodPost, "/consumers/"+url.PathEscape(c.group), restContentType,
+		restContentType, map[string]string{
+			"name":               c.name,
+			"format":             "json",
+			"auto.offset.reset":  "earliest",
+			"auto.commit.enable": "false",
+		}, &instance)
+	var restErr *restError
+	if errors.As(err, &restErr) && restErr.status == http.StatusConflict {
+		// The instance of a previous run wasn't deleted.
+		c.deleteInstance(fmt.Sprintf("%s/consumers/%s/instances/%s", c.client.url, url.PathEscape(c.group),
+			url.PathEscape(c.name)))
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+	// The applied offsets are read again, another replica could have consumed the partitions.
+	c.applied = map[partitionKey]int64{}
+	pattern := "^" + regexp.QuoteMeta(c.topic) + `(\..+)?$`
+	err = c.client.do(ctx, http.MethodPost, instance.BaseURI+"/subscription", restContentType, restContentType,
+		map[string]string{"topic_pattern": pattern}, nil)
+	if err != nil {
+		c.deleteInstance(instance.BaseURI)
+		return "", err
+	}
+	return instance.BaseURI, nil
+}
+
+// Deletes the consumer instance, so its partitions are assigned to the other replicas.
+func (c *Consumer) deleteInstance(instance string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.client.do(ctx, http.MethodDelete, instance, restContentType, restContentType, nil, nil); err != nil {
+		klog.V(2).Infof("Error deleting the Kafka consumer instance %s. %s", instance, err)
+	}
+}
+
+// Polls and applies the sync events until the context is cancelled or an event fails to apply.
+func (c *Consumer) consume(ctx context.Context, instance string) error {
+	for {
+		var records []consumedRecord
+		err := c.client.do(ctx, http.MethodGet,
+			fmt.Sprintf("%s/records?timeout=%d", instance, consumerPollTimeout.Milliseconds()),
+			restContentType, jsonContentType, nil, &records)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offsets, err := c.applyRecords(ctx, records)
+		if len(offsets) > 0 {
+			// The REST Proxy commits the offset after the consumed offset.
+			commitErr := c.client.do(ctx, http.MethodPost, instance+"/offsets", restContentType, restContentType,
+				map[string][]consumedOffset{"offsets": offsets}, nil)
+			if commitErr != nil && err == nil {
+				err = commitErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Applies the records in order. Returns the offset of the last record consumed from each partition, and the error
+// of the record that failed to apply.
+func (c *Consumer) applyRecords(ctx context.Context, records []consumedRecord) ([]consumedOffset, error) {
+	consumed := map[partitionKey]int64{}
+	var err error
+	for _, record := range records {
+		key := partitionKey{topic: record.Topic, partition: record.Partition}
+		if err = c.applyRecord(ctx, key, record); err != nil {
+			break
+		}
+		consumed[key] = record.Offset
+	}
+	offsets := make([]consumedOffset, 0, len(consumed))
+	for key, offset := range consumed {
+		offsets = append(offsets, consumedOffset{Topic: key.topic, Partition: key.partition, Offset: offset})
+	}
+	return offsets, err
+}
+
+// Applies the sync event, unless it was already applied.
+func (c *Consumer) applyRecord(ctx context.Context, key partitionKey, record consumedRecord) error {
+	applied, ok := c.applied[key]
+	if !ok {
+		applied = -1
+		if c.offsets != nil {
+			var err error
+			if applied, err = c.offsets.AppliedOffset(ctx, key.topic, key.partition); err != nil {
+				return err
+			}
+		}
+		c.applied[key] = applied
+	}
+	if record.Offset <= applied {
+		metrics.KafkaSyncEvents.WithLabelValues("skipped").Inc()
+		return nil
+	}
+
+	clusterName := c.recordCluster(record)
+	var event model.SyncEvent
+	if err := json.Unmarshal(record.Value, &event); err != nil || clusterName == "" {
+		klog.Warningf("Skipping invalid sync event from Kafka %s/%d offset %d.", key.topic, key.partition,
+			record.Offset)
+		metrics.KafkaSyncEvents.WithLabelValues("invalid").Inc()
+		metrics.Errors.WithLabelValues("kafka", "decode").Inc()
+		return nil
+	}
+	known, err := c.knownCluster(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+	if !known {
+		klog.Warningf("Rejecting sync event from Kafka %s/%d offset %d. Cluster %s isn't a managed cluster.",
+			key.topic, key.partition, record.Offset, clusterName)
+		metrics.KafkaSyncEvents.WithLabelValues("rejected").Inc()
+		return nil
+	}
+	if c.limiter != nil {
+		release, err := c.limiter.WaitForSync(ctx, clusterName, len(record.Value))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			klog.Warningf("Rejecting sync event from Kafka %s/%d offset %d. %s", key.topic, key.partition,
+				record.Offset, err)
+			metrics.KafkaSyncEvents.WithLabelValues("rejected").Inc()
+			return nil
+		}
+		defer release()
+	}
+
+	syncResponse := &model.SyncResponse{}
+	if event.ClearAll {
+		err = c.store.ResyncData(ctx, event, clusterName, syncResponse)
+	} else {
+		err = c.store.SyncData(ctx, event, clusterName, syncResponse)
+	}
+	if err != nil {
+		return fmt.Errorf("Error applying the sync event of cluster %s from Kafka. %w", clusterName, err)
+	}
+	if resyncRequested, _ := c.store.UpdateLastSync(ctx, clusterName, event); resyncRequested {
+		klog.Infof("A resync was requested for cluster %s, which sends the sync events to Kafka.", clusterName)
+	}
+	metrics.LastSyncTimestamp.WithLabelValues(clusterName).SetToCurrentTime()
+	if c.offsets != nil {
+		if err = c.offsets.SaveOffset(ctx, key.topic, key.partition, record.Offset); err != nil {
+			return err
+		}
+	}
+	c.applied[key] = record.Offset
+	metrics.KafkaSyncEvents.WithLabelValues("applied").Inc()
+	return nil
+}
+
+// Returns the cluster of the record, the record key or the suffix of the topic.
+func (c *Consumer) recordCluster(record consumedRecord) string {
+	var clusterName string
+	if len(record.Key) > 0 {
+		_ = json.Unmarshal(record.Key, &clusterName)
+	}
+	if clusterName == "" {
+		clusterName = strings.TrimPrefix(record.Topic, c.topic+".")
+		if clusterName == record.Topic {
+			return ""
+		}
+	}
+	return clusterName
+}
+
+// Returns true if the cluster is the local-cluster or a managed cluster. The clusters are read again from the store
+// when the cluster isn't known, at most every knownClustersRefresh.
+func (c *Consumer) knownCluster(ctx context.Context, clusterName string) (bool, error) {
+	if clusterName == "local-cluster" || c.knownClusters[clusterName] {
+		return true, nil
+	}
+	if time.Since(c.clustersRead) < knownClustersRefresh {
+		return false, nil
+	}
+	clusters, err := c.store.GetManagedClusters(ctx)
+	if err != nil {
+		return false, err
+	}
+	c.knownClusters = make(map[string]bool, len(clusters))
+	for _, name := range clusters {
+		c.knownClusters[name] = true
+	}
+	c.clustersRead = time.Now()
+	return c.knownClusters[clusterName], nil
+}
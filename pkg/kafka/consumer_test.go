@@ -0,0 +1,218 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Offsets kept in memory.
+type fakeOffsetStore map[partitionKey]int64
+
+func (f fakeOffsetStore) AppliedOffset(ctx context.Context, topic string, partition int) (int64, error) {
+	if offset, ok := f[partitionKey{topic: topic, partition: partition}]; ok {
+		return offset, nil
+	}
+	return -1, nil
+}
+
+func (f fakeOffsetStore) SaveOffset(ctx context.Context, topic string, partition int, offset int64) error {
+	f[partitionKey{topic: topic, partition: partition}] = offset
+	return nil
+}
+
+func newTestConsumer(url string) (*Consumer, *memory.Store) {
+	config.Cfg.KafkaRestURL = url
+	config.Cfg.KafkaSyncTopic = "search-sync"
+	_ = config.Cfg.SetFeatureGates("KafkaSyncEvents=true")
+	defer func() {
+		config.Cfg.KafkaRestURL, config.Cfg.KafkaSyncTopic = "", ""
+		_ = config.Cfg.SetFeatureGates("")
+	}()
+	store := memory.NewStore()
+	for _, name := range []string{"cluster-a", "cluster-b"} {
+		store.UpsertCluster(context.Background(), model.Resource{Kind: "Cluster", UID: "cluster__" + name,
+			Properties: map[string]interface{}{"name": name}})
+	}
+	consumer, _ := NewConsumer(store, nil)
+	return consumer, store
+}
+
+// Limits that record the clusters, and reject the events over maxSize.
+type fakeSyncLimiter struct {
+	maxSize  int
+	clusters []string
+	released int
+}
+
+func (f *fakeSyncLimiter) WaitForSync(ctx context.Context, clusterName string, size int) (func(), error) {
+	if size > f.maxSize {
+		return nil, errors.New("Sync event is over the max request size for this cluster.")
+	}
+	f.clusters = append(f.clusters, clusterName)
+	return func() { f.released++ }, nil
+}
+
+func syncRecord(topic, key string, offset int64, value string) consumedRecord {
+	record := consumedRecord{Topic: topic, Offset: offset, Value: json.RawMessage(value)}
+	if key != "" {
+		record.Key, _ = json.Marshal(key)
+	}
+	return record
+}
+
+func resourceTotal(t *testing.T, store *memory.Store, clusterName string) int {
+	resources, _, err := store.ClusterTotals(context.Background(), clusterName)
+	assert.Nil(t, err)
+	return resources
+}
+
+// Should not create the consumer without KAFKA_SYNC_TOPIC.
+func Test_NewConsumer_disabled(t *testing.T) {
+	consumer, err := NewConsumer(memory.NewStore(), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, consumer)
+}
+
+// Should not create the consumer with the KafkaSyncEvents feature disabled.
+func Test_NewConsumer_featureDisabled(t *testing.T) {
+	config.Cfg.KafkaSyncTopic, config.Cfg.KafkaRestURL = "search-sync", "https://kafka-rest:8082"
+	_ = config.Cfg.SetFeatureGates("KafkaSyncEvents=false")
+	defer func() {
+		config.Cfg.KafkaSyncTopic, config.Cfg.KafkaRestURL = "", ""
+		_ = config.Cfg.SetFeatureGates("")
+	}()
+
+	consumer, err := NewConsumer(memory.NewStore(), nil)
+
+	assert.Nil(t, err)
+	assert.Nil(t, consumer)
+}
+
+// Should apply the events of the cluster in the key or in the topic suffix, and skip the invalid events.
+func Test_applyRecords(t *testing.T) {
+	consumer, store := newTestConsumer("https://kafka-rest:8082")
+
+	offsets, err := consumer.applyRecords(context.Background(), []consumedRecord{
+		syncRecord("search-sync", "cluster-a", 0, `{"addResources":[{"uid":"uid-1","kind":"Pod"}]}`),
+		syncRecord("search-sync.cluster-b", "", 3, `{"addResources":[{"uid":"uid-2","kind":"Pod"}]}`),
+		syncRecord("search-sync", "", 1, `{"addResources":[{"uid":"uid-3","kind":"Pod"}]}`),
+		syncRecord("search-sync", "cluster-a", 2, `not json`),
+	})
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []consumedOffset{{Topic: "search-sync", Offset: 2},
+		{Topic: "search-sync.cluster-b", Offset: 3}}, offsets)
+	assert.Equal(t, 1, resourceTotal(t, store, "cluster-a"))
+	assert.Equal(t, 1, resourceTotal(t, store, "cluster-b"))
+}
+
+// Should reject the events of the clusters that aren't managed clusters.
+func Test_applyRecord_unknownCluster(t *testing.T) {
+	consumer, store := newTestConsumer("https://kafka-rest:8082")
+	key := partitionKey{topic: "search-sync"}
+
+	assert.Nil(t, consumer.applyRecord(context.Background(), key,
+		syncRecord("search-sync", "cluster-x", 0, `{"addResources":[{"uid":"uid-1","kind":"Pod"}]}`)))
+	assert.Equal(t, 0, resourceTotal(t, store, "cluster-x"))
+
+	// The clusters aren't read again before knownClustersRefresh.
+	store.UpsertCluster(context.Background(), model.Resource{Kind: "Cluster", UID: "cluster__cluster-x",
+		Properties: map[string]interface{}{"name": "cluster-x"}})
+	known, err := consumer.knownCluster(context.Background(), "cluster-x")
+	assert.Nil(t, err)
+	assert.False(t, known)
+	consumer.clustersRead = time.Time{}
+	known, err = consumer.knownCluster(context.Background(), "cluster-x")
+	assert.Nil(t, err)
+	assert.True(t, known)
+}
+
+// Should wait for the sync limits before applying the event, and skip the events rejected by the limits.
+func Test_applyRecord_syncLimits(t *testing.T) {
+	consumer, store := newTestConsumer("https://kafka-rest:8082")
+	limiter := &fakeSyncLimiter{maxSize: 100}
+	consumer.limiter = limiter
+	key := partitionKey{topic: "search-sync"}
+
+	assert.Nil(t, consumer.applyRecord(context.Background(), key,
+		syncRecord("search-sync", "cluster-a", 0, `{"addResources":[{"uid":"uid-1","kind":"Pod"}]}`)))
+	assert.Nil(t, consumer.applyRecord(context.Background(), key,
+		syncRecord("search-sync", "cluster-b", 1, `{"addResources":[{"uid":"uid-2","kind":"Pod",`+
+			`"properties":{"label":{"app":"`+strings.Repeat("a", 100)+`"}}}]}`)))
+
+	assert.Equal(t, []string{"cluster-a"}, limiter.clusters)
+	assert.Equal(t, 1, limiter.released)
+	assert.Equal(t, 1, resourceTotal(t, store, "cluster-a"))
+	assert.Equal(t, 0, resourceTotal(t, store, "cluster-b"))
+}
+
+// Should skip the events up to the saved offset.
+func Test_applyRecord_alreadyApplied(t *testing.T) {
+	consumer, store := newTestConsumer("https://kafka-rest:8082")
+	offsets := fakeOffsetStore{{topic: "search-sync", partition: 0}: 5}
+	consumer.offsets = offsets
+	key := partitionKey{topic: "search-sync"}
+
+	assert.Nil(t, consumer.applyRecord(context.Background(), key,
+		syncRecord("search-sync", "cluster-a", 5, `{"addResources":[{"uid":"uid-1","kind":"Pod"}]}`)))
+	assert.Equal(t, 0, resourceTotal(t, store, "cluster-a"))
+
+	assert.Nil(t, consumer.applyRecord(context.Background(), key,
+		syncRecord("search-sync", "cluster-a", 6, `{"addResources":[{"uid":"uid-1","kind":"Pod"}]}`)))
+	assert.Equal(t, 1, resourceTotal(t, store, "cluster-a"))
+	assert.Equal(t, int64(6), offsets[key])
+}
+
+// Should subscribe, apply the records, and commit the offsets.
+func Test_consume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var subscription map[string]string
+	var committed map[string][]consumedOffset
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/consumers/search-indexer":
+			_, _ = w.Write([]byte(`{"base_uri":"http://` + r.Host + `/consumers/search-indexer/instances/pod-1"}`))
+		case "/consumers/search-indexer/instances/pod-1/subscription":
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&subscription))
+			w.WriteHeader(http.StatusNoContent)
+		case "/consumers/search-indexer/instances/pod-1/records":
+			assert.Equal(t, jsonContentType, r.Header.Get("Accept"))
+			if polls++; polls > 1 {
+				cancel()
+				_, _ = w.Write([]byte(`[]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[{"topic":"search-sync","key":"cluster-a","partition":1,"offset":7,` +
+				`"value":{"addResources":[{"uid":"uid-1","kind":"Pod"}]}}]`))
+		case "/consumers/search-indexer/instances/pod-1/offsets":
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&committed))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	config.Cfg.KafkaGroup = "search-indexer"
+	consumer, store := newTestConsumer(server.URL)
+
+	instance, err := consumer.createInstance(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, consumer.consume(ctx, instance))
+
+	assert.Equal(t, `^search-sync(\..+)?$`, subscription["topic_pattern"])
+	assert.Equal(t, []consumedOffset{{Topic: "search-sync", Partition: 1, Offset: 7}}, committed["offsets"])
+	assert.Equal(t, 1, resourceTotal(t, store, "cluster-a"))
+}
@@ -0,0 +1,114 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// Change filter.
+// Excludes high-churn or uninteresting changes from the published stream. The changes are stored as usual.
+//   - PUBLISH_SKIP_KINDS          Kinds not published. Example: Event,ReplicaSet
+//   - PUBLISH_SKIP_NAMESPACES     Patterns matching the namespaces not published. Example: openshift-*,kube-system
+//   - PUBLISH_SKIP_CLUSTERS       Patterns matching the clusters not published. Example: dev-*
+//   - PUBLISH_PROPERTY_SELECTOR   Only publish the changes with properties matching this label selector.
+//     Example: apigroup!=events.k8s.io,status notin (Completed)
+// The delete changes don't have the properties, so they're filtered by cluster, and by kind with the outbox.
+// A resync is only filtered by cluster. The patterns use path.Match() syntax. The skipped changes are counted with
+// the search_indexer_kafka_records metric, result filtered.
+
+type publishFilter struct {
+	kinds      map[string]bool // Lowercase kinds.
+	namespaces []string
+	clusters   []string
+	selector   labels.Selector // Nil if not set.
+}
+
+func newPublishFilter() publishFilter {
+	filter := publishFilter{kinds: map[string]bool{}}
+	for _, kind := range strings.Split(config.Cfg.PublishSkipKinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			filter.kinds[strings.ToLower(kind)] = true
+		}
+	}
+	filter.namespaces = splitPatterns(config.Cfg.PublishSkipNS)
+	filter.clusters = splitPatterns(config.Cfg.PublishSkipClusters)
+	if config.Cfg.PublishSelector != "" {
+		selector, err := labels.Parse(config.Cfg.PublishSelector)
+		if err != nil {
+			// Validated with the config, not expected.
+			klog.Errorf("Invalid PUBLISH_PROPERTY_SELECTOR [%s], publishing all changes. %s",
+				config.Cfg.PublishSelector, err)
+		} else {
+			filter.selector = selector
+		}
+	}
+	return filter
+}
+
+func splitPatterns(patterns string) []string {
+	var result []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// Returns true if the change shouldn't be published.
+func (f publishFilter) skip(change events.Change) bool {
+	if matchesAny(f.clusters, change.Cluster) {
+		return true
+	}
+	if change.Action == "resync" {
+		return false
+	}
+	kind := change.Kind
+	if k, ok := change.Properties["kind"].(string); ok && kind == "" {
+		kind = k
+	}
+	if f.kinds[strings.ToLower(kind)] {
+		return true
+	}
+	if namespace, ok := change.Properties["namespace"].(string); ok && matchesAny(f.namespaces, namespace) {
+		return true
+	}
+	if f.selector != nil && change.Properties != nil {
+		return !f.selector.Matches(propertyLabels(change.Properties))
+	}
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the properties with a single value, as the labels for the selector.
+func propertyLabels(props map[string]interface{}) labels.Set {
+	set := make(labels.Set, len(props))
+	for name, value := range props {
+		switch v := value.(type) {
+		case string:
+			set[name] = v
+		case float64:
+			set[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool, int, int64:
+			set[name] = fmt.Sprint(v)
+		}
+	}
+	return set
+}
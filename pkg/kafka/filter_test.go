@@ -0,0 +1,50 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFilter(kinds, namespaces, clusters, selector string) publishFilter {
+	config.Cfg.PublishSkipKinds, config.Cfg.PublishSkipNS = kinds, namespaces
+	config.Cfg.PublishSkipClusters, config.Cfg.PublishSelector = clusters, selector
+	defer func() {
+		config.Cfg.PublishSkipKinds, config.Cfg.PublishSkipNS = "", ""
+		config.Cfg.PublishSkipClusters, config.Cfg.PublishSelector = "", ""
+	}()
+	return newPublishFilter()
+}
+
+// Should skip the changes of the excluded kinds, namespaces, and clusters.
+func Test_publishFilter_skip(t *testing.T) {
+	filter := newTestFilter("Event, replicaset", "openshift-*,kube-system", "dev-*", "")
+
+	assert.True(t, filter.skip(events.Change{Cluster: "a", Action: "add", Kind: "Event"}))
+	assert.True(t, filter.skip(events.Change{Cluster: "a", Action: "update", Kind: "ReplicaSet"}))
+	assert.True(t, filter.skip(events.Change{Cluster: "a", Action: "add", Kind: "Pod",
+		Properties: map[string]interface{}{"namespace": "openshift-monitoring"}}))
+	assert.True(t, filter.skip(events.Change{Cluster: "dev-1", Action: "resync"}))
+	assert.False(t, filter.skip(events.Change{Cluster: "a", Action: "resync"}))
+	assert.False(t, filter.skip(events.Change{Cluster: "a", Action: "add", Kind: "Pod",
+		Properties: map[string]interface{}{"namespace": "default"}}))
+	// The deletes without the kind are published.
+	assert.False(t, filter.skip(events.Change{Cluster: "a", Action: "delete", UID: "uid-1"}))
+}
+
+// Should only publish the changes with the properties matching the selector.
+func Test_publishFilter_selector(t *testing.T) {
+	filter := newTestFilter("", "", "", "status notin (Completed),restarts!=0")
+
+	assert.False(t, filter.skip(events.Change{Cluster: "a", Action: "update", Kind: "Pod",
+		Properties: map[string]interface{}{"status": "Running", "restarts": float64(2)}}))
+	assert.True(t, filter.skip(events.Change{Cluster: "a", Action: "update", Kind: "Pod",
+		Properties: map[string]interface{}{"status": "Completed", "restarts": float64(2)}}))
+	assert.True(t, filter.skip(events.Change{Cluster: "a", Action: "update", Kind: "Pod",
+		Properties: map[string]interface{}{"status": "Running", "restarts": float64(0)}}))
+	assert.False(t, filter.skip(events.Change{Cluster: "a", Action: "delete", UID: "uid-1"}))
+}
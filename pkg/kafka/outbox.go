@@ -0,0 +1,79 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Outbox relay.
+// With KAFKA_OUTBOX (or NATS_OUTBOX), the sync requests don't queue the changes for the producer. The changes are
+// written to search.outbox with the resources, and the relay publishes them from the outbox. A change is published
+// at least once, and in the order it was written for each resource. The id of the outbox row is the event id, so
+// the consumers (and the JetStream duplicate window) can skip the changes published again after a failure.
+// See database/outbox.go
+
+const (
+	outboxPollInterval = time.Second
+	outboxRetryWait    = 5 * time.Second
+)
+
+// Publishes the changes from the outbox until the context is cancelled.
+func (p *Producer) RunOutbox(ctx context.Context, store database.OutboxStore) {
+	klog.Infof("Publishing the resource changes from the outbox to %s with %s.", p.topic,
+		config.Cfg.EventTransport)
+	for ctx.Err() == nil {
+		published, err := store.RelayOutbox(ctx, kafkaBatchSize, func(outboxEvents []database.OutboxEvent) error {
+			return p.publishOutbox(ctx, outboxEvents)
+		})
+		wait := outboxPollInterval
+		if err != nil && ctx.Err() == nil {
+			logging.SampledErrorf("Error publishing the resource changes from the outbox. Retrying in %s. %s",
+				outboxRetryWait, err)
+			metrics.Errors.WithLabelValues("kafka", "publish").Inc()
+			wait = outboxRetryWait
+		} else if published == kafkaBatchSize {
+			continue // Publish the next changes without waiting.
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Publishes the changes. Returns an error if any change isn't published, so the outbox keeps all of them.
+func (p *Producer) publishOutbox(ctx context.Context, outboxEvents []database.OutboxEvent) error {
+	records := make([]events.Record, 0, len(outboxEvents))
+	for _, event := range outboxEvents {
+		change := events.Change{ID: event.ID, Cluster: event.Cluster, Action: event.Action, UID: event.UID,
+			Kind: event.Kind, Properties: event.Data, Time: event.CreatedAt.UTC().Format(time.RFC3339)}
+		// The filtered changes are marked published with the others.
+		if p.filter.skip(change) {
+			metrics.KafkaRecords.WithLabelValues("filtered").Inc()
+			continue
+		}
+		records = append(records, p.newRecord(change))
+	}
+	for topic, batch := range groupByTopic(records) {
+		failed, err := p.publisher.Publish(ctx, topic, batch)
+		if err == nil && failed > 0 {
+			err = fmt.Errorf("%d of %d resource changes were rejected.", failed, len(batch))
+		}
+		if err != nil {
+			metrics.KafkaRecords.WithLabelValues("failed").Add(float64(len(batch)))
+			return err
+		}
+		metrics.KafkaRecords.WithLabelValues("published").Add(float64(len(batch)))
+	}
+	return nil
+}
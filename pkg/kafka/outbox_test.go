@@ -0,0 +1,65 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// Outbox with the changes not published yet.
+type fakeOutboxStore struct {
+	events []database.OutboxEvent
+}
+
+func (f *fakeOutboxStore) RelayOutbox(ctx context.Context, limit int,
+	publish func([]database.OutboxEvent) error) (int, error) {
+	if len(f.events) == 0 {
+		return 0, nil
+	}
+	if err := publish(f.events); err != nil {
+		return 0, err
+	}
+	published := len(f.events)
+	f.events = nil
+	return published, nil
+}
+
+// Should publish the changes from the outbox with the outbox id.
+func Test_RunOutbox(t *testing.T) {
+	server, received := newFakeRestProxy(t, http.StatusOK)
+	defer server.Close()
+	producer := newTestProducer(server.URL)
+	store := &fakeOutboxStore{events: []database.OutboxEvent{
+		{ID: 3, Cluster: "cluster-a", Action: "add", UID: "uid-1", Kind: "Pod",
+			Data: map[string]interface{}{"name": "pod-1"}, CreatedAt: time.Now()},
+		{ID: 4, Cluster: "cluster-a", Action: "delete", UID: "uid-2", Kind: "Pod", CreatedAt: time.Now()},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go producer.RunOutbox(ctx, store)
+
+	assert.Eventually(t, func() bool { return len(received()) == 2 }, time.Second, 5*time.Millisecond)
+	records := received()
+	assert.Equal(t, "3", records[0].Value.ID)
+	assert.Equal(t, "cluster-a/uid-1", *records[0].Key)
+	assert.Equal(t, "pod-1", records[0].Value.Data.Properties["name"])
+	assert.Equal(t, "delete", records[1].Value.Data.Action)
+}
+
+// Should return an error so the outbox keeps the changes.
+func Test_publishOutbox_error(t *testing.T) {
+	server, _ := newFakeRestProxy(t, http.StatusInternalServerError)
+	defer server.Close()
+	producer := newTestProducer(server.URL)
+
+	err := producer.publishOutbox(context.Background(), []database.OutboxEvent{
+		{ID: 3, Cluster: "cluster-a", Action: "delete", UID: "uid-1"}})
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,213 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stolostron/search-indexer/pkg/events/nats"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Kafka change stream.
+// When KAFKA_REST_URL (or KAFKA_BROKERS) and KAFKA_TOPIC are set, the resource changes from the sync requests are
+// published to KAFKA_TOPIC, so analytics and audit pipelines get a change stream without reading the database. The
+// records are sent with the Kafka REST Proxy v2 API, or directly to KAFKA_BROKERS, see broker.go. With
+// EVENT_TRANSPORT=nats, the same records are published to NATS JetStream instead, see events/nats/publisher.go
+//   - Published after the store writes the changes. The resources that failed to write aren't published.
+//   - Topic: KAFKA_TOPIC, where {clusterName} is replaced with the cluster of the change. For example,
+//     search.{clusterName} publishes the changes of each cluster to its own topic.
+//   - Key: <cluster>/<uid> with KAFKA_KEY=uid, or <cluster> with KAFKA_KEY=cluster.
+//   - Partition: KAFKA_PARTITIONER=key partitions by the key hash, so the changes of a resource (or of a cluster with
+//     KAFKA_KEY=cluster) are in the same partition and in order. KAFKA_PARTITIONER=fixed sends all the changes to
+//     KAFKA_PARTITION, ordered across clusters. KAFKA_PARTITIONER=random sends the records without a key, so they
+//     are spread over the partitions without any order.
+//   - Value: a CloudEvent with the change, see events/cloudevents.go. A resync from the cluster is published as a
+//     single event with action resync, the consumers must read the cluster again. The REST Proxy v2 API can't set
+//     the record headers, so the consumers must read the records in the structured mode. The records sent to
+//     KAFKA_BROKERS have the content-type header.
+//   - The PUBLISH_* filters exclude changes from the stream, see filter.go
+// The sync requests don't wait for Kafka. The records are queued and sent in batches by a background worker, and
+// a batch is retried KAFKA_MAX_RETRY (or NATS_MAX_RETRY) times. When the queue is full or the retries fail, the
+// records are dropped and counted with the search_indexer_kafka_records metric.
+
+const (
+	kafkaQueueSize = 10000
+	kafkaBatchSize = 500
+)
+
+// Publishes the resource changes to Kafka. Use NewProducer() and Run().
+type Producer struct {
+	publisher   events.Publisher
+	source      string // CloudEvents source.
+	topic       string
+	key         string
+	partitioner string
+	partition   int
+	maxRetry    int
+	filter      publishFilter
+	records     chan events.Record
+}
+
+// Creates the producer with the KAFKA_* or NATS_* config of the EVENT_TRANSPORT. Returns nil if the changes aren't
+// published.
+func NewProducer() (*Producer, error) {
+	if !config.Cfg.PublishesChanges() {
+		return nil, nil
+	}
+	var pub events.Publisher
+	var err error
+	topic := config.Cfg.KafkaTopic
+	if config.Cfg.EventTransport == "nats" {
+		topic = config.Cfg.NatsSubject
+		pub = nats.NewPublisher()
+	} else if config.Cfg.KafkaBrokers != "" {
+		pub, err = newBrokerClient()
+	} else {
+		pub, err = newRestClient()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Producer{
+		publisher:   pub,
+		source:      events.Source(),
+		topic:       topic,
+		key:         config.Cfg.KafkaKey,
+		partitioner: config.Cfg.KafkaPartitioner,
+		partition:   config.Cfg.KafkaPartition,
+		maxRetry:    config.Cfg.PublishMaxRetry(),
+		filter:      newPublishFilter(),
+		records:     make(chan events.Record, kafkaQueueSize),
+	}, nil
+}
+
+// Queues the changes written from the sync event. Doesn't block, the records are dropped if the queue is full.
+func (p *Producer) Publish(clusterName string, event model.SyncEvent, response *model.SyncResponse) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if event.ClearAll {
+		p.queue(events.Change{Cluster: clusterName, Action: "resync", Time: now})
+		return
+	}
+	failed := map[string]struct{}{}
+	for _, errs := range [][]model.SyncError{response.AddErrors, response.UpdateErrors, response.DeleteErrors} {
+		for _, e := range errs {
+			failed[e.ResourceUID] = struct{}{}
+		}
+	}
+	for _, r := range event.AddResources {
+		if _, ok := failed[r.UID]; !ok {
+			p.queue(events.Change{Cluster: clusterName, Action: "add", UID: r.UID, Kind: r.Kind,
+				Properties: r.Properties, Time: now})
+		}
+	}
+	for _, r := range event.UpdateResources {
+		if _, ok := failed[r.UID]; !ok {
+			p.queue(events.Change{Cluster: clusterName, Action: "update", UID: r.UID, Kind: r.Kind,
+				Properties: r.Properties, Time: now})
+		}
+	}
+	for _, r := range event.DeleteResources {
+		if _, ok := failed[r.UID]; !ok {
+			p.queue(events.Change{Cluster: clusterName, Action: "delete", UID: r.UID, Time: now})
+		}
+	}
+}
+
+func (p *Producer) queue(change events.Change) {
+	if p.filter.skip(change) {
+		metrics.KafkaRecords.WithLabelValues("filtered").Inc()
+		return
+	}
+	select {
+	case p.records <- p.newRecord(change):
+	default:
+		metrics.KafkaRecords.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Builds the record with the topic, key, and partition of the change.
+func (p *Producer) newRecord(change events.Change) events.Record {
+	r := events.Record{
+		Value: events.NewCloudEvent(p.source, change),
+		Topic: strings.ReplaceAll(p.topic, "{clusterName}", change.Cluster),
+	}
+	if p.partitioner == "fixed" {
+		r.Partition = &p.partition
+	}
+	// Without a key, the REST Proxy spreads the records over the partitions.
+	if p.partitioner != "random" {
+		key := change.Cluster
+		if p.key == "uid" {
+			key += "/" + change.UID
+		}
+		r.Key = &key
+	}
+	return r
+}
+
+// Sends the queued records in batches until the context is cancelled.
+func (p *Producer) Run(ctx context.Context) {
+	klog.Infof("Publishing the resource changes to %s with %s.", p.topic, config.Cfg.EventTransport)
+	for {
+		var batch []events.Record
+		select {
+		case <-ctx.Done():
+			return
+		case record := <-p.records:
+			batch = append(batch, record)
+		}
+		// Add the records already queued, up to the batch size.
+	fill:
+		for len(batch) < kafkaBatchSize {
+			select {
+			case record := <-p.records:
+				batch = append(batch, record)
+			default:
+				break fill
+			}
+		}
+		for topic, records := range groupByTopic(batch) {
+			p.sendWithRetry(ctx, topic, records)
+		}
+	}
+}
+
+// Splits the batch by topic, keeping the order of the records in each topic.
+func groupByTopic(batch []events.Record) map[string][]events.Record {
+	topics := map[string][]events.Record{}
+	for _, record := range batch {
+		topics[record.Topic] = append(topics[record.Topic], record)
+	}
+	return topics
+}
+
+// Sends the batch to the topic, retrying up to KAFKA_MAX_RETRY or NATS_MAX_RETRY attempts.
+func (p *Producer) sendWithRetry(ctx context.Context, topic string, batch []events.Record) {
+	var err error
+	for attempt := 1; attempt <= p.maxRetry; attempt++ {
+		var failed int
+		if failed, err = p.publisher.Publish(ctx, topic, batch); err == nil {
+			metrics.KafkaRecords.WithLabelValues("published").Add(float64(len(batch) - failed))
+			metrics.KafkaRecords.WithLabelValues("failed").Add(float64(failed))
+			return
+		}
+		if attempt < p.maxRetry {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt*500) * time.Millisecond):
+			}
+		}
+	}
+	logging.SampledErrorf("Error publishing %d resource changes to %s. %s", len(batch), topic, err)
+	metrics.Errors.WithLabelValues("kafka", "publish").Inc()
+	metrics.KafkaRecords.WithLabelValues("failed").Add(float64(len(batch)))
+}
@@ -0,0 +1,190 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stolostron/search-indexer/pkg/events/nats"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts a fake REST Proxy recording the records received, with the topic from the request path.
+func newFakeRestProxy(t *testing.T, status int) (*httptest.Server, func() []events.Record) {
+	var received []events.Record
+	var receivedMux sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.URL.Path, "/topics/"))
+		assert.Equal(t, jsonContentType, r.Header.Get("Content-Type"))
+		var body struct{ Records []events.Record }
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		for i := range body.Records {
+			body.Records[i].Topic = strings.TrimPrefix(r.URL.Path, "/topics/")
+		}
+		receivedMux.Lock()
+		received = append(received, body.Records...)
+		receivedMux.Unlock()
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"offsets":[]}`))
+	}))
+	return server, func() []events.Record {
+		receivedMux.Lock()
+		defer receivedMux.Unlock()
+		return append([]events.Record{}, received...)
+	}
+}
+
+func newTestProducer(url string) *Producer {
+	config.Cfg.KafkaRestURL = url
+	_ = config.Cfg.SetFeatureGates("ChangeStream=true")
+	defer func() {
+		config.Cfg.KafkaRestURL = ""
+		_ = config.Cfg.SetFeatureGates("")
+	}()
+	producer, _ := NewProducer()
+	return producer
+}
+
+// Should not create the producer without KAFKA_REST_URL.
+func Test_NewProducer_disabled(t *testing.T) {
+	producer, err := NewProducer()
+	assert.Nil(t, err)
+	assert.Nil(t, producer)
+}
+
+// Should publish the changes written, and skip the resources that failed to write.
+func Test_Publish(t *testing.T) {
+	server, received := newFakeRestProxy(t, http.StatusOK)
+	defer server.Close()
+	producer := newTestProducer(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go producer.Run(ctx)
+
+	producer.Publish("cluster-a", model.SyncEvent{
+		AddResources: []model.Resource{
+			{UID: "uid-1", Kind: "Pod", Properties: map[string]interface{}{"name": "pod-1"}},
+			{UID: "uid-2", Kind: "Pod"},
+		},
+		DeleteResources: []model.DeleteResourceEvent{{UID: "uid-3"}},
+	}, &model.SyncResponse{AddErrors: []model.SyncError{{ResourceUID: "uid-2"}}})
+
+	assert.Eventually(t, func() bool { return len(received()) == 2 }, time.Second, 5*time.Millisecond)
+	records := received()
+	assert.Equal(t, "search-changes", records[0].Topic)
+	assert.Equal(t, "cluster-a/uid-1", *records[0].Key)
+	assert.Equal(t, "add", records[0].Value.Data.Action)
+	assert.Equal(t, "pod-1", records[0].Value.Data.Properties["name"])
+	assert.Equal(t, "delete", records[1].Value.Data.Action)
+	assert.Nil(t, records[1].Partition)
+}
+
+// Should publish a resync as a single record.
+func Test_Publish_resync(t *testing.T) {
+	producer := newTestProducer("https://kafka-rest:8082")
+
+	producer.Publish("cluster-a", model.SyncEvent{ClearAll: true,
+		AddResources: []model.Resource{{UID: "uid-1", Kind: "Pod"}}}, &model.SyncResponse{})
+
+	assert.Len(t, producer.records, 1)
+	record := <-producer.records
+	assert.Equal(t, "resync", record.Value.Data.Action)
+}
+
+// Should not queue the changes excluded by the filter.
+func Test_Publish_filtered(t *testing.T) {
+	producer := newTestProducer("https://kafka-rest:8082")
+	producer.filter = newTestFilter("Event", "", "", "")
+
+	producer.Publish("cluster-a", model.SyncEvent{
+		AddResources: []model.Resource{{UID: "uid-1", Kind: "Event"}, {UID: "uid-2", Kind: "Pod"}},
+	}, &model.SyncResponse{})
+
+	assert.Len(t, producer.records, 1)
+	record := <-producer.records
+	assert.Equal(t, "uid-2", record.Value.Data.UID)
+}
+
+// Should retry KAFKA_MAX_RETRY times and drop the batch.
+func Test_sendWithRetry_failed(t *testing.T) {
+	server, received := newFakeRestProxy(t, http.StatusInternalServerError)
+	defer server.Close()
+	config.Cfg.KafkaMaxRetry = 2
+	defer func() { config.Cfg.KafkaMaxRetry = 3 }()
+	producer := newTestProducer(server.URL)
+
+	batch := []events.Record{{Value: events.NewCloudEvent("/test", events.Change{UID: "uid-1"})}}
+	producer.sendWithRetry(context.Background(), "search-changes", batch)
+
+	assert.Len(t, received(), 2)
+}
+
+// Should publish to the topic of each cluster, keyed by cluster.
+func Test_Publish_clusterTopic(t *testing.T) {
+	server, received := newFakeRestProxy(t, http.StatusOK)
+	defer server.Close()
+	config.Cfg.KafkaTopic, config.Cfg.KafkaKey = "search.{clusterName}", "cluster"
+	defer func() { config.Cfg.KafkaTopic, config.Cfg.KafkaKey = "search-changes", "uid" }()
+	producer := newTestProducer(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go producer.Run(ctx)
+
+	producer.Publish("cluster-a", model.SyncEvent{AddResources: []model.Resource{{UID: "uid-1", Kind: "Pod"}}},
+		&model.SyncResponse{})
+	producer.Publish("cluster-b", model.SyncEvent{AddResources: []model.Resource{{UID: "uid-2", Kind: "Pod"}}},
+		&model.SyncResponse{})
+
+	assert.Eventually(t, func() bool { return len(received()) == 2 }, time.Second, 5*time.Millisecond)
+	topics := map[string]string{}
+	for _, record := range received() {
+		topics[record.Topic] = *record.Key
+	}
+	assert.Equal(t, map[string]string{"search.cluster-a": "cluster-a", "search.cluster-b": "cluster-b"}, topics)
+}
+
+// Should send the records to KAFKA_PARTITION with the fixed partitioner, and without a key with the random
+// partitioner.
+func Test_queue_partitioner(t *testing.T) {
+	config.Cfg.KafkaPartitioner, config.Cfg.KafkaPartition = "fixed", 2
+	producer := newTestProducer("https://kafka-rest:8082")
+	producer.queue(events.Change{Cluster: "cluster-a", UID: "uid-1"})
+	record := <-producer.records
+	assert.Equal(t, 2, *record.Partition)
+	assert.Equal(t, "cluster-a/uid-1", *record.Key)
+
+	config.Cfg.KafkaPartitioner, config.Cfg.KafkaPartition = "random", -1
+	defer func() { config.Cfg.KafkaPartitioner = "key" }()
+	producer = newTestProducer("https://kafka-rest:8082")
+	producer.queue(events.Change{Cluster: "cluster-a", UID: "uid-1"})
+	record = <-producer.records
+	assert.Nil(t, record.Partition)
+	assert.Nil(t, record.Key)
+}
+
+// Should create the producer with the NATS subject and NATS_MAX_RETRY.
+func Test_NewProducer_nats(t *testing.T) {
+	config.Cfg.EventTransport, config.Cfg.NatsURL, config.Cfg.NatsMaxRetry = "nats", "nats://nats:4222", 5
+	_ = config.Cfg.SetFeatureGates("ChangeStream=true")
+	defer func() {
+		config.Cfg.EventTransport, config.Cfg.NatsURL, config.Cfg.NatsMaxRetry = "kafka", "", 3
+		_ = config.Cfg.SetFeatureGates("")
+	}()
+
+	producer, err := NewProducer()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "search.changes.{clusterName}", producer.topic)
+	assert.Equal(t, 5, producer.maxRetry)
+	assert.IsType(t, &nats.Publisher{}, producer.publisher)
+}
@@ -0,0 +1,188 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/events"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"k8s.io/klog/v2"
+)
+
+// Kafka authentication.
+// The indexer doesn't connect to the brokers, the REST Proxy (or the AMQ Streams HTTP Bridge) does. The connection
+// to the proxy is secured with:
+//   - TLS: KAFKA_CA_CERT verifies the proxy certificate, and KAFKA_CLIENT_CERT and KAFKA_CLIENT_KEY are sent for
+//     mutual TLS. The client certificate is read again for each connection, so it can be rotated.
+//   - SASL/PLAIN or SASL/SCRAM: KAFKA_REST_USER and KAFKA_REST_PASS are sent with basic auth. The proxy uses them
+//     as the SASL credentials of the broker connection when it's configured to propagate the client principal.
+//   - OAuth: a bearer token requested from KAFKA_OAUTH_TOKEN_URL with the client credentials grant. The token is
+//     cached until it expires, and the proxy passes it to the brokers for SASL/OAUTHBEARER.
+// With KAFKA_BROKERS, the indexer connects to the brokers with SASL instead, see broker.go
+
+const (
+	jsonContentType = "application/vnd.kafka.json.v2+json" // Records with JSON keys and values.
+	restContentType = "application/vnd.kafka.v2+json"      // Other requests and responses of the v2 API.
+)
+
+// Minimal client for the Kafka REST Proxy v2 API.
+type restClient struct {
+	url        string
+	user       string
+	pass       string
+	httpClient *http.Client
+}
+
+var _ events.Publisher = &restClient{}
+
+type restResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Error response from the REST Proxy.
+type restError struct {
+	status int
+}
+
+func (e *restError) Error() string {
+	return fmt.Sprintf("Kafka REST Proxy responded with status %d", e.status)
+}
+
+func newRestClient() (*restClient, error) {
+	tlsConfig, err := newTLSConfig(config.Cfg.KafkaCACert, config.Cfg.KafkaClientCert, config.Cfg.KafkaClientKey)
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	if config.Cfg.KafkaOAuthTokenURL != "" {
+		transport = &oauth2.Transport{Source: newOAuthTokenSource(transport), Base: transport}
+	}
+	return &restClient{
+		url:        strings.TrimSuffix(config.Cfg.KafkaRestURL, "/"),
+		user:       config.Cfg.KafkaRestUser,
+		pass:       config.Cfg.KafkaRestPass,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// Returns the source of the OAuth tokens requested from KAFKA_OAUTH_TOKEN_URL with the client credentials grant. The
+// token is cached until it expires. The token requests use the transport, with the same TLS config as Kafka.
+func newOAuthTokenSource(transport http.RoundTripper) oauth2.TokenSource {
+	oauthConfig := &clientcredentials.Config{
+		ClientID:     config.Cfg.KafkaOAuthClientID,
+		ClientSecret: config.Cfg.KafkaOAuthSecret,
+		TokenURL:     config.Cfg.KafkaOAuthTokenURL,
+		Scopes:       strings.Fields(config.Cfg.KafkaOAuthScope),
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient,
+		&http.Client{Timeout: 30 * time.Second, Transport: transport})
+	return oauthConfig.TokenSource(ctx)
+}
+
+// Builds the TLS config for the REST Proxy or broker connections.
+func newTLSConfig(caCertFile, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCertFile != "" {
+		caCert, err := os.ReadFile(caCertFile) // #nosec G304
+		if err != nil {
+			return nil, fmt.Errorf("Error reading Kafka CA certificate. %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("Error parsing Kafka CA certificate %s.", caCertFile)
+		}
+	}
+	if certFile != "" {
+		// Fail early if the client certificate can't be loaded.
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("Error loading Kafka client certificate. %w", err)
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				logging.SampledErrorf("Error loading the Kafka client certificate. %s", err)
+				return nil, err
+			}
+			return &cert, nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+// Sends a request to the url, or to the path of the REST Proxy if it starts with /. The body is encoded as JSON, and
+// the response is decoded into out, if not nil. Returns a *restError if the response isn't successful.
+func (c *restClient) do(ctx context.Context, method, url, contentType, accept string, body, out interface{}) error {
+	if strings.HasPrefix(url, "/") {
+		url = c.url + url
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", accept)
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &restError{status: res.StatusCode}
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Sends the batch to the topic. Returns the number of records rejected by Kafka.
+func (c *restClient) Publish(ctx context.Context, topic string, batch []events.Record) (int, error) {
+	var response restResponse
+	err := c.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(topic), jsonContentType, restContentType,
+		map[string][]events.Record{"records": batch}, &response)
+	if err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, offset := range response.Offsets {
+		if offset.ErrorCode != nil {
+			failed++
+			klog.V(3).Infof("Kafka rejected a resource change. %s", offset.Error)
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package kafka
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should verify the REST Proxy certificate with KAFKA_CA_CERT.
+func Test_restClient_caCert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.Nil(t, os.WriteFile(caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	config.Cfg.KafkaRestURL = server.URL
+	defer func() { config.Cfg.KafkaRestURL, config.Cfg.KafkaCACert = "", "" }()
+
+	client, err := newRestClient()
+	assert.Nil(t, err)
+	assert.NotNil(t, client.do(context.Background(), http.MethodGet, "/topics", restContentType, restContentType,
+		nil, nil), "Expected an error without the CA certificate.")
+
+	config.Cfg.KafkaCACert = caFile
+	client, err = newRestClient()
+	assert.Nil(t, err)
+	assert.Nil(t, client.do(context.Background(), http.MethodGet, "/topics", restContentType, restContentType,
+		nil, nil))
+}
+
+// Should fail to create the client if the certificates can't be read.
+func Test_newRestClient_invalidCerts(t *testing.T) {
+	config.Cfg.KafkaCACert = "/not/found/ca.crt"
+	_, err := newRestClient()
+	assert.ErrorContains(t, err, "Error reading Kafka CA certificate.")
+
+	config.Cfg.KafkaCACert = ""
+	config.Cfg.KafkaClientCert, config.Cfg.KafkaClientKey = "/not/found/tls.crt", "/not/found/tls.key"
+	defer func() { config.Cfg.KafkaClientCert, config.Cfg.KafkaClientKey = "", "" }()
+	_, err = newRestClient()
+	assert.ErrorContains(t, err, "Error loading Kafka client certificate.")
+}
+
+// Should send the OAuth bearer token, and request a token only once.
+func Test_restClient_oauth(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(t, "kafka", r.Form.Get("scope"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	config.Cfg.KafkaRestURL = server.URL
+	config.Cfg.KafkaOAuthTokenURL = tokenServer.URL
+	config.Cfg.KafkaOAuthClientID, config.Cfg.KafkaOAuthSecret = "search", "secret"
+	config.Cfg.KafkaOAuthScope = "kafka"
+	defer func() {
+		config.Cfg.KafkaRestURL, config.Cfg.KafkaOAuthTokenURL, config.Cfg.KafkaOAuthScope = "", "", ""
+		config.Cfg.KafkaOAuthClientID, config.Cfg.KafkaOAuthSecret = "", ""
+	}()
+
+	client, err := newRestClient()
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, client.do(context.Background(), http.MethodGet, "/topics", restContentType, restContentType,
+			nil, nil))
+	}
+
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-1"}, authorization)
+	assert.Equal(t, 1, tokenRequests)
+}
@@ -0,0 +1,69 @@
+// Copyright Contributors to the Open Cluster Management project
+package logging
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"k8s.io/klog/v2"
+)
+
+// Log format.
+// With LOG_FORMAT=json, the klog messages are written as structured JSON lines through a logr backend, so the log
+// collectors can parse the level, the caller, and the key-value pairs. The default, text, keeps the klog format.
+// The verbosity is still set with the klog -v flag.
+
+// Routes the klog output to the backend of the log format: text or json.
+func Setup(format string) {
+	switch format {
+	case "json":
+		klog.SetLogger(jsonLogger())
+	default:
+		klog.ClearLogger()
+	}
+}
+
+// Writes the messages as JSON lines to stderr.
+func jsonLogger() logr.Logger {
+	logger := funcr.NewJSON(func(obj string) { fmt.Fprintln(os.Stderr, obj) }, funcr.Options{
+		LogCaller:    funcr.All,
+		LogTimestamp: true,
+		// klog filters the messages with -v before calling the logger.
+		Verbosity: math.MaxInt32,
+	})
+	return logr.New(trimSink{logger.GetSink().(callDepthSink)})
+}
+
+// Removes the newline that klog adds at the end of the messages.
+type trimSink struct {
+	callDepthSink
+}
+
+type callDepthSink interface {
+	logr.LogSink
+	logr.CallDepthLogSink
+}
+
+func (s trimSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.callDepthSink.Info(level, strings.TrimSuffix(msg, "\n"), keysAndValues...)
+}
+
+func (s trimSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.callDepthSink.Error(err, strings.TrimSuffix(msg, "\n"), keysAndValues...)
+}
+
+func (s trimSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return trimSink{s.callDepthSink.WithValues(keysAndValues...).(callDepthSink)}
+}
+
+func (s trimSink) WithName(name string) logr.LogSink {
+	return trimSink{s.callDepthSink.WithName(name).(callDepthSink)}
+}
+
+func (s trimSink) WithCallDepth(depth int) logr.LogSink {
+	return trimSink{s.callDepthSink.WithCallDepth(depth).(callDepthSink)}
+}
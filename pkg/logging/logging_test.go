@@ -0,0 +1,38 @@
+// Copyright Contributors to the Open Cluster Management project
+package logging
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2"
+)
+
+// Should write the klog messages as JSON lines with LOG_FORMAT=json.
+func Test_Setup_json(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() {
+		os.Stderr = stderr
+		Setup("text")
+	}()
+
+	Setup("json")
+	klog.Infof("Synced cluster %s.", "cluster-a")
+	klog.Flush()
+	_ = w.Close()
+	out, err := io.ReadAll(r)
+	assert.Nil(t, err)
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(strings.TrimSpace(string(out))), &entry))
+	assert.Equal(t, "Synced cluster cluster-a.", entry["msg"])
+	assert.Contains(t, entry, "ts")
+	assert.Contains(t, entry["caller"].(map[string]interface{})["file"], "logging_test.go")
+}
@@ -0,0 +1,75 @@
+// Copyright Contributors to the Open Cluster Management project
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// Sampling for repeated errors. During an incident, like a database outage, the same error is logged thousands
+// of times per minute. Messages are grouped by the format string and the text of the errors in the arguments, so
+// the same error from different clusters is grouped, but different errors logged with the same format aren't.
+// The first occurrence is logged, then only 1 in every LOG_SAMPLE_RATE occurrences with the number of repeats.
+// A group is reset when the message isn't seen for the sample window.
+
+const sampleWindow = 5 * time.Minute
+
+type sampledMessage struct {
+	count    int       // Occurrences since the message was last logged.
+	lastSeen time.Time // Used to reset the group.
+}
+
+var sampledMessages = map[string]*sampledMessage{}
+var sampledMessagesLock = sync.Mutex{}
+
+// Logs an error using sampling to avoid flooding the logs with repeated messages.
+func SampledErrorf(format string, args ...interface{}) {
+	if logIt, repeated := sample(sampleKey(format, args)); logIt {
+		msg := fmt.Sprintf(format, args...)
+		if repeated > 0 {
+			msg = fmt.Sprintf("%s [Repeated %d times since last logged]", msg, repeated)
+		}
+		klog.ErrorDepth(1, msg)
+	}
+}
+
+// Returns the format and the text of the error arguments.
+func sampleKey(format string, args []interface{}) string {
+	var key strings.Builder
+	key.WriteString(format)
+	for _, arg := range args {
+		if err, ok := arg.(error); ok && err != nil {
+			key.WriteString("\n")
+			key.WriteString(err.Error())
+		}
+	}
+	return key.String()
+}
+
+// Returns true if the message should be logged and the number of times it repeated since it was last logged.
+func sample(key string) (bool, int) {
+	if config.Cfg.LogSampleRate <= 1 {
+		return true, 0
+	}
+	sampledMessagesLock.Lock()
+	defer sampledMessagesLock.Unlock()
+
+	msg, found := sampledMessages[key]
+	if !found || time.Since(msg.lastSeen) > sampleWindow {
+		sampledMessages[key] = &sampledMessage{lastSeen: time.Now()}
+		return true, 0
+	}
+	msg.lastSeen = time.Now()
+	msg.count++
+	if msg.count >= config.Cfg.LogSampleRate {
+		repeated := msg.count
+		msg.count = 0
+		return true, repeated
+	}
+	return false, 0
+}
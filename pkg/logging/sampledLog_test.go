@@ -0,0 +1,64 @@
+// Copyright Contributors to the Open Cluster Management project
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2"
+)
+
+// Should log the first occurrence and then 1 in every LOG_SAMPLE_RATE occurrences.
+func Test_SampledErrorf(t *testing.T) {
+	config.Cfg.LogSampleRate = 10
+	sampledMessages = map[string]*sampledMessage{}
+
+	// Redirect the logger output.
+	var buf bytes.Buffer
+	klog.LogToStderr(false)
+	klog.SetOutput(&buf)
+	defer func() {
+		klog.SetOutput(os.Stderr)
+	}()
+
+	for i := 0; i < 25; i++ {
+		SampledErrorf("Unable to connect to database. Attempt: %d", i)
+	}
+	klog.Flush()
+
+	logMsg := buf.String()
+	assert.NotContains(t, logMsg, "Attempt: 1\n")
+	assert.NotContains(t, logMsg, "Attempt: 19\n")
+	assert.Contains(t, logMsg, "Attempt: 0\n")
+	assert.Contains(t, logMsg, "Attempt: 10 [Repeated 10 times since last logged]")
+	assert.Contains(t, logMsg, "Attempt: 20 [Repeated 10 times since last logged]")
+}
+
+// Should log every message when sampling is disabled.
+func Test_sample_disabled(t *testing.T) {
+	config.Cfg.LogSampleRate = 1
+	sampledMessages = map[string]*sampledMessage{}
+
+	for i := 0; i < 5; i++ {
+		logIt, repeated := sample("message")
+		assert.True(t, logIt)
+		assert.Equal(t, 0, repeated)
+	}
+}
+
+// Should group the messages by the format and the error text.
+func Test_sampleKey(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	errTimeout := errors.New("timeout")
+	format := "Error syncing cluster %s. %s"
+
+	assert.Equal(t, sampleKey(format, []interface{}{"cluster-a", errRefused}),
+		sampleKey(format, []interface{}{"cluster-b", errRefused}))
+	assert.NotEqual(t, sampleKey(format, []interface{}{"cluster-a", errRefused}),
+		sampleKey(format, []interface{}{"cluster-a", errTimeout}))
+	assert.Equal(t, format, sampleKey(format, []interface{}{"cluster-a", nil}))
+}
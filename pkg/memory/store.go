@@ -0,0 +1,257 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// In-memory storage backend. Selected with STORAGE_BACKEND=memory
+// Keeps the data in maps, so developers can run the indexer and collector locally without a database, and the
+// server tests can run against a real store instead of mocks. The data is lost when the indexer restarts and
+// isn't shared between replicas, don't use it in production.
+
+// Store keeping the indexed data in memory. Use NewStore() to create it.
+type Store struct {
+	mu        sync.RWMutex
+	resources map[string]resource // Keyed by uid.
+	edges     map[edgeKey]edge
+	clusters  map[string]*cluster // Keyed by cluster name.
+}
+
+var _ database.Store = &Store{}
+
+type resource struct {
+	cluster string
+	data    map[string]interface{}
+	hash    int64
+}
+
+// Edges are unique by source, destination, and type, same as the search.edges primary key.
+type edgeKey struct {
+	sourceUID, destUID, edgeType string
+}
+
+type edge struct {
+	model.Edge
+	cluster string
+}
+
+type cluster struct {
+	node     *model.Resource // The Cluster node, set by UpsertCluster().
+	lastSync time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		resources: map[string]resource{},
+		edges:     map[edgeKey]edge{},
+		clusters:  map[string]*cluster{},
+	}
+}
+
+// Applies the changes from a sync event.
+func (s *Store) SyncData(ctx context.Context, event model.SyncEvent, clusterName string,
+	syncResponse *model.SyncResponse) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range event.AddResources {
+		s.putResource(r, clusterName)
+	}
+	for _, r := range event.UpdateResources {
+		s.putResource(r, clusterName)
+	}
+	for _, r := range event.DeleteResources {
+		s.deleteResource(r.UID)
+	}
+	for _, e := range event.AddEdges {
+		s.edges[newEdgeKey(e)] = edge{Edge: e, cluster: clusterName}
+	}
+	for _, e := range event.DeleteEdges {
+		delete(s.edges, newEdgeKey(e))
+	}
+
+	syncResponse.TotalAdded = len(event.AddResources)
+	syncResponse.TotalUpdated = len(event.UpdateResources)
+	syncResponse.TotalDeleted = len(event.DeleteResources)
+	syncResponse.TotalEdgesAdded = len(event.AddEdges)
+	syncResponse.TotalEdgesDeleted = len(event.DeleteEdges)
+	return nil
+}
+
+// Replaces the cluster data with the state in the sync event.
+func (s *Store) ResyncData(ctx context.Context, event model.SyncEvent, clusterName string,
+	syncResponse *model.SyncResponse) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	incoming := make(map[string]bool, len(event.AddResources))
+	for _, r := range event.AddResources {
+		incoming[r.UID] = true
+		if existing, found := s.resources[r.UID]; !found {
+			syncResponse.TotalAdded++
+		} else if existing.hash != resourceHash(r) {
+			syncResponse.TotalUpdated++
+		}
+		s.putResource(r, clusterName)
+	}
+	for uid, r := range s.resources {
+		if r.cluster == clusterName && !incoming[uid] {
+			delete(s.resources, uid)
+			syncResponse.TotalDeleted++
+		}
+	}
+
+	incomingEdges := make(map[edgeKey]bool, len(event.AddEdges))
+	for _, e := range event.AddEdges {
+		key := newEdgeKey(e)
+		incomingEdges[key] = true
+		if _, found := s.edges[key]; !found {
+			syncResponse.TotalEdgesAdded++
+		}
+		s.edges[key] = edge{Edge: e, cluster: clusterName}
+	}
+	for key, e := range s.edges {
+		if e.cluster == clusterName && !incomingEdges[key] {
+			delete(s.edges, key)
+			syncResponse.TotalEdgesDeleted++
+		}
+	}
+	klog.V(1).Infof("Completed resync of cluster %12s.\t RequestId: %d", clusterName, event.RequestId)
+	return nil
+}
+
+// Returns the number of resources and edges for the cluster.
+func (s *Store) ClusterTotals(ctx context.Context, clusterName string) (resources int, edges int, e error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.resources {
+		if r.cluster == clusterName {
+			resources++
+		}
+	}
+	for _, e := range s.edges {
+		if e.cluster == clusterName {
+			edges++
+		}
+	}
+	return resources, edges, nil
+}
+
+// Returns the sum of the resource hashes for the cluster. See database.ClusterChecksum()
+func (s *Store) ClusterChecksum(ctx context.Context, clusterName string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	checksum := int64(0)
+	for _, r := range s.resources {
+		if r.cluster == clusterName {
+			checksum += r.hash
+		}
+	}
+	return checksum, nil
+}
+
+// Records the last sync. The consistency check isn't implemented in memory, so it never requests a resync.
+func (s *Store) UpdateLastSync(ctx context.Context, clusterName string, event model.SyncEvent) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cluster(clusterName).lastSync = time.Now()
+	return false, nil
+}
+
+func (s *Store) Backpressure() (overloaded bool, retryAfter time.Duration) {
+	return false, 0
+}
+
+// Creates or updates the Cluster node.
+func (s *Store) UpsertCluster(ctx context.Context, r model.Resource) {
+	clusterName, _ := r.Properties["name"].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cluster(clusterName).node = &r
+}
+
+// Deletes the cluster resources and edges, and optionally the Cluster node.
+func (s *Store) DeleteClusterAndResources(ctx context.Context, clusterName string, deleteClusterNode bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uid, r := range s.resources {
+		if r.cluster == clusterName {
+			delete(s.resources, uid)
+		}
+	}
+	for key, e := range s.edges {
+		if e.cluster == clusterName {
+			delete(s.edges, key)
+		}
+	}
+	if deleteClusterNode {
+		delete(s.clusters, clusterName)
+	}
+}
+
+// Returns the clusters with resources or a Cluster node, excluding the local-cluster.
+func (s *Store) GetManagedClusters(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clusters := map[string]bool{}
+	for _, r := range s.resources {
+		clusters[r.cluster] = true
+	}
+	for name, c := range s.clusters {
+		if c.node != nil {
+			clusters[name] = true
+		}
+	}
+	managedClusters := make([]string, 0, len(clusters))
+	for name := range clusters {
+		if name != "" && name != "local-cluster" {
+			managedClusters = append(managedClusters, name)
+		}
+	}
+	sort.Strings(managedClusters)
+	return managedClusters, nil
+}
+
+// Returns the cluster entry, creating it if needed. The caller must hold the lock.
+func (s *Store) cluster(clusterName string) *cluster {
+	c, found := s.clusters[clusterName]
+	if !found {
+		c = &cluster{}
+		s.clusters[clusterName] = c
+	}
+	return c
+}
+
+// The caller must hold the lock.
+func (s *Store) putResource(r model.Resource, clusterName string) {
+	s.resources[r.UID] = resource{cluster: clusterName, data: r.Properties, hash: resourceHash(r)}
+}
+
+// Deletes the resource and the edges pointing to it. The caller must hold the lock.
+func (s *Store) deleteResource(uid string) {
+	delete(s.resources, uid)
+	for key := range s.edges {
+		if key.sourceUID == uid || key.destUID == uid {
+			delete(s.edges, key)
+		}
+	}
+}
+
+func resourceHash(r model.Resource) int64 {
+	data, _ := json.Marshal(r.Properties)
+	return database.ResourceHash(r.UID, data)
+}
+
+func newEdgeKey(e model.Edge) edgeKey {
+	return edgeKey{sourceUID: e.SourceUID, destUID: e.DestUID, edgeType: e.EdgeType}
+}
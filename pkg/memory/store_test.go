@@ -0,0 +1,77 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SyncData(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	event := model.SyncEvent{
+		AddResources: []model.Resource{{UID: "uid-1"}, {UID: "uid-2"}, {UID: "uid-3"}},
+		AddEdges: []model.Edge{{SourceUID: "uid-1", DestUID: "uid-2", EdgeType: "ownedBy"},
+			{SourceUID: "uid-3", DestUID: "uid-2", EdgeType: "ownedBy"}},
+	}
+	err := store.SyncData(ctx, event, "cluster-a", &model.SyncResponse{})
+	assert.Nil(t, err)
+
+	// Deleting a resource deletes the edges pointing to it.
+	event = model.SyncEvent{DeleteResources: []model.DeleteResourceEvent{{UID: "uid-1"}}}
+	syncResponse := &model.SyncResponse{}
+	err = store.SyncData(ctx, event, "cluster-a", syncResponse)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, syncResponse.TotalDeleted)
+	resources, edges, _ := store.ClusterTotals(ctx, "cluster-a")
+	assert.Equal(t, 2, resources)
+	assert.Equal(t, 1, edges)
+}
+
+// Should replace the cluster data and leave the other clusters unchanged.
+func Test_ResyncData(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	_ = store.SyncData(ctx, model.SyncEvent{
+		AddResources: []model.Resource{{UID: "uid-1"}, {UID: "uid-2", Properties: map[string]interface{}{"a": 1}}},
+		AddEdges:     []model.Edge{{SourceUID: "uid-1", DestUID: "uid-2", EdgeType: "ownedBy"}},
+	}, "cluster-a", &model.SyncResponse{})
+	_ = store.SyncData(ctx, model.SyncEvent{AddResources: []model.Resource{{UID: "uid-b"}}}, "cluster-b",
+		&model.SyncResponse{})
+
+	syncResponse := &model.SyncResponse{}
+	err := store.ResyncData(ctx, model.SyncEvent{
+		ClearAll:     true,
+		AddResources: []model.Resource{{UID: "uid-2", Properties: map[string]interface{}{"a": 2}}, {UID: "uid-3"}},
+	}, "cluster-a", syncResponse)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.SyncResponse{TotalAdded: 1, TotalUpdated: 1, TotalDeleted: 1, TotalEdgesDeleted: 1},
+		*syncResponse)
+	resources, _, _ := store.ClusterTotals(ctx, "cluster-b")
+	assert.Equal(t, 1, resources)
+}
+
+func Test_GetManagedClusters(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	_ = store.SyncData(ctx, model.SyncEvent{AddResources: []model.Resource{{UID: "uid-1"}}}, "cluster-b",
+		&model.SyncResponse{})
+	_ = store.SyncData(ctx, model.SyncEvent{AddResources: []model.Resource{{UID: "uid-2"}}}, "local-cluster",
+		&model.SyncResponse{})
+	store.UpsertCluster(ctx, model.Resource{UID: "cluster__cluster-a",
+		Properties: map[string]interface{}{"name": "cluster-a"}})
+
+	clusters, err := store.GetManagedClusters(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, clusters)
+
+	store.DeleteClusterAndResources(ctx, "cluster-b", true)
+	clusters, _ = store.GetManagedClusters(ctx)
+	assert.Equal(t, []string{"cluster-a"}, clusters)
+}
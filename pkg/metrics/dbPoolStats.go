@@ -0,0 +1,78 @@
+// Copyright Contributors to the Open Cluster Management project
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Database connection pool statistics. Implemented by *pgxpool.Stat
+type DBPoolStats interface {
+	AcquireCount() int64
+	AcquireDuration() time.Duration
+	AcquiredConns() int32
+	CanceledAcquireCount() int64
+	EmptyAcquireCount() int64
+	IdleConns() int32
+	MaxConns() int32
+	TotalConns() int32
+}
+
+// Collects the connection pool statistics when metrics are scraped.
+// Helps to identify if syncs are slow because the pool is starved or because the database is slow.
+type dbPoolCollector struct {
+	stat                 func() DBPoolStats
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	maxConns             *prometheus.Desc
+	totalConns           *prometheus.Desc
+}
+
+func newDBPoolCollector(stat func() DBPoolStats) *dbPoolCollector {
+	return &dbPoolCollector{
+		stat: stat,
+		acquireCount: prometheus.NewDesc("search_indexer_db_pool_acquire_count",
+			"Total successful connection acquires from the pool.", nil, nil),
+		acquireDuration: prometheus.NewDesc("search_indexer_db_pool_acquire_duration_seconds",
+			"Total time (seconds) waiting to acquire a connection from the pool.", nil, nil),
+		acquiredConns: prometheus.NewDesc("search_indexer_db_pool_acquired_conns",
+			"Connections currently acquired from the pool.", nil, nil),
+		canceledAcquireCount: prometheus.NewDesc("search_indexer_db_pool_canceled_acquire_count",
+			"Total connection acquires canceled by a context.", nil, nil),
+		emptyAcquireCount: prometheus.NewDesc("search_indexer_db_pool_empty_acquire_count",
+			"Total connection acquires that waited because the pool was empty.", nil, nil),
+		idleConns: prometheus.NewDesc("search_indexer_db_pool_idle_conns",
+			"Idle connections in the pool.", nil, nil),
+		maxConns: prometheus.NewDesc("search_indexer_db_pool_max_conns",
+			"Maximum size of the pool.", nil, nil),
+		totalConns: prometheus.NewDesc("search_indexer_db_pool_total_conns",
+			"Total connections in the pool.", nil, nil),
+	}
+}
+
+// Register the connection pool statistics with the prometheus registry.
+func RegisterDBPoolStats(stat func() DBPoolStats) {
+	PromRegistry.MustRegister(newDBPoolCollector(stat))
+}
+
+func (c *dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireCount, prometheus.CounterValue,
+		float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+}
@@ -0,0 +1,49 @@
+// Copyright Contributors to the Open Cluster Management project
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPoolStats struct{}
+
+func (m mockPoolStats) AcquireCount() int64            { return 10 }
+func (m mockPoolStats) AcquireDuration() time.Duration { return 1500 * time.Millisecond }
+func (m mockPoolStats) AcquiredConns() int32           { return 3 }
+func (m mockPoolStats) CanceledAcquireCount() int64    { return 1 }
+func (m mockPoolStats) EmptyAcquireCount() int64       { return 2 }
+func (m mockPoolStats) IdleConns() int32               { return 5 }
+func (m mockPoolStats) MaxConns() int32                { return 10 }
+func (m mockPoolStats) TotalConns() int32              { return 8 }
+
+// Should collect the connection pool statistics.
+func Test_dbPoolCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newDBPoolCollector(func() DBPoolStats { return mockPoolStats{} }))
+
+	collectedMetrics, err := registry.Gather()
+	assert.Nil(t, err)
+
+	values := map[string]float64{}
+	for _, m := range collectedMetrics {
+		if m.GetMetric()[0].GetCounter() != nil {
+			values[m.GetName()] = m.GetMetric()[0].GetCounter().GetValue()
+		} else {
+			values[m.GetName()] = m.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"search_indexer_db_pool_acquire_count":            10,
+		"search_indexer_db_pool_acquire_duration_seconds": 1.5,
+		"search_indexer_db_pool_acquired_conns":           3,
+		"search_indexer_db_pool_canceled_acquire_count":   1,
+		"search_indexer_db_pool_empty_acquire_count":      2,
+		"search_indexer_db_pool_idle_conns":               5,
+		"search_indexer_db_pool_max_conns":                10,
+		"search_indexer_db_pool_total_conns":              8,
+	}, values)
+}
@@ -26,12 +26,180 @@ var (
 		Help: "Total requests the search indexer is processing at a given time.",
 	})
 
+	LimiterRequests = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_limiter_requests",
+		Help: "Sync requests processing with a slot of the request limiter. The limit is REQUEST_LIMIT.",
+	})
+
+	// The series of a cluster is deleted when it doesn't have requests, so there are at most REQUEST_LIMIT series
+	// (and the hub cluster) at a time.
+	ClusterRequestsInFlight = promauto.With(PromRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "search_indexer_cluster_requests_in_flight",
+		Help: "Sync requests from the cluster processing or parked waiting for the previous request.",
+	}, []string{"managed_cluster_name"})
+
+	RequestsRejected = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_requests_rejected",
+		Help: "Total sync requests rejected with 429 Too Many Requests, by reason (cluster_busy, replaced, " +
+			"request_limit, large_request_limit, or cluster_rate).",
+	}, []string{"reason"})
+
 	RequestSize = promauto.With(PromRegistry).NewHistogram(prometheus.HistogramOpts{
 		Name:    "search_indexer_request_size",
 		Help:    "Total changes (add, update, delete) in the search indexer request (from managed cluster).",
 		Buckets: []float64{50, 100, 200, 500, 5000, 10000, 25000, 50000, 100000, 200000},
 	})
 
+	ProbeCount = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_probe_count",
+		Help: "Total probe requests (liveness, readiness, heartbeat) received by the search indexer.",
+	}, []string{"probe"})
+
+	StaleClusters = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_stale_clusters",
+		Help: "Clusters that haven't synced within STALE_CLUSTER_TTL_HOURS, found by the last stale cluster cleanup.",
+	})
+
+	StaleClustersDeleted = promauto.With(PromRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_stale_clusters_deleted",
+		Help: "Total stale clusters with resources and edges deleted by the stale cluster cleanup.",
+	})
+
+	ClustersStaleData = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_clusters_stale_data",
+		Help: "Clusters flagged with searchDataStale because they haven't synced within STALE_DATA_WINDOW_MS.",
+	})
+
+	KafkaRecords = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_kafka_records",
+		Help: "Total resource changes sent to Kafka, by result (published, failed, dropped, or filtered).",
+	}, []string{"result"})
+
+	KafkaSyncEvents = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_kafka_sync_events",
+		Help: "Total sync events consumed from Kafka, by result (applied, skipped, invalid, or rejected).",
+	}, []string{"result"})
+
+	ClustersCacheSize = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_clusters_cache_size",
+		Help: "Cluster nodes kept in the clusters cache of this replica.",
+	})
+
+	ClusterCacheDiscrepancies = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_cluster_cache_discrepancies",
+		Help: "Total clusters cache entries that didn't match the database, by type (changed or deleted).",
+	}, []string{"type"})
+
+	IsLeader = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_is_leader",
+		Help: "Set to 1 while this replica holds the leader lease and runs the clustersync.",
+	})
+
+	Leader = promauto.With(PromRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "search_indexer_leader",
+		Help: "Set to 1 for the identity of the current leader, as observed by this replica.",
+	}, []string{"leader"})
+
+	LeaderTransitions = promauto.With(PromRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_leader_transitions",
+		Help: "Total leader changes observed by this replica.",
+	})
+
+	BatchSize = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_batch_size",
+		Help: "Current size of the database batches with DB_BATCH_ADAPTIVE.",
+	})
+
+	BatchQueueDepth = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_batch_queue_depth",
+		Help: "Batches waiting for a worker to be sent to the database.",
+	})
+
+	BatchDuration = promauto.With(PromRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "search_indexer_batch_duration",
+		Help:    "Time (seconds) to send a batch to the database and read the results. Includes the retries.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	BatchStatements = promauto.With(PromRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "search_indexer_batch_statements",
+		Help:    "Statements in each batch sent to the database. Includes the retries.",
+		Buckets: []float64{1, 10, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+	})
+
+	BatchRetries = promauto.With(PromRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_batch_retries",
+		Help: "Total batches sent again as two smaller batches after an error.",
+	})
+
+	BatchSplitDepth = promauto.With(PromRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "search_indexer_batch_split_depth",
+		Help:    "Number of times a batch was divided to isolate the failing items.",
+		Buckets: []float64{1, 2, 4, 6, 8, 10, 12},
+	})
+
+	BatchFailedItems = promauto.With(PromRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_batch_failed_items",
+		Help: "Total batch items that failed after isolating them in a batch of one.",
+	})
+
+	OutageBufferItems = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_outage_buffer_items",
+		Help: "Batch items kept in memory while the database is unavailable.",
+	})
+
+	ClusterDeletes = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_cluster_deletes",
+		Help: "Total deleted clusters, by the kind of the deleted object and the result (deleted or canceled).",
+	}, []string{"kind", "result"})
+
+	ClusterDeleteRows = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_cluster_delete_rows",
+		Help: "Total rows deleted from the search tables when a cluster is deleted, by table.",
+	}, []string{"table"})
+
+	PendingClusterUpserts = promauto.With(PromRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_pending_cluster_upserts",
+		Help: "Cluster nodes that failed to write to the database and are waiting to retry.",
+	})
+
+	LastSyncTimestamp = promauto.With(PromRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "search_indexer_last_sync_timestamp_seconds",
+		Help: "Unix time of the last successful sync from the cluster processed by this replica.",
+	}, []string{"managed_cluster_name"})
+
+	ClusterDrifted = promauto.With(PromRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "search_indexer_cluster_drifted",
+		Help: "Set to 1 for clusters with data that doesn't match the totals reported by the collector.",
+	}, []string{"managed_cluster_name"})
+
+	OrphanEdgesDeleted = promauto.With(PromRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_orphan_edges_deleted",
+		Help: "Total edges deleted because the source or destination resource doesn't exist.",
+	})
+
+	UnresolvedEdges = promauto.With(PromRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_unresolved_edges",
+		Help: "Total edges from sync requests not stored because the source or destination resource doesn't exist.",
+	})
+
+	MaintenanceDuration = promauto.With(PromRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_indexer_maintenance_duration",
+		Help:    "Time (seconds) to run VACUUM or ANALYZE on the search tables.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	}, []string{"table", "operation"})
+
+	DBOperationDuration = promauto.With(PromRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_indexer_db_operation_duration",
+		Help:    "Time (seconds) of the database operations, by operation.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+
+	Errors = promauto.With(PromRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "search_indexer_errors",
+		Help: "Total errors, by component (database, server, clustersync, or kafka) and error type.",
+	}, []string{"component", "error_type"})
+
 	// FUTURE: The summary metric could combine RequestCount and RequestDuration into a single metric.
 	// RequestSummary = promauto.With(PromRegistry).NewSummaryVec(prometheus.SummaryOpts{
 	// 	Name: "search_indexer_requests_summary",
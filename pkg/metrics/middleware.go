@@ -14,6 +14,9 @@ func PrometheusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		clusterName := params["id"]
+		if hub := params["hub"]; hub != "" {
+			clusterName = hub + "/" + clusterName // Cluster of another hub, see database/federation.go
+		}
 
 		// Add the managed_cluster_name label to metrics.
 		clusterNameLabel := prometheus.Labels{"managed_cluster_name": clusterName}
@@ -21,7 +21,12 @@ func Test_PrometheusInstrumentation(t *testing.T) {
 	// Validate the collected metrics.
 
 	collectedMetrics, _ := PromRegistry.Gather() // use the prometheus registry to confirm metrics have been scraped.
-	assert.Equal(t, 4, len(collectedMetrics))    // Validate total metrics collected.
+	assert.Equal(t, 22, len(collectedMetrics))   // Validate total metrics collected.
+
+	// Metrics are sorted by name. Skip the metrics before the request metrics.
+	for len(collectedMetrics) > 0 && collectedMetrics[0].GetName() != "search_indexer_request_count" {
+		collectedMetrics = collectedMetrics[1:]
+	}
 
 	// METRIC 1:  search_indexer_request_count
 	assert.Equal(t, "search_indexer_request_count", collectedMetrics[0].GetName())
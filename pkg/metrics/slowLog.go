@@ -8,7 +8,10 @@ import (
 	"k8s.io/klog/v2"
 )
 
-var DEFAULT_SLOW_LOG = time.Duration(config.Cfg.SlowLog) * time.Millisecond
+// Returns the SLOW_LOG time, it can be reloaded. See config/reload.go
+func DefaultSlowLog() time.Duration {
+	return time.Duration(config.Live().SlowLog) * time.Millisecond
+}
 
 // Record the time when a function starts and logs if the function takes more than the expected duration.
 // The returned function should be invoked with defer.
@@ -17,12 +20,26 @@ func SlowLog(msg string, logAfter time.Duration) func() {
 
 	// This function should be invoked with defer to execute at the end of the caller function.
 	return func() {
-		if (logAfter > 0 && time.Since(start) > logAfter) || (time.Since(start) > DEFAULT_SLOW_LOG) {
+		if (logAfter > 0 && time.Since(start) > logAfter) || (time.Since(start) > DefaultSlowLog()) {
 			klog.Warningf("%s - %s", time.Since(start).Round(time.Millisecond), msg)
 		}
 	}
 }
 
+// Records the duration of a database operation and logs it if it takes more than the SLOW_LOG time.
+// The returned function should be invoked with defer, or after the operation completes.
+func SlowDBOperation(operation, msg string) func() {
+	start := time.Now()
+
+	return func() {
+		elapsed := time.Since(start)
+		DBOperationDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+		if elapsed > DefaultSlowLog() {
+			klog.Warningf("%s - %s", elapsed.Round(time.Millisecond), msg)
+		}
+	}
+}
+
 // Logs the duration of a step in a process and reset the timer.
 func LogStepDuration(timer *time.Time, cluster, message string) {
 	klog.V(5).Infof("\t> %6s\t [%12s] %s", time.Since(*timer).Round(time.Millisecond), cluster, message)
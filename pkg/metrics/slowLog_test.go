@@ -0,0 +1,53 @@
+// Copyright Contributors to the Open Cluster Management project
+package metrics
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2"
+)
+
+// Should record the duration and log the operations slower than the SLOW_LOG time.
+func Test_SlowDBOperation(t *testing.T) {
+	tunables := config.Live()
+	tunables.SlowLog = 5
+	config.SetTunables(&tunables)
+	defer func() {
+		config.SetTunables(nil)
+		DBOperationDuration.Reset()
+	}()
+
+	// Redirect the logger output.
+	var buf bytes.Buffer
+	klog.LogToStderr(false)
+	klog.SetOutput(&buf)
+	defer func() {
+		klog.SetOutput(os.Stderr)
+	}()
+
+	SlowDBOperation("count", "Fast count.")()
+	done := SlowDBOperation("batch", "Slow batch.")
+	time.Sleep(10 * time.Millisecond)
+	done()
+	klog.Flush()
+
+	assert.NotContains(t, buf.String(), "Fast count.")
+	assert.Contains(t, buf.String(), "Slow batch.")
+
+	families, err := PromRegistry.Gather()
+	assert.Nil(t, err)
+	var observed uint64
+	for _, family := range families {
+		if family.GetName() == "search_indexer_db_operation_duration" {
+			for _, m := range family.GetMetric() {
+				observed += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	assert.Equal(t, uint64(2), observed)
+}
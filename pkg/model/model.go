@@ -15,6 +15,7 @@ type Edge struct {
 	SourceUID, DestUID   string
 	EdgeType             string
 	SourceKind, DestKind string
+	Properties           map[string]interface{} `json:",omitempty"` // Optional. For example, the owner kind.
 }
 
 // SyncEvent - Object sent by the collector with the resources to change.
@@ -28,6 +29,14 @@ type SyncEvent struct {
 	AddEdges    []Edge
 	DeleteEdges []Edge
 	RequestId   int
+
+	// Totals in the collector after this event is applied. Optional, used by the consistency check.
+	TotalResources int `json:"totalResources,omitempty"`
+	TotalEdges     int `json:"totalEdges,omitempty"`
+	// Checksum of the collector resources after this event is applied. Optional, see database.ClusterChecksum.
+	Checksum int64 `json:"checksum,omitempty"`
+	// Version of the collector. Optional, stored in the collectorVersion property of the Cluster node.
+	CollectorVersion string `json:"collectorVersion,omitempty"`
 }
 
 // SyncResponse - Response to a SyncEvent
@@ -44,8 +53,15 @@ type SyncResponse struct {
 	DeleteErrors      []SyncError
 	AddEdgeErrors     []SyncError
 	DeleteEdgeErrors  []SyncError
+	Truncated         []SyncError // Resources stored without some properties because of the size limits.
+	UnresolvedEdges   []SyncError // Edges not stored because the source or destination resource doesn't exist.
+	BatchRetries      int         // Batches sent again as two smaller batches after an error.
+	BatchSplitDepth   int         // Max number of times a batch was divided to isolate the failing items.
+	BatchFailedItems  int         // Items that failed after isolating them in a batch of one.
+	Buffered          int         // Items kept in memory during a database outage, written when it's available.
 	Version           string
 	RequestId         int
+	ResyncRequired    bool // The data in the database doesn't match the collector totals or checksum.
 }
 
 // SyncError is used to respond with errors.
@@ -0,0 +1,129 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// Writes documents with the bulk API. Sends a request each time the batch size is reached.
+// Each operation succeeds or fails independently, so the failed operations are reported in the sync response,
+// and don't need the retry used to isolate errors in a Postgres batch.
+type bulkWriter struct {
+	ctx          context.Context
+	store        *Store
+	syncResponse *model.SyncResponse
+	body         bytes.Buffer
+	ops          []bulkOp
+	created      map[string]int // Documents created by action.
+	updated      map[string]int // Documents updated by action.
+	err          error
+}
+
+type bulkOp struct {
+	opType string
+	action string // Used to report errors.
+	uid    string // Used to report errors.
+}
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int             `json:"status"`
+	Result string          `json:"result"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+func (s *Store) newBulkWriter(ctx context.Context, syncResponse *model.SyncResponse) *bulkWriter {
+	return &bulkWriter{
+		ctx:          ctx,
+		store:        s,
+		syncResponse: syncResponse,
+		created:      map[string]int{},
+		updated:      map[string]int{},
+	}
+}
+
+// Adds an operation to the bulk request. The doc is ignored for delete operations.
+func (w *bulkWriter) add(opType, index, id string, doc interface{}, action, uid string) {
+	if w.err != nil {
+		return
+	}
+	meta, _ := json.Marshal(map[string]interface{}{opType: map[string]string{"_index": index, "_id": id}})
+	w.body.Write(meta)
+	w.body.WriteByte('\n')
+	if opType != "delete" {
+		source, _ := json.Marshal(doc)
+		w.body.Write(source)
+		w.body.WriteByte('\n')
+	}
+	w.ops = append(w.ops, bulkOp{opType: opType, action: action, uid: uid})
+	if len(w.ops) >= w.store.getBatchSize() {
+		w.err = w.flush()
+	}
+}
+
+// Sends the pending operations. Waits for the refresh, so the totals and checksum include the changes.
+func (w *bulkWriter) flush() error {
+	if w.err != nil || len(w.ops) == 0 {
+		return w.err
+	}
+	ops := w.ops
+	body := append([]byte{}, w.body.Bytes()...)
+	w.ops = nil
+	w.body.Reset()
+
+	var res bulkResponse
+	if err := w.store.client.do(w.ctx, http.MethodPost, "/_bulk?refresh=wait_for", body, &res); err != nil {
+		return err
+	}
+	for i, item := range res.Items {
+		if i >= len(ops) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusNotFound && ops[i].opType == "delete":
+				// Already deleted.
+			case result.Status >= 300:
+				klog.Errorf("ERROR processing bulk operation %+v. %s", ops[i], result.Error)
+				w.addError(ops[i])
+			case result.Result == "created":
+				w.created[ops[i].action]++
+			case result.Result == "updated":
+				w.updated[ops[i].action]++
+			}
+		}
+	}
+	return nil
+}
+
+func (w *bulkWriter) addError(op bulkOp) {
+	var errorArray *[]model.SyncError
+	switch op.action {
+	case "addResource":
+		errorArray = &w.syncResponse.AddErrors
+	case "updateResource":
+		errorArray = &w.syncResponse.UpdateErrors
+	case "deleteResource":
+		errorArray = &w.syncResponse.DeleteErrors
+	case "addEdge":
+		errorArray = &w.syncResponse.AddEdgeErrors
+	case "deleteEdge":
+		errorArray = &w.syncResponse.DeleteEdgeErrors
+	default:
+		klog.Error("Unable to process sync error with type: ", op.action)
+		return
+	}
+	*errorArray = append(*errorArray,
+		model.SyncError{ResourceUID: op.uid, Message: "Resource generated an error while updating OpenSearch."})
+}
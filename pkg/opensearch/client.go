@@ -0,0 +1,102 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Minimal client for the OpenSearch REST API. Uses only the APIs shared with Elasticsearch, so the store works
+// with both.
+type client struct {
+	url        string
+	user       string
+	pass       string
+	httpClient *http.Client
+}
+
+func newClient(url, user, pass, caCertFile string) (*client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCertFile != "" {
+		caCert, err := os.ReadFile(caCertFile) // #nosec G304
+		if err != nil {
+			return nil, fmt.Errorf("Error reading OpenSearch CA certificate. %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("Error parsing OpenSearch CA certificate %s.", caCertFile)
+		}
+	}
+	return &client{
+		url:  strings.TrimSuffix(url, "/"),
+		user: user,
+		pass: pass,
+		httpClient: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Sends a request and decodes the JSON response into out, if not nil. The body is encoded as JSON, unless it's
+// already a []byte like the NDJSON body of the bulk API.
+func (c *client) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+		contentType = "application/x-ndjson"
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &responseError{status: res.StatusCode, method: method, path: path, message: string(msg)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+type responseError struct {
+	status  int
+	method  string
+	path    string
+	message string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("OpenSearch %s %s responded with status %d. %s", e.method, e.path, e.status, e.message)
+}
@@ -0,0 +1,425 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/logging"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// OpenSearch storage backend. Selected with STORAGE_BACKEND=opensearch
+// Uses 3 indices, named with the OPENSEARCH_INDEX_PREFIX.
+//   - <prefix>-resources: A document per resource, with the resource uid as the document id.
+//   - <prefix>-edges: A document per edge, with the source, destination, and edge type as the document id.
+//     Relationships are queried with terms queries on sourceId and destId, like the search.edges table.
+//   - <prefix>-clusters: A document per cluster, with the Cluster node and the last sync.
+// The resource properties are mapped as text with a keyword sub-field, so consumers get relevance-ranked
+// free-text search and exact filters. Map properties like labels are stored as a list of key=value strings,
+// because label keys with dots would conflict with the object mapping.
+
+// Store writing the indexed data to OpenSearch.
+type Store struct {
+	client         *client
+	batchSize      int // Overrides the reloadable DB_BATCH_SIZE when set.
+	resourcesIndex string
+	edgesIndex     string
+	clustersIndex  string
+}
+
+var _ database.Store = &Store{}
+
+type resourceDoc struct {
+	UID     string                 `json:"uid"`
+	Cluster string                 `json:"cluster"`
+	Hash    int64                  `json:"hash"`
+	Gen     int64                  `json:"gen,omitempty"` // Resync generation, see ResyncData()
+	Data    map[string]interface{} `json:"data"`
+}
+
+type edgeDoc struct {
+	SourceID   string                 `json:"sourceId"`
+	SourceKind string                 `json:"sourceKind"`
+	DestID     string                 `json:"destId"`
+	DestKind   string                 `json:"destKind"`
+	EdgeType   string                 `json:"edgeType"`
+	Cluster    string                 `json:"cluster"`
+	Gen        int64                  `json:"gen,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Creates the store using the OPENSEARCH_* configuration.
+func NewStore() (*Store, error) {
+	c, err := newClient(config.Cfg.OpenSearchURL, config.Cfg.OpenSearchUser, config.Cfg.OpenSearchPass,
+		config.Cfg.OpenSearchCACert)
+	if err != nil {
+		return nil, err
+	}
+	prefix := config.Cfg.OpenSearchIndex
+	return &Store{
+		client:         c,
+		resourcesIndex: prefix + "-resources",
+		edgesIndex:     prefix + "-edges",
+		clustersIndex:  prefix + "-clusters",
+	}, nil
+}
+
+// Returns the max operations in a bulk request.
+func (s *Store) getBatchSize() int {
+	if s.batchSize > 0 {
+		return s.batchSize
+	}
+	return config.Live().DBBatchSize
+}
+
+// Creates the indices if they don't exist.
+func (s *Store) InitializeIndices(ctx context.Context) error {
+	// Map all the resource properties as text with a keyword sub-field. Dynamic mapping would use the type of
+	// the first value seen, and reject resources with a different type for the same property.
+	dataTemplates := []map[string]interface{}{}
+	for _, mappingType := range []string{"string", "long", "double", "boolean"} {
+		dataTemplates = append(dataTemplates, map[string]interface{}{
+			"data_" + mappingType: map[string]interface{}{
+				"path_match":         "data.*",
+				"match_mapping_type": mappingType,
+				"mapping": map[string]interface{}{
+					"type":   "text",
+					"fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256}},
+				},
+			},
+		})
+	}
+	keyword := map[string]string{"type": "keyword"}
+	long := map[string]string{"type": "long"}
+	indices := map[string]interface{}{
+		s.resourcesIndex: map[string]interface{}{
+			"date_detection":    false,
+			"dynamic_templates": dataTemplates,
+			"properties":        map[string]interface{}{"uid": keyword, "cluster": keyword, "hash": long, "gen": long},
+		},
+		s.edgesIndex: map[string]interface{}{
+			"properties": map[string]interface{}{"sourceId": keyword, "sourceKind": keyword, "destId": keyword,
+				"destKind": keyword, "edgeType": keyword, "cluster": keyword, "gen": long,
+				"properties": map[string]string{"type": "object"}},
+		},
+		s.clustersIndex: map[string]interface{}{
+			"date_detection":    false,
+			"dynamic_templates": dataTemplates,
+			"properties": map[string]interface{}{"uid": keyword, "cluster": keyword,
+				"lastSync": map[string]string{"type": "date"}, "reportedResources": long, "reportedEdges": long},
+		},
+	}
+	for index, mappings := range indices {
+		err := s.client.do(ctx, http.MethodPut, "/"+index, map[string]interface{}{"mappings": mappings}, nil)
+		var resErr *responseError
+		if errors.As(err, &resErr) && resErr.status == http.StatusBadRequest &&
+			bytes.Contains([]byte(resErr.message), []byte("resource_already_exists_exception")) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Error creating index %s. %w", index, err)
+		}
+		klog.Infof("Created OpenSearch index %s.", index)
+	}
+	return nil
+}
+
+// Applies the changes from a sync event with the bulk API.
+func (s *Store) SyncData(ctx context.Context, event model.SyncEvent, clusterName string,
+	syncResponse *model.SyncResponse) error {
+
+	defer metrics.SlowLog(fmt.Sprintf("Slow Sync from cluster %s.", clusterName), 0)()
+	w := s.newBulkWriter(ctx, syncResponse)
+	for _, resource := range event.AddResources {
+		w.add("index", s.resourcesIndex, resource.UID, newResourceDoc(resource, clusterName, 0), "addResource",
+			resource.UID)
+	}
+	for _, resource := range event.UpdateResources {
+		w.add("index", s.resourcesIndex, resource.UID, newResourceDoc(resource, clusterName, 0), "updateResource",
+			resource.UID)
+	}
+	deletedUIDs := make([]string, len(event.DeleteResources))
+	for i, resource := range event.DeleteResources {
+		deletedUIDs[i] = resource.UID
+		w.add("delete", s.resourcesIndex, resource.UID, nil, "deleteResource", resource.UID)
+	}
+	for _, edge := range event.AddEdges {
+		w.add("index", s.edgesIndex, edgeID(edge), newEdgeDoc(edge, clusterName, 0), "addEdge", edge.SourceUID)
+	}
+	for _, edge := range event.DeleteEdges {
+		w.add("delete", s.edgesIndex, edgeID(edge), nil, "deleteEdge", edge.SourceUID)
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	// Delete the edges pointing to the deleted resources. Terms queries are limited to 65536 terms.
+	for start := 0; start < len(deletedUIDs); start += 10000 {
+		end := start + 10000
+		if end > len(deletedUIDs) {
+			end = len(deletedUIDs)
+		}
+		query := map[string]interface{}{"bool": map[string]interface{}{"should": []interface{}{
+			map[string]interface{}{"terms": map[string]interface{}{"sourceId": deletedUIDs[start:end]}},
+			map[string]interface{}{"terms": map[string]interface{}{"destId": deletedUIDs[start:end]}},
+		}}}
+		if _, err := s.deleteByQuery(ctx, s.edgesIndex, query); err != nil {
+			return err
+		}
+	}
+
+	syncResponse.TotalAdded = len(event.AddResources) - len(syncResponse.AddErrors)
+	syncResponse.TotalUpdated = len(event.UpdateResources) - len(syncResponse.UpdateErrors)
+	syncResponse.TotalDeleted = len(event.DeleteResources) - len(syncResponse.DeleteErrors)
+	syncResponse.TotalEdgesAdded = len(event.AddEdges) - len(syncResponse.AddEdgeErrors)
+	syncResponse.TotalEdgesDeleted = len(event.DeleteEdges) - len(syncResponse.DeleteEdgeErrors)
+	klog.V(1).Infof("Completed sync of cluster %12s", clusterName)
+	return nil
+}
+
+// Replaces the cluster data with the state in the sync event. All documents are indexed with a new generation,
+// then the cluster documents from previous generations are deleted.
+func (s *Store) ResyncData(ctx context.Context, event model.SyncEvent, clusterName string,
+	syncResponse *model.SyncResponse) error {
+
+	defer metrics.SlowLog(fmt.Sprintf("Slow resync from %12s. RequestId: %d", clusterName, event.RequestId), 0)()
+	klog.Infof(
+		"Starting resync from %12s. This is normal, but it could be a problem if it happens often.", clusterName)
+
+	gen := time.Now().UnixNano()
+	w := s.newBulkWriter(ctx, syncResponse)
+	for _, resource := range event.AddResources {
+		w.add("index", s.resourcesIndex, resource.UID, newResourceDoc(resource, clusterName, gen), "addResource",
+			resource.UID)
+	}
+	for _, edge := range event.AddEdges {
+		w.add("index", s.edgesIndex, edgeID(edge), newEdgeDoc(edge, clusterName, gen), "addEdge", edge.SourceUID)
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	previousGen := map[string]interface{}{"bool": map[string]interface{}{
+		"filter":   map[string]interface{}{"term": map[string]interface{}{"cluster": clusterName}},
+		"must_not": map[string]interface{}{"term": map[string]interface{}{"gen": gen}},
+	}}
+	deletedResources, err := s.deleteByQuery(ctx, s.resourcesIndex, previousGen)
+	if err != nil {
+		return err
+	}
+	deletedEdges, err := s.deleteByQuery(ctx, s.edgesIndex, previousGen)
+	if err != nil {
+		return err
+	}
+
+	syncResponse.TotalAdded = w.created["addResource"]
+	syncResponse.TotalUpdated = w.updated["addResource"]
+	syncResponse.TotalDeleted = deletedResources
+	syncResponse.TotalEdgesAdded = w.created["addEdge"]
+	syncResponse.TotalEdgesDeleted = deletedEdges
+	klog.V(1).Infof("Completed resync of cluster %12s.\t RequestId: %d", clusterName, event.RequestId)
+	return nil
+}
+
+// Returns the number of resources and edges for the cluster.
+func (s *Store) ClusterTotals(ctx context.Context, clusterName string) (resources int, edges int, e error) {
+	query := map[string]interface{}{"query": clusterQuery(clusterName)}
+	var count struct {
+		Count int `json:"count"`
+	}
+	if e = s.client.do(ctx, http.MethodPost, "/"+s.resourcesIndex+"/_count", query, &count); e != nil {
+		return 0, 0, e
+	}
+	resources = count.Count
+	if e = s.client.do(ctx, http.MethodPost, "/"+s.edgesIndex+"/_count", query, &count); e != nil {
+		return 0, 0, e
+	}
+	return resources, count.Count, nil
+}
+
+// Returns the sum of the resource hashes for the cluster. See database.ClusterChecksum()
+func (s *Store) ClusterChecksum(ctx context.Context, clusterName string) (int64, error) {
+	query := map[string]interface{}{
+		"size":  0,
+		"query": clusterQuery(clusterName),
+		"aggs":  map[string]interface{}{"checksum": map[string]interface{}{"sum": map[string]string{"field": "hash"}}},
+	}
+	var res struct {
+		Aggregations struct {
+			Checksum struct {
+				Value float64 `json:"value"`
+			} `json:"checksum"`
+		} `json:"aggregations"`
+	}
+	if err := s.client.do(ctx, http.MethodPost, "/"+s.resourcesIndex+"/_search", query, &res); err != nil {
+		return 0, err
+	}
+	return int64(res.Aggregations.Checksum.Value), nil
+}
+
+// Records the last sync and the collector totals in the cluster document, and the sync properties of the Cluster
+// node. The partial update merges them with the Cluster node data. The consistency check isn't implemented for
+// OpenSearch, so it never requests a resync.
+func (s *Store) UpdateLastSync(ctx context.Context, clusterName string, event model.SyncEvent) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	data := map[string]interface{}{"lastSyncTime": now}
+	if event.CollectorVersion != "" {
+		data["collectorVersion"] = event.CollectorVersion
+	}
+	doc := map[string]interface{}{"cluster": clusterName, "lastSync": now, "data": data}
+	if event.TotalResources > 0 || event.TotalEdges > 0 {
+		doc["reportedResources"] = event.TotalResources
+		doc["reportedEdges"] = event.TotalEdges
+	}
+	err := s.client.do(ctx, http.MethodPost, "/"+s.clustersIndex+"/_update/"+url.PathEscape(clusterName),
+		map[string]interface{}{"doc": doc, "doc_as_upsert": true}, nil)
+	if err != nil {
+		logging.SampledErrorf("Error updating last sync for cluster %s. %s", clusterName, err)
+	}
+	return false, err
+}
+
+// The bulk API already limits the requests to the batch size, OpenSearch rejects requests when its queues are
+// full.
+func (s *Store) Backpressure() (overloaded bool, retryAfter time.Duration) {
+	return false, 0
+}
+
+// Creates or updates the Cluster node in the cluster document.
+func (s *Store) UpsertCluster(ctx context.Context, resource model.Resource) {
+	clusterName, _ := resource.Properties["name"].(string)
+	doc := map[string]interface{}{"uid": resource.UID, "cluster": clusterName, "data": docData(resource.Properties)}
+	err := s.client.do(ctx, http.MethodPost, "/"+s.clustersIndex+"/_update/"+url.PathEscape(clusterName),
+		map[string]interface{}{"doc": doc, "doc_as_upsert": true}, nil)
+	if err != nil {
+		klog.Warningf("Error inserting/updating cluster %s: %s", clusterName, err)
+	}
+}
+
+// Deletes the cluster resources and edges, and optionally the cluster document.
+func (s *Store) DeleteClusterAndResources(ctx context.Context, clusterName string, deleteClusterNode bool) {
+	for _, index := range []string{s.resourcesIndex, s.edgesIndex} {
+		if _, err := s.deleteByQuery(ctx, index, clusterQuery(clusterName)); err != nil {
+			logging.SampledErrorf("Error deleting cluster %s from %s. %s", clusterName, index, err)
+			return
+		}
+	}
+	klog.V(2).Infof("Successfully deleted resources and edges for cluster %s from OpenSearch!", clusterName)
+	if deleteClusterNode {
+		err := s.client.do(ctx, http.MethodDelete, "/"+s.clustersIndex+"/_doc/"+url.PathEscape(clusterName), nil, nil)
+		var resErr *responseError
+		if err != nil && !(errors.As(err, &resErr) && resErr.status == http.StatusNotFound) {
+			logging.SampledErrorf("Error deleting cluster node %s. %s", clusterName, err)
+		}
+	}
+}
+
+// Returns the clusters with resources or a cluster document, excluding the local-cluster.
+func (s *Store) GetManagedClusters(ctx context.Context) ([]string, error) {
+	query := map[string]interface{}{
+		"size": 0,
+		"aggs": map[string]interface{}{
+			"clusters": map[string]interface{}{"terms": map[string]interface{}{"field": "cluster", "size": 10000}},
+		},
+	}
+	var res struct {
+		Aggregations struct {
+			Clusters struct {
+				Buckets []struct {
+					Key string `json:"key"`
+				} `json:"buckets"`
+			} `json:"clusters"`
+		} `json:"aggregations"`
+	}
+	clusters := map[string]bool{}
+	for _, index := range []string{s.resourcesIndex, s.clustersIndex} {
+		if err := s.client.do(ctx, http.MethodPost, "/"+index+"/_search", query, &res); err != nil {
+			klog.Errorf("Error querying managed clusters from %s. Error: [%+v]", index, err)
+			return nil, err
+		}
+		for _, bucket := range res.Aggregations.Clusters.Buckets {
+			clusters[bucket.Key] = true
+		}
+	}
+	managedClusters := make([]string, 0, len(clusters))
+	for cluster := range clusters {
+		if cluster != "" && cluster != "local-cluster" {
+			managedClusters = append(managedClusters, cluster)
+		}
+	}
+	sort.Strings(managedClusters)
+	return managedClusters, nil
+}
+
+// Deletes the documents matching the query. Returns the number of documents deleted.
+func (s *Store) deleteByQuery(ctx context.Context, index string, query interface{}) (int, error) {
+	var res struct {
+		Deleted int `json:"deleted"`
+	}
+	err := s.client.do(ctx, http.MethodPost, "/"+index+"/_delete_by_query?conflicts=proceed&refresh=true",
+		map[string]interface{}{"query": query}, &res)
+	return res.Deleted, err
+}
+
+func clusterQuery(clusterName string) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{"cluster": clusterName}}
+}
+
+func newResourceDoc(resource model.Resource, clusterName string, gen int64) resourceDoc {
+	data, _ := json.Marshal(resource.Properties)
+	return resourceDoc{
+		UID:     resource.UID,
+		Cluster: clusterName,
+		Hash:    database.ResourceHash(resource.UID, data),
+		Gen:     gen,
+		Data:    docData(resource.Properties),
+	}
+}
+
+// Converts map properties, like labels, to a list of key=value strings.
+func docData(properties map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		if m, ok := value.(map[string]interface{}); ok {
+			pairs := make([]string, 0, len(m))
+			for k, v := range m {
+				pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+			}
+			sort.Strings(pairs)
+			data[key] = pairs
+		} else {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+func newEdgeDoc(edge model.Edge, clusterName string, gen int64) edgeDoc {
+	return edgeDoc{
+		SourceID:   edge.SourceUID,
+		SourceKind: edge.SourceKind,
+		DestID:     edge.DestUID,
+		DestKind:   edge.DestKind,
+		EdgeType:   edge.EdgeType,
+		Cluster:    clusterName,
+		Gen:        gen,
+		Properties: edge.Properties,
+	}
+}
+
+// Edges are unique by source, destination, and type, same as the search.edges primary key.
+func edgeID(edge model.Edge) string {
+	return edge.SourceUID + "|" + edge.EdgeType + "|" + edge.DestUID
+}
@@ -0,0 +1,192 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package opensearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Builds a store with a fake OpenSearch server.
+func buildMockStore(t *testing.T, handler http.HandlerFunc) *Store {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &Store{
+		client:         &client{url: server.URL, httpClient: server.Client()},
+		batchSize:      100,
+		resourcesIndex: "search-resources",
+		edgesIndex:     "search-edges",
+		clustersIndex:  "search-clusters",
+	}
+}
+
+// Reads the operations in a bulk request body.
+func readBulkOps(t *testing.T, r *http.Request) []map[string]map[string]string {
+	ops := []map[string]map[string]string{}
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var op map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, op)
+		if _, isDelete := op["delete"]; !isDelete {
+			scanner.Scan() // Skip the document.
+		}
+	}
+	return ops
+}
+
+func Test_SyncData(t *testing.T) {
+	defer testutils.SupressConsoleOutput()()
+	var bulkOps []map[string]map[string]string
+	var deleteEdgesQuery string
+	store := buildMockStore(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_bulk":
+			assert.Equal(t, "wait_for", r.URL.Query().Get("refresh"))
+			bulkOps = readBulkOps(t, r)
+			_, _ = w.Write([]byte(`{"errors":true,"items":[
+				{"index":{"status":201,"result":"created"}},
+				{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}},
+				{"delete":{"status":404,"result":"not_found"}},
+				{"index":{"status":201,"result":"created"}}]}`))
+		case "/search-edges/_delete_by_query":
+			body, _ := io.ReadAll(r.Body)
+			deleteEdgesQuery = string(body)
+			_, _ = w.Write([]byte(`{"deleted":1}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	event := model.SyncEvent{
+		AddResources:    []model.Resource{{UID: "uid-1", Properties: map[string]interface{}{"kind": "Pod"}}},
+		UpdateResources: []model.Resource{{UID: "uid-2", Properties: map[string]interface{}{"kind": "Pod"}}},
+		DeleteResources: []model.DeleteResourceEvent{{UID: "uid-3"}},
+		AddEdges:        []model.Edge{{SourceUID: "uid-1", DestUID: "uid-2", EdgeType: "ownedBy"}},
+	}
+	syncResponse := &model.SyncResponse{}
+
+	err := store.SyncData(context.Background(), event, "cluster-a", syncResponse)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(bulkOps))
+	assert.Equal(t, map[string]string{"_index": "search-resources", "_id": "uid-1"}, bulkOps[0]["index"])
+	assert.Equal(t, map[string]string{"_index": "search-resources", "_id": "uid-3"}, bulkOps[2]["delete"])
+	assert.Equal(t, map[string]string{"_index": "search-edges", "_id": "uid-1|ownedBy|uid-2"}, bulkOps[3]["index"])
+	assert.Equal(t, `{"query":{"bool":{"should":[{"terms":{"sourceId":["uid-3"]}},{"terms":{"destId":["uid-3"]}}]}}}`,
+		deleteEdgesQuery)
+	assert.Equal(t, []model.SyncError{{ResourceUID: "uid-2",
+		Message: "Resource generated an error while updating OpenSearch."}}, syncResponse.UpdateErrors)
+	assert.Equal(t, 1, syncResponse.TotalAdded)
+	assert.Equal(t, 0, syncResponse.TotalUpdated)
+	assert.Equal(t, 1, syncResponse.TotalDeleted)
+	assert.Equal(t, 1, syncResponse.TotalEdgesAdded)
+}
+
+// Should index all documents with a new generation, then delete the documents from previous generations.
+func Test_ResyncData(t *testing.T) {
+	requests := []string{}
+	store := buildMockStore(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/_bulk":
+			_, _ = w.Write([]byte(`{"errors":false,"items":[
+				{"index":{"status":201,"result":"created"}},
+				{"index":{"status":200,"result":"updated"}},
+				{"index":{"status":201,"result":"created"}}]}`))
+		case "/search-resources/_delete_by_query":
+			body, _ := io.ReadAll(r.Body)
+			assert.True(t, strings.Contains(string(body), `"must_not":{"term":{"gen":`))
+			_, _ = w.Write([]byte(`{"deleted":3}`))
+		case "/search-edges/_delete_by_query":
+			_, _ = w.Write([]byte(`{"deleted":2}`))
+		}
+	})
+	event := model.SyncEvent{
+		ClearAll:     true,
+		AddResources: []model.Resource{{UID: "uid-1"}, {UID: "uid-2"}},
+		AddEdges:     []model.Edge{{SourceUID: "uid-1", DestUID: "uid-2", EdgeType: "ownedBy"}},
+	}
+	syncResponse := &model.SyncResponse{}
+
+	err := store.ResyncData(context.Background(), event, "cluster-a", syncResponse)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/_bulk", "/search-resources/_delete_by_query", "/search-edges/_delete_by_query"},
+		requests)
+	assert.Equal(t, model.SyncResponse{TotalAdded: 1, TotalUpdated: 1, TotalDeleted: 3, TotalEdgesAdded: 1,
+		TotalEdgesDeleted: 2}, *syncResponse)
+}
+
+func Test_ClusterTotals(t *testing.T) {
+	store := buildMockStore(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"query":{"term":{"cluster":"cluster-a"}}}`, string(body))
+		if r.URL.Path == "/search-resources/_count" {
+			_, _ = w.Write([]byte(`{"count":5}`))
+		} else {
+			_, _ = w.Write([]byte(`{"count":3}`))
+		}
+	})
+
+	resources, edges, err := store.ClusterTotals(context.Background(), "cluster-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, resources)
+	assert.Equal(t, 3, edges)
+}
+
+func Test_GetManagedClusters(t *testing.T) {
+	store := buildMockStore(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search-resources/_search" {
+			_, _ = w.Write([]byte(`{"aggregations":{"clusters":{"buckets":[{"key":"cluster-b"},{"key":"local-cluster"}]}}}`))
+		} else {
+			_, _ = w.Write([]byte(`{"aggregations":{"clusters":{"buckets":[{"key":"cluster-a"},{"key":"cluster-b"}]}}}`))
+		}
+	})
+
+	clusters, err := store.GetManagedClusters(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cluster-a", "cluster-b"}, clusters)
+}
+
+// Should ignore the indices that already exist.
+func Test_InitializeIndices(t *testing.T) {
+	created := 0
+	store := buildMockStore(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		if r.URL.Path == "/search-edges" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"type":"resource_already_exists_exception"}}`))
+			return
+		}
+		created++
+	})
+
+	err := store.InitializeIndices(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, created)
+}
+
+func Test_docData(t *testing.T) {
+	data := docData(map[string]interface{}{
+		"name":  "pod-a",
+		"label": map[string]interface{}{"app.kubernetes.io/name": "foo", "app": "bar"},
+	})
+
+	assert.Equal(t, map[string]interface{}{"name": "pod-a",
+		"label": []string{"app.kubernetes.io/name=foo", "app=bar"}}, data)
+}
@@ -0,0 +1,27 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"k8s.io/klog/v2"
+)
+
+// Rejects new sync requests while the database is falling behind, instead of accepting work we can't complete.
+// The Retry-After header tells the collector when the in-flight batches are expected to complete.
+func (s *ServerConfig) backpressureMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if overloaded, retryAfter := s.Dao.Backpressure(); overloaded {
+			clusterName := requestClusterName(r)
+			klog.Warningf("Rejecting sync from %s because the database is falling behind. Retry after %s",
+				clusterName, retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Indexer database is falling behind, retry later.", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
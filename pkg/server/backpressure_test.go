@@ -0,0 +1,72 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Holds the batches until released, to keep them in-flight.
+type blockingPool struct {
+	pgxmock.PgxPoolIface
+	release chan struct{}
+}
+
+func (p blockingPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	<-p.release
+	return p.PgxPoolIface.SendBatch(ctx, b)
+}
+
+// Should reject the sync request with 503 and Retry-After while the database is falling behind.
+func Test_backpressureMiddleware(t *testing.T) {
+	originalLimit := config.Cfg.BackpressureBatches
+	config.Cfg.BackpressureBatches = 1
+	defer func() { config.Cfg.BackpressureBatches = originalLimit }()
+	mockPool := testutils.NewMockPool(t)
+	pool := blockingPool{PgxPoolIface: mockPool, release: make(chan struct{})}
+	dao := database.NewDAO(pool)
+	server := ServerConfig{Dao: &dao}
+	handler := server.backpressureMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Request is accepted when there aren't batches in-flight.
+	req := httptest.NewRequest("POST", "https://localhost:3010/aggregator/clusters/cluster1/sync", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	// Hold a batch in-flight.
+	mockPool.ExpectBatch().
+		ExpectExec("INSERT into resources as r (uid, cluster, data, hash) values($1,$2,$3,$4) "+
+			"ON CONFLICT (uid) DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE r.uid=$1 and "+
+			"(r.data IS DISTINCT FROM $3 OR r.hash IS DISTINCT FROM $4 OR r.deleted_at IS NOT NULL)").
+		WithArgs("uid-1", "cluster2", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	done := make(chan struct{})
+	go func() {
+		event := model.SyncEvent{AddResources: []model.Resource{{UID: "uid-1", Properties: map[string]interface{}{}}}}
+		_ = server.Dao.SyncData(context.Background(), event, "cluster2", &model.SyncResponse{})
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { overloaded, _ := server.Dao.Backpressure(); return overloaded },
+		time.Second, time.Millisecond)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "1", res.Header().Get("Retry-After"))
+
+	close(pool.release)
+	<-done
+}
@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// Seconds the collector of a paused cluster waits to retry.
+const pausedRetryAfter = 60
+
+// Time of the last sync request accepted from each cluster with requestsPerMinute.
+var clusterLastRequest = map[string]time.Time{}
+var clusterLastRequestLock = sync.Mutex{}
+
+// Applies the per-cluster overrides to the sync requests. See config/clusterOverrides.go
+func clusterOverridesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clusterName := requestClusterName(r)
+		override := config.ClusterOverrideFor(clusterName)
+
+		if override.Paused {
+			klog.V(3).Infof("Rejecting sync from %s because the cluster is paused.", clusterName)
+			w.Header().Set("Retry-After", strconv.Itoa(pausedRetryAfter))
+			http.Error(w, "Sync is paused for this cluster, retry later.", http.StatusServiceUnavailable)
+			return
+		}
+		if override.MaxRequestSize > 0 {
+			if r.ContentLength > override.MaxRequestSize {
+				klog.Warningf("Rejecting sync from %s because the request is over the cluster max size. Size: %d",
+					clusterName, r.ContentLength)
+				http.Error(w, "Request is over the max size for this cluster.", http.StatusRequestEntityTooLarge)
+				return
+			}
+			// The length isn't known for chunked requests.
+			r.Body = http.MaxBytesReader(w, r.Body, override.MaxRequestSize)
+		}
+		if override.RequestsPerMinute > 0 {
+			if wait := reserveClusterRequest(clusterName, override.RequestsPerMinute); wait > 0 {
+				klog.V(3).Infof("Rejecting sync from %s because it's over the cluster request rate.", clusterName)
+				metrics.RequestsRejected.WithLabelValues("cluster_rate").Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too many requests from this cluster, retry later.", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Records the request if the cluster is within the rate, the requests are spaced by a minute / requestsPerMinute.
+// Otherwise, returns the time to wait for the next request.
+func reserveClusterRequest(clusterName string, requestsPerMinute int) time.Duration {
+	interval := time.Minute / time.Duration(requestsPerMinute)
+	clusterLastRequestLock.Lock()
+	defer clusterLastRequestLock.Unlock()
+	if elapsed := time.Since(clusterLastRequest[clusterName]); elapsed < interval {
+		return interval - elapsed
+	}
+	clusterLastRequest[clusterName] = time.Now()
+	return 0
+}
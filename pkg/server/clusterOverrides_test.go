@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveWithClusterOverrides(clusterName string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "https://localhost:3010/aggregator/clusters/"+clusterName+"/sync",
+		bytes.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"id": clusterName})
+	res := httptest.NewRecorder()
+	clusterOverridesMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(res, req)
+	return res
+}
+
+// Should reject the requests of a paused cluster.
+func Test_clusterOverridesMiddleware_paused(t *testing.T) {
+	config.SetClusterOverrides(map[string]config.ClusterOverride{"cluster-a": {Paused: true}})
+	defer config.SetClusterOverrides(nil)
+
+	res := serveWithClusterOverrides("cluster-a", nil)
+
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "60", res.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serveWithClusterOverrides("cluster-b", nil).Code)
+}
+
+// Should reject the requests over the max size of the cluster.
+func Test_clusterOverridesMiddleware_maxRequestSize(t *testing.T) {
+	config.SetClusterOverrides(map[string]config.ClusterOverride{"cluster-a": {MaxRequestSize: 10}})
+	defer config.SetClusterOverrides(nil)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serveWithClusterOverrides("cluster-a", make([]byte, 11)).Code)
+	assert.Equal(t, http.StatusOK, serveWithClusterOverrides("cluster-a", make([]byte, 10)).Code)
+}
+
+// Should reject the requests over the request rate of the cluster.
+func Test_clusterOverridesMiddleware_requestsPerMinute(t *testing.T) {
+	config.SetClusterOverrides(map[string]config.ClusterOverride{"cluster-a": {RequestsPerMinute: 2}})
+	defer config.SetClusterOverrides(nil)
+	defer delete(clusterLastRequest, "cluster-a")
+
+	assert.Equal(t, http.StatusOK, serveWithClusterOverrides("cluster-a", nil).Code)
+	res := serveWithClusterOverrides("cluster-a", nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+}
@@ -0,0 +1,50 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-indexer/pkg/database"
+	"k8s.io/klog/v2"
+)
+
+// Lists the batch items that failed permanently. Uses the pagination contract, see pagination.go.
+func (s *ServerConfig) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.Dao.(database.DeadLetterStore).DeadLetters(r.Context(), page.After, page.Limit)
+	if err != nil {
+		klog.Warningf("Error listing dead letter items. Error: %s", err)
+		http.Error(w, "Server error while processing the request.", http.StatusInternalServerError)
+		return
+	}
+	writePage(w, items, page, func(item database.DeadLetter) []string {
+		return []string{strconv.FormatInt(item.ID, 10)}
+	})
+}
+
+// Retries a batch item that failed permanently. The item is deleted if the retry succeeds.
+func (s *ServerConfig) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dead letter id.", http.StatusBadRequest)
+		return
+	}
+	err = s.Dao.(database.DeadLetterStore).RetryDeadLetter(r.Context(), id)
+	if errors.Is(err, database.ErrDeadLetterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		klog.Warningf("Error retrying dead letter item %d. Error: %s", id, err)
+		http.Error(w, "Retry failed: "+err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+// Copyright Contributors to the Open Cluster Management project
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ListDeadLetters(t *testing.T) {
+	server, mockPool := buildMockServer(t)
+	columns := []string{"id", "action", "uid", "args", "error", "created_at"}
+	mockPool.ExpectQuery(`SELECT "id", "action", "uid", "args", "error", "created_at" ` +
+		`FROM "dead_letter" ORDER BY "id" ASC LIMIT $1`).WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(columns))
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/deadletters", nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/deadletters", server.ListDeadLetters)
+	router.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.Equal(t, "{\"items\":[]}\n", responseRecorder.Body.String())
+}
+
+func Test_RetryDeadLetter_invalidId(t *testing.T) {
+	server, _ := buildMockServer(t)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/admin/deadletters/abc/retry", nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/deadletters/{id}/retry", server.RetryDeadLetter)
+	router.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, http.StatusBadRequest, responseRecorder.Code)
+}
+
+func Test_RetryDeadLetter_notFound(t *testing.T) {
+	server, mockPool := buildMockServer(t)
+	mockPool.ExpectQuery("SELECT action, args FROM dead_letter WHERE id=$1").WithArgs(int64(6)).
+		WillReturnRows(pgxmock.NewRows([]string{"action", "args"}))
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/admin/deadletters/6/retry", nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/deadletters/{id}/retry", server.RetryDeadLetter)
+	router.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, http.StatusNotFound, responseRecorder.Code)
+}
+
+// Should require a token authorized for the path and method.
+func Test_DeadLetters_unauthorized(t *testing.T) {
+	server, _ := buildMockServer(t)
+	authClient = fakeAuthClient(false, "/admin/deadletters", "/admin/deadletters/6/retry")
+	defer func() { authClient = nil }()
+	router := server.newRouter()
+
+	for _, request := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/deadletters", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/deadletters/6/retry", nil),
+	} {
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusUnauthorized, responseRecorder.Code)
+
+		request.Header.Set("Authorization", "Bearer valid")
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusForbidden, responseRecorder.Code)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Effective configuration.
+// GET /debug/config returns the configuration this replica is running with, so support can verify the settings
+// without access to the pod spec, the config file, and the ConfigMaps. The secrets are redacted like PrintConfig().
+// The request must have a Kubernetes bearer token authorized to get the non-resource URL /debug/config, for example
+// with a ClusterRole rule {nonResourceURLs: ["/debug/config"], verbs: ["get"]}.
+
+const debugConfigPath = "/debug/config"
+
+// Client to review the bearer tokens. Replaced in the unit tests.
+var authClient kubernetes.Interface
+
+type effectiveConfig struct {
+	Version      string                  `json:"version"`
+	Config       config.Config           `json:"config"`
+	FeatureGates map[config.Feature]bool `json:"featureGates"`
+	Tunables     config.Tunables         `json:"tunables"` // Current values, after the reloads. See config/reload.go
+}
+
+// Returns the effective configuration, with the secrets redacted.
+func DebugConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	redacted := config.Cfg.Redacted()
+	redacted.KubeClient = nil
+	if err := json.NewEncoder(w).Encode(effectiveConfig{
+		Version:      config.COMPONENT_VERSION,
+		Config:       redacted,
+		FeatureGates: config.Cfg.FeatureStates(),
+		Tunables:     config.Live(),
+	}); err != nil {
+		klog.Error("Error encoding the effective configuration. ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Allows the request if the bearer token is authorized for the request path and method with a SubjectAccessReview.
+// The verb is the method in lowercase, for example post to retry a dead letter item.
+func requireNonResourceAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, verb := r.URL.Path, strings.ToLower(r.Method)
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		extra := make(map[string]authzv1.ExtraValue, len(user.Extra))
+		for k, v := range user.Extra {
+			extra[k] = authzv1.ExtraValue(v)
+		}
+		access, err := authClient.AuthorizationV1().SubjectAccessReviews().Create(r.Context(),
+			&authzv1.SubjectAccessReview{Spec: authzv1.SubjectAccessReviewSpec{
+				User:                  user.Username,
+				UID:                   user.UID,
+				Groups:                user.Groups,
+				Extra:                 extra,
+				NonResourceAttributes: &authzv1.NonResourceAttributes{Path: path, Verb: verb},
+			}}, metav1.CreateOptions{})
+		if err != nil {
+			klog.Warningf("Error authorizing the request of %s to %s. %s", user.Username, path, err)
+			http.Error(w, "Error authorizing the request.", http.StatusInternalServerError)
+			return
+		}
+		if !access.Status.Allowed {
+			klog.V(2).Infof("Rejecting the request of %s to %s. %s", user.Username, path, access.Status.Reason)
+			http.Error(w, "Not authorized.", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Returns the user of the bearer token with a TokenReview. Otherwise, responds with the error and returns false.
+func authenticate(w http.ResponseWriter, r *http.Request) (authnv1.UserInfo, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		http.Error(w, "Missing bearer token.", http.StatusUnauthorized)
+		return authnv1.UserInfo{}, false
+	}
+	review, err := authClient.AuthenticationV1().TokenReviews().Create(r.Context(),
+		&authnv1.TokenReview{Spec: authnv1.TokenReviewSpec{Token: token}}, metav1.CreateOptions{})
+	if err != nil {
+		klog.Warningf("Error reviewing the token of a request to %s. %s", r.URL.Path, err)
+		http.Error(w, "Error authenticating the request.", http.StatusInternalServerError)
+		return authnv1.UserInfo{}, false
+	}
+	if !review.Status.Authenticated {
+		http.Error(w, "Invalid bearer token.", http.StatusUnauthorized)
+		return authnv1.UserInfo{}, false
+	}
+	return review.Status.User, true
+}
@@ -0,0 +1,87 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Fake client authenticating the token "valid" as user support, who is allowed to get the paths if allowed is true.
+// The paths default to /debug/config.
+func fakeAuthClient(allowed bool, paths ...string) *fake.Clientset {
+	if len(paths) == 0 {
+		paths = []string{debugConfigPath}
+	}
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		review.Status.Authenticated = review.Spec.Token == "valid"
+		review.Status.User = authnv1.UserInfo{Username: "support"}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object,
+		error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		review.Status.Allowed = allowed && review.Spec.User == "support" &&
+			slices.Contains(paths, review.Spec.NonResourceAttributes.Path)
+		return true, review, nil
+	})
+	return client
+}
+
+func getDebugConfig(token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "https://localhost:3010/debug/config", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res := httptest.NewRecorder()
+	server := &ServerConfig{DisableSync: true}
+	server.newRouter().ServeHTTP(res, req)
+	return res
+}
+
+// Should return the effective config with the secrets redacted.
+func Test_DebugConfig(t *testing.T) {
+	authClient = fakeAuthClient(true)
+	defer func() { authClient = nil }()
+	dbPass := config.Cfg.DBPass
+	config.Cfg.DBPass = "secret"
+	defer func() { config.Cfg.DBPass = dbPass }()
+
+	res := getDebugConfig("valid")
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	var body struct {
+		Config       map[string]interface{}
+		FeatureGates map[string]bool
+		Tunables     map[string]interface{}
+	}
+	assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &body))
+	assert.Equal(t, "[REDACTED]", body.Config["DBPass"])
+	assert.Contains(t, body.FeatureGates, "ChangeStream")
+	assert.False(t, body.FeatureGates["ChangeStream"])
+	assert.Equal(t, float64(config.Live().RequestLimit), body.Tunables["RequestLimit"])
+	assert.NotContains(t, res.Body.String(), "secret")
+}
+
+// Should reject the requests without a valid token, or without access.
+func Test_DebugConfig_unauthorized(t *testing.T) {
+	authClient = fakeAuthClient(false)
+	defer func() { authClient = nil }()
+
+	assert.Equal(t, http.StatusUnauthorized, getDebugConfig("").Code)
+	assert.Equal(t, http.StatusUnauthorized, getDebugConfig("invalid").Code)
+	assert.Equal(t, http.StatusForbidden, getDebugConfig("valid").Code)
+}
@@ -0,0 +1,44 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// Federation hub authentication.
+// The hubs in FEDERATION_HUBS send a Kubernetes bearer token of this hub with the sync requests. The token is
+// authenticated with a TokenReview, and the user must be the user of the hub in FEDERATION_HUB_USERS, for example
+// hub-a=system:serviceaccount:open-cluster-management:search-hub-a. A hub can't send the data of another hub.
+// The sync requests from the clusters of this hub aren't authenticated here.
+
+// Rejects the sync requests from other hubs without a token of the hub user.
+func federationHubMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub := mux.Vars(r)["hub"]
+		if hub == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hubUser := config.Cfg.FederationHubUser(hub)
+		if !federationHubAllowed(hub) || hubUser == "" {
+			klog.Warningf("Rejecting sync from hub %s. The hub isn't in FEDERATION_HUBS.", hub)
+			http.Error(w, "Hub isn't allowed to send data to this indexer.", http.StatusForbidden)
+			return
+		}
+		user, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		if user.Username != hubUser {
+			klog.Warningf("Rejecting sync from hub %s. The token of %s isn't the hub user.", hub, user.Username)
+			http.Error(w, "Token isn't allowed to send the data of this hub.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
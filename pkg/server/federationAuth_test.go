@@ -0,0 +1,42 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func syncFromHub(hub, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/aggregator/hubs/"+hub+"/clusters/local-cluster/sync",
+		strings.NewReader("{}"))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	responseRecorder := httptest.NewRecorder()
+	server := &ServerConfig{Dao: memory.NewStore()}
+	server.newRouter().ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// Should only accept the data of a hub with the token of the hub user.
+func Test_federationHubMiddleware(t *testing.T) {
+	config.Cfg.FederationHubs, config.Cfg.FederationHubUsers = "hub-a,hub-b", "hub-a=support,hub-b=other"
+	authClient = fakeAuthClient(false)
+	defer func() {
+		config.Cfg.FederationHubs, config.Cfg.FederationHubUsers = "", ""
+		authClient = nil
+	}()
+
+	assert.Equal(t, http.StatusOK, syncFromHub("hub-a", "valid").Code)
+	assert.Equal(t, http.StatusUnauthorized, syncFromHub("hub-a", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, syncFromHub("hub-a", "invalid").Code)
+	assert.Equal(t, http.StatusForbidden, syncFromHub("hub-b", "valid").Code)
+	assert.Equal(t, http.StatusForbidden, syncFromHub("hub-c", "valid").Code)
+}
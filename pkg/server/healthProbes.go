@@ -3,20 +3,41 @@
 package server
 
 import (
-	"fmt"
 	"net/http"
 
+	"github.com/stolostron/search-indexer/pkg/clustersync"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
+var okResponse = []byte("OK")
+var notReadyResponse = []byte("Not ready")
+
 // LivenessProbe is used to check if this service is alive.
-func LivenessProbe(w http.ResponseWriter, r *http.Request) {
-	klog.V(7).Info("livenessProbe")
-	fmt.Fprint(w, "OK")
-}
+var LivenessProbe = probeHandler("liveness", nil)
+
+// ReadinessProbe checks if this service is available. The leader isn't ready until the initial sync of the
+// clusters completes, see clustersync/readiness.go
+var ReadinessProbe = probeHandler("readiness", clustersync.Ready)
+
+// Builds a handler that responds OK without allocating. Probes are called often by many replicas,
+// so we count them with a metric instead of logging each request.
+// Use this fast path for any other lightweight endpoint, like heartbeats.
+// If ready is set, responds 503 while it returns false. It must not allocate either.
+func probeHandler(probe string, ready func() bool) http.HandlerFunc {
+	probeCount := metrics.ProbeCount.WithLabelValues(probe)
+	logMsg := probe + "Probe"
 
-// ReadinessProbe checks if this service is available.
-func ReadinessProbe(w http.ResponseWriter, r *http.Request) {
-	klog.V(7).Info("readinessProbe")
-	fmt.Fprint(w, "OK")
+	return func(w http.ResponseWriter, r *http.Request) {
+		probeCount.Inc()
+		if klogV := klog.V(5); klogV.Enabled() {
+			klogV.Info(logMsg)
+		}
+		if ready != nil && !ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write(notReadyResponse)
+			return
+		}
+		_, _ = w.Write(okResponse)
+	}
 }
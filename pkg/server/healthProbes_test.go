@@ -69,3 +69,41 @@ func TestReadinessProbe(t *testing.T) {
 			rr.Body.String(), expected)
 	}
 }
+
+// Discards the response without allocating.
+type discardResponseWriter struct{ header http.Header }
+
+func (d discardResponseWriter) Header() http.Header         { return d.header }
+func (d discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponseWriter) WriteHeader(statusCode int)  {}
+
+// Probes should not allocate memory.
+func TestProbes_noAllocations(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/liveness", nil)
+	w := discardResponseWriter{header: http.Header{}}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		LivenessProbe(w, req)
+		ReadinessProbe(w, req)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Expected probes to not allocate memory. Got %v allocations per run.", allocs)
+	}
+}
+
+// Should respond 503 while the service isn't ready.
+func TestReadinessProbe_notReady(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/readiness", nil)
+	rr := httptest.NewRecorder()
+	handler := probeHandler("readiness", func() bool { return false })
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if rr.Body.String() != "Not ready" {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), "Not ready")
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"sync"
 
-	"github.com/gorilla/mux"
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 )
 
 var largeRequestCountTracker int
@@ -17,16 +17,17 @@ var largeRequestCountTrackerLock = sync.RWMutex{}
 // Checks if we are able to accept the incoming request based upon request size
 func largeRequestLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		clusterName := params["id"]
-		if r.ContentLength > int64(config.Cfg.LargeRequestSize) {
+		clusterName := requestClusterName(r)
+		tunables := config.Live()
+		if r.ContentLength > int64(tunables.LargeRequestSize) {
 			largeRequestCountTrackerLock.RLock()
 			largeRequestCount := largeRequestCountTracker
 			largeRequestCountTrackerLock.RUnlock()
 
-			if largeRequestCount >= config.Cfg.LargeRequestLimit {
+			if largeRequestCount >= tunables.LargeRequestLimit {
 				klog.Warningf("Rejecting large request from %s because there's too many large requests processing. Request size: %dMB",
 					clusterName, r.ContentLength/1024/1024)
+				metrics.RequestsRejected.WithLabelValues("large_request_limit").Inc()
 				http.Error(w, "Too many large requests currently processing, retry later.", http.StatusTooManyRequests)
 				return
 			}
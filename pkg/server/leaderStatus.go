@@ -0,0 +1,23 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/stolostron/search-indexer/pkg/clustersync"
+	"k8s.io/klog/v2"
+)
+
+const leaderStatusPath = "/debug/leader"
+
+// Returns the leader election status observed by this replica, so operators can tell which replica runs the
+// clustersync during incidents.
+func LeaderStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(clustersync.GetLeaderStatus()); err != nil {
+		klog.Error("Error encoding the leader status. ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/clustersync"
+	"github.com/stretchr/testify/assert"
+)
+
+func getLeaderStatus(token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/debug/leader", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	responseRecorder := httptest.NewRecorder()
+	server := &ServerConfig{DisableSync: true}
+	server.newRouter().ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// Should respond with the leader status of this replica.
+func Test_LeaderStatus(t *testing.T) {
+	authClient = fakeAuthClient(true, leaderStatusPath)
+	defer func() { authClient = nil }()
+
+	responseRecorder := getLeaderStatus("valid")
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.Equal(t, "application/json", responseRecorder.Header().Get("Content-Type"))
+	var status clustersync.LeaderStatus
+	assert.Nil(t, json.Unmarshal(responseRecorder.Body.Bytes(), &status))
+	assert.Equal(t, clustersync.GetLeaderStatus(), status)
+}
+
+// Should reject the requests without a valid token, or without access.
+func Test_LeaderStatus_unauthorized(t *testing.T) {
+	authClient = fakeAuthClient(false, leaderStatusPath)
+	defer func() { authClient = nil }()
+
+	assert.Equal(t, http.StatusUnauthorized, getLeaderStatus("").Code)
+	assert.Equal(t, http.StatusForbidden, getLeaderStatus("valid").Code)
+}
@@ -0,0 +1,101 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"k8s.io/klog/v2"
+)
+
+// Pagination contract for list and stream endpoints (export, history, stats).
+//
+// Results are sorted by a stable unique key and paginated using the key of the last item (keyset pagination),
+// so clients can safely resume even when rows are inserted or deleted between requests.
+//
+//	Request:  GET <endpoint>?limit=<max items>&after=<cursor>
+//	            limit - Max items in the page. Default: 100, Max: 1000
+//	            after - Opaque cursor from the previous response. Omit to get the first page.
+//	Response: {"items": [...], "next": "<cursor>"}
+//	            next  - Cursor to request the following page. Omitted on the last page.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+type pageRequest struct {
+	Limit int
+	After []string // Sort key of the last item in the previous page. Empty for the first page.
+}
+
+type pageResponse[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Reads the pagination parameters from the request query.
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageLimit}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, fmt.Errorf("Invalid limit [%s]. Must be a number between 1 and %d.", limitStr, maxPageLimit)
+		}
+		page.Limit = limit
+	}
+
+	if cursor := r.URL.Query().Get("after"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return page, fmt.Errorf("Invalid cursor [%s].", cursor)
+		}
+		page.After = after
+	}
+	return page, nil
+}
+
+// Encodes the sort key of an item into an opaque cursor.
+func encodeCursor(key []string) string {
+	keyJSON, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(keyJSON)
+}
+
+// Decodes a cursor into the sort key of an item.
+func decodeCursor(cursor string) ([]string, error) {
+	keyJSON, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var key []string
+	if err = json.Unmarshal(keyJSON, &key); err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty cursor")
+	}
+	return key, nil
+}
+
+// Writes a page of items to the response. The items must be sorted by the key returned by keyFunc.
+// Queries should fetch limit+1 items, the extra item is used to detect if there's a next page.
+func writePage[T any](w http.ResponseWriter, items []T, page pageRequest, keyFunc func(T) []string) {
+	response := pageResponse[T]{Items: items}
+	if len(items) > page.Limit {
+		response.Items = items[:page.Limit]
+		response.Next = encodeCursor(keyFunc(response.Items[page.Limit-1]))
+	}
+	if response.Items == nil {
+		response.Items = make([]T, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		klog.Error("Error encoding page response. ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
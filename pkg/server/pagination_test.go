@@ -0,0 +1,66 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Should use the default limit when the request doesn't have pagination parameters.
+func Test_parsePageRequest_default(t *testing.T) {
+	req := httptest.NewRequest("GET", "/test", nil)
+
+	page, err := parsePageRequest(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, defaultPageLimit, page.Limit)
+	assert.Nil(t, page.After)
+}
+
+// Should read the limit and decode the cursor.
+func Test_parsePageRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/test?limit=5&after="+encodeCursor([]string{"a", "b"}), nil)
+
+	page, err := parsePageRequest(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, page.Limit)
+	assert.Equal(t, []string{"a", "b"}, page.After)
+}
+
+// Should reject invalid limit and cursor.
+func Test_parsePageRequest_invalid(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=5000", "limit=abc", "after=not-a-cursor"} {
+		req := httptest.NewRequest("GET", "/test?"+query, nil)
+		_, err := parsePageRequest(req)
+		assert.NotNil(t, err, "Expected error for query %s", query)
+	}
+}
+
+// Should trim the extra item and respond with a cursor for the next page.
+func Test_writePage(t *testing.T) {
+	res := httptest.NewRecorder()
+	items := []string{"a", "b", "c"}
+
+	writePage(res, items, pageRequest{Limit: 2}, func(item string) []string { return []string{item} })
+
+	var decoded pageResponse[string]
+	err := json.NewDecoder(res.Body).Decode(&decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, decoded.Items)
+	next, _ := decodeCursor(decoded.Next)
+	assert.Equal(t, []string{"b"}, next)
+}
+
+// Should respond without cursor on the last page.
+func Test_writePage_lastPage(t *testing.T) {
+	res := httptest.NewRecorder()
+
+	writePage(res, []string{}, pageRequest{Limit: 2}, func(item string) []string { return []string{item} })
+
+	assert.Equal(t, "{\"items\":[]}\n", res.Body.String())
+}
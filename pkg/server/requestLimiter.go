@@ -9,19 +9,23 @@ import (
 
 	klog "k8s.io/klog/v2"
 
-	"github.com/gorilla/mux"
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 )
 
 var requestTracker = map[string]time.Time{}
 var requestTrackerLock = sync.RWMutex{}
 
+// Requests parked while a previous request from the same cluster is processing. Only one request is parked
+// per cluster, a newer request replaces (coalesces) the one waiting. The channel receives true when it's the
+// parked request's turn to process, or false if it was replaced by a newer request.
+var requestWaiting = map[string]chan bool{}
+
 // Checks if we are able to accept the incoming request.
 func requestLimiterMiddleware(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		clusterName := params["id"]
+		clusterName := requestClusterName(r)
 
 		requestTrackerLock.RLock()
 		requestCount := len(requestTracker)
@@ -29,29 +33,135 @@ func requestLimiterMiddleware(next http.Handler) http.Handler {
 		timeReqReceived, foundClusterProcessing := requestTracker[clusterName]
 		requestTrackerLock.RUnlock()
 
-		if foundClusterProcessing {
+		if foundClusterProcessing && config.Cfg.QueueClusterRequest {
+			klog.V(3).Infof("Parking request from %s until the previous request completes. Duration: %s",
+				clusterName, time.Since(timeReqReceived))
+			if !waitForClusterRequest(w, r, clusterName) {
+				return
+			}
+		} else if foundClusterProcessing {
 			klog.Warningf("Rejecting request from %s because there's a previous request processing. Duration: %s",
 				clusterName, time.Since(timeReqReceived))
+			metrics.RequestsRejected.WithLabelValues("cluster_busy").Inc()
 			http.Error(w, "A previous request from this cluster is processing, retry later.", http.StatusTooManyRequests)
 			return
-		}
+		} else {
+			if requestCount >= config.Live().RequestLimit && clusterName != "local-cluster" {
+				klog.Warningf("Too many pending requests (%d). Rejecting sync from %s", requestCount, clusterName)
+				metrics.RequestsRejected.WithLabelValues("request_limit").Inc()
+				http.Error(w, "Indexer has too many pending requests, retry later.", http.StatusTooManyRequests)
+				return
+			}
 
-		if requestCount >= config.Cfg.RequestLimit && clusterName != "local-cluster" {
-			klog.Warningf("Too many pending requests (%d). Rejecting sync from %s", requestCount, clusterName)
-			http.Error(w, "Indexer has too many pending requests, retry later.", http.StatusTooManyRequests)
-			return
+			requestTrackerLock.Lock()
+			requestTracker[clusterName] = time.Now()
+			updateInFlightMetrics(clusterName)
+			requestTrackerLock.Unlock()
 		}
 
-		requestTrackerLock.Lock()
+		// Using defer to guarantee this gets executed if there's an error processing the request.
+		defer releaseClusterRequest(clusterName)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Parks the request until the previous request from the same cluster completes.
+// Returns true when the request can proceed. Otherwise, it has already responded to the request.
+func waitForClusterRequest(w http.ResponseWriter, r *http.Request, clusterName string) bool {
+	waitCh := make(chan bool, 1)
+
+	requestTrackerLock.Lock()
+	if _, processing := requestTracker[clusterName]; !processing {
+		// The previous request completed while we were checking.
 		requestTracker[clusterName] = time.Now()
+		updateInFlightMetrics(clusterName)
 		requestTrackerLock.Unlock()
+		return true
+	}
+	if parked, found := requestWaiting[clusterName]; found {
+		parked <- false // Replace the parked request with this newer request.
+	}
+	requestWaiting[clusterName] = waitCh
+	updateInFlightMetrics(clusterName)
+	requestTrackerLock.Unlock()
 
-		defer func() { // Using defer to guarantee this gets executed if there's an error processing the request.
-			requestTrackerLock.Lock()
-			delete(requestTracker, clusterName)
-			requestTrackerLock.Unlock()
-		}()
+	select {
+	case proceed := <-waitCh:
+		if !proceed {
+			klog.Warningf("Rejecting parked request from %s because it was replaced by a newer request.", clusterName)
+			metrics.RequestsRejected.WithLabelValues("replaced").Inc()
+			http.Error(w, "A newer request from this cluster replaced this request, retry later.",
+				http.StatusTooManyRequests)
+		}
+		return proceed
+	case <-r.Context().Done():
+		requestTrackerLock.Lock()
+		if requestWaiting[clusterName] == waitCh {
+			delete(requestWaiting, clusterName)
+			updateInFlightMetrics(clusterName)
+		}
+		requestTrackerLock.Unlock()
 
-		next.ServeHTTP(w, r)
-	})
+		// The previous request may have handed over to this request before we removed it.
+		select {
+		case proceed := <-waitCh:
+			if proceed {
+				releaseClusterRequest(clusterName)
+			}
+		default:
+		}
+		klog.Warningf("Parked request from %s was cancelled. %s", clusterName, r.Context().Err())
+		http.Error(w, "Request cancelled while waiting for a previous request from this cluster.",
+			http.StatusServiceUnavailable)
+		return false
+	}
+}
+
+// Takes the request slot of the cluster if it isn't processing a request, and the requests are under REQUEST_LIMIT.
+// Returns false if the slot isn't available.
+func acquireClusterRequest(clusterName string) bool {
+	requestTrackerLock.Lock()
+	defer requestTrackerLock.Unlock()
+	if _, processing := requestTracker[clusterName]; processing {
+		return false
+	}
+	if len(requestTracker) >= config.Live().RequestLimit && clusterName != "local-cluster" {
+		return false
+	}
+	requestTracker[clusterName] = time.Now()
+	updateInFlightMetrics(clusterName)
+	return true
+}
+
+// Releases the cluster request slot. If a request from the same cluster is parked, hand over the slot to it.
+func releaseClusterRequest(clusterName string) {
+	requestTrackerLock.Lock()
+	defer requestTrackerLock.Unlock()
+	if parked, found := requestWaiting[clusterName]; found {
+		delete(requestWaiting, clusterName)
+		requestTracker[clusterName] = time.Now()
+		updateInFlightMetrics(clusterName)
+		parked <- true
+		return
+	}
+	delete(requestTracker, clusterName)
+	updateInFlightMetrics(clusterName)
+}
+
+// Updates the in-flight metrics after a change to the requests of the cluster. Must hold requestTrackerLock.
+func updateInFlightMetrics(clusterName string) {
+	metrics.LimiterRequests.Set(float64(len(requestTracker)))
+	inFlight := 0
+	if _, processing := requestTracker[clusterName]; processing {
+		inFlight++
+	}
+	if _, parked := requestWaiting[clusterName]; parked {
+		inFlight++
+	}
+	if inFlight == 0 {
+		metrics.ClusterRequestsInFlight.DeleteLabelValues(clusterName)
+	} else {
+		metrics.ClusterRequestsInFlight.WithLabelValues(clusterName).Set(float64(inFlight))
+	}
 }
@@ -9,6 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -79,3 +83,117 @@ func Test_requestLimiterMiddleware_with50PendingRequests(t *testing.T) {
 	assert.Equal(t, "Indexer has too many pending requests, retry later.\n", string(bodyBytes))
 
 }
+
+// Verify that request is parked and processed after the pending request from the same cluster completes.
+func Test_requestLimiterMiddleware_queueExistingRequest(t *testing.T) {
+	config.Cfg.QueueClusterRequest = true
+	defer func() { config.Cfg.QueueClusterRequest = false }()
+	// Mock a pending request from cluster. See note above about omitting the cluster name.
+	requestTracker = map[string]time.Time{"": time.Now()}
+	requestWaiting = map[string]chan bool{}
+
+	processed := false
+	requestLimiterHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { processed = true })
+	req := httptest.NewRequest("POST", "https://localhost:3010/aggregator/clusters/cluster1/sync", nil)
+	res := httptest.NewRecorder()
+	middleware := requestLimiterMiddleware(requestLimiterHandler)
+
+	// Execute middleware.
+	done := make(chan struct{})
+	go func() {
+		middleware.ServeHTTP(res, req)
+		close(done)
+	}()
+	waitForParkedRequests(t, 1)
+
+	// Complete the pending request.
+	releaseClusterRequest("")
+	<-done
+
+	// Validate the parked request was processed and the tracker was cleared.
+	assert.True(t, processed)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 0, len(requestTracker))
+}
+
+// Verify that a parked request is replaced when a newer request from the same cluster arrives.
+func Test_requestLimiterMiddleware_queueCoalesceRequests(t *testing.T) {
+	config.Cfg.QueueClusterRequest = true
+	defer func() { config.Cfg.QueueClusterRequest = false }()
+	requestTracker = map[string]time.Time{"": time.Now()}
+	requestWaiting = map[string]chan bool{}
+
+	requestLimiterHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	middleware := requestLimiterMiddleware(requestLimiterHandler)
+	req := httptest.NewRequest("POST", "https://localhost:3010/aggregator/clusters/cluster1/sync", nil)
+
+	// Park the first request.
+	firstRes := httptest.NewRecorder()
+	firstDone := make(chan struct{})
+	go func() {
+		middleware.ServeHTTP(firstRes, req)
+		close(firstDone)
+	}()
+	waitForParkedRequests(t, 1)
+
+	// Send a newer request, it should replace the first parked request.
+	secondRes := httptest.NewRecorder()
+	secondDone := make(chan struct{})
+	go func() {
+		middleware.ServeHTTP(secondRes, req)
+		close(secondDone)
+	}()
+	<-firstDone
+	assert.Equal(t, http.StatusTooManyRequests, firstRes.Code)
+
+	// Complete the pending request, the newer request gets processed.
+	waitForParkedRequests(t, 1)
+	releaseClusterRequest("")
+	<-secondDone
+	assert.Equal(t, http.StatusOK, secondRes.Code)
+}
+
+// Verify the in-flight metrics while a request processes, and the rejections by reason.
+func Test_requestLimiterMiddleware_metrics(t *testing.T) {
+	requestTracker = map[string]time.Time{}
+	requestWaiting = map[string]chan bool{}
+	rejected := testutil.ToFloat64(metrics.RequestsRejected.WithLabelValues("cluster_busy"))
+
+	var limiterRequests, clusterInFlight float64
+	var busyCode int
+	middleware := requestLimiterMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiterRequests = testutil.ToFloat64(metrics.LimiterRequests)
+		clusterInFlight = testutil.ToFloat64(metrics.ClusterRequestsInFlight.WithLabelValues("cluster1"))
+		// A second request from the cluster is rejected while this one processes.
+		busyRes := httptest.NewRecorder()
+		requestLimiterMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(
+			busyRes, r)
+		busyCode = busyRes.Code
+	}))
+	req := mux.SetURLVars(httptest.NewRequest("POST", "https://localhost:3010/aggregator/clusters/cluster1/sync",
+		nil), map[string]string{"id": "cluster1"})
+
+	middleware.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, float64(1), limiterRequests)
+	assert.Equal(t, float64(1), clusterInFlight)
+	assert.Equal(t, http.StatusTooManyRequests, busyCode)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.RequestsRejected.WithLabelValues("cluster_busy")))
+	// The series of the cluster is deleted after the request completes.
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.LimiterRequests))
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.ClusterRequestsInFlight))
+}
+
+// Waits until the expected number of requests are parked.
+func waitForParkedRequests(t *testing.T, expected int) {
+	for i := 0; i < 100; i++ {
+		requestTrackerLock.RLock()
+		parked := len(requestWaiting)
+		requestTrackerLock.RUnlock()
+		if parked == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d parked requests.", expected)
+}
@@ -12,45 +12,66 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stolostron/search-indexer/pkg/config"
 	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/kafka"
 	"github.com/stolostron/search-indexer/pkg/metrics"
+	"github.com/stolostron/search-indexer/pkg/tracing"
 	"k8s.io/klog/v2"
 )
 
 type ServerConfig struct {
-	Dao *database.DAO
+	Dao         database.Store  // Storage backend. Use a *database.DAO for Postgres.
+	DisableSync bool            // Serve only the probes, metrics, and debug endpoints. Used with RUN_MODE=clustersync.
+	Producer    *kafka.Producer // Publishes the changes to Kafka. Nil without the change stream or with the outbox.
 }
 
 func (s *ServerConfig) StartAndListen(ctx context.Context) {
+	if authClient == nil {
+		authClient = config.Cfg.KubeClient
+	}
+	s.listen(ctx, s.newRouter())
+}
+
+// Creates the router. The sync and admin endpoints aren't added with DisableSync.
+func (s *ServerConfig) newRouter() *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/liveness", LivenessProbe).Methods("GET")
 	router.HandleFunc("/readiness", ReadinessProbe).Methods("GET")
 	router.Handle("/metrics", promhttp.HandlerFor(metrics.PromRegistry, promhttp.HandlerOpts{})).Methods("GET")
+	router.HandleFunc(leaderStatusPath, requireNonResourceAccess(LeaderStatus)).Methods("GET")
+	router.HandleFunc(debugConfigPath, requireNonResourceAccess(DebugConfig)).Methods("GET")
+	if s.DisableSync {
+		return router
+	}
 
 	// Add middleware to the /aggregator subroute.
 	syncSubrouter := router.PathPrefix("/aggregator").Subrouter()
 	syncSubrouter.Use(metrics.PrometheusMiddleware)
+	// Continues the trace of the collector. See tracing/tracing.go
+	syncSubrouter.Use(tracing.Middleware("SyncResources"))
+	// Authenticates the hubs sending the data of their clusters. See federationAuth.go
+	syncSubrouter.Use(federationHubMiddleware)
+	syncSubrouter.Use(clusterOverridesMiddleware)
+	syncSubrouter.Use(s.backpressureMiddleware)
 	syncSubrouter.Use(requestLimiterMiddleware)
 	syncSubrouter.Use(largeRequestLimiterMiddleware)
 	syncSubrouter.HandleFunc("/clusters/{id}/sync", s.SyncResources).Methods("POST")
-
-	// Configure TLS
-	cfg := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-		PreferServerCipherSuites: true,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-		},
+	// Receives the data of the clusters of other hubs. See database/federation.go
+	if config.Cfg.FederationHubs != "" {
+		syncSubrouter.HandleFunc("/hubs/{hub}/clusters/{id}/sync", s.SyncResources).Methods("POST")
 	}
-	srv := &http.Server{
-		Addr:              config.Cfg.ServerAddress,
-		Handler:           router,
-		TLSConfig:         cfg,
-		ReadHeaderTimeout: time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
-		ReadTimeout:       time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
-		WriteTimeout:      time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
-		TLSNextProto:      make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+
+	// Admin endpoints to inspect and retry the batch items that failed permanently.
+	if _, ok := s.Dao.(database.DeadLetterStore); ok {
+		router.HandleFunc("/admin/deadletters", requireNonResourceAccess(s.ListDeadLetters)).Methods("GET")
+		router.HandleFunc("/admin/deadletters/{id}/retry", requireNonResourceAccess(s.RetryDeadLetter)).
+			Methods("POST")
 	}
+	return router
+}
+
+// Starts the server and waits for the context to be cancelled, then shuts down the server.
+func (s *ServerConfig) listen(ctx context.Context, handler http.Handler) {
+	srv := newHTTPServer(handler)
 
 	// Start the server
 	go func() {
@@ -76,3 +97,33 @@ func (s *ServerConfig) StartAndListen(ctx context.Context) {
 	}
 	ctxCancel()
 }
+
+// Creates the http server with the TLS configuration.
+// HTTP/2 is disabled unless enabled with config HTTP2_ENABLED.
+func newHTTPServer(handler http.Handler) *http.Server {
+	cfg := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		PreferServerCipherSuites: true,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+	}
+	srv := &http.Server{
+		Addr:              config.Cfg.ServerAddress,
+		Handler:           handler,
+		TLSConfig:         cfg,
+		ReadHeaderTimeout: time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
+		ReadTimeout:       time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
+		TLSNextProto:      make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+	}
+
+	if config.Cfg.HTTP2Enabled {
+		klog.Info("HTTP/2 is enabled.")
+		// A nil TLSNextProto lets the server negotiate h2. HTTP/2 requires the AES_128_GCM_SHA256 cipher suite.
+		srv.TLSNextProto = nil
+		cfg.CipherSuites = append(cfg.CipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+	}
+	return srv
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should disable HTTP/2 by default.
+func Test_newHTTPServer(t *testing.T) {
+	srv := newHTTPServer(http.NewServeMux())
+
+	assert.NotNil(t, srv.TLSNextProto)
+	assert.Equal(t, 0, len(srv.TLSNextProto))
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, srv.TLSConfig.CipherSuites)
+}
+
+// Should allow HTTP/2 negotiation and add the cipher suite required by HTTP/2.
+func Test_newHTTPServer_http2Enabled(t *testing.T) {
+	config.Cfg.HTTP2Enabled = true
+	defer func() { config.Cfg.HTTP2Enabled = false }()
+
+	srv := newHTTPServer(http.NewServeMux())
+
+	assert.Nil(t, srv.TLSNextProto)
+	assert.Contains(t, srv.TLSConfig.CipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+}
+
+// Should serve only the probes, metrics, and debug endpoints with DisableSync.
+func Test_newRouter_disableSync(t *testing.T) {
+	router := (&ServerConfig{DisableSync: true}).newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/liveness", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/aggregator/clusters/cluster-a/sync", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
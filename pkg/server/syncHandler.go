@@ -4,33 +4,58 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/stolostron/search-indexer/pkg/metrics"
 
 	"github.com/gorilla/mux"
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/database"
 	"github.com/stolostron/search-indexer/pkg/model"
+	"github.com/stolostron/search-indexer/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/klog/v2"
 )
 
+// Seconds the collector waits to retry when the database is unavailable and the outage buffer is full.
+const outageRetryAfter = 30
+
 func (s *ServerConfig) SyncResources(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	w.Header().Set("Content-Type", "application/json")
-	params := mux.Vars(r)
-	clusterName := params["id"]
+	clusterName := requestClusterName(r)
+	// The span continuing the trace of the collector. See tracing/tracing.go
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.String("cluster", clusterName))
+	hub := mux.Vars(r)["hub"]
+	if hub != "" && !federationHubAllowed(hub) {
+		klog.Warningf("Rejecting sync from %s. The hub isn't in FEDERATION_HUBS.", clusterName)
+		http.Error(w, "Hub isn't allowed to send data to this indexer.", http.StatusForbidden)
+		return
+	}
 
 	// Decode SyncEvent from request body.
 	var syncEvent model.SyncEvent
 	err := json.NewDecoder(r.Body).Decode(&syncEvent)
 	if err != nil {
+		tracing.SetError(span, err)
+		metrics.Errors.WithLabelValues("server", "decode").Inc()
 		klog.Errorf("Error decoding request body from cluster [%s]. Error: %+v\n", clusterName, err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	// Data received from another hub. See database/federation.go
+	if hub != "" {
+		database.TagSourceHub(&syncEvent, hub)
+	}
 	resourceTotal := len(syncEvent.AddResources) + len(syncEvent.UpdateResources) + len(syncEvent.DeleteResources)
 	metrics.RequestSize.Observe(float64(resourceTotal))
+	span.SetAttributes(attribute.Bool("clearAll", syncEvent.ClearAll), attribute.Int("resources", resourceTotal))
 
 	// Initialize SyncResponse object.
 	syncResponse := &model.SyncResponse{
@@ -51,16 +76,36 @@ func (s *ServerConfig) SyncResources(w http.ResponseWriter, r *http.Request) {
 	} else {
 		err = s.Dao.SyncData(r.Context(), syncEvent, clusterName, syncResponse)
 	}
+	tracing.SetError(span, err)
+	if errors.Is(err, database.ErrOutageBufferFull) {
+		klog.Warningf("Rejecting sync from %12s because the database is unavailable and the outage buffer is full.",
+			clusterName)
+		w.Header().Set("Retry-After", strconv.Itoa(outageRetryAfter))
+		http.Error(w, "Indexer database is unavailable, retry later.", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
+		metrics.Errors.WithLabelValues("server", "sync").Inc()
 		klog.Warningf("Responding with error to request from %12s. RequestId: %s  Error: %s",
 			clusterName, syncEvent.RequestId, err)
 		http.Error(w, "Server error while processing the request.", http.StatusInternalServerError)
 		return
 	}
 
+	// Publish the changes written to the Kafka change stream. See kafka/producer.go
+	if s.Producer != nil {
+		s.Producer.Publish(clusterName, syncEvent, syncResponse)
+	}
+
 	// Get the total cluster resources for validation by the collector.
+	// The totals aren't available while the changes are buffered during a database outage.
 	totalResources, totalEdges, validateErr := s.Dao.ClusterTotals(r.Context(), clusterName)
-	if validateErr != nil {
+	if validateErr != nil && syncResponse.Buffered > 0 {
+		klog.V(1).Infof("Responding without totals to %12s. Buffered %d items during a database outage.",
+			clusterName, syncResponse.Buffered)
+	} else if validateErr != nil {
+		tracing.SetError(span, validateErr)
+		metrics.Errors.WithLabelValues("server", "totals").Inc()
 		klog.Warningf("Responding with error to request from %12s. RequestId: %s  Error: %s",
 			clusterName, syncEvent.RequestId, validateErr)
 		http.Error(w, "Server error while processing the request.", http.StatusInternalServerError)
@@ -69,6 +114,21 @@ func (s *ServerConfig) SyncResources(w http.ResponseWriter, r *http.Request) {
 	syncResponse.TotalResources = totalResources
 	syncResponse.TotalEdges = totalEdges
 
+	// Compare the checksum if sent by the collector. A mismatch asks the collector to resync.
+	if syncEvent.Checksum != 0 {
+		checksum, checksumErr := s.Dao.ClusterChecksum(r.Context(), clusterName)
+		if checksumErr == nil && checksum != syncEvent.Checksum {
+			klog.V(1).Infof("Checksum for cluster %s doesn't match. Requesting resync.", clusterName)
+			syncResponse.ResyncRequired = true
+		}
+	}
+
+	// Track the last successful sync to find clusters that stopped syncing, and the collector totals for the
+	// consistency check. Errors are logged, but don't fail the request because the data was synced.
+	resyncRequested, _ := s.Dao.UpdateLastSync(r.Context(), clusterName, syncEvent)
+	syncResponse.ResyncRequired = syncResponse.ResyncRequired || resyncRequested
+	metrics.LastSyncTimestamp.WithLabelValues(clusterName).SetToCurrentTime()
+
 	// Send Response
 	w.WriteHeader(http.StatusOK)
 	encodeError := json.NewEncoder(w).Encode(syncResponse)
@@ -82,3 +142,22 @@ func (s *ServerConfig) SyncResources(w http.ResponseWriter, r *http.Request) {
 		clusterName, time.Since(start), syncEvent.ClearAll, len(syncEvent.AddResources))
 	// klog.V(5).Infof("Response for [%s]: %+v", clusterName, syncResponse)
 }
+
+// Returns the name of the cluster sending the request. The clusters of other hubs are qualified with the hub name.
+func requestClusterName(r *http.Request) string {
+	params := mux.Vars(r)
+	if hub := params["hub"]; hub != "" {
+		return database.FederatedClusterName(hub, params["id"])
+	}
+	return params["id"]
+}
+
+// Returns true if the hub is in FEDERATION_HUBS.
+func federationHubAllowed(hub string) bool {
+	for _, allowed := range strings.Split(config.Cfg.FederationHubs, ",") {
+		if strings.TrimSpace(allowed) == hub {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +11,14 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stolostron/search-indexer/pkg/metrics"
 	"github.com/stolostron/search-indexer/pkg/model"
 	"github.com/stolostron/search-indexer/pkg/testutils"
 	"github.com/stretchr/testify/assert"
@@ -33,12 +38,9 @@ func Test_syncRequest(t *testing.T) {
 	// Create server with mock database.
 	server, mockPool := buildMockServer(t)
 
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 5}, {"count": 3}},
-		},
-	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(2)
+	expectSimpleSyncBatch(mockPool, nil)
+	testutils.MockClusterTotals(mockPool, "test-cluster", 5, 3)
+	mockLastSync(mockPool, false)
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
@@ -59,9 +61,15 @@ func Test_syncRequest(t *testing.T) {
 	if fmt.Sprintf("%+v", decodedResp) != fmt.Sprintf("%+v", expected) {
 		t.Errorf("Incorrect response body.\n expected '%+v'\n received '%+v'", expected, decodedResp)
 	}
+
+	lastSync := testutil.ToFloat64(metrics.LastSyncTimestamp.WithLabelValues("test-cluster"))
+	if time.Since(time.Unix(int64(lastSync), 0)) > time.Minute {
+		t.Errorf("Want the last sync timestamp of test-cluster set to the current time, got %v", lastSync)
+	}
 }
 
-func Test_syncRequest_withError(t *testing.T) {
+// Should respond with the resync requested by the consistency check.
+func Test_syncRequest_resyncRequired(t *testing.T) {
 	// Read mock request body.
 	body, readErr := os.Open("./mocks/simple.json")
 	if readErr != nil {
@@ -74,19 +82,72 @@ func Test_syncRequest_withError(t *testing.T) {
 	// Create server with mock database.
 	server, mockPool := buildMockServer(t)
 
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 5}, {"count": 3}},
-		},
-		MockErrorOnClose: errors.New("unexpected EOF"),
+	expectSimpleSyncBatch(mockPool, nil)
+	testutils.MockClusterTotals(mockPool, "test-cluster", 5, 3)
+	mockLastSync(mockPool, true)
+
+	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
+	router.ServeHTTP(responseRecorder, request)
+
+	// Validate
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	var decodedResp model.SyncResponse
+	err := json.NewDecoder(responseRecorder.Body).Decode(&decodedResp)
+	assert.Nil(t, err)
+	assert.True(t, decodedResp.ResyncRequired)
+}
+
+// Should request a resync when the checksum from the collector doesn't match.
+func Test_syncRequest_checksumMismatch(t *testing.T) {
+	body := strings.NewReader(`{"checksum": 12345}`)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/aggregator/clusters/test-cluster/sync", body)
+	router := mux.NewRouter()
+
+	// Create server with mock database.
+	server, mockPool := buildMockServer(t)
+
+	testutils.MockClusterTotals(mockPool, "test-cluster", 5, 3)
+	checksumRows := pgxmock.NewRows([]string{"checksum"}).AddRow(int64(54321))
+	mockPool.ExpectQuery("SELECT COALESCE(SUM(hash), 0)::BIGINT FROM resources " +
+		"WHERE cluster=$1 AND deleted_at IS NULL").WithArgs("test-cluster").WillReturnRows(checksumRows)
+	mockLastSync(mockPool, false)
+
+	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
+	router.ServeHTTP(responseRecorder, request)
+
+	// Validate
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	var decodedResp model.SyncResponse
+	err := json.NewDecoder(responseRecorder.Body).Decode(&decodedResp)
+	assert.Nil(t, err)
+	assert.True(t, decodedResp.ResyncRequired)
+}
+
+func Test_syncRequest_withError(t *testing.T) {
+	// Read mock request body.
+	body, readErr := os.Open("./mocks/simple.json")
+	if readErr != nil {
+		t.Fatal(readErr)
 	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(2)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/aggregator/clusters/test-cluster/sync", body)
+	router := mux.NewRouter()
+
+	// Create server with mock database.
+	server, mockPool := buildMockServer(t)
+
+	expectSimpleSyncBatch(mockPool, errors.New("unexpected EOF"))
+	connectionErrors := testutil.ToFloat64(metrics.Errors.WithLabelValues("database", "connection"))
+	syncErrors := testutil.ToFloat64(metrics.Errors.WithLabelValues("server", "sync"))
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
 
 	// Validate
 	assert.Equal(t, http.StatusInternalServerError, responseRecorder.Code)
+	assert.Equal(t, connectionErrors+1, testutil.ToFloat64(metrics.Errors.WithLabelValues("database", "connection")))
+	assert.Equal(t, syncErrors+1, testutil.ToFloat64(metrics.Errors.WithLabelValues("server", "sync")))
 	bodyString, _ := responseRecorder.Body.ReadString(byte(0))
 	assert.Equal(t, "Server error while processing the request.\n", bodyString)
 }
@@ -104,13 +165,12 @@ func Test_syncRequest_withErrorQueryingTotalResources(t *testing.T) {
 	// Create server with mock database.
 	server, mockPool := buildMockServer(t)
 
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 10}, {"count": 4}},
-		},
-		MockErrorOnClose: errors.New("unexpected EOF"),
-	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(2)
+	expectSimpleSyncBatch(mockPool, nil)
+	totals := mockPool.ExpectBatch()
+	totals.ExpectQuery(`SELECT COUNT(*) FROM "resources" WHERE (("cluster" = $1) AND ("deleted_at" IS NULL))`).
+		WithArgs("test-cluster").WillReturnError(errors.New("unexpected EOF"))
+	totals.ExpectQuery(`SELECT COUNT(*) FROM "edges" ` +
+		`WHERE (("cluster" = $1) AND ("edgetype" != $2) AND ("deleted_at" IS NULL))`).Maybe()
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
@@ -136,14 +196,10 @@ func Test_resyncRequest(t *testing.T) {
 	server, mockPool := buildMockServer(t)
 	testutils.MockDatabaseState(mockPool) // Mock Postgres state and SELECT queries.
 
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 10}, {"count": 4}},
-		},
-	}
-
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(5)
+	expectResyncResourcesBatch(mockPool, nil)
+	expectResyncEdgesBatch(mockPool, nil)
+	testutils.MockClusterTotals(mockPool, "test-cluster", 10, 4)
+	mockLastSync(mockPool, false)
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
@@ -177,17 +233,8 @@ func Test_resyncRequest_withErrorDeletingResources(t *testing.T) {
 
 	// Create server with mock database.
 	server, mockPool := buildMockServer(t)
-	testutils.MockDatabaseState(mockPool) // Mock Postgres state and SELECT queries.
-
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("unexpected EOF"))
-
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 10}},
-		},
-		MockErrorOnClose: errors.New("unexpected EOF"),
-	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(3)
+	testutils.MockExistingResources(mockPool) // Mock Postgres state and SELECT queries.
+	expectResyncResourcesBatch(mockPool, errors.New("unexpected EOF"))
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
@@ -212,16 +259,8 @@ func Test_resyncRequest_withErrorDeletingEdges(t *testing.T) {
 	// Create server with mock database.
 	server, mockPool := buildMockServer(t)
 	testutils.MockDatabaseState(mockPool) // Mock Postgres state and SELECT queries.
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any())
-	mockPool.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("unexpected EOF"))
-
-	br := &testutils.MockBatchResults{
-		MockRows: testutils.MockRows{
-			MockData: []map[string]interface{}{{"count": 10}},
-		},
-		MockErrorOnClose: errors.New("unexpected EOF"),
-	}
-	mockPool.EXPECT().SendBatch(gomock.Any(), gomock.Any()).Return(br).Times(3)
+	expectResyncResourcesBatch(mockPool, nil)
+	expectResyncEdgesBatch(mockPool, errors.New("unexpected EOF"))
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
@@ -241,6 +280,7 @@ func Test_incorrectRequestBody(t *testing.T) {
 	router := mux.NewRouter()
 
 	server, _ := buildMockServer(t)
+	decodeErrors := testutil.ToFloat64(metrics.Errors.WithLabelValues("server", "decode"))
 
 	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
 	router.ServeHTTP(responseRecorder, request)
@@ -248,4 +288,76 @@ func Test_incorrectRequestBody(t *testing.T) {
 	if responseRecorder.Code != http.StatusBadRequest {
 		t.Errorf("Want status '%d', got '%d'", http.StatusBadRequest, responseRecorder.Code)
 	}
+	assert.Equal(t, decodeErrors+1, testutil.ToFloat64(metrics.Errors.WithLabelValues("server", "decode")))
+}
+
+// Should sync against a real store, without mocks.
+func Test_syncRequest_memoryStore(t *testing.T) {
+	server := ServerConfig{Dao: memory.NewStore()}
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", server.SyncResources)
+
+	for _, test := range []struct {
+		file     string
+		expected model.SyncResponse
+	}{
+		{"./mocks/simple.json", model.SyncResponse{TotalAdded: 2, TotalResources: 2}},
+		{"./mocks/simple-delete.json", model.SyncResponse{TotalDeleted: 1, TotalResources: 1}},
+	} {
+		body, readErr := os.Open(test.file)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/aggregator/clusters/local-cluster/sync", body)
+
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusOK, responseRecorder.Code)
+		var decodedResp model.SyncResponse
+		err := json.NewDecoder(responseRecorder.Body).Decode(&decodedResp)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected.TotalAdded, decodedResp.TotalAdded, test.file)
+		assert.Equal(t, test.expected.TotalDeleted, decodedResp.TotalDeleted, test.file)
+		assert.Equal(t, test.expected.TotalResources, decodedResp.TotalResources, test.file)
+	}
+}
+
+// Should store the data of a cluster from another hub under the hub qualified cluster name.
+func Test_syncRequest_federatedHub(t *testing.T) {
+	config.Cfg.FederationHubs = "hub-a"
+	defer func() { config.Cfg.FederationHubs = "" }()
+	store := memory.NewStore()
+	server := ServerConfig{Dao: store}
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/hubs/{hub}/clusters/{id}/sync", server.SyncResources)
+	body, readErr := os.Open("./mocks/simple.json")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/aggregator/hubs/hub-a/clusters/local-cluster/sync", body)
+
+	router.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	clusters, err := store.GetManagedClusters(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hub-a/local-cluster"}, clusters)
+}
+
+// Should reject the data of a hub that isn't in FEDERATION_HUBS.
+func Test_syncRequest_federatedHubNotAllowed(t *testing.T) {
+	config.Cfg.FederationHubs = "hub-a"
+	defer func() { config.Cfg.FederationHubs = "" }()
+	server := ServerConfig{Dao: memory.NewStore()}
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/hubs/{hub}/clusters/{id}/sync", server.SyncResources)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/aggregator/hubs/hub-b/clusters/local-cluster/sync",
+		strings.NewReader("{}"))
+
+	router.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, http.StatusForbidden, responseRecorder.Code)
 }
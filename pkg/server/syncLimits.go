@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/kafka"
+	"k8s.io/klog/v2"
+)
+
+// Limits of the queued sync events.
+// The sync events consumed from Kafka don't go through the middlewares of the sync endpoint, see kafka/consumer.go.
+// WaitForSync() applies the same limits before an event is applied:
+//   - Cluster overrides: the events of a paused cluster, or over the requests per minute of the cluster, wait. The
+//     events over the max request size of the cluster are rejected.
+//   - Backpressure: the events wait while the store is falling behind.
+//   - Request limiter: the events wait until the cluster isn't processing a request, and under REQUEST_LIMIT.
+// The events of a partition are applied in order, so they wait instead of being rejected like the sync requests.
+
+// Wait to check the request limiter again while the cluster is processing a request.
+const syncLimitsRetryWait = time.Second
+
+var ErrSyncTooLarge = errors.New("Sync event is over the max request size for this cluster.")
+
+var _ kafka.SyncLimiter = &ServerConfig{}
+
+// Waits until the sync event of the cluster can be applied, and takes the request slot of the cluster. Returns the
+// func releasing the slot, or an error if the event is rejected or the context is cancelled.
+func (s *ServerConfig) WaitForSync(ctx context.Context, clusterName string, size int) (func(), error) {
+	for {
+		override := config.ClusterOverrideFor(clusterName)
+		if override.MaxRequestSize > 0 && int64(size) > override.MaxRequestSize {
+			return nil, ErrSyncTooLarge
+		}
+		wait := syncLimitsRetryWait
+		if override.Paused {
+			wait = pausedRetryAfter * time.Second
+		} else if overloaded, retryAfter := s.Dao.Backpressure(); overloaded {
+			wait = retryAfter
+		} else if acquireClusterRequest(clusterName) {
+			if override.RequestsPerMinute == 0 {
+				return func() { releaseClusterRequest(clusterName) }, nil
+			}
+			if wait = reserveClusterRequest(clusterName, override.RequestsPerMinute); wait == 0 {
+				return func() { releaseClusterRequest(clusterName) }, nil
+			}
+			releaseClusterRequest(clusterName)
+		}
+		klog.V(3).Infof("Waiting %s to apply the sync event from %s.", wait, clusterName)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
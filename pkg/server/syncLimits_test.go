@@ -0,0 +1,63 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stolostron/search-indexer/pkg/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// Should reject the events over the max size of the cluster.
+func Test_WaitForSync_maxRequestSize(t *testing.T) {
+	config.SetClusterOverrides(map[string]config.ClusterOverride{"cluster-a": {MaxRequestSize: 10}})
+	defer config.SetClusterOverrides(nil)
+	server := ServerConfig{Dao: memory.NewStore()}
+
+	_, err := server.WaitForSync(context.Background(), "cluster-a", 11)
+
+	assert.Equal(t, ErrSyncTooLarge, err)
+}
+
+// Should take the request slot of the cluster, and wait while the cluster is processing a request.
+func Test_WaitForSync_requestLimiter(t *testing.T) {
+	server := ServerConfig{Dao: memory.NewStore()}
+
+	release, err := server.WaitForSync(context.Background(), "cluster-a", 10)
+	assert.Nil(t, err)
+	requestTrackerLock.RLock()
+	_, processing := requestTracker["cluster-a"]
+	requestTrackerLock.RUnlock()
+	assert.True(t, processing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = server.WaitForSync(ctx, "cluster-a", 10)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	release()
+	release, err = server.WaitForSync(context.Background(), "cluster-a", 10)
+	assert.Nil(t, err)
+	release()
+}
+
+// Should wait while the cluster is paused.
+func Test_WaitForSync_paused(t *testing.T) {
+	config.SetClusterOverrides(map[string]config.ClusterOverride{"cluster-a": {Paused: true}})
+	defer config.SetClusterOverrides(nil)
+	server := ServerConfig{Dao: memory.NewStore()}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := server.WaitForSync(ctx, "cluster-a", 10)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	requestTrackerLock.RLock()
+	_, processing := requestTracker["cluster-a"]
+	requestTrackerLock.RUnlock()
+	assert.False(t, processing)
+}
@@ -4,16 +4,14 @@ package server
 import (
 	"testing"
 
-	"github.com/driftprogramming/pgxpoolmock"
-	"github.com/golang/mock/gomock"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stolostron/search-indexer/pkg/database"
+	"github.com/stolostron/search-indexer/pkg/testutils"
 )
 
 // Builds a ServerConfig instance with a mock database connection.
-func buildMockServer(t *testing.T) (ServerConfig, *pgxpoolmock.MockPgxPool) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-	mockPool := pgxpoolmock.NewMockPgxPool(ctrl)
+func buildMockServer(t *testing.T) (ServerConfig, pgxmock.PgxPoolIface) {
+	mockPool := testutils.NewMockPool(t)
 
 	dao := database.NewDAO(mockPool)
 	server := ServerConfig{
@@ -21,3 +19,68 @@ func buildMockServer(t *testing.T) (ServerConfig, *pgxpoolmock.MockPgxPool) {
 	}
 	return server, mockPool
 }
+
+// Mocks the queries updating the last sync time and the sync properties for the cluster. The sync properties are
+// written once per interval, so the update is optional.
+func mockLastSync(mockPool pgxmock.PgxPoolIface, resyncRequested bool) {
+	rows := pgxmock.NewRows([]string{"resync_requested"}).AddRow(resyncRequested)
+	mockPool.ExpectQuery("INSERT INTO cluster_sync AS s "+
+		"(cluster, last_sync, reported_resources, reported_edges) VALUES ($1, now(), NULLIF($2, 0), NULLIF($3, 0)) "+
+		"ON CONFLICT (cluster) DO UPDATE SET last_sync=now(), reported_resources=EXCLUDED.reported_resources, "+
+		"reported_edges=EXCLUDED.reported_edges, resync_requested=(s.resync_requested AND NOT $4) "+
+		"RETURNING s.resync_requested").
+		WithArgs("test-cluster", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).WillReturnRows(rows)
+	mockPool.ExpectExec("UPDATE clusters SET data = (data - 'searchDataStale') || jsonb_strip_nulls("+
+		"jsonb_build_object('lastSyncTime', $2::text, 'collectorVersion', NULLIF($3, ''))) WHERE uid = $1").
+		WithArgs("cluster__test-cluster", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1)).Maybe()
+}
+
+// Expects the batch adding the resources from mocks/simple.json. The first statement returns the error when not nil.
+func expectSimpleSyncBatch(mockPool pgxmock.PgxPoolIface, err error) {
+	batch := mockPool.ExpectBatch()
+	for i := 0; i < 2; i++ {
+		exec := batch.ExpectExec("INSERT into resources as r (uid, cluster, data, hash) values($1,$2,$3,$4) "+
+			"ON CONFLICT (uid) DO UPDATE SET data=$3, hash=$4, deleted_at=NULL WHERE r.uid=$1 and "+
+			"(r.data IS DISTINCT FROM $3 OR r.hash IS DISTINCT FROM $4 OR r.deleted_at IS NOT NULL)").
+			WithArgs(pgxmock.AnyArg(), "test-cluster", pgxmock.AnyArg(), pgxmock.AnyArg())
+		if err != nil && i == 0 {
+			exec.WillReturnError(err)
+		} else {
+			exec.WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}
+	}
+}
+
+// Expects the batch resetting the resources from mocks/clearAll.json, and deleting the resource from
+// testutils.MockDatabaseState(). The first statement returns the error when not nil.
+func expectResyncResourcesBatch(mockPool pgxmock.PgxPoolIface, err error) {
+	batch := mockPool.ExpectBatch()
+	for i := 0; i < 2; i++ {
+		exec := batch.ExpectExec(`INSERT INTO "resources" ("cluster", "data", "hash", "uid") `+
+			`VALUES ($1, $2, $3, $4) ON CONFLICT (uid) DO UPDATE SET "data"=EXCLUDED.data,"deleted_at"=NULL,`+
+			`"hash"=EXCLUDED.hash WHERE ("resources"."deleted_at" IS NOT NULL)`).
+			WithArgs("test-cluster", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg())
+		if err != nil && i == 0 {
+			exec.WillReturnError(err)
+		} else {
+			exec.WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}
+	}
+	batch.ExpectExec(`DELETE FROM "resources" WHERE ("uid" IN ($1))`).WithArgs("uid-123").
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	batch.ExpectExec(`DELETE FROM "edges" WHERE (("sourceid" IN ($1)) OR ("destid" IN ($2)))`).
+		WithArgs("uid-123", "uid-123").WillReturnResult(pgxmock.NewResult("DELETE", 1))
+}
+
+// Expects the batch deleting the edge from testutils.MockDatabaseState(). Returns the error when not nil.
+func expectResyncEdgesBatch(mockPool pgxmock.PgxPoolIface, err error) {
+	exec := mockPool.ExpectBatch().
+		ExpectExec(`DELETE FROM "edges" WHERE (("sourceid" = $1) AND ("destid" = $2) AND ("edgetype" = $3))`).
+		WithArgs("sourceId1", "destId1", "edgeType1")
+	if err != nil {
+		exec.WillReturnError(err)
+	} else {
+		exec.WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	}
+}
@@ -2,21 +2,41 @@
 package testutils
 
 import (
-	"github.com/driftprogramming/pgxpoolmock"
-	"github.com/golang/mock/gomock"
+	"github.com/pashagolub/pgxmock/v4"
 )
 
 // Mocks the existing state of the database for the test-cluster.
-func MockDatabaseState(mockPool *pgxpoolmock.MockPgxPool) {
-	columns := []string{"uid", "data"}
-	resourceRows := pgxpoolmock.NewRows(columns).AddRow("uid-123", `{"kind: "mock"}`).ToPgxRows()
-	edgeColumns := []string{"sourceId", "edgeType", "destId"}
-	edgeRows := pgxpoolmock.NewRows(edgeColumns).AddRow("sourceId1", "edgeType1", "destId1").ToPgxRows()
+func MockDatabaseState(mockPool pgxmock.PgxPoolIface) {
+	MockExistingResources(mockPool)
+	MockExistingEdges(mockPool)
+}
+
+// Mocks the existing resources of the test-cluster.
+func MockExistingResources(mockPool pgxmock.PgxPoolIface) {
+	hash := int64(123)
+	resourceRows := pgxmock.NewRows([]string{"uid", "data", "hash"}).AddRow("uid-123", `{"kind: "mock"}`, &hash)
+	mockPool.ExpectQuery(
+		`SELECT "uid", "data", "hash" FROM "resources" WHERE (("cluster" = $1) AND ("deleted_at" IS NULL))`).
+		WithArgs("test-cluster").WillReturnRows(resourceRows)
+}
+
+// Mocks the existing edges of the test-cluster.
+func MockExistingEdges(mockPool pgxmock.PgxPoolIface) {
+	edgeColumns := []string{"sourceId", "edgeType", "destId", "properties"}
+	edgeRows := pgxmock.NewRows(edgeColumns).AddRow("sourceId1", "edgeType1", "destId1", nil)
+	mockPool.ExpectQuery(
+		`SELECT "sourceid", "edgetype", "destid", "properties" FROM "edges" `+
+			`WHERE (("edgetype" != $1) AND ("cluster" = $2) AND ("deleted_at" IS NULL))`).
+		WithArgs("interCluster", "test-cluster").WillReturnRows(edgeRows)
+}
 
-	mockPool.EXPECT().Query(gomock.Any(), gomock.Eq(
-		`SELECT "uid", "data" FROM "search"."resources" WHERE (("cluster" = $1) AND ("uid" != $2))`),
-		[]interface{}{"test-cluster", "cluster__test-cluster"}).Return(resourceRows, nil)
-	mockPool.EXPECT().Query(gomock.Any(), gomock.Eq(
-		`SELECT "sourceid", "edgetype", "destid" FROM "search"."edges" WHERE (("edgetype" != $1) AND ("cluster" = $2))`),
-		[]interface{}{"interCluster", "test-cluster"}).Return(edgeRows, nil)
+// Mocks the batch counting the resources and edges of the cluster. See DAO.ClusterTotals()
+func MockClusterTotals(mockPool pgxmock.PgxPoolIface, clusterName string, resources, edges int) {
+	batch := mockPool.ExpectBatch()
+	batch.ExpectQuery(
+		`SELECT COUNT(*) FROM "resources" WHERE (("cluster" = $1) AND ("deleted_at" IS NULL))`).
+		WithArgs(clusterName).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(resources))
+	batch.ExpectQuery(`SELECT COUNT(*) FROM "edges" `+
+		`WHERE (("cluster" = $1) AND ("edgetype" != $2) AND ("deleted_at" IS NULL))`).
+		WithArgs(clusterName, "interCluster").WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(edges))
 }
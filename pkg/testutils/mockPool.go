@@ -0,0 +1,24 @@
+// Copyright Contributors to the Open Cluster Management project
+package testutils
+
+import (
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+// Creates a mock database pool that matches the exact SQL, in any order. The test fails if an expected
+// statement isn't sent.
+func NewMockPool(t *testing.T) pgxmock.PgxPoolIface {
+	mockPool, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockPool.MatchExpectationsInOrder(false)
+	t.Cleanup(func() {
+		if err := mockPool.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return mockPool
+}
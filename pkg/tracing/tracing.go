@@ -0,0 +1,93 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+// OpenTelemetry tracing.
+// With OTEL_EXPORTER_OTLP_ENDPOINT, the indexer records spans for the sync requests, the DAO operations, the batches,
+// and the database queries, and exports them to the OTLP/HTTP endpoint of a trace collector, for example
+// http://otel-collector:4318. This shows where a slow sync spends its time.
+//   - A sync request with the W3C traceparent header continues the trace of the collector, and keeps its sampling
+//     decision. See Middleware(). The requests without a traceparent start a new trace, sampled at
+//     TRACING_SAMPLE_PCT percent.
+//   - The database queries are recorded by otelpgx. See database/connection.go
+// Until Run() sets up the SDK, the global tracer provider of OpenTelemetry doesn't record the spans, so the code
+// doesn't check if tracing is enabled.
+
+const (
+	tracerName      = "github.com/stolostron/search-indexer"
+	shutdownTimeout = 10 * time.Second
+)
+
+// Starts a span as a child of the span in the context. Use End() when the operation completes.
+func Start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name)
+}
+
+// Marks the span as failed. A nil error is ignored.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Middleware starting the span of the incoming requests, continuing the trace of the traceparent header.
+// Get the span with trace.SpanFromContext(r.Context()).
+func Middleware(operation string) func(http.Handler) http.Handler {
+	return otelhttp.NewMiddleware(operation)
+}
+
+// Enables tracing and exports the spans until the context is cancelled. Does nothing if
+// OTEL_EXPORTER_OTLP_ENDPOINT isn't set.
+func Run(ctx context.Context) {
+	if config.Cfg.TracingEndpoint == "" {
+		return
+	}
+	url := strings.TrimSuffix(config.Cfg.TracingEndpoint, "/") + "/v1/traces"
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(url))
+	if err != nil {
+		klog.Errorf("Error creating the trace exporter for %s. Tracing is disabled. Error: %+v", url, err)
+		return
+	}
+	samplePct := config.Cfg.TracingSamplePct
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(samplePct)/100))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "search-indexer"),
+			attribute.String("service.version", config.COMPONENT_VERSION),
+			attribute.String("service.instance.id", config.Cfg.PodName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	klog.Infof("Exporting the traces to %s. Sampling %d%% of the new traces.", url, samplePct)
+
+	<-ctx.Done()
+	// Exports the queued spans before exiting.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := provider.Shutdown(shutdownCtx); err != nil {
+		klog.Warningf("Error exporting the traces on shutdown. Error: %+v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-indexer/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Should not record the spans when tracing is disabled.
+func Test_Start_disabled(t *testing.T) {
+	_, span := Start(context.Background(), "test")
+
+	assert.False(t, span.IsRecording())
+	span.SetAttributes(attribute.String("key", "value"))
+	SetError(span, errors.New("error"))
+	span.End()
+}
+
+// Should export the spans, continuing the trace of the request.
+func Test_Run(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer collector.Close()
+	config.Cfg.TracingEndpoint = collector.URL
+	defer func() { config.Cfg.TracingEndpoint = "" }()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		_, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+		return ok
+	}, time.Second, time.Millisecond)
+
+	handler := Middleware("SyncResources")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, trace.SpanFromContext(r.Context()).IsRecording())
+		_, span := Start(r.Context(), "DAO.SyncData")
+		span.SetAttributes(attribute.Int("resources", 5))
+		SetError(span, errors.New("database error"))
+		span.End()
+	}))
+	req := httptest.NewRequest("POST", "https://localhost:3010/aggregator/clusters/cluster-a/sync", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	cancel()
+	<-done
+
+	var exported coltracepb.ExportTraceServiceRequest
+	assert.Nil(t, proto.Unmarshal(<-bodies, &exported))
+	spans := exported.ResourceSpans[0].ScopeSpans
+	var syncData, request *tracepb.Span
+	for _, scope := range spans {
+		for _, span := range scope.Spans {
+			switch span.Name {
+			case "DAO.SyncData":
+				syncData = span
+			case "SyncResources":
+				request = span
+			}
+		}
+	}
+	if !assert.NotNil(t, syncData) || !assert.NotNil(t, request) {
+		return
+	}
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", hex.EncodeToString(syncData.TraceId))
+	assert.Equal(t, request.SpanId, syncData.ParentSpanId)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, syncData.Status.Code)
+	assert.Equal(t, "database error", syncData.Status.Message)
+	assert.Equal(t, "resources", syncData.Attributes[0].Key)
+	assert.Equal(t, int64(5), syncData.Attributes[0].Value.GetIntValue())
+	assert.Equal(t, "b7ad6b7169203331", hex.EncodeToString(request.ParentSpanId))
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, request.Kind)
+}